@@ -0,0 +1,72 @@
+// Command backfill-media copies videos and thumbnails of completed projects
+// that still point at provider hosted URLs into our storage, and rewrites
+// the rows to our own URLs. It is safe to re-run; projects already in
+// storage are skipped.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	_ "github.com/lib/pq"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/service"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/genvid/backend/internal/zhipu"
+	"github.com/genvid/backend/pkg/auth"
+	"github.com/jmoiron/sqlx"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 50, "projects to load per query")
+	dryRun := flag.Bool("dry-run", false, "only report projects that would be mirrored")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := sqlx.Connect("postgres", cfg.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	jwtService, err := auth.NewJWTService(cfg.JWT, repository.NewJWTKeyRepository(db))
+	if err != nil {
+		log.Fatalf("Failed to configure JWT: %v", err)
+	}
+
+	profileRepo := repository.NewProfileRepository(db)
+	authService := service.NewAuthService(profileRepo, repository.NewSessionRepository(db), repository.NewMFARepository(db), jwtService, nil, cfg)
+	projectService := service.NewProjectService(
+		repository.NewProjectRepository(db),
+		profileRepo,
+		repository.NewRenderRepository(db),
+		repository.NewStoryboardRepository(db),
+		repository.NewPromptRepository(db),
+		repository.NewAvatarRepository(db),
+		repository.NewAssetRepository(db),
+		store,
+		authService,
+		zhipu.NewClient(cfg.External.Zhipu.APIKey),
+		cfg,
+	)
+
+	report, err := projectService.BackfillMedia(context.Background(), *batchSize, *dryRun)
+	if err != nil {
+		log.Fatalf("Backfill aborted: %v", err)
+	}
+
+	log.Printf("Scanned %d projects: %d mirrored, %d already stored, %d failed",
+		report.Scanned, report.Mirrored, report.Skipped, report.Failed)
+}
@@ -0,0 +1,42 @@
+// Command fake-oidc is a local OpenID Connect provider for trying Google
+// sign-in without Google. It approves every authorization request at once
+// as the configured user, and checks PKCE, redirect URI and client ID like
+// a real provider. Run it and point the API at it:
+//
+//	go run ./cmd/fake-oidc -email you@example.com
+//	GOOGLE_ISSUER_URL=http://localhost:9999
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/genvid/backend/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9999", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL (default http://<addr>)")
+	email := flag.String("email", "user@example.com", "email of the signed-in user; login_hint overrides it")
+	name := flag.String("name", "Test User", "name of the signed-in user")
+	subject := flag.String("sub", "", "subject of the signed-in user (default derived from the email)")
+	verified := flag.Bool("email-verified", true, "report the email as verified")
+	flag.Parse()
+
+	p, err := oidctest.New()
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+	p.Issuer = *issuer
+	p.Subject = *subject
+	p.Email = *email
+	p.Name = *name
+	p.EmailVerified = *verified
+	if p.Issuer == "" {
+		p.Issuer = "http://" + *addr
+	}
+
+	log.Printf("Fake OIDC provider at %s signing in %s", p.Issuer, p.Email)
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
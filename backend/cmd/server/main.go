@@ -12,11 +12,16 @@ import (
 
 	_ "github.com/lib/pq"
 
+	"github.com/genvid/backend/internal/captcha"
 	"github.com/genvid/backend/internal/config"
 	"github.com/genvid/backend/internal/handler"
+	"github.com/genvid/backend/internal/mailer"
 	"github.com/genvid/backend/internal/middleware"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/ratelimit"
 	"github.com/genvid/backend/internal/repository"
 	"github.com/genvid/backend/internal/service"
+	"github.com/genvid/backend/internal/storage"
 	"github.com/genvid/backend/internal/zhipu"
 	"github.com/genvid/backend/pkg/auth"
 	"github.com/go-chi/chi/v5"
@@ -44,21 +49,89 @@ func main() {
 	}
 	log.Println("Connected to database")
 
-	jwtService := auth.NewJWTService(cfg.JWT)
+	jwtService, err := auth.NewJWTService(cfg.JWT, repository.NewJWTKeyRepository(db))
+	if err != nil {
+		log.Fatalf("Failed to configure JWT: %v", err)
+	}
+	if err := jwtService.RotateKeys(context.Background()); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
 
 	zhipuClient := zhipu.NewClient(cfg.External.Zhipu.APIKey)
 
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	if cfg.IsProduction() && cfg.Mail.Driver != "resend" {
+		log.Printf("Warning: MAIL_DRIVER=%s does not send email; verification and reset links are written to %s", cfg.Mail.Driver, cfg.Mail.Dir)
+	}
+
+	limits, err := ratelimit.New(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limit store: %v", err)
+	}
+	if cfg.IsProduction() && cfg.RateLimit.Store != "redis" {
+		log.Printf("Warning: RATE_LIMIT_STORE=%s keeps sign-in and API key limits per instance and loses them on restart", cfg.RateLimit.Store)
+	}
+
+	verifier, err := captcha.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize CAPTCHA: %v", err)
+	}
+
 	profileRepo := repository.NewProfileRepository(db)
 	projectRepo := repository.NewProjectRepository(db)
+	renderRepo := repository.NewRenderRepository(db)
+	storyboardRepo := repository.NewStoryboardRepository(db)
+	promptRepo := repository.NewPromptRepository(db)
+	avatarRepo := repository.NewAvatarRepository(db)
+	assetRepo := repository.NewAssetRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
+	accountTokenRepo := repository.NewAccountTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	usageLogRepo := repository.NewUsageLogRepository(db)
+	adminRepo := repository.NewAdminRepository(db)
 
-	authService := service.NewAuthService(profileRepo, jwtService, cfg)
-	projectService := service.NewProjectService(projectRepo, profileRepo, authService, zhipuClient, cfg)
+	accountService := service.NewAccountService(profileRepo, accountTokenRepo, sessionRepo, mail, cfg)
+	loginGuard := service.NewLoginGuard(limits, verifier, profileRepo, usageLogRepo, accountService, cfg)
+	authService := service.NewAuthService(profileRepo, sessionRepo, mfaRepo, jwtService, loginGuard, cfg)
+	mfaService, err := service.NewMFAService(mfaRepo, profileRepo, authService, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize MFA: %v", err)
+	}
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, limits, cfg)
+	oauthService := service.NewOAuthService(authService, profileRepo, identityRepo, cfg)
+	projectService := service.NewProjectService(projectRepo, profileRepo, renderRepo, storyboardRepo, promptRepo, avatarRepo, assetRepo, store, authService, zhipuClient, cfg)
+	storageService := service.NewStorageService(profileRepo, projectRepo, renderRepo, assetRepo, uploadRepo, store)
+	assetService := service.NewAssetService(assetRepo, projectRepo, projectService, storageService, store, cfg)
+	productPageService := service.NewProductPageService(assetService)
+	uploadService := service.NewUploadService(uploadRepo, assetService, store)
+	adminService := service.NewAdminService(adminRepo, profileRepo, projectRepo, sessionRepo, mfaRepo, usageLogRepo, projectService, storageService)
 
-	authHandler := handler.NewAuthHandler(authService)
-	projectHandler := handler.NewProjectHandler(projectService)
+	authHandler := handler.NewAuthHandler(authService, accountService)
+	accountHandler := handler.NewAccountHandler(accountService)
+	oauthHandler := handler.NewOAuthHandler(oauthService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	mfaHandler := handler.NewMFAHandler(mfaService)
+	projectHandler := handler.NewProjectHandler(projectService, productPageService)
+	timelineHandler := handler.NewTimelineHandler(projectService)
+	storyboardHandler := handler.NewStoryboardHandler(projectService)
 	avatarHandler := handler.NewAvatarHandler()
 	paymentHandler := handler.NewPaymentHandler(cfg)
-	uploadHandler := handler.NewUploadHandler("./uploads", cfg.Server.AppURL)
+	assetHandler := handler.NewAssetHandler(assetService)
+	uploadHandler := handler.NewUploadHandler(assetService)
+	storageHandler := handler.NewStorageHandler(storageService)
+	resumableUploadHandler := handler.NewResumableUploadHandler(uploadService, assetService)
+	adminHandler := handler.NewAdminHandler(adminService)
 
 	r := chi.NewRouter()
 
@@ -69,6 +142,7 @@ func main() {
 
 	r.Use(middleware.LoggingMiddleware)
 	r.Use(middleware.RecoveryMiddleware)
+	r.Use(middleware.ClientIP(cfg.Server.TrustProxy))
 	r.Use(middleware.CORSMiddleware(allowedOrigins))
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -76,34 +150,128 @@ func main() {
 		w.Write([]byte(`{"status":"healthy"}`))
 	})
 
-	r.Handle("/uploads/*", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
-	r.Handle("/temp_videos/*", http.StripPrefix("/temp_videos/", http.FileServer(http.Dir("./temp_videos"))))
+	r.Get("/.well-known/jwks.json", authHandler.JWKS)
+
+	// Local objects are only readable through signed URLs; S3 serves its own
+	// presigned URLs.
+	if local, ok := store.(*storage.Local); ok {
+		r.Handle(storage.LocalPathPrefix+"*", local)
+	}
 
 	r.Route("/api", func(r chi.Router) {
 		r.Post("/auth/register", authHandler.Register)
 		r.Post("/auth/login", authHandler.Login)
 		r.Post("/auth/refresh", authHandler.RefreshToken)
+		r.Post("/auth/logout", authHandler.Logout)
+		r.Post("/auth/mfa/verify", mfaHandler.Verify)
+		r.Post("/auth/password/forgot", accountHandler.ForgotPassword)
+		r.Post("/auth/password/reset", accountHandler.ResetPassword)
+		r.Post("/auth/verify-email", accountHandler.VerifyEmail)
+		r.Get("/auth/google/start", oauthHandler.GoogleStart)
+		r.Get("/auth/google/callback", oauthHandler.GoogleCallback)
 		r.Post("/payments/webhook", paymentHandler.HandleWebhook)
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AuthMiddleware(jwtService))
+			r.Use(middleware.AuthMiddleware(jwtService, authService, apiKeyService))
+
+			// API keys reach the routes their scopes allow; account and key
+			// management need a signed-in session.
+			read := middleware.RequireScope(model.APIKeyScopeRead)
+			write := middleware.RequireScope(model.APIKeyScopeWrite)
+			generate := middleware.RequireScope(model.APIKeyScopeGenerate)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireSession)
 
-			r.Get("/user/profile", authHandler.GetProfile)
-			r.Patch("/user/profile", authHandler.UpdateProfile)
+				r.Patch("/user/profile", authHandler.UpdateProfile)
+				r.Put("/user/password", authHandler.ChangePassword)
+				r.Post("/auth/logout-all", authHandler.LogoutAll)
+				r.Get("/user/sessions", authHandler.ListSessions)
+				r.Delete("/user/sessions/{id}", authHandler.RevokeSession)
+				r.Post("/user/verify-email", accountHandler.ResendVerification)
 
-			r.Get("/projects", projectHandler.List)
-			r.Post("/projects", projectHandler.Create)
-			r.Get("/projects/{id}", projectHandler.GetByID)
-			r.Delete("/projects/{id}", projectHandler.Delete)
-			r.Post("/projects/{id}/generate", projectHandler.GenerateVideo)
+				r.Get("/user/api-keys", apiKeyHandler.List)
+				r.Post("/user/api-keys", apiKeyHandler.Create)
+				r.Delete("/user/api-keys/{id}", apiKeyHandler.Revoke)
 
-			r.Get("/avatars", avatarHandler.List)
-			r.Get("/avatars/{id}", avatarHandler.GetByID)
+				r.Get("/user/mfa", mfaHandler.Status)
+				r.Post("/user/mfa/totp", mfaHandler.StartTOTP)
+				r.Post("/user/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+				r.Post("/user/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+				r.Post("/user/mfa/disable", mfaHandler.Disable)
 
-			r.Post("/upload", uploadHandler.Upload)
-			r.Delete("/upload", uploadHandler.Delete)
+				r.Post("/payments/checkout", paymentHandler.CreateCheckoutSession)
+			})
 
-			r.Post("/payments/checkout", paymentHandler.CreateCheckoutSession)
+			// Staff routes. Support can look up accounts, adjust credits and
+			// recover stuck projects; account changes need an admin.
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(middleware.RequireSession)
+				r.Use(middleware.RequireRole(model.RoleSupport, model.RoleAdmin))
+
+				r.Get("/users", adminHandler.SearchUsers)
+				r.Get("/users/{id}", adminHandler.GetUser)
+				r.Get("/users/{id}/projects", adminHandler.ListUserProjects)
+				r.Get("/users/{id}/usage", adminHandler.ListUserUsage)
+				r.Post("/users/{id}/credits", adminHandler.AdjustCredits)
+
+				r.Get("/projects/stuck", adminHandler.ListStuckProjects)
+				r.Post("/projects/{id}/requeue", adminHandler.RequeueProject)
+				r.Post("/projects/{id}/fail", adminHandler.FailProject)
+
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireRole(model.RoleAdmin))
+
+					r.Put("/users/{id}/tier", adminHandler.ChangeTier)
+					r.Put("/users/{id}/role", adminHandler.ChangeRole)
+					r.Post("/users/{id}/disable", adminHandler.DisableUser)
+					r.Post("/users/{id}/enable", adminHandler.EnableUser)
+					r.Get("/audit-log", adminHandler.ListAudit)
+				})
+			})
+
+			r.With(read).Get("/user/profile", authHandler.GetProfile)
+			r.With(read).Get("/user/storage", storageHandler.Usage)
+
+			r.With(read).Get("/projects", projectHandler.List)
+			r.With(write).Post("/projects", projectHandler.Create)
+			r.With(write).Post("/projects/parse-url", projectHandler.ParseURL)
+			r.With(read).Get("/projects/{id}", projectHandler.GetByID)
+			r.With(write).Delete("/projects/{id}", projectHandler.Delete)
+			r.With(generate).Post("/projects/{id}/generate", projectHandler.GenerateVideo)
+			r.With(generate).Post("/projects/{id}/extend", projectHandler.ExtendVideo)
+			r.With(read).Get("/projects/{id}/renders", projectHandler.ListRenders)
+			r.With(read).Get("/projects/{id}/download", projectHandler.Download)
+			r.With(read).Get("/projects/{id}/storyboard", storyboardHandler.Get)
+			r.With(write).Post("/projects/{id}/storyboard", storyboardHandler.Build)
+			r.With(write).Patch("/projects/{id}/storyboard/scenes/{sceneID}", storyboardHandler.UpdateScene)
+
+			r.With(read).Get("/renders/{id}/timeline", timelineHandler.Get)
+			r.With(write).Post("/renders/{id}/timeline/clips", timelineHandler.InsertClip)
+			r.With(write).Patch("/renders/{id}/timeline/clips/{clipID}", timelineHandler.TrimClip)
+			r.With(write).Delete("/renders/{id}/timeline/clips/{clipID}", timelineHandler.DropClip)
+			r.With(write).Put("/renders/{id}/timeline/order", timelineHandler.ReorderClips)
+			r.With(write).Post("/renders/{id}/rerender", timelineHandler.Rerender)
+
+			r.With(read).Get("/avatars", avatarHandler.List)
+			r.With(read).Get("/avatars/{id}", avatarHandler.GetByID)
+			r.With(read).Get("/style-presets", storyboardHandler.ListStylePresets)
+
+			r.With(read).Get("/assets", assetHandler.List)
+			r.With(write).Post("/assets", assetHandler.Upload)
+			r.With(read).Get("/assets/{id}", assetHandler.Get)
+			r.With(write).Patch("/assets/{id}", assetHandler.Update)
+			r.With(write).Delete("/assets/{id}", assetHandler.Delete)
+
+			r.With(write).Post("/upload", uploadHandler.Upload)
+			r.With(write).Post("/upload/from-url", uploadHandler.FromURL)
+			r.With(write).Delete("/upload", uploadHandler.Delete)
+
+			r.With(write).Post("/uploads", resumableUploadHandler.Create)
+			r.With(write).Head("/uploads/{id}", resumableUploadHandler.Head)
+			r.With(write).Patch("/uploads/{id}", resumableUploadHandler.Patch)
+			r.With(write).Get("/uploads/{id}", resumableUploadHandler.Get)
+			r.With(write).Delete("/uploads/{id}", resumableUploadHandler.Delete)
 		})
 	})
 
@@ -116,6 +284,51 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Expired videos, orphaned assets and abandoned uploads are removed
+	// from storage in the background.
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := storageService.Sweep(context.Background(), 100, false)
+			if err != nil {
+				log.Printf("Storage sweep failed: %v", err)
+				continue
+			}
+			if report.ObjectsDeleted > 0 || report.Failed > 0 {
+				log.Printf("Storage sweep: %d projects expired, %d assets, %d stored files and %d uploads removed, %d objects (%d bytes) reclaimed, %d failed",
+					report.ProjectsExpired, report.AssetsDeleted, report.BlobsDeleted, report.UploadsExpired, report.ObjectsDeleted, report.BytesReclaimed, report.Failed)
+			}
+		}
+	}()
+
+	// Each instance checks hourly that the current signing key is not about
+	// to retire without a published successor.
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := jwtService.RotateKeys(context.Background()); err != nil {
+				log.Printf("JWT key rotation failed: %v", err)
+			}
+		}
+	}()
+
+	// Sessions that ended a month ago are no longer useful for anything,
+	// nor are expired sign-in challenges.
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := authService.PruneSessions(context.Background()); err != nil {
+				log.Printf("Session cleanup failed: %v", err)
+			}
+			if _, err := mfaService.PruneChallenges(context.Background()); err != nil {
+				log.Printf("MFA challenge cleanup failed: %v", err)
+			}
+		}
+	}()
+
 	go func() {
 		log.Printf("Server starting on %s", addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -0,0 +1,61 @@
+// Command sweep-storage runs one storage sweep: it removes the media of
+// projects past their retention, orphaned assets, unused stored files and
+// abandoned uploads, and reports the bytes reclaimed. The API server runs the same sweep hourly.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	_ "github.com/lib/pq"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/service"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 500, "projects, assets and uploads to remove per kind")
+	dryRun := flag.Bool("dry-run", false, "only report what would be removed")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := sqlx.Connect("postgres", cfg.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	storageService := service.NewStorageService(
+		repository.NewProfileRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewRenderRepository(db),
+		repository.NewAssetRepository(db),
+		repository.NewUploadRepository(db),
+		store,
+	)
+
+	report, err := storageService.Sweep(context.Background(), *batchSize, *dryRun)
+	if err != nil {
+		log.Fatalf("Sweep aborted: %v", err)
+	}
+
+	verb := "removed"
+	if report.DryRun {
+		verb = "would remove"
+	}
+	log.Printf("Sweep %s %d objects (%d bytes): %d expired projects, %d orphaned assets, %d unused stored files, %d abandoned uploads; %d failed",
+		verb, report.ObjectsDeleted, report.BytesReclaimed, report.ProjectsExpired, report.AssetsDeleted, report.BlobsDeleted, report.UploadsExpired, report.Failed)
+}
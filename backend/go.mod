@@ -12,6 +12,8 @@ require (
 	github.com/redis/go-redis/v9 v9.7.0
 	github.com/stripe/stripe-go/v80 v80.2.0
 	golang.org/x/crypto v0.25.0
+	golang.org/x/image v0.18.0
+	golang.org/x/net v0.21.0
 	golang.org/x/oauth2 v0.22.0
 )
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -16,9 +17,15 @@ type Config struct {
 	Redis     RedisConfig
 	JWT       JWTConfig
 	OAuth     OAuthConfig
+	MFA       MFAConfig
 	External  ExternalConfig
 	AWS       AWSConfig
+	Storage   StorageConfig
+	Media     MediaConfig
+	Mail      MailConfig
 	RateLimit RateLimitConfig
+	Login     LoginConfig
+	Captcha   CaptchaConfig
 }
 
 // ServerConfig holds server configuration
@@ -26,6 +33,9 @@ type ServerConfig struct {
 	Port   string
 	Env    string
 	AppURL string
+	// TrustProxy takes client addresses from X-Forwarded-For; enable only
+	// behind a reverse proxy that sets it.
+	TrustProxy bool
 }
 
 // DatabaseConfig holds database configuration
@@ -50,11 +60,26 @@ type JWTConfig struct {
 	Secret        string
 	Expiry        time.Duration
 	RefreshExpiry time.Duration
+	// Algorithm is RS256, EdDSA or HS256. HS256 signs with Secret and is
+	// meant for development; the others use rotating keys published as JWKS.
+	Algorithm   string
+	KeyRotation time.Duration // how long each asymmetric key signs
+	// KeySecret encrypts stored private keys.
+	KeySecret string
 }
 
 // OAuthConfig holds OAuth provider configuration
 type OAuthConfig struct {
 	Google GoogleOAuthConfig
+	// StateSecret signs the state cookie of a sign-in in progress.
+	StateSecret string
+}
+
+// MFAConfig holds two-factor authentication configuration
+type MFAConfig struct {
+	Issuer string // name shown in authenticator apps
+	// KeySecret encrypts stored TOTP secrets.
+	KeySecret string
 }
 
 // GoogleOAuthConfig holds Google OAuth configuration
@@ -62,6 +87,7 @@ type GoogleOAuthConfig struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
+	IssuerURL    string // OpenID issuer; point at a local provider to test
 }
 
 // ExternalConfig holds external service configuration
@@ -102,12 +128,61 @@ type AWSConfig struct {
 	S3Bucket        string
 }
 
+// StorageConfig holds media storage configuration
+type StorageConfig struct {
+	Driver      string // "local" or "s3"
+	LocalDir    string
+	PublicURL   string // base URL the API serves local objects from
+	S3Endpoint  string // empty for AWS; set for MinIO or R2
+	S3PathStyle bool
+	S3PublicURL string // optional CDN in front of the bucket
+	// SigningSecret signs local media URLs.
+	SigningSecret string
+	URLExpiry     time.Duration // lifetime of signed and presigned media URLs
+}
+
+// MediaConfig holds local media rendering configuration
+type MediaConfig struct {
+	MusicDir string // background tracks offered to slideshows
+	FontFile string // caption font; empty uses the fontconfig default
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	Driver string // "file" (default) or "resend"
+	From   string
+	Dir    string // where the file driver writes .eml files
+}
+
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
 	Requests int
 	Window   time.Duration
+	Store    string // "memory" (default) or "redis"
+}
+
+// LoginConfig holds sign-in and sign-up throttling configuration
+type LoginConfig struct {
+	FailureWindow  time.Duration // how long failed sign-ins are counted
+	CaptchaAfter   int           // failures per email or IP before a CAPTCHA is required
+	MaxFailures    int           // failures per email before it is locked
+	MaxIPFailures  int           // failures per IP address before it is locked
+	Lockout        time.Duration // how long a locked email or IP address is refused
+	MaxSignups     int           // sign-ups per IP address per FailureWindow
+	CaptchaSignups int           // sign-ups per IP address before a CAPTCHA is required
 }
 
+// CaptchaConfig holds CAPTCHA verification configuration
+type CaptchaConfig struct {
+	Provider  string // "stub" (default), "turnstile", "hcaptcha" or "recaptcha"
+	SecretKey string
+	StubToken string // the only token the stub accepts
+}
+
+// DefaultJWTSecret is used in development for any secret that is unset. It
+// is public, so Load refuses it in production.
+const DefaultJWTSecret = "your-super-secret-jwt-key-change-in-production"
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	// Load .env file if exists
@@ -115,9 +190,10 @@ func Load() (*Config, error) {
 
 	config := &Config{
 		Server: ServerConfig{
-			Port:   getEnv("PORT", "8080"),
-			Env:    getEnv("ENV", "development"),
-			AppURL: getEnv("APP_URL", "http://localhost:3000"),
+			Port:       getEnv("PORT", "8080"),
+			Env:        getEnv("ENV", "development"),
+			AppURL:     getEnv("APP_URL", "http://localhost:3000"),
+			TrustProxy: getBoolEnv("TRUST_PROXY", false),
 		},
 		Database: DatabaseConfig{
 			URL:      getEnv("DATABASE_URL", ""),
@@ -133,15 +209,18 @@ func Load() (*Config, error) {
 			Port: getEnv("REDIS_PORT", "6379"),
 		},
 		JWT: JWTConfig{
-			Secret:        getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
+			Secret:        getEnv("JWT_SECRET", DefaultJWTSecret),
 			Expiry:        getDurationEnv("JWT_EXPIRY", 24*time.Hour),
 			RefreshExpiry: getDurationEnv("JWT_REFRESH_EXPIRY", 168*time.Hour),
+			Algorithm:     getEnv("JWT_ALGORITHM", "RS256"),
+			KeyRotation:   getDurationEnv("JWT_KEY_ROTATION", 30*24*time.Hour),
 		},
 		OAuth: OAuthConfig{
 			Google: GoogleOAuthConfig{
 				ClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 				ClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 				RedirectURL:  getEnv("GOOGLE_REDIRECT_URL", ""),
+				IssuerURL:    getEnv("GOOGLE_ISSUER_URL", "https://accounts.google.com"),
 			},
 		},
 		External: ExternalConfig{
@@ -166,15 +245,94 @@ func Load() (*Config, error) {
 			Region:          getEnv("AWS_REGION", "us-east-1"),
 			S3Bucket:        getEnv("S3_BUCKET", "genvid-videos"),
 		},
+		Storage: StorageConfig{
+			Driver:      getEnv("STORAGE_DRIVER", "local"),
+			LocalDir:    getEnv("STORAGE_LOCAL_DIR", "./storage"),
+			PublicURL:   getEnv("STORAGE_PUBLIC_URL", "http://localhost:8080"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3PathStyle: getBoolEnv("S3_FORCE_PATH_STYLE", false),
+			S3PublicURL: getEnv("S3_PUBLIC_URL", ""),
+			URLExpiry:   getDurationEnv("STORAGE_URL_EXPIRY", time.Hour),
+		},
+		Media: MediaConfig{
+			MusicDir: getEnv("MUSIC_LIBRARY_DIR", "./assets/music"),
+			FontFile: getEnv("CAPTION_FONT_FILE", ""),
+		},
+		MFA: MFAConfig{
+			Issuer: getEnv("MFA_ISSUER", "Genvid"),
+		},
+		Mail: MailConfig{
+			Driver: getEnv("MAIL_DRIVER", "file"),
+			From:   getEnv("MAIL_FROM", "Genvid <onboarding@resend.dev>"),
+			Dir:    getEnv("MAIL_DIR", "./mail"),
+		},
 		RateLimit: RateLimitConfig{
 			Requests: getIntEnv("RATE_LIMIT_REQUESTS", 100),
 			Window:   getDurationEnv("RATE_LIMIT_WINDOW", time.Hour),
+			Store:    getEnv("RATE_LIMIT_STORE", "memory"),
+		},
+		Login: LoginConfig{
+			FailureWindow:  getDurationEnv("LOGIN_FAILURE_WINDOW", time.Hour),
+			CaptchaAfter:   getIntEnv("LOGIN_CAPTCHA_AFTER", 3),
+			MaxFailures:    getIntEnv("LOGIN_MAX_FAILURES", 10),
+			MaxIPFailures:  getIntEnv("LOGIN_MAX_IP_FAILURES", 100),
+			Lockout:        getDurationEnv("LOGIN_LOCKOUT", 15*time.Minute),
+			MaxSignups:     getIntEnv("SIGNUP_MAX_PER_IP", 20),
+			CaptchaSignups: getIntEnv("SIGNUP_CAPTCHA_AFTER", 3),
+		},
+		Captcha: CaptchaConfig{
+			Provider:  getEnv("CAPTCHA_PROVIDER", "stub"),
+			SecretKey: getEnv("CAPTCHA_SECRET_KEY", ""),
+			StubToken: getEnv("CAPTCHA_STUB_TOKEN", "captcha-ok"),
 		},
 	}
 
+	config.JWT.KeySecret = getEnv("JWT_KEY_SECRET", DefaultJWTSecret)
+	config.Storage.SigningSecret = getEnv("STORAGE_SIGNING_SECRET", DefaultJWTSecret)
+	config.OAuth.StateSecret = getEnv("OAUTH_STATE_SECRET", DefaultJWTSecret)
+	config.MFA.KeySecret = getEnv("MFA_KEY_SECRET", DefaultJWTSecret)
+
+	if config.IsProduction() {
+		if err := config.checkSecrets(); err != nil {
+			return nil, err
+		}
+		// The stub passes anyone who sends its fixed token, which would
+		// leave sign-in throttling without a real CAPTCHA behind it.
+		if config.Captcha.Provider == "" || config.Captcha.Provider == "stub" {
+			return nil, fmt.Errorf("CAPTCHA_PROVIDER must be turnstile, hcaptcha or recaptcha in production")
+		}
+	}
+
 	return config, nil
 }
 
+// checkSecrets fails when a secret production relies on is unset or still
+// the public default. Each secret is separate so that leaking one, such as
+// the HS256 signing secret, does not expose the others.
+func (c *Config) checkSecrets() error {
+	secrets := []struct{ name, value string }{
+		{"STORAGE_SIGNING_SECRET", c.Storage.SigningSecret},
+		{"OAUTH_STATE_SECRET", c.OAuth.StateSecret},
+		{"MFA_KEY_SECRET", c.MFA.KeySecret},
+	}
+	if c.JWT.Algorithm == "HS256" {
+		secrets = append(secrets, struct{ name, value string }{"JWT_SECRET", c.JWT.Secret})
+	} else {
+		secrets = append(secrets, struct{ name, value string }{"JWT_KEY_SECRET", c.JWT.KeySecret})
+	}
+
+	var missing []string
+	for _, secret := range secrets {
+		if secret.value == "" || secret.value == DefaultJWTSecret {
+			missing = append(missing, secret.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s must be set in production", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // GetDSN returns the database connection string
 func (c *Config) GetDSN() string {
 	if c.Database.URL != "" {
@@ -218,6 +376,15 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
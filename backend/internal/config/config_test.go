@@ -0,0 +1,76 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadProductionChecks(t *testing.T) {
+	secrets := map[string]string{
+		"JWT_SECRET":             "jwt-secret",
+		"JWT_KEY_SECRET":         "jwt-key-secret",
+		"STORAGE_SIGNING_SECRET": "storage-secret",
+		"OAUTH_STATE_SECRET":     "oauth-secret",
+		"MFA_KEY_SECRET":         "mfa-secret",
+	}
+
+	tests := []struct {
+		name      string
+		env       string
+		algorithm string
+		unset     string
+		value     string // set instead of unsetting when non-empty
+		captcha   string // CAPTCHA_PROVIDER; "" sets turnstile and "-" leaves it unset
+		wantErr   string
+	}{
+		{name: "all set", env: "production", algorithm: "RS256"},
+		{name: "development uses defaults", env: "development", algorithm: "RS256", unset: "MFA_KEY_SECRET"},
+		{name: "missing storage secret", env: "production", algorithm: "RS256", unset: "STORAGE_SIGNING_SECRET", wantErr: "STORAGE_SIGNING_SECRET"},
+		{name: "missing state secret", env: "production", algorithm: "RS256", unset: "OAUTH_STATE_SECRET", wantErr: "OAUTH_STATE_SECRET"},
+		{name: "missing mfa secret", env: "production", algorithm: "RS256", unset: "MFA_KEY_SECRET", wantErr: "MFA_KEY_SECRET"},
+		{name: "default key secret", env: "production", algorithm: "EdDSA", unset: "JWT_KEY_SECRET", value: DefaultJWTSecret, wantErr: "JWT_KEY_SECRET"},
+		{name: "hs256 ignores key secret", env: "production", algorithm: "HS256", unset: "JWT_KEY_SECRET"},
+		{name: "hs256 needs jwt secret", env: "production", algorithm: "HS256", unset: "JWT_SECRET", wantErr: "JWT_SECRET"},
+		{name: "stub captcha", env: "production", algorithm: "RS256", captcha: "stub", wantErr: "CAPTCHA_PROVIDER"},
+		{name: "default captcha", env: "production", algorithm: "RS256", captcha: "-", wantErr: "CAPTCHA_PROVIDER"},
+		{name: "stub captcha in development", env: "development", algorithm: "RS256", captcha: "stub"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENV", tt.env)
+			t.Setenv("JWT_ALGORITHM", tt.algorithm)
+			switch tt.captcha {
+			case "":
+				t.Setenv("CAPTCHA_PROVIDER", "turnstile")
+			case "-":
+				t.Setenv("CAPTCHA_PROVIDER", "")
+			default:
+				t.Setenv("CAPTCHA_PROVIDER", tt.captcha)
+			}
+			for name, value := range secrets {
+				if name == tt.unset {
+					value = tt.value
+				}
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				if tt.unset != "" && tt.env == "development" && cfg.MFA.KeySecret != DefaultJWTSecret {
+					t.Errorf("MFA.KeySecret = %q, want the development default", cfg.MFA.KeySecret)
+				}
+				if cfg.Storage.SigningSecret == cfg.JWT.Secret {
+					t.Error("storage signing secret fell back to the JWT secret")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load() error = %v, want it to name %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/service"
+	"github.com/genvid/backend/pkg/auth"
+)
+
+type AccountHandler struct {
+	accountService *service.AccountService
+}
+
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+// ForgotPassword emails a reset link. The response is the same whether or
+// not the email has an account.
+func (h *AccountHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+	if req.Email == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Email is required", nil)
+		return
+	}
+
+	// Rate limiting only applies to existing accounts, so it is not
+	// reported either.
+	err := h.accountService.ForgotPassword(r.Context(), req.Email)
+	if err != nil && !errors.Is(err, service.ErrTooManyEmails) {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to send reset email", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, model.SuccessResponse(map[string]string{
+		"message": "If an account exists for this email, a reset link has been sent",
+	}))
+}
+
+// ResetPassword sets a new password with the token from a reset link.
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+	if req.Token == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Token is required", nil)
+		return
+	}
+
+	if err := h.accountService.ResetPassword(r.Context(), &req); err != nil {
+		respondAccountError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail confirms an email with the token from a verification link and
+// returns the updated profile.
+func (h *AccountHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req model.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+	if req.Token == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Token is required", nil)
+		return
+	}
+
+	profile, err := h.accountService.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		respondAccountError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(profile))
+}
+
+// ResendVerification emails the signed-in user a new verification link.
+func (h *AccountHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	if err := h.accountService.ResendVerification(r.Context(), userID); err != nil {
+		respondAccountError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, model.SuccessResponse(map[string]string{
+		"message": "Verification email sent",
+	}))
+}
+
+func respondAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAccountToken):
+		respondError(w, http.StatusBadRequest, "INVALID_TOKEN", "This link is invalid, expired or already used", nil)
+	case errors.Is(err, service.ErrEmailAlreadyVerified):
+		respondError(w, http.StatusConflict, "ALREADY_VERIFIED", "Email is already verified", nil)
+	case errors.Is(err, service.ErrTooManyEmails):
+		respondError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Too many emails sent to this address; try again later", nil)
+	case errors.Is(err, auth.ErrPasswordTooShort):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Password must be at least 8 characters", nil)
+	case errors.Is(err, auth.ErrPasswordTooLong):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Password must be at most 72 bytes", nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process request", nil)
+	}
+}
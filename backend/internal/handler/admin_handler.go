@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminHandler serves the staff API under /api/admin. Routes are guarded by
+// role in main; every change is audited by AdminService.
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+// SearchUsers finds accounts by ID, email or name, filtered by role, tier
+// and whether they are disabled.
+func (h *AdminHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	page, limit := pageParams(r)
+	query := r.URL.Query()
+	filter := model.AdminUserFilter{
+		Query: query.Get("q"),
+		Role:  query.Get("role"),
+		Tier:  query.Get("tier"),
+	}
+	if v := query.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "disabled must be true or false", nil)
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	users, total, err := h.adminService.SearchUsers(r.Context(), filter, page, limit, readAction(r))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponseWithMeta(users, pageMeta(page, limit, total)))
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.adminService.GetUser(r.Context(), chi.URLParam(r, "id"), readAction(r))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(user))
+}
+
+func (h *AdminHandler) ListUserProjects(w http.ResponseWriter, r *http.Request) {
+	page, limit := pageParams(r)
+	projects, total, err := h.adminService.ListProjects(r.Context(), chi.URLParam(r, "id"), page, limit, readAction(r))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponseWithMeta(projects, pageMeta(page, limit, total)))
+}
+
+func (h *AdminHandler) ListUserUsage(w http.ResponseWriter, r *http.Request) {
+	page, limit := pageParams(r)
+	entries, total, err := h.adminService.ListUsage(r.Context(), chi.URLParam(r, "id"), page, limit, readAction(r))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponseWithMeta(entries, pageMeta(page, limit, total)))
+}
+
+// AdjustCredits adds or removes credits; negative amounts remove them.
+func (h *AdminHandler) AdjustCredits(w http.ResponseWriter, r *http.Request) {
+	var req model.AdminCreditsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	profile, err := h.adminService.AdjustCredits(r.Context(), chi.URLParam(r, "id"), req.Amount, adminAction(r, req.Reason))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(profile))
+}
+
+func (h *AdminHandler) ChangeTier(w http.ResponseWriter, r *http.Request) {
+	var req model.AdminTierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	profile, err := h.adminService.ChangeTier(r.Context(), chi.URLParam(r, "id"), req.Tier, adminAction(r, req.Reason))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(profile))
+}
+
+// ChangeRole grants or removes staff access and signs the user out.
+func (h *AdminHandler) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	var req model.AdminRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	profile, err := h.adminService.ChangeRole(r.Context(), chi.URLParam(r, "id"), req.Role, adminAction(r, req.Reason))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(profile))
+}
+
+// DisableUser signs the account out everywhere and blocks sign-in and its
+// API keys until it is enabled again.
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *AdminHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	var req model.AdminReasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	profile, err := h.adminService.SetDisabled(r.Context(), chi.URLParam(r, "id"), disabled, adminAction(r, req.Reason))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(profile))
+}
+
+// ListStuckProjects returns projects queued or processing without progress
+// for too long.
+func (h *AdminHandler) ListStuckProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := h.adminService.ListStuckProjects(r.Context(), readAction(r))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(projects))
+}
+
+// RequeueProject starts a stuck project's render again without charging.
+func (h *AdminHandler) RequeueProject(w http.ResponseWriter, r *http.Request) {
+	var req model.AdminReasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	render, err := h.adminService.RequeueProject(r.Context(), chi.URLParam(r, "id"), adminAction(r, req.Reason))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, model.SuccessResponse(render))
+}
+
+// FailProject fails a stuck project and refunds its render.
+func (h *AdminHandler) FailProject(w http.ResponseWriter, r *http.Request) {
+	var req model.AdminReasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	project, err := h.adminService.FailProject(r.Context(), chi.URLParam(r, "id"), adminAction(r, req.Reason))
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(project))
+}
+
+// ListAudit returns admin actions, filtered by actor, target user and
+// action.
+func (h *AdminHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	page, limit := pageParams(r)
+	query := r.URL.Query()
+	filter := model.AdminAuditFilter{
+		ActorID:      query.Get("actor_id"),
+		TargetUserID: query.Get("user_id"),
+		Action:       query.Get("action"),
+	}
+
+	entries, total, err := h.adminService.ListAudit(r.Context(), filter, page, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list audit log", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponseWithMeta(entries, pageMeta(page, limit, total)))
+}
+
+func adminAction(r *http.Request, reason string) service.AdminAction {
+	return service.AdminAction{ActorID: getUserIDFromContext(r), Reason: reason, Client: clientInfo(r)}
+}
+
+// readAction is the audited actor of a read, with the optional reason
+// query parameter.
+func readAction(r *http.Request) service.AdminAction {
+	return adminAction(r, r.URL.Query().Get("reason"))
+}
+
+// pageParams reads page, from 1, and limit, 1-100 defaulting to 20.
+func pageParams(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+func pageMeta(page, limit, total int) *model.Meta {
+	return &model.Meta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: (total + limit - 1) / limit,
+	}
+}
+
+func respondAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "User or project not found", nil)
+	case errors.Is(err, service.ErrReasonRequired),
+		errors.Is(err, service.ErrInvalidCreditDelta):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidTier):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("%v; valid tiers are %v", err, model.SubscriptionTiers), nil)
+	case errors.Is(err, service.ErrInvalidRole):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+	case errors.Is(err, service.ErrInsufficientCredits):
+		respondError(w, http.StatusConflict, "INSUFFICIENT_CREDITS", "The balance cannot go below zero", nil)
+	case errors.Is(err, service.ErrSelfAdminAction):
+		respondError(w, http.StatusForbidden, "SELF_ACTION", err.Error(), nil)
+	case errors.Is(err, service.ErrProjectNotStuck):
+		respondError(w, http.StatusConflict, "PROJECT_NOT_STUCK", "Project is not queued or processing, or is still making progress", nil)
+	case errors.Is(err, service.ErrCannotRequeue):
+		respondError(w, http.StatusConflict, "CANNOT_REQUEUE", err.Error(), nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process admin request", nil)
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// List returns the user's keys without their secrets.
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	keys, err := h.apiKeyService.List(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list API keys", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(keys))
+}
+
+// Create makes a key and returns its plaintext once.
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	key, err := h.apiKeyService.Create(r.Context(), userID, &req)
+	if err != nil {
+		respondAPIKeyError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, model.SuccessResponse(key))
+}
+
+// Revoke deactivates a key; requests with it fail from then on.
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		respondAPIKeyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondAPIKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "API key not found", nil)
+	case errors.Is(err, service.ErrInvalidAPIKeyName),
+		errors.Is(err, service.ErrInvalidRateLimit),
+		errors.Is(err, service.ErrInvalidExpiry):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidScope):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("%v; valid scopes are %v", err, model.APIKeyScopes), nil)
+	case errors.Is(err, service.ErrTooManyAPIKeys):
+		respondError(w, http.StatusConflict, "TOO_MANY_KEYS", "Revoke an API key before creating another", nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process API key", nil)
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// multipartMemory is how much of a multipart body is kept in memory; the
+// rest spills to temporary files.
+const multipartMemory = 32 << 20
+
+// maxMultipartUpload caps a single-request upload. Larger files go through
+// /api/uploads.
+const maxMultipartUpload = 200 << 20
+
+type AssetHandler struct {
+	assetService *service.AssetService
+}
+
+func NewAssetHandler(assetService *service.AssetService) *AssetHandler {
+	return &AssetHandler{assetService: assetService}
+}
+
+func (h *AssetHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMultipartUpload+(1<<20))
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		respondError(w, http.StatusBadRequest, "FILE_TOO_LARGE", "File size exceeds 200MB limit; use /api/uploads for larger files", nil)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_FILE", "No file provided", nil)
+		return
+	}
+	defer file.Close()
+
+	req := model.UploadAssetRequest{
+		Purpose:   model.AssetPurpose(r.FormValue("purpose")),
+		IsPrimary: r.FormValue("is_primary") == "true",
+	}
+	if req.Purpose == "" {
+		req.Purpose = model.AssetPurposeProductImage
+	}
+	if projectID := r.FormValue("project_id"); projectID != "" {
+		req.ProjectID = &projectID
+	}
+	if altText := r.FormValue("alt_text"); altText != "" {
+		req.AltText = &altText
+	}
+
+	asset, err := h.assetService.Upload(r.Context(), userID, file, header.Filename, &req)
+	if err != nil {
+		respondAssetError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, model.SuccessResponse(h.assetService.SignAsset(r.Context(), asset)))
+}
+
+func (h *AssetHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := model.AssetListFilter{
+		Purpose:   model.AssetPurpose(r.URL.Query().Get("purpose")),
+		ProjectID: r.URL.Query().Get("project_id"),
+	}
+
+	assets, total, err := h.assetService.List(r.Context(), userID, filter, page, limit)
+	if err != nil {
+		respondAssetError(w, err)
+		return
+	}
+
+	meta := &model.Meta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: (total + limit - 1) / limit,
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponseWithMeta(h.assetService.SignAssets(r.Context(), assets), meta))
+}
+
+func (h *AssetHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	asset, err := h.assetService.Get(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		respondAssetError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.assetService.SignAsset(r.Context(), asset)))
+}
+
+func (h *AssetHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.UpdateAssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	asset, err := h.assetService.Update(r.Context(), chi.URLParam(r, "id"), userID, &req)
+	if err != nil {
+		respondAssetError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.assetService.SignAsset(r.Context(), asset)))
+}
+
+func (h *AssetHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	if err := h.assetService.Delete(r.Context(), chi.URLParam(r, "id"), userID); err != nil {
+		respondAssetError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondAssetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrAssetNotFound):
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "Asset not found", nil)
+	case errors.Is(err, service.ErrAssetTooLarge):
+		respondError(w, http.StatusBadRequest, "FILE_TOO_LARGE", err.Error(), nil)
+	case errors.Is(err, service.ErrUnsupportedMedia):
+		respondError(w, http.StatusBadRequest, "INVALID_TYPE", "File type is not allowed for this purpose", nil)
+	case errors.Is(err, service.ErrInvalidAsset):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+	case errors.Is(err, service.ErrQuotaExceeded):
+		respondError(w, http.StatusRequestEntityTooLarge, "QUOTA_EXCEEDED", "Storage quota exceeded", nil)
+	case errors.Is(err, service.ErrAssetInUse):
+		respondError(w, http.StatusConflict, "ASSET_IN_USE", err.Error(), nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process asset", nil)
+	}
+}
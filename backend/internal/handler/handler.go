@@ -2,21 +2,28 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/genvid/backend/internal/middleware"
 	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
 	"github.com/genvid/backend/internal/service"
+	"github.com/genvid/backend/pkg/auth"
 	"github.com/go-chi/chi/v5"
 )
 
 type AuthHandler struct {
-	authService *service.AuthService
+	authService    *service.AuthService
+	accountService *service.AccountService
 }
 
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *service.AuthService, accountService *service.AccountService) *AuthHandler {
+	return &AuthHandler{authService: authService, accountService: accountService}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -35,9 +42,16 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Password must be at least 8 characters", nil)
 		return
 	}
+	if len(req.Password) > 72 {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Password must be at most 72 bytes", nil)
+		return
+	}
 
-	resp, err := h.authService.Register(r.Context(), &req)
+	resp, err := h.authService.Register(r.Context(), &req, clientInfo(r))
 	if err != nil {
+		if respondLoginGuardError(w, err) {
+			return
+		}
 		if err == service.ErrEmailExists {
 			respondError(w, http.StatusConflict, "EMAIL_EXISTS", "Email already registered", nil)
 			return
@@ -46,6 +60,10 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Free credits arrive once the email is confirmed; a failed send can be
+	// retried from POST /api/user/verify-email.
+	_ = h.accountService.SendVerification(r.Context(), &resp.User)
+
 	respondJSON(w, http.StatusCreated, resp)
 }
 
@@ -61,8 +79,11 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.authService.Login(r.Context(), &req)
+	resp, err := h.authService.Login(r.Context(), &req, clientInfo(r))
 	if err != nil {
+		if respondMFARequired(w, err) || respondLoginGuardError(w, err) {
+			return
+		}
 		if err == service.ErrInvalidCredentials {
 			respondError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password", nil)
 			return
@@ -88,15 +109,111 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.authService.RefreshToken(r.Context(), req.RefreshToken)
+	resp, err := h.authService.RefreshToken(r.Context(), req.RefreshToken, clientInfo(r))
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired refresh token", nil)
+		switch {
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			respondError(w, http.StatusUnauthorized, "TOKEN_REUSED", "Refresh token was already used; sign in again", nil)
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			respondError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired refresh token", nil)
+		case errors.Is(err, service.ErrAccountDisabled):
+			respondAccountDisabled(w)
+		default:
+			respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to refresh token", nil)
+		}
 		return
 	}
 
 	respondJSON(w, http.StatusOK, resp)
 }
 
+// Logout signs out the session of the refresh token in the body.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Refresh token is required", nil)
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), req.RefreshToken); err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to log out", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll signs the user out on every device, including this one.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	if err := h.authService.LogoutAll(r.Context(), userID); err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to log out", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions returns the devices the user is signed in on.
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(r.Context(), userID, middleware.GetSessionID(r))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list sessions", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(sessions))
+}
+
+// RevokeSession signs out one device; revoking the current session logs
+// this device out.
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	err := h.authService.RevokeSession(r.Context(), userID, chi.URLParam(r, "id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "Session not found or already signed out", nil)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to revoke session", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS serves the public keys that verify access tokens. It is a plain key
+// set document rather than an API response, so standard JWT libraries can
+// fetch it.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.authService.JWKS())
+}
+
 func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	userID := getUserIDFromContext(r)
 	if userID == "" {
@@ -135,12 +252,45 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, model.SuccessResponse(profile))
 }
 
+// ChangePassword sets a new password and signs out the user's other
+// sessions. current_password is required unless the account has none yet.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.authService.ChangePassword(r.Context(), userID, middleware.GetSessionID(r), &req); err != nil {
+		switch {
+		case errors.Is(err, service.ErrWrongPassword):
+			respondError(w, http.StatusForbidden, "INVALID_PASSWORD", "Current password is incorrect", nil)
+		case errors.Is(err, auth.ErrPasswordTooShort):
+			respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Password must be at least 8 characters", nil)
+		case errors.Is(err, auth.ErrPasswordTooLong):
+			respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Password must be at most 72 bytes", nil)
+		default:
+			respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to change password", nil)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 type ProjectHandler struct {
-	projectService *service.ProjectService
+	projectService     *service.ProjectService
+	productPageService *service.ProductPageService
 }
 
-func NewProjectHandler(projectService *service.ProjectService) *ProjectHandler {
-	return &ProjectHandler{projectService: projectService}
+func NewProjectHandler(projectService *service.ProjectService, productPageService *service.ProductPageService) *ProjectHandler {
+	return &ProjectHandler{projectService: projectService, productPageService: productPageService}
 }
 
 func (h *ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -156,6 +306,18 @@ func (h *ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.ProductName == "" && (req.ProductURL == nil || *req.ProductURL == "") {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Product name is required", nil)
+		return
+	}
+
+	if req.ProductURL != nil && *req.ProductURL != "" {
+		extendWriteDeadline(w, service.ProductPageBudget)
+	}
+	if err := h.productPageService.Prefill(r.Context(), userID, &req); err != nil {
+		respondProductPageError(w, err)
+		return
+	}
 	if req.ProductName == "" {
 		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Product name is required", nil)
 		return
@@ -163,11 +325,55 @@ func (h *ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	project, err := h.projectService.Create(r.Context(), userID, &req)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create project", nil)
+		switch {
+		case errors.Is(err, service.ErrAssetNotFound), errors.Is(err, service.ErrInvalidAsset), errors.Is(err, service.ErrMediaNotFound):
+			respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Product image not found", nil)
+		default:
+			respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create project", nil)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, model.SuccessResponse(h.projectService.SignProject(r.Context(), project)))
+}
+
+// ParseURL reads a product page and suggests project fields. The main
+// image is imported as an asset the client can pass as
+// product_image_asset_id.
+func (h *ProjectHandler) ParseURL(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.ParseProductURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "url is required", nil)
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, model.SuccessResponse(project))
+	extendWriteDeadline(w, service.ProductPageBudget)
+	info, err := h.productPageService.Parse(r.Context(), userID, req.URL, true)
+	if err != nil {
+		respondProductPageError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.productPageService.SignInfo(r.Context(), info)))
+}
+
+func respondProductPageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrBlockedURL):
+		respondError(w, http.StatusBadRequest, "INVALID_URL", "Only public http(s) URLs can be parsed", nil)
+	case errors.Is(err, service.ErrRemoteFetch):
+		respondError(w, http.StatusBadGateway, "FETCH_FAILED", "Failed to download the product page", nil)
+	case errors.Is(err, service.ErrProductPage):
+		respondError(w, http.StatusUnprocessableEntity, "PARSE_FAILED", "No product found on the page", nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to parse product page", nil)
+	}
 }
 
 func (h *ProjectHandler) GetByID(w http.ResponseWriter, r *http.Request) {
@@ -189,7 +395,7 @@ func (h *ProjectHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, model.SuccessResponse(project))
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.projectService.SignProject(r.Context(), project)))
 }
 
 func (h *ProjectHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -222,7 +428,7 @@ func (h *ProjectHandler) List(w http.ResponseWriter, r *http.Request) {
 		TotalPages: (total + limit - 1) / limit,
 	}
 
-	respondJSON(w, http.StatusOK, model.SuccessResponseWithMeta(projects, meta))
+	respondJSON(w, http.StatusOK, model.SuccessResponseWithMeta(h.projectService.SignProjects(r.Context(), projects), meta))
 }
 
 func (h *ProjectHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -265,28 +471,177 @@ func (h *ProjectHandler) GenerateVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Script == "" {
+	// Slideshows can run on images alone; AI generation needs a script.
+	if req.Script == "" && req.Mode != string(model.GenerationModeSlideshow) {
 		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Script is required", nil)
 		return
 	}
 
 	project, err := h.projectService.GenerateVideo(r.Context(), projectID, userID, &req)
 	if err != nil {
-		if err == service.ErrInsufficientCredits {
+		switch err {
+		case service.ErrInsufficientCredits:
 			respondError(w, http.StatusPaymentRequired, "INSUFFICIENT_CREDITS", "No credits remaining", nil)
-			return
+		case service.ErrInvalidMode:
+			respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Mode must be ai or slideshow", nil)
+		case service.ErrNoSlideshowImages, service.ErrInvalidTransition, service.ErrMediaNotFound, service.ErrEmptyScript,
+			service.ErrInvalidPreset, service.ErrInvalidAvatar:
+			respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		default:
+			respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate video", nil)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, model.SuccessResponse(h.projectService.SignProject(r.Context(), project)))
+}
+
+func (h *ProjectHandler) ExtendVideo(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	projectID := chi.URLParam(r, "id")
+	if projectID == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Project ID is required", nil)
+		return
+	}
+
+	var req model.ExtendVideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	render, err := h.projectService.ExtendVideo(r.Context(), projectID, userID, &req)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidExtension:
+			respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		case service.ErrInsufficientCredits:
+			respondError(w, http.StatusPaymentRequired, "INSUFFICIENT_CREDITS", "Not enough credits for the added segments", nil)
+		case service.ErrRenderNotReady:
+			respondError(w, http.StatusConflict, "RENDER_NOT_READY", "Project has no completed video to extend", nil)
+		case repository.ErrNotFound, repository.ErrUnauthorized:
+			respondError(w, http.StatusNotFound, "NOT_FOUND", "Project not found", nil)
+		default:
+			respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to extend video", nil)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, model.SuccessResponse(h.projectService.SignRender(r.Context(), render)))
+}
+
+func (h *ProjectHandler) ListRenders(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	projectID := chi.URLParam(r, "id")
+	if projectID == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Project ID is required", nil)
+		return
+	}
+
+	renders, err := h.projectService.ListRenders(r.Context(), projectID, userID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "Project not found", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.projectService.SignRenders(r.Context(), renders)))
+}
+
+// Download returns a short-lived URL that saves the project's video under the
+// product name.
+func (h *ProjectHandler) Download(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	projectID := chi.URLParam(r, "id")
+	if projectID == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Project ID is required", nil)
+		return
+	}
+
+	url, err := h.projectService.DownloadURL(r.Context(), projectID, userID)
+	if err != nil {
+		switch err {
+		case service.ErrRenderNotReady:
+			respondError(w, http.StatusConflict, "RENDER_NOT_READY", "Project has no completed video", nil)
+		case repository.ErrNotFound, repository.ErrUnauthorized:
+			respondError(w, http.StatusNotFound, "NOT_FOUND", "Project not found", nil)
+		default:
+			respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create download link", nil)
 		}
-		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate video", nil)
 		return
 	}
 
-	respondJSON(w, http.StatusAccepted, model.SuccessResponse(project))
+	respondJSON(w, http.StatusOK, model.SuccessResponse(map[string]string{"url": url}))
 }
 
 func getUserIDFromContext(r *http.Request) string {
 	return middleware.GetUserID(r)
 }
 
+// maxUserAgent bounds the user agent stored with a session.
+const maxUserAgent = 512
+
+// clientInfo describes the device a sign-in comes from.
+func clientInfo(r *http.Request) model.ClientInfo {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgent {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgent], "")
+	}
+	return model.ClientInfo{IPAddress: middleware.GetClientIP(r), UserAgent: userAgent}
+}
+
+// respondLoginGuardError writes the refusal of a throttled sign-in or
+// sign-up, or of a disabled account, and reports whether err was one.
+func respondLoginGuardError(w http.ResponseWriter, err error) bool {
+	var throttled *service.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(throttled.RetryAfter, time.Second).Seconds()))))
+		if throttled.Locked {
+			respondError(w, http.StatusTooManyRequests, "ACCOUNT_LOCKED", "Too many failed attempts; sign-in is temporarily locked", nil)
+		} else {
+			respondError(w, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS", "Too many attempts; try again later", nil)
+		}
+	case errors.Is(err, service.ErrCaptchaRequired):
+		respondError(w, http.StatusForbidden, "CAPTCHA_REQUIRED", "Solve the CAPTCHA and send its captcha_token", nil)
+	case errors.Is(err, service.ErrInvalidCaptcha):
+		respondError(w, http.StatusForbidden, "INVALID_CAPTCHA", "CAPTCHA was not solved; try again", nil)
+	case errors.Is(err, service.ErrAccountDisabled):
+		respondAccountDisabled(w)
+	default:
+		return false
+	}
+	return true
+}
+
+func respondAccountDisabled(w http.ResponseWriter) {
+	respondError(w, http.StatusForbidden, "ACCOUNT_DISABLED", "This account has been disabled; contact support", nil)
+}
+
+// writeSlack is the time left to finish a request once the remote work
+// extendWriteDeadline allows for is done.
+const writeSlack = 15 * time.Second
+
+// extendWriteDeadline lets a handler that waits up to d on remote servers
+// outlive the server's write timeout.
+func extendWriteDeadline(w http.ResponseWriter, d time.Duration) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d + writeSlack))
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/genvid/backend/internal/middleware"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/service"
+)
+
+type MFAHandler struct {
+	mfaService *service.MFAService
+}
+
+func NewMFAHandler(mfaService *service.MFAService) *MFAHandler {
+	return &MFAHandler{mfaService: mfaService}
+}
+
+// Verify finishes a sign-in with the challenge from login and a TOTP or
+// recovery code.
+func (h *MFAHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var req model.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "mfa_token and code are required", nil)
+		return
+	}
+
+	resp, err := h.mfaService.Verify(r.Context(), &req, clientInfo(r))
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *MFAHandler) Status(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	status, err := h.mfaService.Status(r.Context(), userID)
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(status))
+}
+
+// StartTOTP returns a new authenticator secret and its provisioning URI.
+func (h *MFAHandler) StartTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.MFAReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	enrollment, err := h.mfaService.StartTOTP(r.Context(), userID, middleware.GetSessionID(r), &req, clientInfo(r))
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(enrollment))
+}
+
+// ConfirmTOTP enables the new authenticator and returns the recovery codes.
+func (h *MFAHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if req.Code == "" {
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Code is required", nil)
+		return
+	}
+
+	codes, err := h.mfaService.ConfirmTOTP(r.Context(), userID, req.Code)
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(codes))
+}
+
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.MFAReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), userID, middleware.GetSessionID(r), &req, clientInfo(r)); err != nil {
+		respondMFAError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes and returns the new
+// ones.
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.MFAReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), userID, middleware.GetSessionID(r), &req, clientInfo(r))
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(codes))
+}
+
+// respondMFARequired writes the challenge of a sign-in that needs a second
+// factor and reports whether err was one.
+func respondMFARequired(w http.ResponseWriter, err error) bool {
+	var mfa *service.MFARequiredError
+	if !errors.As(err, &mfa) {
+		return false
+	}
+	respondJSON(w, http.StatusOK, mfa.Challenge)
+	return true
+}
+
+func respondMFAError(w http.ResponseWriter, err error) {
+	if respondLoginGuardError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidMFAToken):
+		respondError(w, http.StatusUnauthorized, "INVALID_MFA_TOKEN", "Sign-in expired or had too many attempts; please sign in again", nil)
+	case errors.Is(err, service.ErrInvalidMFACode):
+		respondError(w, http.StatusUnauthorized, "INVALID_MFA_CODE", "Invalid or already used authentication code", nil)
+	case errors.Is(err, service.ErrMFACodeRequired):
+		respondError(w, http.StatusBadRequest, "MFA_CODE_REQUIRED", "An authentication or recovery code is required", nil)
+	case errors.Is(err, service.ErrWrongPassword):
+		respondError(w, http.StatusForbidden, "INVALID_PASSWORD", "Password is incorrect", nil)
+	case errors.Is(err, service.ErrRecentLogin):
+		respondError(w, http.StatusForbidden, "RECENT_LOGIN_REQUIRED", "Sign in again to confirm it is you", nil)
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		respondError(w, http.StatusConflict, "MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled", nil)
+	case errors.Is(err, service.ErrMFANotEnabled):
+		respondError(w, http.StatusConflict, "MFA_NOT_ENABLED", "Two-factor authentication is not enabled", nil)
+	case errors.Is(err, service.ErrNoTOTPEnrollment):
+		respondError(w, http.StatusConflict, "NO_ENROLLMENT", "No authenticator is being set up; start again", nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process request", nil)
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/genvid/backend/internal/service"
+)
+
+// oauthStateCookie holds the signed state of a sign-in at the provider. It
+// is scoped to the callback and lives as long as the state.
+const oauthStateCookie = "genvid_oauth_state"
+
+type OAuthHandler struct {
+	oauthService *service.OAuthService
+}
+
+func NewOAuthHandler(oauthService *service.OAuthService) *OAuthHandler {
+	return &OAuthHandler{oauthService: oauthService}
+}
+
+// GoogleStart redirects the browser to Google's consent screen.
+func (h *OAuthHandler) GoogleStart(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.oauthService.StartGoogle(r.Context())
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/api/auth/google",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		// Lax so the cookie comes back on the top-level redirect from Google.
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GoogleCallback finishes the sign-in and returns the usual AuthResponse,
+// or an MFA challenge like Login.
+func (h *OAuthHandler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Path:     "/api/auth/google",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		respondError(w, http.StatusBadRequest, "OAUTH_DENIED", "Sign-in was cancelled or denied: "+reason, nil)
+		return
+	}
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "code and state are required", nil)
+		return
+	}
+
+	var signedState string
+	if cookie, err := r.Cookie(oauthStateCookie); err == nil {
+		signedState = cookie.Value
+	}
+
+	resp, err := h.oauthService.FinishGoogle(r.Context(), code, state, signedState, clientInfo(r))
+	if err != nil {
+		if respondMFARequired(w, err) {
+			return
+		}
+		respondOAuthError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func respondOAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrOAuthDisabled):
+		respondError(w, http.StatusNotFound, "OAUTH_DISABLED", "Google sign-in is not configured", nil)
+	case errors.Is(err, service.ErrOAuthState):
+		respondError(w, http.StatusBadRequest, "INVALID_STATE", "Sign-in expired or was started in another browser; please try again", nil)
+	case errors.Is(err, service.ErrEmailNotVerified):
+		respondError(w, http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Your Google account's email is not verified", nil)
+	case errors.Is(err, service.ErrOAuthExchange):
+		respondError(w, http.StatusBadGateway, "OAUTH_FAILED", "Could not complete sign-in with Google", nil)
+	case errors.Is(err, service.ErrAccountDisabled):
+		respondAccountDisabled(w)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to sign in", nil)
+	}
+}
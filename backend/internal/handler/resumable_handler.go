@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// tusVersion is the tus protocol version spoken by ResumableUploadHandler.
+const tusVersion = "1.0.0"
+
+// chunkTimeout replaces the server's read and write timeouts for a PATCH,
+// which may carry tens of megabytes.
+const chunkTimeout = 10 * time.Minute
+
+// ResumableUploadHandler serves /api/uploads with the tus 1.0 core protocol
+// and its creation, checksum (sha1, sha256, md5), expiration and
+// termination extensions. Plain clients can use the same endpoints: POST
+// with Upload-Length, PATCH with Upload-Offset, and GET for the result.
+type ResumableUploadHandler struct {
+	uploadService *service.UploadService
+	assetService  *service.AssetService
+}
+
+func NewResumableUploadHandler(uploadService *service.UploadService, assetService *service.AssetService) *ResumableUploadHandler {
+	return &ResumableUploadHandler{uploadService: uploadService, assetService: assetService}
+}
+
+func (h *ResumableUploadHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Upload-Length header is required", nil)
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid Upload-Metadata header", nil)
+		return
+	}
+
+	session, err := h.uploadService.Create(r.Context(), userID, length, metadata)
+	if err != nil {
+		respondResumableError(w, err)
+		return
+	}
+
+	setUploadHeaders(w, session)
+	w.Header().Set("Location", "/api/uploads/"+session.ID)
+	respondJSON(w, http.StatusCreated, model.SuccessResponse(session))
+}
+
+// Head reports how much of an upload the server has, so the client knows
+// where to resume.
+func (h *ResumableUploadHandler) Head(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.uploadService.Get(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUploadNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setUploadHeaders(w, session)
+	w.Header().Set("Cache-Control", "no-store")
+	if session.Status == model.UploadStatusUploading && time.Now().After(session.ExpiresAt) {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ResumableUploadHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondError(w, http.StatusUnsupportedMediaType, "INVALID_REQUEST", "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Upload-Offset header is required", nil)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(chunkTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(chunkTimeout))
+
+	session, err := h.uploadService.WriteChunk(r.Context(), chi.URLParam(r, "id"), userID, offset, r.Body, r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		respondResumableError(w, err)
+		return
+	}
+
+	setUploadHeaders(w, session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get returns the upload as JSON. Once status is completed it includes the
+// asset; failed uploads carry the reason in error.
+func (h *ResumableUploadHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	session, err := h.uploadService.Get(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		respondResumableError(w, err)
+		return
+	}
+	if session.Asset != nil {
+		session.Asset = h.assetService.SignAsset(r.Context(), session.Asset)
+	}
+
+	setUploadHeaders(w, session)
+	respondJSON(w, http.StatusOK, model.SuccessResponse(session))
+}
+
+func (h *ResumableUploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	if err := h.uploadService.Delete(r.Context(), chi.URLParam(r, "id"), userID); err != nil {
+		respondResumableError(w, err)
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setUploadHeaders(w http.ResponseWriter, session *model.UploadSession) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.UploadOffset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.UploadLength, 10))
+	if session.Status == model.UploadStatusUploading {
+		w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkTusVersion rejects tus clients speaking another protocol version.
+// Requests without the header are plain API calls and are accepted.
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	if v := r.Header.Get("Tus-Resumable"); v != "" && v != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondError(w, http.StatusPreconditionFailed, "UNSUPPORTED_VERSION", "Unsupported tus version", nil)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes "key base64value,key2 base64value2".
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func respondResumableError(w http.ResponseWriter, err error) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "Upload not found", nil)
+	case errors.Is(err, service.ErrUploadExpired):
+		respondError(w, http.StatusGone, "UPLOAD_EXPIRED", err.Error(), nil)
+	case errors.Is(err, service.ErrUploadOffset):
+		respondError(w, http.StatusConflict, "OFFSET_MISMATCH", err.Error(), nil)
+	case errors.Is(err, service.ErrUploadClosed), errors.Is(err, service.ErrUploadStillFinishing):
+		respondError(w, http.StatusConflict, "UPLOAD_CLOSED", err.Error(), nil)
+	case errors.Is(err, service.ErrChecksumMismatch):
+		// 460 is the tus checksum extension's status for a bad digest.
+		respondError(w, 460, "CHECKSUM_MISMATCH", err.Error(), nil)
+	case errors.Is(err, service.ErrUnsupportedChecksum):
+		respondError(w, http.StatusBadRequest, "UNSUPPORTED_CHECKSUM", err.Error(), nil)
+	case errors.Is(err, service.ErrChunkTooLarge), errors.Is(err, service.ErrAssetTooLarge):
+		respondError(w, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", err.Error(), nil)
+	case errors.Is(err, service.ErrQuotaExceeded):
+		respondError(w, http.StatusRequestEntityTooLarge, "QUOTA_EXCEEDED", "Storage quota exceeded", nil)
+	case errors.Is(err, service.ErrInvalidAsset):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process upload", nil)
+	}
+}
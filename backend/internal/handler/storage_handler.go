@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/service"
+)
+
+type StorageHandler struct {
+	storageService *service.StorageService
+}
+
+func NewStorageHandler(storageService *service.StorageService) *StorageHandler {
+	return &StorageHandler{storageService: storageService}
+}
+
+// Usage reports the user's stored bytes, quota and retention period.
+func (h *StorageHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	usage, err := h.storageService.Usage(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load storage usage", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(usage))
+}
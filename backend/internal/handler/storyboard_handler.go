@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type StoryboardHandler struct {
+	projectService *service.ProjectService
+}
+
+func NewStoryboardHandler(projectService *service.ProjectService) *StoryboardHandler {
+	return &StoryboardHandler{projectService: projectService}
+}
+
+func (h *StoryboardHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	scenes, err := h.projectService.GetStoryboard(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		respondStoryboardError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(scenes))
+}
+
+func (h *StoryboardHandler) Build(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.BuildStoryboardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	scenes, err := h.projectService.BuildStoryboard(r.Context(), chi.URLParam(r, "id"), userID, &req)
+	if err != nil {
+		respondStoryboardError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, model.SuccessResponse(scenes))
+}
+
+func (h *StoryboardHandler) UpdateScene(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.UpdateSceneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	scene, err := h.projectService.UpdateScene(r.Context(), chi.URLParam(r, "id"), userID, chi.URLParam(r, "sceneID"), &req)
+	if err != nil {
+		respondStoryboardError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(scene))
+}
+
+func (h *StoryboardHandler) ListStylePresets(w http.ResponseWriter, r *http.Request) {
+	presets, err := h.projectService.ListStylePresets(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list style presets", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(presets))
+}
+
+func respondStoryboardError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, repository.ErrUnauthorized):
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "Project not found", nil)
+	case errors.Is(err, service.ErrSceneNotFound):
+		respondError(w, http.StatusNotFound, "SCENE_NOT_FOUND", "Scene not found", nil)
+	case errors.Is(err, service.ErrEmptyScript):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Script is required", nil)
+	case errors.Is(err, service.ErrInvalidScene):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Role must be hook, problem, demo or cta, duration must be 5 or 10, and script cannot be empty", nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update storyboard", nil)
+	}
+}
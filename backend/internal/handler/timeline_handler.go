@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type TimelineHandler struct {
+	projectService *service.ProjectService
+}
+
+func NewTimelineHandler(projectService *service.ProjectService) *TimelineHandler {
+	return &TimelineHandler{projectService: projectService}
+}
+
+func (h *TimelineHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	timeline, err := h.projectService.GetTimeline(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		respondTimelineError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.projectService.SignTimeline(r.Context(), timeline)))
+}
+
+func (h *TimelineHandler) TrimClip(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.TrimClipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	timeline, err := h.projectService.TrimClip(r.Context(), chi.URLParam(r, "id"), userID, chi.URLParam(r, "clipID"), &req)
+	if err != nil {
+		respondTimelineError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.projectService.SignTimeline(r.Context(), timeline)))
+}
+
+func (h *TimelineHandler) ReorderClips(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.ReorderClipsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	timeline, err := h.projectService.ReorderClips(r.Context(), chi.URLParam(r, "id"), userID, &req)
+	if err != nil {
+		respondTimelineError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.projectService.SignTimeline(r.Context(), timeline)))
+}
+
+func (h *TimelineHandler) DropClip(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	timeline, err := h.projectService.DropClip(r.Context(), chi.URLParam(r, "id"), userID, chi.URLParam(r, "clipID"))
+	if err != nil {
+		respondTimelineError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.SuccessResponse(h.projectService.SignTimeline(r.Context(), timeline)))
+}
+
+func (h *TimelineHandler) InsertClip(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	var req model.InsertClipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	timeline, err := h.projectService.InsertClip(r.Context(), chi.URLParam(r, "id"), userID, &req)
+	if err != nil {
+		respondTimelineError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, model.SuccessResponse(h.projectService.SignTimeline(r.Context(), timeline)))
+}
+
+func (h *TimelineHandler) Rerender(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
+		return
+	}
+
+	render, err := h.projectService.Rerender(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		respondTimelineError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, model.SuccessResponse(h.projectService.SignRender(r.Context(), render)))
+}
+
+func respondTimelineError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, repository.ErrUnauthorized):
+		respondError(w, http.StatusNotFound, "NOT_FOUND", "Render not found", nil)
+	case errors.Is(err, service.ErrClipNotFound):
+		respondError(w, http.StatusNotFound, "CLIP_NOT_FOUND", "Timeline clip not found", nil)
+	case errors.Is(err, service.ErrRenderNotReady):
+		respondError(w, http.StatusConflict, "RENDER_NOT_READY", "Render has not completed yet", nil)
+	case errors.Is(err, service.ErrInvalidTimeline):
+		respondError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update timeline", nil)
+	}
+}
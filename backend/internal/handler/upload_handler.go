@@ -2,30 +2,22 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
 
-	"github.com/google/uuid"
+	"github.com/genvid/backend/internal/media"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/service"
 )
 
+// UploadHandler serves the original product image upload endpoint. Uploads
+// are recorded as product_image assets; new clients should use /api/assets.
 type UploadHandler struct {
-	uploadDir string
-	baseURL   string
+	assetService *service.AssetService
 }
 
-func NewUploadHandler(uploadDir, baseURL string) *UploadHandler {
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		panic(fmt.Sprintf("Failed to create upload directory: %v", err))
-	}
-	return &UploadHandler{
-		uploadDir: uploadDir,
-		baseURL:   baseURL,
-	}
+func NewUploadHandler(assetService *service.AssetService) *UploadHandler {
+	return &UploadHandler{assetService: assetService}
 }
 
 func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
@@ -35,13 +27,14 @@ func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	maxSize := int64(10 << 20)
-	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	maxSize := media.MaxSize[media.KindImage]
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+(1<<20))
 
 	if err := r.ParseMultipartForm(maxSize); err != nil {
 		respondError(w, http.StatusBadRequest, "FILE_TOO_LARGE", "File size exceeds 10MB limit", nil)
 		return
 	}
+	defer r.MultipartForm.RemoveAll()
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
@@ -50,60 +43,78 @@ func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
-	if !allowedExts[ext] {
-		respondError(w, http.StatusBadRequest, "INVALID_TYPE", "Only image files (jpg, png, gif, webp) are allowed", nil)
+	asset, err := h.assetService.Upload(r.Context(), userID, file, header.Filename, &model.UploadAssetRequest{
+		Purpose: model.AssetPurposeProductImage,
+	})
+	if err != nil {
+		respondUploadError(w, err)
 		return
 	}
 
-	buffer := make([]byte, 512)
-	if _, err := file.Read(buffer); err != nil {
-		respondError(w, http.StatusBadRequest, "READ_ERROR", "Failed to read file", nil)
-		return
-	}
-	if _, err := file.Seek(0, 0); err != nil {
-		respondError(w, http.StatusInternalServerError, "SEEK_ERROR", "Failed to process file", nil)
-		return
-	}
+	h.respondUpload(w, r, asset)
+}
 
-	contentType := http.DetectContentType(buffer)
-	if !strings.HasPrefix(contentType, "image/") {
-		respondError(w, http.StatusBadRequest, "INVALID_CONTENT", "File is not a valid image", nil)
+// FromURL imports a product image from a public URL, typically the seller's
+// shop page.
+func (h *UploadHandler) FromURL(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", nil)
 		return
 	}
 
-	filename := fmt.Sprintf("%s_%d%s", uuid.New().String(), time.Now().Unix(), ext)
-	userDir := filepath.Join(h.uploadDir, userID)
-	if err := os.MkdirAll(userDir, 0755); err != nil {
-		respondError(w, http.StatusInternalServerError, "CREATE_DIR_ERROR", "Failed to create upload directory", nil)
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		respondError(w, http.StatusBadRequest, "INVALID_REQUEST", "url is required", nil)
 		return
 	}
 
-	filePath := filepath.Join(userDir, filename)
-	dst, err := os.Create(filePath)
+	extendWriteDeadline(w, service.RemoteFetchTimeout)
+	asset, err := h.assetService.UploadFromURL(r.Context(), userID, req.URL, &model.UploadAssetRequest{
+		Purpose: model.AssetPurposeProductImage,
+	})
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "SAVE_ERROR", "Failed to save file", nil)
+		respondUploadError(w, err)
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		respondError(w, http.StatusInternalServerError, "SAVE_ERROR", "Failed to save file", nil)
-		return
-	}
+	h.respondUpload(w, r, asset)
+}
 
-	imageURL := fmt.Sprintf("%s/uploads/%s/%s", h.baseURL, userID, filename)
+func (h *UploadHandler) respondUpload(w http.ResponseWriter, r *http.Request, asset *model.Asset) {
+	// The signed URL doubles as the reference clients send back; the
+	// signature is stripped before it is saved.
+	signed := h.assetService.SignAsset(r.Context(), asset)
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"data": map[string]string{
-			"url":      imageURL,
-			"filename": filename,
+			"url":      signed.URL,
+			"filename": asset.Filename,
+			"asset_id": asset.ID,
 		},
 	})
 }
 
+func respondUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnsupportedMedia), errors.Is(err, service.ErrInvalidAsset):
+		respondError(w, http.StatusBadRequest, "INVALID_TYPE", "Only image files (jpg, png, gif, webp) are allowed", nil)
+	case errors.Is(err, service.ErrAssetTooLarge):
+		respondError(w, http.StatusBadRequest, "FILE_TOO_LARGE", "File size exceeds 10MB limit", nil)
+	case errors.Is(err, service.ErrQuotaExceeded):
+		respondError(w, http.StatusRequestEntityTooLarge, "QUOTA_EXCEEDED", "Storage quota exceeded", nil)
+	case errors.Is(err, service.ErrBlockedURL):
+		respondError(w, http.StatusBadRequest, "INVALID_URL", "Only public http(s) URLs can be imported", nil)
+	case errors.Is(err, service.ErrRemoteFetch):
+		respondError(w, http.StatusBadGateway, "FETCH_FAILED", "Failed to download the image", nil)
+	default:
+		respondError(w, http.StatusInternalServerError, "SAVE_ERROR", "Failed to save file", nil)
+	}
+}
+
 func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	userID := getUserIDFromContext(r)
 	if userID == "" {
@@ -119,9 +130,8 @@ func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(h.uploadDir, userID, req.Filename)
-	if err := os.Remove(filePath); err != nil {
-		if os.IsNotExist(err) {
+	if err := h.assetService.DeleteUpload(r.Context(), userID, req.Filename); err != nil {
+		if errors.Is(err, service.ErrAssetNotFound) {
 			respondError(w, http.StatusNotFound, "NOT_FOUND", "File not found", nil)
 			return
 		}
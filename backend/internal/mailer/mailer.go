@@ -0,0 +1,35 @@
+// Package mailer sends transactional email such as verification and
+// password reset links.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/genvid/backend/internal/config"
+)
+
+// Message is a single email with plain text and HTML bodies.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New builds the mailer selected by MAIL_DRIVER.
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mail.Driver {
+	case "", "file":
+		return NewFile(cfg.Mail.Dir, cfg.Mail.From)
+	case "resend":
+		return NewResend(cfg.External.Resend, cfg.Mail.From)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Mail.Driver)
+	}
+}
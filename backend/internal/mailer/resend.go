@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+)
+
+const resendEndpoint = "https://api.resend.com/emails"
+
+// Resend sends email through the Resend API.
+type Resend struct {
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+func NewResend(cfg config.ResendConfig, from string) (*Resend, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("resend: RESEND_API_KEY is not set")
+	}
+	return &Resend{
+		apiKey: cfg.APIKey,
+		from:   from,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (m *Resend) Send(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"from":    m.from,
+		"to":      []string{msg.To},
+		"subject": msg.Subject,
+		"text":    msg.Text,
+		"html":    msg.HTML,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, resendEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("resend: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("resend: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
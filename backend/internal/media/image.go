@@ -0,0 +1,320 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// MaxImageSide is the longest side kept for normalized uploads. Larger
+// images are scaled down; the provider gains nothing from more pixels.
+const MaxImageSide = 2048
+
+// maxImagePixels guards against decompression bombs.
+const maxImagePixels = 50_000_000
+
+const jpegQuality = 90
+
+// Fit is how an image is shaped into a different aspect ratio.
+type Fit string
+
+const (
+	// FitCrop fills the frame and trims the overflow around the centre.
+	FitCrop Fit = "crop"
+	// FitPad keeps the whole image and fills the bars with the border
+	// colour.
+	FitPad Fit = "pad"
+)
+
+// cropTolerance is how far the aspect ratios may differ before cropping
+// would cut into the product and padding is used instead.
+const cropTolerance = 0.15
+
+// Normalized is an image ready to store: upright, without metadata and no
+// larger than MaxImageSide.
+type Normalized struct {
+	Image       image.Image
+	Data        []byte
+	ContentType string
+}
+
+// NormalizeImage decodes an upload, applies its EXIF orientation, takes the
+// first frame of a GIF, scales it down to MaxImageSide and re-encodes it.
+// Re-encoding drops EXIF, XMP and other metadata. Images with transparency
+// stay PNG; everything else becomes JPEG.
+func NormalizeImage(r io.Reader) (*Normalized, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("image dimensions %dx%d are not supported", cfg.Width, cfg.Height)
+	}
+
+	// image.Decode returns the first frame of an animated GIF.
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	img = scaleDown(img, MaxImageSide)
+
+	n := &Normalized{Image: img}
+	if isOpaque(img) {
+		n.ContentType = "image/jpeg"
+		n.Data, err = EncodeJPEG(img)
+	} else {
+		n.ContentType = "image/png"
+		n.Data, err = encodePNG(img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// Variant shapes img into exactly width x height. Close aspect ratios are
+// cropped; others are padded so the product is never cut off.
+func Variant(img image.Image, width, height int) (image.Image, Fit) {
+	b := img.Bounds()
+	src := float64(b.Dx()) / float64(b.Dy())
+	dst := float64(width) / float64(height)
+
+	if ratio := src / dst; ratio >= 1-cropTolerance && ratio <= 1+cropTolerance {
+		return crop(img, width, height), FitCrop
+	}
+	return pad(img, width, height), FitPad
+}
+
+// EncodeJPEG encodes img as a JPEG, flattening transparency onto white.
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	if !isOpaque(img) {
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		img = flat
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func scaleDown(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+	return resize(img, w, h)
+}
+
+func resize(img image.Image, width, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+// crop scales img to cover width x height and trims the centre.
+func crop(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	scale := max(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	sw := max(width, int(float64(b.Dx())*scale+0.5))
+	sh := max(height, int(float64(b.Dy())*scale+0.5))
+	scaled := resize(img, sw, sh)
+
+	x0, y0 := (sw-width)/2, (sh-height)/2
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), scaled, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+// pad scales img to fit inside width x height and centres it on the
+// image's average border colour, which blends with typical product shots.
+func pad(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	scale := min(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	sw := max(1, min(width, int(float64(b.Dx())*scale+0.5)))
+	sh := max(1, min(height, int(float64(b.Dy())*scale+0.5)))
+	scaled := resize(img, sw, sh)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(borderColor(img)), image.Point{}, draw.Src)
+
+	offset := image.Pt((width-sw)/2, (height-sh)/2)
+	draw.Draw(dst, scaled.Bounds().Add(offset), scaled, image.Point{}, draw.Over)
+	return dst
+}
+
+func borderColor(img image.Image) color.Color {
+	b := img.Bounds()
+	var r, g, bl, n uint64
+	sample := func(x, y int) {
+		cr, cg, cb, ca := img.At(x, y).RGBA()
+		if ca == 0 {
+			// Transparent borders pad with white.
+			cr, cg, cb = 0xffff, 0xffff, 0xffff
+		}
+		r, g, bl, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), n+1
+	}
+
+	stepX, stepY := max(1, b.Dx()/64), max(1, b.Dy()/64)
+	for x := b.Min.X; x < b.Max.X; x += stepX {
+		sample(x, b.Min.Y)
+		sample(x, b.Max.Y-1)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		sample(b.Min.X, y)
+		sample(b.Max.X-1, y)
+	}
+
+	return color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: 0xffff}
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return true
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	swap := orientation >= 5
+	dw, dh := w, h
+	if swap {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag from a JPEG, returning 1
+// when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // image data starts; no EXIF
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if o, err := exifOrientation(segment[6:]); err == nil {
+				return o
+			}
+			return 1
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) (int, error) {
+	if len(tiff) < 8 {
+		return 0, errors.New("short exif")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, errors.New("bad exif byte order")
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0, errors.New("bad exif offset")
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		off := ifd + 2 + e*12
+		if off+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[off:]) == 0x0112 {
+			return int(order.Uint16(tiff[off+8:])), nil
+		}
+	}
+	return 1, nil
+}
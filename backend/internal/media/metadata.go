@@ -0,0 +1,149 @@
+// Package media identifies uploaded files and reads their metadata.
+package media
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/genvid/backend/internal/video"
+)
+
+// Kinds of media accepted as assets.
+const (
+	KindImage = "image"
+	KindVideo = "video"
+	KindAudio = "audio"
+)
+
+// allowed maps accepted content types to their kind.
+var allowed = map[string]string{
+	"image/jpeg":      KindImage,
+	"image/png":       KindImage,
+	"image/gif":       KindImage,
+	"image/webp":      KindImage,
+	"video/mp4":       KindVideo,
+	"video/quicktime": KindVideo,
+	"video/webm":      KindVideo,
+	"audio/mpeg":      KindAudio,
+	"audio/wave":      KindAudio,
+	"audio/wav":       KindAudio,
+	"audio/x-wav":     KindAudio,
+	"audio/mp4":       KindAudio,
+	"audio/aac":       KindAudio,
+	"audio/ogg":       KindAudio,
+}
+
+// MaxSize is the upload limit for each kind. Videos this large need the
+// resumable upload API; a single multipart request is capped lower.
+var MaxSize = map[string]int64{
+	KindImage: 10 << 20,
+	KindVideo: 1 << 30,
+	KindAudio: 20 << 20,
+}
+
+// Metadata describes a media file. Zero fields are unknown.
+type Metadata struct {
+	ContentType string
+	Kind        string
+	Width       int
+	Height      int
+	Duration    float64
+}
+
+// Sniff detects the content type from the first bytes of a file, falling back
+// to the extension for containers the standard sniffer does not know. It
+// returns "" for types that are not accepted.
+func Sniff(head []byte, filename string) string {
+	// QuickTime and M4A files often list an mp4 brand as compatible, which
+	// DetectContentType reports as video/mp4; their major brand says better.
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4A ":
+			return "audio/mp4"
+		}
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if _, ok := allowed[contentType]; ok {
+		return contentType
+	}
+
+	// DetectContentType misses QuickTime and M4A. Only trust the extension
+	// when the bytes look like an ISO media container.
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		byExt, _, _ := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))))
+		switch byExt {
+		case "video/quicktime", "video/mp4", "audio/mp4":
+			return byExt
+		case "audio/x-m4a":
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	}
+
+	return ""
+}
+
+// Kind returns the media kind of an accepted content type, or "".
+func Kind(contentType string) string {
+	return allowed[contentType]
+}
+
+// Probe reads dimensions and duration from a local file. Images are decoded
+// in-process; video and audio need ffprobe, and an error is returned when it
+// is unavailable.
+func Probe(path, contentType string) (Metadata, error) {
+	meta := Metadata{ContentType: contentType, Kind: Kind(contentType)}
+
+	switch meta.Kind {
+	case KindImage:
+		f, err := os.Open(path)
+		if err != nil {
+			return meta, err
+		}
+		defer f.Close()
+
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return meta, fmt.Errorf("decode image: %w", err)
+		}
+		meta.Width, meta.Height = cfg.Width, cfg.Height
+
+	case KindVideo:
+		duration, err := video.ProbeDuration(path)
+		if err != nil {
+			return meta, err
+		}
+		meta.Duration = duration
+
+		width, height, err := video.ProbeDimensions(path)
+		if err != nil {
+			return meta, err
+		}
+		meta.Width, meta.Height = width, height
+
+	case KindAudio:
+		duration, err := video.ProbeDuration(path)
+		if err != nil {
+			return meta, err
+		}
+		meta.Duration = duration
+
+	default:
+		return meta, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	return meta, nil
+}
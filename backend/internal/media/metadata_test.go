@@ -0,0 +1,101 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ftyp returns the start of an ISO media file with the given major brand.
+func ftyp(brand string) []byte {
+	return append([]byte("\x00\x00\x00\x18ftyp"+brand), "\x00\x00\x02\x00isommp41"...)
+}
+
+func TestSniff(t *testing.T) {
+	pngHead := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		name     string
+		head     []byte
+		filename string
+		want     string
+	}{
+		{"png", pngHead, "photo.png", "image/png"},
+		{"png named jpg", pngHead, "photo.jpg", "image/png"},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "photo.jpg", "image/jpeg"},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), "anim.gif", "image/gif"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "photo.webp", "image/webp"},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01"), "clip.webm", "video/webm"},
+		{"mp3", []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), "song.mp3", "audio/mpeg"},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "voice.wav", "audio/wave"},
+		{"mp4", ftyp("isom"), "clip.mp4", "video/mp4"},
+		{"quicktime brand", ftyp("qt  "), "clip.bin", "video/quicktime"},
+		{"m4a brand", ftyp("M4A "), "voice.bin", "audio/mp4"},
+		{"unknown brand", ftyp("xxxx"), "clip", "video/mp4"},
+		{"html", []byte("<!DOCTYPE html><html>"), "page.png", ""},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg">`), "logo.svg", ""},
+		{"pdf", []byte("%PDF-1.7\n"), "doc.pdf", ""},
+		{"text named mp4", []byte("hello world"), "clip.mp4", ""},
+		{"short ftyp", []byte("\x00\x00\x00\x18ftyp"), "clip.mov", ""},
+		{"empty", nil, "clip.mp4", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sniff(tt.head, tt.filename); got != tt.want {
+				t.Errorf("Sniff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKind(t *testing.T) {
+	tests := map[string]string{
+		"image/png":       KindImage,
+		"video/quicktime": KindVideo,
+		"audio/mp4":       KindAudio,
+		"text/html":       "",
+		"":                "",
+	}
+	for contentType, want := range tests {
+		if got := Kind(contentType); got != want {
+			t.Errorf("Kind(%q) = %q, want %q", contentType, got, want)
+		}
+	}
+}
+
+func TestProbeImage(t *testing.T) {
+	var buf bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 640, 360))
+	img.Set(0, 0, color.White)
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "frame.png")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := Probe(path, Sniff(buf.Bytes(), "frame.png"))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	want := Metadata{ContentType: "image/png", Kind: KindImage, Width: 640, Height: 360}
+	if meta != want {
+		t.Errorf("Probe() = %+v, want %+v", meta, want)
+	}
+
+	if _, err := Probe(path, "text/plain"); err == nil {
+		t.Error("Probe() of an unsupported type succeeded")
+	}
+
+	if err := os.WriteFile(path, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Probe(path, "image/png"); err == nil {
+		t.Error("Probe() of a corrupt image succeeded")
+	}
+}
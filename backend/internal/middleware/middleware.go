@@ -3,23 +3,51 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/ratelimit"
 	"github.com/genvid/backend/pkg/auth"
 )
 
 type contextKey string
 
 const (
-	UserIDKey contextKey = "user_id"
-	EmailKey  contextKey = "email"
+	UserIDKey    contextKey = "user_id"
+	EmailKey     contextKey = "email"
+	SessionIDKey contextKey = "session_id"
+	RoleKey      contextKey = "role"
+	APIKeyKey    contextKey = "api_key"
+	ClientIPKey  contextKey = "client_ip"
 )
 
-func AuthMiddleware(jwtService *auth.JWTService) func(http.Handler) http.Handler {
+// SessionChecker reports whether the session an access token belongs to is
+// still signed in.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, userID, sessionID string) (bool, error)
+}
+
+// APIKeyAuthenticator resolves an API key and counts the request against
+// its rate limit.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, *ratelimit.Result, error)
+}
+
+// AuthMiddleware accepts an access token or an API key, sent as
+// "Authorization: Bearer gv_..." or in X-API-Key.
+func AuthMiddleware(jwtService *auth.JWTService, sessions SessionChecker, apiKeys APIKeyAuthenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := apiKeyFromRequest(r); key != "" {
+				authenticateAPIKey(w, r, next, apiKeys, key)
+				return
+			}
+
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
 				respondAuthError(w, "MISSING_TOKEN", "Authorization header is required")
@@ -33,20 +61,111 @@ func AuthMiddleware(jwtService *auth.JWTService) func(http.Handler) http.Handler
 			}
 
 			token := parts[1]
-			claims, err := jwtService.ValidateToken(token)
+			claims, err := jwtService.ValidateAccessToken(token)
 			if err != nil {
 				respondAuthError(w, "INVALID_TOKEN", "Invalid or expired token")
 				return
 			}
 
+			active, err := sessions.SessionActive(r.Context(), claims.UserID, claims.SessionID)
+			if err != nil {
+				RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to check session", nil)
+				return
+			}
+			if !active {
+				respondAuthError(w, "SESSION_REVOKED", "Session has been signed out")
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 			ctx = context.WithValue(ctx, EmailKey, claims.Email)
+			ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, RoleKey, claims.Role)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") && strings.HasPrefix(parts[1], model.APIKeyPrefix) {
+		return parts[1]
+	}
+	return ""
+}
+
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, apiKeys APIKeyAuthenticator, raw string) {
+	key, limit, err := apiKeys.AuthenticateAPIKey(r.Context(), raw)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			respondAuthError(w, "INVALID_API_KEY", "Invalid, revoked or expired API key")
+			return
+		}
+		RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to check API key", nil)
+		return
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(limit.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(limit.Reset.Unix(), 10))
+	if !limit.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.RetryAfter().Seconds()))))
+		RespondError(w, http.StatusTooManyRequests, "RATE_LIMITED", "API key rate limit exceeded", nil)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, key.UserID)
+	ctx = context.WithValue(ctx, APIKeyKey, key)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireScope rejects API keys without scope. Signed-in sessions have
+// every scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := GetAPIKey(r); key != nil && !key.HasScope(scope) {
+				RespondError(w, http.StatusForbidden, "INSUFFICIENT_SCOPE", "API key lacks the "+scope+" scope", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects API keys, for account and key management.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIKey(r) != nil {
+			RespondError(w, http.StatusForbidden, "SESSION_REQUIRED", "This endpoint is not available to API keys", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole admits signed-in sessions whose token carries one of roles,
+// for staff routes. API keys have no role.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := GetRole(r)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			RespondError(w, http.StatusForbidden, "INSUFFICIENT_ROLE", "Your account cannot access this endpoint", nil)
+		})
+	}
+}
+
 func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -66,8 +185,9 @@ func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 				} else {
 					w.Header().Set("Access-Control-Allow-Origin", allowedOrigins[0])
 				}
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Requested-With, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset, Upload-Checksum")
+				w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Expires, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 				w.Header().Set("Access-Control-Max-Age", "86400")
 			}
@@ -82,6 +202,32 @@ func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 	}
 }
 
+// ClientIP stores the client's address in the request context. Behind a
+// reverse proxy, set trustProxy to use the address the proxy appended to
+// X-Forwarded-For; the entries before it come from the client and can be
+// forged.
+func ClientIP(trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ""
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				ip = host
+			}
+			if trustProxy {
+				if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+					parts := strings.Split(forwarded, ",")
+					ip = strings.TrimSpace(parts[len(parts)-1])
+				}
+			}
+			if net.ParseIP(ip) == nil {
+				ip = ""
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClientIPKey, ip)))
+		})
+	}
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		next.ServeHTTP(w, r)
@@ -114,6 +260,40 @@ func GetUserID(r *http.Request) string {
 	return ""
 }
 
+// GetAPIKey returns the API key that authenticated the request, or nil for
+// signed-in sessions.
+func GetAPIKey(r *http.Request) *model.APIKey {
+	if key, ok := r.Context().Value(APIKeyKey).(*model.APIKey); ok {
+		return key
+	}
+	return nil
+}
+
+// GetClientIP returns the address stored by ClientIP, or "" if unknown.
+func GetClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	return ""
+}
+
+// GetSessionID returns the session of the request's access token.
+func GetSessionID(r *http.Request) string {
+	if sessionID, ok := r.Context().Value(SessionIDKey).(string); ok {
+		return sessionID
+	}
+	return ""
+}
+
+// GetRole returns the role of the request's access token, or "" for API
+// keys.
+func GetRole(r *http.Request) string {
+	if role, ok := r.Context().Value(RoleKey).(string); ok {
+		return role
+	}
+	return ""
+}
+
 func RespondError(w http.ResponseWriter, status int, code, message string, details map[string]string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
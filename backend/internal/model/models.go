@@ -1,7 +1,10 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Profile struct {
@@ -19,8 +22,29 @@ type Profile struct {
 	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
 	LastLoginAt        *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+	// PasswordSet is false for accounts from before passwords were stored;
+	// they must set one before logging in with email and password.
+	PasswordSet  bool    `json:"password_set" db:"password_set"`
+	PasswordHash *string `json:"-" db:"password_hash"`
+	// EmailVerifiedAt is nil until the user follows the verification link;
+	// free credits are granted then.
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	Role            string     `json:"role" db:"role"`
+	// DisabledAt is set while staff have disabled the account.
+	DisabledAt *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
 }
 
+// Profile roles. Support and admin staff use the admin API.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
+var SubscriptionTiers = []string{"free", "starter", "pro", "business", "enterprise"}
+
 type ProjectStatus string
 
 const (
@@ -30,6 +54,8 @@ const (
 	ProjectStatusCompleted  ProjectStatus = "completed"
 	ProjectStatusFailed     ProjectStatus = "failed"
 	ProjectStatusCanceled   ProjectStatus = "canceled"
+	// ProjectStatusExpired projects had their media removed by retention.
+	ProjectStatusExpired ProjectStatus = "expired"
 )
 
 type VideoFormat string
@@ -49,10 +75,12 @@ type Project struct {
 	ProductDescription *string       `json:"product_description,omitempty" db:"product_description"`
 	ProductURL         *string       `json:"product_url,omitempty" db:"product_url"`
 	ProductImageURL    *string       `json:"product_image_url,omitempty" db:"product_image_url"`
+	ProductImageID     *string       `json:"product_image_asset_id,omitempty" db:"product_image_asset_id"`
 	Script             *string       `json:"script,omitempty" db:"script"`
 	Language           string        `json:"language" db:"language"`
 	Format             VideoFormat   `json:"format" db:"format"`
 	VideoDuration      int           `json:"video_duration" db:"video_duration"`
+	StylePreset        *string       `json:"style_preset,omitempty" db:"style_preset"`
 	Status             ProjectStatus `json:"status" db:"status"`
 	ProgressPercent    int           `json:"progress_percent" db:"progress_percent"`
 	ErrorMessage       *string       `json:"error_message,omitempty" db:"error_message"`
@@ -64,6 +92,119 @@ type Project struct {
 	UpdatedAt          time.Time     `json:"updated_at" db:"updated_at"`
 	StartedAt          *time.Time    `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt        *time.Time    `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt          *time.Time    `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+type GenerationMode string
+
+const (
+	GenerationModeAI        GenerationMode = "ai"
+	GenerationModeSlideshow GenerationMode = "slideshow"
+	GenerationModeEdit      GenerationMode = "edit"
+	GenerationModeExtend    GenerationMode = "extend"
+)
+
+type Render struct {
+	ID              string           `json:"id" db:"id"`
+	ProjectID       string           `json:"project_id" db:"project_id"`
+	UserID          string           `json:"user_id" db:"user_id"`
+	Mode            GenerationMode   `json:"mode" db:"mode"`
+	Status          ProjectStatus    `json:"status" db:"status"`
+	Format          VideoFormat      `json:"format" db:"format"`
+	DurationSeconds int              `json:"duration_seconds" db:"duration_seconds"`
+	CreditsCharged  int              `json:"credits_charged" db:"credits_charged"`
+	Options         json.RawMessage  `json:"options,omitempty" db:"options"`
+	ParentRenderID  *string          `json:"parent_render_id,omitempty" db:"parent_render_id"`
+	Timeline        *json.RawMessage `json:"-" db:"timeline"`
+	VideoURL        *string          `json:"video_url,omitempty" db:"video_url"`
+	ThumbnailURL    *string          `json:"thumbnail_url,omitempty" db:"thumbnail_url"`
+	ErrorMessage    *string          `json:"error_message,omitempty" db:"error_message"`
+	CreatedAt       time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at" db:"updated_at"`
+	CompletedAt     *time.Time       `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+type RenderSegment struct {
+	ID               string    `json:"id" db:"id"`
+	RenderID         string    `json:"render_id" db:"render_id"`
+	SceneID          *string   `json:"scene_id,omitempty" db:"scene_id"`
+	StylePreset      *string   `json:"style_preset,omitempty" db:"style_preset"`
+	PromptTemplateID *string   `json:"prompt_template_id,omitempty" db:"prompt_template_id"`
+	Position         int       `json:"position" db:"position"`
+	Prompt           *string   `json:"prompt,omitempty" db:"prompt"`
+	ExternalTaskID   *string   `json:"external_task_id,omitempty" db:"external_task_id"`
+	VideoURL         *string   `json:"video_url,omitempty" db:"video_url"`
+	DurationSeconds  *float64  `json:"duration_seconds,omitempty" db:"duration_seconds"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+type StoryboardScene struct {
+	ID              string    `json:"id" db:"id"`
+	ProjectID       string    `json:"project_id" db:"project_id"`
+	Position        int       `json:"position" db:"position"`
+	Role            string    `json:"role" db:"role"`
+	Script          string    `json:"script" db:"script"`
+	VisualPrompt    *string   `json:"visual_prompt,omitempty" db:"visual_prompt"`
+	SpeechSeconds   float64   `json:"speech_seconds" db:"speech_seconds"`
+	DurationSeconds int       `json:"duration_seconds" db:"duration_seconds"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type BuildStoryboardRequest struct {
+	Script        string `json:"script,omitempty" validate:"max=5000"`
+	Language      string `json:"language,omitempty" validate:"omitempty,len=2"`
+	VideoDuration int    `json:"video_duration,omitempty" validate:"omitempty,oneof=5 10 30"`
+}
+
+type UpdateSceneRequest struct {
+	Role            *string `json:"role,omitempty" validate:"omitempty,oneof=hook problem demo cta"`
+	Script          *string `json:"script,omitempty"`
+	VisualPrompt    *string `json:"visual_prompt,omitempty" validate:"omitempty,max=2000"`
+	DurationSeconds *int    `json:"duration_seconds,omitempty" validate:"omitempty,oneof=5 10"`
+}
+
+type ClipSource string
+
+const (
+	ClipSourceSegment ClipSource = "segment"
+	ClipSourceIntro   ClipSource = "intro"
+	ClipSourceOutro   ClipSource = "outro"
+)
+
+// TimelineClip is one cut of a render timeline. Segment clips reference a
+// render segment; intro and outro clips reference an uploaded asset.
+type TimelineClip struct {
+	ID        string     `json:"id"`
+	Source    ClipSource `json:"source"`
+	SegmentID *string    `json:"segment_id,omitempty"`
+	AssetURL  *string    `json:"asset_url,omitempty"`
+	InPoint   float64    `json:"in_point"`
+	OutPoint  float64    `json:"out_point"`
+}
+
+type Timeline struct {
+	RenderID string         `json:"render_id"`
+	Clips    []TimelineClip `json:"clips"`
+	Duration float64        `json:"duration"`
+}
+
+type TrimClipRequest struct {
+	InPoint  float64 `json:"in_point"`
+	OutPoint float64 `json:"out_point"`
+}
+
+type ReorderClipsRequest struct {
+	ClipIDs []string `json:"clip_ids"`
+}
+
+type InsertClipRequest struct {
+	Position  *int       `json:"position,omitempty"`
+	Source    ClipSource `json:"source"`
+	SegmentID *string    `json:"segment_id,omitempty"`
+	AssetURL  *string    `json:"asset_url,omitempty"`
+	InPoint   float64    `json:"in_point"`
+	OutPoint  float64    `json:"out_point"`
 }
 
 type Avatar struct {
@@ -81,6 +222,164 @@ type Avatar struct {
 	UsageCount      int      `json:"usage_count" db:"usage_count"`
 }
 
+type AssetType string
+
+const (
+	AssetTypeImage    AssetType = "image"
+	AssetTypeVideo    AssetType = "video"
+	AssetTypeAudio    AssetType = "audio"
+	AssetTypeDocument AssetType = "document"
+)
+
+type AssetPurpose string
+
+const (
+	AssetPurposeProductImage   AssetPurpose = "product_image"
+	AssetPurposeProductVideo   AssetPurpose = "product_video"
+	AssetPurposeGeneratedVideo AssetPurpose = "generated_video"
+	AssetPurposeThumbnail      AssetPurpose = "thumbnail"
+	AssetPurposeMusic          AssetPurpose = "background_music"
+	AssetPurposeVoiceover      AssetPurpose = "voiceover"
+	AssetPurposeOther          AssetPurpose = "other"
+)
+
+type Asset struct {
+	ID               string       `json:"id" db:"id"`
+	ProjectID        *string      `json:"project_id,omitempty" db:"project_id"`
+	RenderID         *string      `json:"render_id,omitempty" db:"render_id"`
+	UserID           string       `json:"user_id" db:"user_id"`
+	Type             AssetType    `json:"type" db:"type"`
+	Purpose          AssetPurpose `json:"purpose" db:"purpose"`
+	Filename         string       `json:"filename" db:"filename"`
+	OriginalFilename *string      `json:"original_filename,omitempty" db:"original_filename"`
+	URL              string       `json:"url" db:"url"`
+	ThumbnailURL     *string      `json:"thumbnail_url,omitempty" db:"thumbnail_url"`
+	StorageKey       *string      `json:"-" db:"storage_key"`
+	ChecksumSHA256   *string      `json:"checksum_sha256,omitempty" db:"checksum_sha256"`
+	BlobSHA256       *string      `json:"-" db:"blob_sha256"`
+	SourceURL        *string      `json:"source_url,omitempty" db:"source_url"`
+	FileSizeBytes    *int64       `json:"file_size_bytes,omitempty" db:"file_size_bytes"`
+	MimeType         *string      `json:"mime_type,omitempty" db:"mime_type"`
+	Width            *int         `json:"width,omitempty" db:"width"`
+	Height           *int         `json:"height,omitempty" db:"height"`
+	DurationSeconds  *float64     `json:"duration_seconds,omitempty" db:"duration_seconds"`
+	AltText          *string      `json:"alt_text,omitempty" db:"alt_text"`
+	IsPrimary        bool         `json:"is_primary" db:"is_primary"`
+	CreatedAt        time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at" db:"updated_at"`
+
+	Variants []AssetVariant `json:"variants,omitempty" db:"-"`
+}
+
+// AssetVariant is an image asset padded or cropped to a video format.
+type AssetVariant struct {
+	ID            string      `json:"id" db:"id"`
+	AssetID       string      `json:"asset_id" db:"asset_id"`
+	Format        VideoFormat `json:"format" db:"format"`
+	Fit           string      `json:"fit" db:"fit"`
+	URL           string      `json:"url" db:"url"`
+	StorageKey    string      `json:"-" db:"storage_key"`
+	Width         int         `json:"width" db:"width"`
+	Height        int         `json:"height" db:"height"`
+	FileSizeBytes *int64      `json:"file_size_bytes,omitempty" db:"file_size_bytes"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+}
+
+// AssetBlob is a stored upload shared by all of a user's assets with the
+// same content. RefCount is kept by the database as assets come and go.
+type AssetBlob struct {
+	UserID     string    `json:"-" db:"user_id"`
+	SHA256     string    `json:"sha256" db:"sha256"`
+	StorageKey string    `json:"-" db:"storage_key"`
+	SizeBytes  int64     `json:"size_bytes" db:"size_bytes"`
+	RefCount   int       `json:"ref_count" db:"ref_count"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type UploadStatus string
+
+const (
+	UploadStatusUploading  UploadStatus = "uploading"
+	UploadStatusProcessing UploadStatus = "processing"
+	UploadStatusCompleted  UploadStatus = "completed"
+	UploadStatusFailed     UploadStatus = "failed"
+)
+
+// UploadSession is a resumable upload in progress. Once every byte has
+// arrived the chunks are joined into AssetID.
+type UploadSession struct {
+	ID           string       `json:"id" db:"id"`
+	UserID       string       `json:"user_id" db:"user_id"`
+	ProjectID    *string      `json:"project_id,omitempty" db:"project_id"`
+	Purpose      AssetPurpose `json:"purpose" db:"purpose"`
+	Filename     string       `json:"filename" db:"filename"`
+	UploadLength int64        `json:"upload_length" db:"upload_length"`
+	UploadOffset int64        `json:"upload_offset" db:"upload_offset"`
+	Status       UploadStatus `json:"status" db:"status"`
+	AssetID      *string      `json:"asset_id,omitempty" db:"asset_id"`
+	Error        *string      `json:"error,omitempty" db:"error"`
+	ExpiresAt    time.Time    `json:"expires_at" db:"expires_at"`
+	CreatedAt    time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at" db:"updated_at"`
+
+	Asset *Asset `json:"asset,omitempty" db:"-"`
+}
+
+// UploadChunk is one PATCH of an upload session, stored as its own object.
+type UploadChunk struct {
+	SessionID  string `db:"session_id"`
+	Offset     int64  `db:"chunk_offset"`
+	Size       int64  `db:"size"`
+	StorageKey string `db:"storage_key"`
+}
+
+// StorageUsage is a user's stored bytes against their tier's quota. Zero
+// QuotaBytes or RetentionDays means unlimited.
+type StorageUsage struct {
+	Tier          string `json:"tier"`
+	UsedBytes     int64  `json:"used_bytes"`
+	QuotaBytes    int64  `json:"quota_bytes"`
+	RetentionDays int    `json:"retention_days"`
+}
+
+// AssetListFilter narrows an asset listing. Empty fields match everything.
+type AssetListFilter struct {
+	Purpose   AssetPurpose
+	ProjectID string
+}
+
+type UploadAssetRequest struct {
+	Purpose   AssetPurpose
+	ProjectID *string
+	AltText   *string
+	IsPrimary bool
+}
+
+type UpdateAssetRequest struct {
+	AltText   *string `json:"alt_text,omitempty" validate:"omitempty,max=500"`
+	IsPrimary *bool   `json:"is_primary,omitempty"`
+}
+
+type StylePreset struct {
+	ID          string  `json:"id" db:"id"`
+	Slug        string  `json:"slug" db:"slug"`
+	Name        string  `json:"name" db:"name"`
+	Description *string `json:"description,omitempty" db:"description"`
+	Camera      string  `json:"camera" db:"camera"`
+	Lighting    string  `json:"lighting" db:"lighting"`
+	Setting     string  `json:"setting" db:"setting"`
+	Mood        string  `json:"mood" db:"mood"`
+	IsDefault   bool    `json:"is_default" db:"is_default"`
+}
+
+type PromptTemplate struct {
+	ID   string  `json:"id" db:"id"`
+	Name string  `json:"name" db:"name"`
+	Role *string `json:"role,omitempty" db:"role"`
+	Body string  `json:"body" db:"body"`
+}
+
 type ScriptTemplate struct {
 	ID         string `json:"id" db:"id"`
 	Name       string `json:"name" db:"name"`
@@ -95,11 +394,355 @@ type RegisterRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
 	FullName string `json:"full_name,omitempty"`
+	// CaptchaToken is required after several sign-ups from one address.
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	// CaptchaToken is required after repeated failed sign-ins.
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+// OAuthIdentity links an account at an external identity provider to a
+// profile.
+type OAuthIdentity struct {
+	Provider    string     `json:"provider" db:"provider"`
+	Subject     string     `json:"-" db:"subject"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	Email       *string    `json:"email,omitempty" db:"email"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
+
+// ChangePasswordRequest sets the signed-in user's password. The current
+// password is required unless the account has none yet.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password,omitempty"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+// AccountTokenPurpose is what an emailed account link does.
+type AccountTokenPurpose string
+
+const (
+	AccountTokenVerifyEmail   AccountTokenPurpose = "verify_email"
+	AccountTokenResetPassword AccountTokenPurpose = "reset_password"
+)
+
+// AccountToken is a single-use link sent by email. Only the SHA-256 of the
+// token is stored.
+type AccountToken struct {
+	ID        string              `json:"id" db:"id"`
+	UserID    string              `json:"user_id" db:"user_id"`
+	Purpose   AccountTokenPurpose `json:"purpose" db:"purpose"`
+	TokenHash string              `json:"-" db:"token_hash"`
+	Email     string              `json:"email" db:"email"`
+	ExpiresAt time.Time           `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time          `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time           `json:"created_at" db:"created_at"`
+}
+
+// ForgotPasswordRequest asks for a password reset link.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest sets a new password with the token from a reset link.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+// VerifyEmailRequest confirms an email address with the token from a
+// verification link.
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// Reasons a session was revoked.
+const (
+	SessionRevokedLogout         = "logout"
+	SessionRevokedLogoutAll      = "logout_all"
+	SessionRevokedTokenReuse     = "token_reuse"
+	SessionRevokedPasswordChange = "password_change"
+	SessionRevokedPasswordReset  = "password_reset"
+	SessionRevokedByUser         = "revoked"
+	SessionRevokedRoleChange     = "role_change"
+	SessionRevokedDisabled       = "account_disabled"
+	SessionRevokedEmailClaimed   = "email_claimed" // signed in with a provider that verified the email
+)
+
+// ClientInfo identifies the device a request came from.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// AuthSession is one sign-in on one device.
+type AuthSession struct {
+	ID            string     `json:"id" db:"id"`
+	UserID        string     `json:"user_id" db:"user_id"`
+	IPAddress     *string    `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent     *string    `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedReason *string    `json:"revoked_reason,omitempty" db:"revoked_reason"`
+}
+
+// DeviceSession is a signed-in session as listed to its user. Current
+// marks the session of the request.
+type DeviceSession struct {
+	AuthSession
+	Current bool `json:"current"`
+}
+
+// Usage log events recorded by the backend.
+const (
+	UsageEventLoginLocked    = "login_locked"
+	UsageEventCreditAdjusted = "credit_adjusted"
+)
+
+// UsageLog is an entry of the account activity and audit log.
+type UsageLog struct {
+	ID          string          `json:"id" db:"id"`
+	UserID      *string         `json:"user_id,omitempty" db:"user_id"`
+	ProjectID   *string         `json:"project_id,omitempty" db:"project_id"`
+	Event       string          `json:"event" db:"event"`
+	Description *string         `json:"description,omitempty" db:"description"`
+	Metadata    json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+	IPAddress   *string         `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent   *string         `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+// RefreshToken is a stored refresh token. ID is the token's jti.
+type RefreshToken struct {
+	ID        string     `json:"id" db:"id"`
+	SessionID string     `json:"session_id" db:"session_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TOTPFactor is a user's authenticator app. It protects sign-in once
+// ConfirmedAt is set.
+type TOTPFactor struct {
+	UserID       string     `db:"user_id"`
+	Secret       []byte     `db:"secret"` // encrypted base32 secret
+	ConfirmedAt  *time.Time `db:"confirmed_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+// MFAChallenge is the second step of a sign-in, issued once the password
+// or Google step succeeded. Only the SHA-256 of the token is stored.
+type MFAChallenge struct {
+	ID        string     `db:"id"`
+	UserID    string     `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	Attempts  int        `db:"attempts"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// MFAChallengeResponse replaces the AuthResponse of a sign-in that needs a
+// second factor. MFAToken and a code are exchanged at /auth/mfa/verify.
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	ExpiresIn   int64    `json:"expires_in"`
+	Methods     []string `json:"methods"`
+}
+
+// MFAVerifyRequest finishes a sign-in with a TOTP or recovery code.
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// MFAStatus describes the signed-in user's two-factor authentication.
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// TOTPEnrollment is a new authenticator secret, shown once as a QR code of
+// OTPAuthURL or typed in as Secret.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// MFAReauthRequest proves the user is present before MFA changes. Password
+// is required for accounts that have one; Code, when MFA is enabled, is a
+// TOTP or recovery code.
+type MFAReauthRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// MFACodeRequest confirms a new authenticator with its first code.
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// RecoveryCodesResponse shows newly generated recovery codes, once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// API key scopes. Keys can reach every endpoint except account and key
+// management, which need a signed-in session.
+const (
+	APIKeyScopeRead     = "read"     // GET endpoints
+	APIKeyScopeWrite    = "write"    // creating, editing and deleting
+	APIKeyScopeGenerate = "generate" // starting renders, which spends credits
+)
+
+// APIKeyScopes lists the valid scopes.
+var APIKeyScopes = []string{APIKeyScopeRead, APIKeyScopeWrite, APIKeyScopeGenerate}
+
+// APIKeyPrefix starts every API key, so keys are recognizable in headers
+// and secret scanners.
+const APIKeyPrefix = "gv_"
+
+// APIKey grants programmatic access as its owner. Only the SHA-256 of the
+// key is stored; KeyPrefix, its first characters, identifies it in lists.
+type APIKey struct {
+	ID         string         `json:"id" db:"id"`
+	UserID     string         `json:"user_id" db:"user_id"`
+	Name       string         `json:"name" db:"name"`
+	KeyHash    string         `json:"-" db:"key_hash"`
+	KeyPrefix  string         `json:"key_prefix" db:"key_prefix"`
+	Scopes     pq.StringArray `json:"scopes" db:"scopes"`
+	RateLimit  int            `json:"rate_limit" db:"rate_limit"`
+	IsActive   bool           `json:"is_active" db:"is_active"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
+
+// HasScope reports whether the key grants scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest creates an API key. Scopes default to read and write;
+// rate_limit defaults to RATE_LIMIT_REQUESTS per RATE_LIMIT_WINDOW.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	RateLimit int        `json:"rate_limit,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey is returned once, when the key is created; Key is the only
+// copy of the plaintext key.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// JWTSigningKey is an asymmetric key that signs tokens. It signs from
+// ActivatesAt until RetiresAt and verifies until ExpiresAt.
+type JWTSigningKey struct {
+	KID         string    `db:"kid"`
+	Algorithm   string    `db:"algorithm"`
+	PrivateKey  []byte    `db:"private_key"` // encrypted PKCS#8
+	PublicKey   []byte    `db:"public_key"`  // PKIX
+	ActivatesAt time.Time `db:"activates_at"`
+	RetiresAt   time.Time `db:"retires_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Actions recorded in the admin audit log.
+const (
+	AdminActionAdjustCredits = "credits.adjust"
+	AdminActionChangeTier    = "tier.change"
+	AdminActionChangeRole    = "role.change"
+	AdminActionDisable       = "account.disable"
+	AdminActionEnable        = "account.enable"
+	AdminActionRequeue       = "project.requeue"
+	AdminActionFail          = "project.fail"
+	// Staff reads of account data are recorded too.
+	AdminActionSearchUsers  = "user.search"
+	AdminActionViewUser     = "user.view"
+	AdminActionViewProjects = "user.projects"
+	AdminActionViewUsage    = "user.usage"
+	AdminActionViewStuck    = "projects.stuck"
+)
+
+// AdminAuditEntry records a change made, or account data read, through the
+// admin API.
+type AdminAuditEntry struct {
+	ID              string          `json:"id" db:"id"`
+	ActorID         *string         `json:"actor_id,omitempty" db:"actor_id"`
+	Action          string          `json:"action" db:"action"`
+	TargetUserID    *string         `json:"target_user_id,omitempty" db:"target_user_id"`
+	TargetProjectID *string         `json:"target_project_id,omitempty" db:"target_project_id"`
+	Reason          string          `json:"reason" db:"reason"`
+	Metadata        json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+	IPAddress       *string         `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent       *string         `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AdminUserFilter narrows a user search. Empty fields match everything;
+// Query matches an exact ID or part of the email or name.
+type AdminUserFilter struct {
+	Query    string
+	Role     string
+	Tier     string
+	Disabled *bool
+}
+
+// AdminAuditFilter narrows the audit log. Empty fields match everything.
+type AdminAuditFilter struct {
+	ActorID      string
+	TargetUserID string
+	Action       string
+}
+
+// AdminUser is an account as staff see it.
+type AdminUser struct {
+	Profile
+	MFAEnabled     bool          `json:"mfa_enabled"`
+	ActiveSessions int           `json:"active_sessions"`
+	Storage        *StorageUsage `json:"storage"`
+}
+
+type AdminCreditsRequest struct {
+	// Amount is added to the balance; negative amounts remove credits.
+	Amount int    `json:"amount" validate:"required"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type AdminTierRequest struct {
+	Tier   string `json:"tier" validate:"required"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type AdminRoleRequest struct {
+	Role   string `json:"role" validate:"required,oneof=user support admin"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// AdminReasonRequest is the body of admin actions that only need a reason.
+type AdminReasonRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
 }
 
 type AuthResponse struct {
@@ -111,17 +754,53 @@ type AuthResponse struct {
 }
 
 type CreateProjectRequest struct {
-	ProductName        string  `json:"product_name" validate:"required"`
+	ProductName        string  `json:"product_name" validate:"required_without=ProductURL"`
 	ProductDescription *string `json:"product_description,omitempty"`
 	ProductURL         *string `json:"product_url,omitempty"`
-	ProductImageURL    *string `json:"product_image_url,omitempty"`
+	ProductImageID     *string `json:"product_image_asset_id,omitempty"`
+	// Deprecated: use ProductImageID. Still accepted for uploaded images.
+	ProductImageURL *string `json:"product_image_url,omitempty"`
+}
+
+// ProductPageInfo is what a product page says about its product, shaped
+// like the project fields it fills.
+type ProductPageInfo struct {
+	ProductURL         string   `json:"product_url"`
+	ProductName        string   `json:"product_name"`
+	ProductDescription string   `json:"product_description,omitempty"`
+	Brand              string   `json:"brand,omitempty"`
+	Price              string   `json:"price,omitempty"`
+	Currency           string   `json:"currency,omitempty"`
+	Images             []string `json:"images"`
+	// ProductImage is the main image, imported as a product_image asset.
+	ProductImage *Asset `json:"product_image,omitempty"`
+}
+
+type ParseProductURLRequest struct {
+	URL string `json:"url" validate:"required,url"`
 }
 
 type GenerateVideoRequest struct {
-	Script        string `json:"script" validate:"required,min=10,max=5000"`
-	Language      string `json:"language" validate:"required,len=2"`
-	Format        string `json:"format" validate:"required,oneof=9:16 1:1 16:9"`
-	VideoDuration int    `json:"video_duration" validate:"oneof=5 10 30"`
+	Script        string            `json:"script" validate:"required,min=10,max=5000"`
+	Language      string            `json:"language" validate:"required,len=2"`
+	Format        string            `json:"format" validate:"required,oneof=9:16 1:1 16:9"`
+	VideoDuration int               `json:"video_duration" validate:"oneof=5 10 30"`
+	Mode          string            `json:"mode,omitempty" validate:"omitempty,oneof=ai slideshow"`
+	AvatarID      *string           `json:"avatar_id,omitempty" validate:"omitempty,uuid"`
+	StylePreset   string            `json:"style_preset,omitempty"`
+	Slideshow     *SlideshowOptions `json:"slideshow,omitempty"`
+}
+
+type ExtendVideoRequest struct {
+	Seconds int    `json:"seconds" validate:"required,min=1,max=30"`
+	Prompt  string `json:"prompt,omitempty" validate:"max=2000"`
+}
+
+type SlideshowOptions struct {
+	ImageURLs  []string `json:"image_urls,omitempty" validate:"max=20"`
+	Captions   []string `json:"captions,omitempty"`
+	Transition string   `json:"transition,omitempty"`
+	MusicTrack string   `json:"music_track,omitempty"`
 }
 
 type APIResponse struct {
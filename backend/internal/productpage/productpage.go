@@ -0,0 +1,648 @@
+// Package productpage reads product details from a shop's product page.
+//
+// Extract works on HTML that has already been fetched, so it can be run
+// against saved pages. Sources are tried from most to least structured:
+// JSON-LD Product data, Shopify's embedded product JSON, Amazon's page
+// markup, OpenGraph tags and finally the document title.
+package productpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoProduct is returned when a page has no recognizable product name.
+var ErrNoProduct = errors.New("no product found on page")
+
+const (
+	maxDescription = 2000
+	maxImages      = 10
+)
+
+// Product holds what a page says about its product. Empty fields were not
+// found.
+type Product struct {
+	Name        string
+	Description string
+	Brand       string
+	Price       string
+	Currency    string
+	// Images are absolute http(s) URLs, best first.
+	Images []string
+}
+
+// Extract parses a product page. pageURL is the URL the page was served
+// from and resolves relative image links.
+func Extract(pageURL *url.URL, body []byte) (*Product, error) {
+	doc, err := xhtml.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &page{base: pageURL, meta: map[string][]string{}}
+	p.walk(doc)
+	if p.baseHref != "" {
+		if base, err := pageURL.Parse(p.baseHref); err == nil {
+			p.base = base
+		}
+	}
+
+	product := &Product{}
+	for _, candidate := range []*Product{p.jsonLD, p.shopify, p.amazon, p.openGraph(), p.fallback()} {
+		product.merge(candidate)
+	}
+
+	product.Name = clean(product.Name)
+	product.Description = truncate(clean(product.Description), maxDescription)
+	product.Brand = clean(product.Brand)
+	product.Currency = strings.ToUpper(strings.TrimSpace(product.Currency))
+	product.Images = p.resolve(product.Images)
+
+	if product.Name == "" {
+		return nil, ErrNoProduct
+	}
+	return product, nil
+}
+
+// merge fills empty fields from other and appends its images.
+func (p *Product) merge(other *Product) {
+	if other == nil {
+		return
+	}
+	if p.Name == "" {
+		p.Name = other.Name
+	}
+	if p.Description == "" {
+		p.Description = other.Description
+	}
+	if p.Brand == "" {
+		p.Brand = other.Brand
+	}
+	// A price is only useful with its currency, so they are taken together
+	// unless the first source had no currency at all.
+	if p.Price == "" {
+		p.Price = other.Price
+		if p.Currency == "" {
+			p.Currency = other.Currency
+		}
+	} else if p.Currency == "" && other.Price == p.Price {
+		p.Currency = other.Currency
+	}
+	p.Images = append(p.Images, other.Images...)
+}
+
+type page struct {
+	base     *url.URL
+	baseHref string
+	title    string
+	meta     map[string][]string
+
+	jsonLD  *Product
+	shopify *Product
+	amazon  *Product
+}
+
+func (p *page) walk(n *xhtml.Node) {
+	if n.Type == xhtml.ElementNode {
+		switch n.DataAtom {
+		case atom.Base:
+			if p.baseHref == "" {
+				p.baseHref = attr(n, "href")
+			}
+		case atom.Title:
+			if p.title == "" {
+				p.title = text(n)
+			}
+		case atom.Meta:
+			key := strings.ToLower(attr(n, "property"))
+			if key == "" {
+				key = strings.ToLower(attr(n, "name"))
+			}
+			if key == "" {
+				key = strings.ToLower(attr(n, "itemprop"))
+			}
+			if content := attr(n, "content"); key != "" && content != "" {
+				p.meta[key] = append(p.meta[key], content)
+			}
+		case atom.Script:
+			p.script(n)
+		}
+		p.amazonNode(n)
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.walk(c)
+	}
+}
+
+func (p *page) script(n *xhtml.Node) {
+	body := strings.TrimSpace(text(n))
+	if body == "" {
+		return
+	}
+
+	typ := strings.ToLower(attr(n, "type"))
+	switch {
+	case typ == "application/ld+json":
+		if p.jsonLD != nil {
+			return
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(body), &v); err != nil {
+			return
+		}
+		if obj := findLDProduct(v); obj != nil {
+			p.jsonLD = ldProduct(obj)
+		}
+
+	case typ == "application/json" && p.shopify == nil &&
+		(strings.HasPrefix(attr(n, "id"), "ProductJson") || hasAttr(n, "data-product-json")):
+		var sp shopifyProduct
+		if err := json.Unmarshal([]byte(body), &sp); err == nil && sp.Title != "" {
+			p.shopify = sp.product()
+		}
+	}
+}
+
+// JSON-LD
+
+func findLDProduct(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if obj := findLDProduct(item); obj != nil {
+				return obj
+			}
+		}
+	case map[string]interface{}:
+		if ldIsType(v["@type"], "Product") || ldIsType(v["@type"], "ProductGroup") {
+			return v
+		}
+		if obj := findLDProduct(v["@graph"]); obj != nil {
+			return obj
+		}
+		if obj := findLDProduct(v["mainEntity"]); obj != nil {
+			return obj
+		}
+	}
+	return nil
+}
+
+func ldIsType(v interface{}, want string) bool {
+	switch v := v.(type) {
+	case string:
+		return strings.EqualFold(strings.TrimPrefix(v, "http://schema.org/"), want) ||
+			strings.EqualFold(strings.TrimPrefix(v, "https://schema.org/"), want)
+	case []interface{}:
+		for _, item := range v {
+			if ldIsType(item, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ldProduct(obj map[string]interface{}) *Product {
+	product := &Product{
+		Name:        ldString(obj["name"]),
+		Description: stripTags(ldString(obj["description"])),
+		Brand:       ldString(obj["brand"]),
+		Images:      ldImages(obj["image"]),
+	}
+
+	offers := obj["offers"]
+	if offers == nil {
+		// Product groups keep offers on their variants.
+		if variants, ok := obj["hasVariant"].([]interface{}); ok && len(variants) > 0 {
+			if first, ok := variants[0].(map[string]interface{}); ok {
+				offers = first["offers"]
+				product.Images = append(product.Images, ldImages(first["image"])...)
+			}
+		}
+	}
+	product.Price, product.Currency = ldOffer(offers)
+	return product
+}
+
+// ldString reads a text value, or the name of an object such as a Brand.
+func ldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return html.UnescapeString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		return ldString(v["name"])
+	case []interface{}:
+		if len(v) > 0 {
+			return ldString(v[0])
+		}
+	}
+	return ""
+}
+
+func ldImages(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case map[string]interface{}:
+		if u := ldString(v["url"]); u != "" {
+			return []string{u}
+		}
+		return ldImages(v["contentUrl"])
+	case []interface{}:
+		var images []string
+		for _, item := range v {
+			images = append(images, ldImages(item)...)
+		}
+		return images
+	}
+	return nil
+}
+
+func ldOffer(v interface{}) (string, string) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if price, currency := ldOffer(item); price != "" {
+				return price, currency
+			}
+		}
+	case map[string]interface{}:
+		currency := ldString(v["priceCurrency"])
+		for _, key := range []string{"price", "lowPrice"} {
+			if price := normalizePrice(ldString(v[key])); price != "" {
+				return price, currency
+			}
+		}
+		if spec, ok := v["priceSpecification"]; ok {
+			price, specCurrency := ldOffer(spec)
+			if specCurrency == "" {
+				specCurrency = currency
+			}
+			return price, specCurrency
+		}
+		if offers, ok := v["offers"]; ok {
+			return ldOffer(offers)
+		}
+	}
+	return "", ""
+}
+
+// Shopify
+
+// shopifyProduct is the product JSON Shopify themes embed in
+// <script id="ProductJson-..."> or <script data-product-json>.
+type shopifyProduct struct {
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Vendor      string           `json:"vendor"`
+	Price       json.Number      `json:"price"`
+	Images      []string         `json:"images"`
+	Media       []shopifyMedia   `json:"media"`
+	Variants    []shopifyVariant `json:"variants"`
+}
+
+type shopifyMedia struct {
+	Src string `json:"src"`
+}
+
+type shopifyVariant struct {
+	Price json.Number `json:"price"`
+}
+
+func (sp *shopifyProduct) product() *Product {
+	product := &Product{
+		Name:        sp.Title,
+		Description: stripTags(sp.Description),
+		Brand:       sp.Vendor,
+		Images:      sp.Images,
+	}
+	for _, m := range sp.Media {
+		product.Images = append(product.Images, m.Src)
+	}
+
+	// Shopify prices are integers in the shop currency's minor unit. The
+	// currency itself is not in this JSON; OpenGraph supplies it.
+	price := sp.Price
+	if price == "" && len(sp.Variants) > 0 {
+		price = sp.Variants[0].Price
+	}
+	if cents, err := price.Int64(); err == nil {
+		product.Price = strconv.FormatFloat(float64(cents)/100, 'f', 2, 64)
+	}
+	return product
+}
+
+// Amazon
+
+var amazonPriceIDs = map[string]bool{
+	"priceblock_ourprice":  true,
+	"priceblock_dealprice": true,
+	"priceblock_saleprice": true,
+	"price_inside_buybox":  true,
+	"kindle-price":         true,
+}
+
+func (p *page) amazonNode(n *xhtml.Node) {
+	id := attr(n, "id")
+	switch {
+	case id == "productTitle":
+		p.amazonProduct().Name = text(n)
+
+	case id == "landingImage" || id == "imgBlkFront":
+		a := p.amazonProduct()
+		if hires := attr(n, "data-old-hires"); hires != "" {
+			a.Images = append(a.Images, hires)
+		}
+		a.Images = append(a.Images, dynamicImages(attr(n, "data-a-dynamic-image"))...)
+		if src := attr(n, "src"); src != "" && !strings.HasPrefix(src, "data:") {
+			a.Images = append(a.Images, src)
+		}
+
+	case id == "feature-bullets" || id == "productDescription":
+		a := p.amazonProduct()
+		if a.Description == "" {
+			a.Description = text(n)
+		}
+
+	case id == "bylineInfo":
+		brand := strings.TrimPrefix(strings.TrimPrefix(text(n), "Brand: "), "Visit the ")
+		p.amazonProduct().Brand = strings.TrimSuffix(brand, " Store")
+
+	case amazonPriceIDs[id]:
+		p.amazonPrice(text(n))
+
+	case n.DataAtom == atom.Span && hasClass(n, "a-offscreen") && p.amazon != nil && p.amazon.Price == "":
+		// The first off-screen price after the title is the buy box price.
+		if p.amazon.Name != "" {
+			p.amazonPrice(text(n))
+		}
+	}
+}
+
+func (p *page) amazonProduct() *Product {
+	if p.amazon == nil {
+		p.amazon = &Product{}
+	}
+	return p.amazon
+}
+
+func (p *page) amazonPrice(s string) {
+	a := p.amazonProduct()
+	if a.Price != "" {
+		return
+	}
+	if price := normalizePrice(s); price != "" {
+		a.Price, a.Currency = price, currencyFromSymbol(s)
+	}
+}
+
+// dynamicImages reads Amazon's {"url": [width, height], ...} map, largest
+// first.
+func dynamicImages(s string) []string {
+	var sizes map[string][]int
+	if s == "" || json.Unmarshal([]byte(s), &sizes) != nil {
+		return nil
+	}
+
+	images := make([]string, 0, len(sizes))
+	for u := range sizes {
+		images = append(images, u)
+	}
+	area := func(u string) int {
+		if d := sizes[u]; len(d) == 2 {
+			return d[0] * d[1]
+		}
+		return 0
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if area(images[i]) != area(images[j]) {
+			return area(images[i]) > area(images[j])
+		}
+		return images[i] < images[j]
+	})
+	return images
+}
+
+// OpenGraph and fallbacks
+
+func (p *page) openGraph() *Product {
+	product := &Product{
+		Name:        p.first("og:title", "twitter:title"),
+		Description: p.first("og:description", "twitter:description"),
+		Brand:       p.first("product:brand", "og:brand"),
+	}
+	for _, key := range []string{"og:image:secure_url", "og:image", "og:image:url", "twitter:image"} {
+		product.Images = append(product.Images, p.meta[key]...)
+	}
+	for _, prefix := range []string{"product:price", "og:price"} {
+		if price := normalizePrice(p.first(prefix + ":amount")); price != "" {
+			product.Price, product.Currency = price, p.first(prefix+":currency")
+			break
+		}
+	}
+	if product.Price == "" {
+		// Microdata, e.g. <meta itemprop="price">.
+		product.Price = normalizePrice(p.first("price"))
+		product.Currency = p.first("pricecurrency")
+	}
+	return product
+}
+
+func (p *page) fallback() *Product {
+	return &Product{
+		Name:        p.title,
+		Description: p.first("description"),
+	}
+}
+
+func (p *page) first(keys ...string) string {
+	for _, key := range keys {
+		for _, v := range p.meta[key] {
+			if v = strings.TrimSpace(v); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// resolve makes image links absolute, drops anything that is not http(s)
+// and removes duplicates.
+func (p *page) resolve(images []string) []string {
+	seen := map[string]bool{}
+	var resolved []string
+	for _, raw := range images {
+		raw = strings.TrimSpace(html.UnescapeString(raw))
+		if raw == "" {
+			continue
+		}
+		u, err := p.base.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		s := u.String()
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		resolved = append(resolved, s)
+		if len(resolved) == maxImages {
+			break
+		}
+	}
+	return resolved
+}
+
+// Helpers
+
+var (
+	priceNumber = regexp.MustCompile(`\d[\d.,\s]*`)
+	spaces      = regexp.MustCompile(`\s+`)
+)
+
+// normalizePrice turns "1.299,00 €", "$1,299.00" or "1299" into "1299.00"
+// style decimals. It returns "" when there is no number.
+func normalizePrice(s string) string {
+	num := strings.ReplaceAll(priceNumber.FindString(s), " ", "")
+	num = strings.TrimRight(num, ".,")
+	if num == "" {
+		return ""
+	}
+
+	// The last separator followed by exactly one or two digits is the
+	// decimal point; every other separator groups thousands.
+	decimal := -1
+	if i := strings.LastIndexAny(num, ".,"); i >= 0 && len(num)-i-1 <= 2 {
+		decimal = i
+	}
+
+	var b strings.Builder
+	for i, r := range num {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case i == decimal:
+			b.WriteByte('.')
+		}
+	}
+	if _, err := strconv.ParseFloat(b.String(), 64); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+var currencySymbols = []struct{ symbol, code string }{
+	{"US$", "USD"},
+	{"CA$", "CAD"},
+	{"A$", "AUD"},
+	{"R$", "BRL"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+	{"¥", "JPY"},
+	{"₹", "INR"},
+	{"$", "USD"},
+}
+
+func currencyFromSymbol(s string) string {
+	for _, c := range currencySymbols {
+		if strings.Contains(s, c.symbol) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// stripTags returns the text of an HTML fragment.
+func stripTags(s string) string {
+	if !strings.Contains(s, "<") {
+		return s
+	}
+
+	var b strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(s))
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return b.String()
+		case xhtml.TextToken:
+			b.Write(z.Text())
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			b.WriteByte(' ')
+		}
+	}
+}
+
+func clean(s string) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
+
+func text(n *xhtml.Node) string {
+	var b strings.Builder
+	var collect func(*xhtml.Node)
+	collect = func(n *xhtml.Node) {
+		if n.Type == xhtml.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+			return
+		}
+		if n.Type == xhtml.ElementNode && n.DataAtom == atom.Style {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	if n.DataAtom == atom.Script {
+		return b.String()
+	}
+	return clean(b.String())
+}
+
+func attr(n *xhtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *xhtml.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func hasClass(n *xhtml.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package productpage
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		file    string
+		pageURL string
+		want    *Product
+	}{
+		{
+			file:    "jsonld.html",
+			pageURL: "https://shop.northpeak.example/products/trail-runner-2",
+			want: &Product{
+				Name:        "Trail Runner 2 & Gaiter Set",
+				Description: "A lightweight trail shoe with a grippy outsole. Includes gaiters.",
+				Brand:       "Northpeak",
+				Price:       "129.95",
+				Currency:    "USD",
+				Images: []string{
+					"https://shop.northpeak.example/images/trail-runner-2-side.jpg",
+					"https://cdn.northpeak.example/trail-runner-2-top.jpg",
+					"https://cdn.northpeak.example/og/trail-runner-2.jpg",
+				},
+			},
+		},
+		{
+			// The Shopify price is in cents; OpenGraph supplies its currency
+			// and <base> resolves relative images.
+			file:    "shopify.html",
+			pageURL: "https://fernandco.example/products/linen-apron",
+			want: &Product{
+				Name:        "Linen Apron",
+				Description: "Stonewashed linen apron with two deep pockets. 100% linen Adjustable neck strap",
+				Brand:       "Fern & Co",
+				Price:       "48.00",
+				Currency:    "EUR",
+				Images: []string{
+					"https://fernandco.example/cdn/shop/files/apron-front.jpg?v=1",
+					"https://fernandco.example/cdn/shop/files/apron-back.jpg?v=1",
+					"https://fernandco.example/cdn/shop/files/apron-detail.jpg?v=1",
+					"https://fernandco.example/cdn/shop/files/apron-og.jpg",
+					"http://fernandco.example/cdn/shop/files/apron-og.jpg",
+				},
+			},
+		},
+		{
+			// The buy box price wins over the one in "similar items", and the
+			// largest dynamic image comes before smaller ones.
+			file:    "amazon.html",
+			pageURL: "https://www.amazon.example/dp/B000000000",
+			want: &Product{
+				Name:        "Kettle Pro 1.7L Electric Kettle, Stainless Steel",
+				Description: "Boils 1.7 litres in under five minutes Auto shut-off and boil-dry protection",
+				Brand:       "KettlePro",
+				Price:       "39.99",
+				Currency:    "USD",
+				Images: []string{
+					"https://m.media-amazon.example/images/I/kettle-hires.jpg",
+					"https://m.media-amazon.example/images/I/kettle-1000.jpg",
+					"https://m.media-amazon.example/images/I/kettle-500.jpg",
+				},
+			},
+		},
+		{
+			file:    "opengraph.html",
+			pageURL: "https://littlekiln.example/shop/pour-over",
+			want: &Product{
+				Name:        "Ceramic Pour-Over Set",
+				Description: "Handmade ceramic dripper and carafe, glazed in speckled white.",
+				Brand:       "Little Kiln",
+				Price:       "1299.00",
+				Currency:    "SEK",
+				Images: []string{
+					"https://littlekiln.example/media/pour-over-1.jpg",
+					"https://littlekiln.example/media/pour-over-2.jpg",
+				},
+			},
+		},
+		{
+			file:    "title-only.html",
+			pageURL: "https://sketch.example/books/a5",
+			want: &Product{
+				Name:        "Hand-Bound Sketchbook",
+				Description: "A5 sketchbook with 120 pages of cotton paper.",
+				Price:       "18",
+				Currency:    "GBP",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := Extract(mustParse(t, tt.pageURL), readPage(t, tt.file))
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract() =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractNoProduct(t *testing.T) {
+	_, err := Extract(mustParse(t, "https://example.com/"), readPage(t, "empty.html"))
+	if !errors.Is(err, ErrNoProduct) {
+		t.Fatalf("Extract() error = %v, want ErrNoProduct", err)
+	}
+}
+
+func TestNormalizePrice(t *testing.T) {
+	tests := map[string]string{
+		"$1,299.00":  "1299.00",
+		"1.299,00 €": "1299.00",
+		"1 299,5":    "1299.5",
+		"1299":       "1299",
+		"12.000":     "12000",
+		"USD 9.99.":  "9.99",
+		"free":       "",
+		"":           "",
+	}
+	for in, want := range tests {
+		if got := normalizePrice(in); got != want {
+			t.Errorf("normalizePrice(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func readPage(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,155 @@
+// Package prompt compiles storyboard scenes into provider-ready visual
+// descriptions. Spoken dialogue is never sent to the provider as-is; the
+// template describes what the camera should see.
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// ProductLock is prepended whenever the provider also receives the product
+// image, so the generated footage does not redesign the product.
+const ProductLock = "Strictly preserve the exact appearance of the product in the image: maintain identical shape, size, colors, textures, materials, branding, logos, labels, and all visual details. Do not modify, distort, or alter the product in any way. Only animate the scene around the product. "
+
+// MaxLength is the longest prompt the provider accepts.
+const MaxLength = 1500
+
+// Preset is the look and camera language of a style preset.
+type Preset struct {
+	Name     string
+	Camera   string
+	Lighting string
+	Setting  string
+	Mood     string
+}
+
+// Persona describes the on-screen presenter.
+type Persona struct {
+	Gender    string
+	AgeRange  string
+	Ethnicity string
+	Style     string
+}
+
+type Product struct {
+	Name        string
+	Description string
+	HasImage    bool
+}
+
+// Input is everything the compiler knows about one scene.
+type Input struct {
+	Role      string
+	Direction string
+	Persona   *Persona
+	Product   Product
+	Preset    Preset
+}
+
+// DefaultTemplate is used when no template is configured for a scene role.
+const DefaultTemplate = `{{if .Direction}}{{.Direction}}{{else}}{{.Subject}} with {{.Product.Name}}{{end}}. Camera: {{.Preset.Camera}}. Setting: {{.Preset.Setting}}. Lighting: {{.Preset.Lighting}}. Mood: {{.Preset.Mood}}.`
+
+// DefaultPreset is used when no style preset is configured.
+var DefaultPreset = Preset{
+	Name:     "UGC Selfie",
+	Camera:   "handheld smartphone selfie angle at arm's length, slight natural shake",
+	Lighting: "soft natural window light",
+	Setting:  "a lived-in room at home",
+	Mood:     "authentic, casual and enthusiastic",
+}
+
+// templateData is what template bodies can reference.
+type templateData struct {
+	Role      string
+	Direction string
+	Subject   string
+	Product   Product
+	Preset    Preset
+}
+
+// Compile renders the template body for the input. The product lock is
+// added when an image is sent alongside the prompt.
+func Compile(body string, in Input) (string, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("parse prompt template: %w", err)
+	}
+
+	productName := strings.TrimSpace(in.Product.Name)
+	if productName == "" {
+		productName = "the product"
+	}
+
+	data := templateData{
+		Role:      in.Role,
+		Direction: strings.TrimSpace(in.Direction),
+		Subject:   describePersona(in.Persona),
+		Product: Product{
+			Name:        productName,
+			Description: truncate(strings.TrimSpace(in.Product.Description), 200),
+			HasImage:    in.Product.HasImage,
+		},
+		Preset: in.Preset,
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("execute prompt template: %w", err)
+	}
+
+	compiled := collapseSpaces(b.String())
+	if in.Product.HasImage {
+		compiled = ProductLock + compiled
+	}
+	return truncate(compiled, MaxLength), nil
+}
+
+// describePersona turns avatar attributes into a short noun phrase such as
+// "A friendly woman in her 20s".
+func describePersona(p *Persona) string {
+	if p == nil {
+		return "A person"
+	}
+
+	var words []string
+	if p.Style != "" {
+		words = append(words, p.Style)
+	}
+	if p.Ethnicity != "" {
+		words = append(words, p.Ethnicity)
+	}
+
+	noun, pronoun := "person", "their"
+	switch p.Gender {
+	case "female":
+		noun, pronoun = "woman", "her"
+	case "male":
+		noun, pronoun = "man", "his"
+	}
+	words = append(words, noun)
+
+	phrase := strings.Join(words, " ")
+	if p.AgeRange != "" {
+		phrase += " in " + pronoun + " " + p.AgeRange
+	}
+
+	article := "A"
+	if strings.ContainsAny(phrase[:1], "aeiouAEIOU") {
+		article = "An"
+	}
+	return article + " " + phrase
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
@@ -0,0 +1,145 @@
+// Package ratelimit counts requests per key in fixed windows.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+)
+
+// Result is the state of a key's window after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the current window ends.
+	Reset time.Time
+}
+
+// RetryAfter is how long a rejected caller should wait.
+func (r *Result) RetryAfter() time.Duration {
+	if wait := time.Until(r.Reset); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Limiter allows up to limit requests per key in each window.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error)
+}
+
+// Counter counts events per key, such as failed sign-ins, without
+// rejecting them.
+type Counter interface {
+	// Add counts an event and returns the key's count and when it
+	// expires, window after the first event.
+	Add(ctx context.Context, key string, window time.Duration) (int, time.Time, error)
+	// Get returns the key's count and expiry, or zero when it has none.
+	Get(ctx context.Context, key string) (int, time.Time, error)
+	// Reset forgets the key's count.
+	Reset(ctx context.Context, key string) error
+}
+
+// Store both limits and counts.
+type Store interface {
+	Limiter
+	Counter
+}
+
+// New builds the store selected by RATE_LIMIT_STORE.
+func New(ctx context.Context, cfg *config.Config) (Store, error) {
+	switch cfg.RateLimit.Store {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		return DialRedis(ctx, cfg.Redis)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimit.Store)
+	}
+}
+
+// Memory is a Store for a single instance. Counts are lost on restart.
+type Memory struct {
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+	sweepAt time.Time
+}
+
+type memoryWindow struct {
+	count int
+	reset time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{windows: map[string]*memoryWindow{}}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := m.window(key, window)
+	result := &Result{Limit: limit, Reset: w.reset}
+	if w.count >= limit {
+		return result, nil
+	}
+	w.count++
+	result.Allowed = true
+	result.Remaining = limit - w.count
+	return result, nil
+}
+
+func (m *Memory) Add(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := m.window(key, window)
+	w.count++
+	return w.count, w.reset, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.windows[key]
+	if !ok || !time.Now().Before(w.reset) {
+		return 0, time.Time{}, nil
+	}
+	return w.count, w.reset, nil
+}
+
+func (m *Memory) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.windows, key)
+	return nil
+}
+
+// window returns the key's current window, starting a new one when the
+// last has ended. The caller holds m.mu.
+func (m *Memory) window(key string, window time.Duration) *memoryWindow {
+	now := time.Now()
+
+	// Drop finished windows now and then so idle keys do not accumulate.
+	if now.After(m.sweepAt) {
+		for k, w := range m.windows {
+			if !now.Before(w.reset) {
+				delete(m.windows, k)
+			}
+		}
+		m.sweepAt = now.Add(time.Minute)
+	}
+
+	w, ok := m.windows[key]
+	if !ok || !now.Before(w.reset) {
+		w = &memoryWindow{reset: now.Add(window)}
+		m.windows[key] = w
+	}
+	return w
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "genvid:ratelimit:"
+
+// incrScript counts an event and returns the count and the milliseconds
+// left in its window. The window starts with the first event; a key that
+// somehow lost its expiry gets a new one.
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {n, ttl}
+`)
+
+// Redis is a Store shared by every instance using the same Redis.
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+// DialRedis connects to REDIS_URL, or REDIS_HOST and REDIS_PORT when the
+// URL is empty.
+func DialRedis(ctx context.Context, cfg config.RedisConfig) (*Redis, error) {
+	opts := &redis.Options{Addr: net.JoinHostPort(cfg.Host, cfg.Port)}
+	if cfg.URL != "" {
+		var err error
+		opts, err = redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+		}
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return NewRedis(client), nil
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	count, reset, err := r.Add(ctx, key, window)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Limit: limit, Reset: reset}
+	if count > limit {
+		return result, nil
+	}
+	result.Allowed = true
+	result.Remaining = limit - count
+	return result, nil
+}
+
+func (r *Redis) Add(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	values, err := incrScript.Run(ctx, r.client, []string{redisKeyPrefix + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(values) != 2 {
+		return 0, time.Time{}, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+	return int(values[0]), time.Now().Add(time.Duration(values[1]) * time.Millisecond), nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (int, time.Time, error) {
+	var count *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Get(ctx, redisKeyPrefix+key)
+		ttl = pipe.PTTL(ctx, redisKeyPrefix+key)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return 0, time.Time{}, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	n, err := count.Int()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	// PTTL is negative for keys without an expiry, which Add never
+	// leaves behind.
+	if ttl.Val() <= 0 {
+		return 0, time.Time{}, nil
+	}
+	return n, time.Now().Add(ttl.Val()), nil
+}
+
+func (r *Redis) Reset(ctx context.Context, key string) error {
+	return r.client.Del(ctx, redisKeyPrefix+key).Err()
+}
+
+// Close closes the connection pool.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/genvid/backend/internal/model"
 	"github.com/google/uuid"
@@ -14,6 +15,9 @@ var (
 	ErrNotFound     = errors.New("record not found")
 	ErrDuplicate    = errors.New("record already exists")
 	ErrUnauthorized = errors.New("unauthorized")
+	ErrNoCredits    = errors.New("no credits remaining")
+	ErrConflict     = errors.New("record was modified concurrently")
+	ErrTokenReused  = errors.New("token was already used")
 )
 
 type ProfileRepository struct {
@@ -24,11 +28,24 @@ func NewProfileRepository(db *sqlx.DB) *ProfileRepository {
 	return &ProfileRepository{db: db}
 }
 
+// FreeCredits are granted once per account, when its email is verified.
+const FreeCredits = 3
+
+const profileColumns = `id, email, full_name, avatar_url, company_name,
+		       credits_remaining, credits_used_total, subscription_tier, subscription_status,
+		       preferred_language, email_notifications, created_at, updated_at, last_login_at,
+		       password_hash, password_hash IS NOT NULL AS password_set, email_verified_at,
+		       role, disabled_at`
+
+// Create inserts a profile. Profiles created with EmailVerifiedAt set (the
+// identity provider verified the email) get the free credits at once.
 func (r *ProfileRepository) Create(ctx context.Context, profile *model.Profile) error {
 	query := `
-		INSERT INTO profiles (id, email, full_name, credits_remaining, subscription_tier, subscription_status)
-		VALUES ($1, $2, $3, 3, 'free', 'inactive')
-		RETURNING created_at, updated_at
+		INSERT INTO profiles (id, email, full_name, password_hash, password_changed_at, email_verified_at,
+		                      credits_remaining, subscription_tier, subscription_status)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4::text IS NULL THEN NULL ELSE NOW() END, $5,
+		        CASE WHEN $5::timestamptz IS NULL THEN 0 ELSE $6 END, 'free', 'inactive')
+		RETURNING credits_remaining, created_at, updated_at
 	`
 
 	err := r.db.QueryRowxContext(
@@ -37,15 +54,19 @@ func (r *ProfileRepository) Create(ctx context.Context, profile *model.Profile)
 		profile.ID,
 		profile.Email,
 		profile.FullName,
-	).Scan(&profile.CreatedAt, &profile.UpdatedAt)
+		profile.PasswordHash,
+		profile.EmailVerifiedAt,
+		FreeCredits,
+	).Scan(&profile.CreditsRemaining, &profile.CreatedAt, &profile.UpdatedAt)
 
 	if err != nil {
 		return err
 	}
 
-	profile.CreditsRemaining = 3
 	profile.SubscriptionTier = "free"
 	profile.SubscriptionStatus = "inactive"
+	profile.Role = model.RoleUser
+	profile.PasswordSet = profile.PasswordHash != nil
 
 	return nil
 }
@@ -53,9 +74,7 @@ func (r *ProfileRepository) Create(ctx context.Context, profile *model.Profile)
 func (r *ProfileRepository) GetByID(ctx context.Context, id string) (*model.Profile, error) {
 	profile := &model.Profile{}
 	query := `
-		SELECT id, email, full_name, avatar_url, company_name,
-		       credits_remaining, credits_used_total, subscription_tier, subscription_status,
-		       preferred_language, email_notifications, created_at, updated_at, last_login_at
+		SELECT ` + profileColumns + `
 		FROM profiles
 		WHERE id = $1
 	`
@@ -74,9 +93,7 @@ func (r *ProfileRepository) GetByID(ctx context.Context, id string) (*model.Prof
 func (r *ProfileRepository) GetByEmail(ctx context.Context, email string) (*model.Profile, error) {
 	profile := &model.Profile{}
 	query := `
-		SELECT id, email, full_name, avatar_url, company_name,
-		       credits_remaining, credits_used_total, subscription_tier, subscription_status,
-		       preferred_language, email_notifications, created_at, updated_at, last_login_at
+		SELECT ` + profileColumns + `
 		FROM profiles
 		WHERE email = $1
 	`
@@ -115,6 +132,90 @@ func (r *ProfileRepository) Update(ctx context.Context, profile *model.Profile)
 	return err
 }
 
+// SetPassword stores a new password hash.
+func (r *ProfileRepository) SetPassword(ctx context.Context, id, passwordHash string) error {
+	query := `UPDATE profiles SET password_hash = $2, password_changed_at = NOW() WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// VerifyEmail marks email as verified if it is still the profile's address,
+// granting the free credits the first time. It reports whether the profile
+// was newly verified.
+func (r *ProfileRepository) VerifyEmail(ctx context.Context, id, email string) (bool, error) {
+	query := `
+		UPDATE profiles
+		SET email_verified_at = NOW(), credits_remaining = credits_remaining + $3, updated_at = NOW()
+		WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+	`
+	result, err := r.db.ExecContext(ctx, query, id, email, FreeCredits)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ClaimEmail verifies email for a provider that has proven the user owns
+// it. Whoever registered the unverified profile may not have, so the same
+// transaction drops its password, sessions, API keys and second factor. It
+// reports whether the profile was unverified.
+func (r *ProfileRepository) ClaimEmail(ctx context.Context, id, email string) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE profiles
+		SET email_verified_at = NOW(), credits_remaining = credits_remaining + $3,
+		    password_hash = NULL, password_changed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+	`, id, email, FreeCredits)
+	if err != nil {
+		return false, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE auth_sessions SET revoked_at = NOW(), revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, id, model.SessionRevokedEmailClaimed)
+	if err != nil {
+		return false, err
+	}
+	for _, query := range []string{
+		`UPDATE api_keys SET is_active = false WHERE user_id = $1 AND is_active`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM mfa_challenges WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
 func (r *ProfileRepository) UpdateLastLogin(ctx context.Context, id string) error {
 	query := `UPDATE profiles SET last_login_at = NOW() WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, id)
@@ -137,7 +238,29 @@ func (r *ProfileRepository) DecrementCredits(ctx context.Context, id string) err
 		return err
 	}
 	if rows == 0 {
-		return errors.New("no credits remaining")
+		return ErrNoCredits
+	}
+
+	return nil
+}
+
+func (r *ProfileRepository) DecrementCreditsBy(ctx context.Context, id string, amount int) error {
+	query := `
+		UPDATE profiles
+		SET credits_remaining = credits_remaining - $2, credits_used_total = credits_used_total + $2
+		WHERE id = $1 AND credits_remaining >= $2
+	`
+	result, err := r.db.ExecContext(ctx, query, id, amount)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoCredits
 	}
 
 	return nil
@@ -149,146 +272,2323 @@ func (r *ProfileRepository) IncrementCredits(ctx context.Context, id string, amo
 	return err
 }
 
-type ProjectRepository struct {
+type IdentityRepository struct {
 	db *sqlx.DB
 }
 
-func NewProjectRepository(db *sqlx.DB) *ProjectRepository {
-	return &ProjectRepository{db: db}
+func NewIdentityRepository(db *sqlx.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
 }
 
-func (r *ProjectRepository) Create(ctx context.Context, project *model.Project) error {
+func (r *IdentityRepository) Get(ctx context.Context, provider, subject string) (*model.OAuthIdentity, error) {
+	identity := &model.OAuthIdentity{}
 	query := `
-		INSERT INTO projects (id, user_id, product_name, product_description, product_url, product_image_url, status)
-		VALUES ($1, $2, $3, $4, $5, $6, 'draft')
-		RETURNING id, created_at, updated_at
+		SELECT provider, subject, user_id, email, created_at, last_login_at
+		FROM oauth_identities
+		WHERE provider = $1 AND subject = $2
 	`
 
-	if project.ID == "" {
-		project.ID = uuid.New().String()
+	if err := r.db.GetContext(ctx, identity, query, provider, subject); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
 	}
 
-	err := r.db.QueryRowxContext(
-		ctx,
-		query,
-		project.ID,
-		project.UserID,
-		project.ProductName,
-		project.ProductDescription,
-		project.ProductURL,
-		project.ProductImageURL,
-	).Scan(&project.ID, &project.CreatedAt, &project.UpdatedAt)
+	return identity, nil
+}
+
+func (r *IdentityRepository) Create(ctx context.Context, identity *model.OAuthIdentity) error {
+	query := `
+		INSERT INTO oauth_identities (provider, subject, user_id, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (provider, subject) DO NOTHING
+		RETURNING created_at, last_login_at
+	`
+
+	err := r.db.QueryRowxContext(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email).
+		Scan(&identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicate
+		}
+		return err
+	}
+
+	return nil
+}
 
+// Touch records a login through the identity and its current email.
+func (r *IdentityRepository) Touch(ctx context.Context, provider, subject string, email *string) error {
+	query := `UPDATE oauth_identities SET email = $3, last_login_at = NOW() WHERE provider = $1 AND subject = $2`
+	_, err := r.db.ExecContext(ctx, query, provider, subject, email)
 	return err
 }
 
-func (r *ProjectRepository) GetByID(ctx context.Context, id string) (*model.Project, error) {
-	project := &model.Project{}
+type AccountTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewAccountTokenRepository(db *sqlx.DB) *AccountTokenRepository {
+	return &AccountTokenRepository{db: db}
+}
+
+const accountTokenColumns = `id, user_id, purpose, token_hash, email, expires_at, used_at, created_at`
+
+// Create stores a token and retires the user's unused tokens for the same
+// purpose, so only the latest link works.
+func (r *AccountTokenRepository) Create(ctx context.Context, token *model.AccountToken) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE account_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`, token.UserID, token.Purpose); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO account_tokens (user_id, purpose, token_hash, email, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, token.UserID, token.Purpose, token.TokenHash, token.Email, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountSince counts the tokens sent to email for purpose since a time.
+func (r *AccountTokenRepository) CountSince(ctx context.Context, email string, purpose model.AccountTokenPurpose, since time.Time) (int, error) {
+	var count int
 	query := `
-		SELECT id, user_id, avatar_id, title, product_name, product_description, product_url, product_image_url,
-		       script, language, format, video_duration, status, progress_percent, error_message,
-		       external_task_id, external_provider, video_url, thumbnail_url,
-		       created_at, updated_at, started_at, completed_at
-		FROM projects
-		WHERE id = $1
+		SELECT COUNT(*) FROM account_tokens
+		WHERE lower(email) = lower($1) AND purpose = $2 AND created_at > $3
 	`
+	err := r.db.GetContext(ctx, &count, query, email, purpose, since)
+	return count, err
+}
 
-	err := r.db.GetContext(ctx, project, query, id)
-	if err != nil {
+// Consume marks an unused, unexpired token as used and returns it. Each
+// token can be consumed once.
+func (r *AccountTokenRepository) Consume(ctx context.Context, tokenHash string, purpose model.AccountTokenPurpose) (*model.AccountToken, error) {
+	token := &model.AccountToken{}
+	query := `
+		UPDATE account_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING ` + accountTokenColumns
+
+	if err := r.db.GetContext(ctx, token, query, tokenHash, purpose); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
 
-	return project, nil
+	return token, nil
 }
 
-func (r *ProjectRepository) GetByUserID(ctx context.Context, userID string, limit, offset int) ([]model.Project, int, error) {
-	var projects []model.Project
-	var total int
+// Revoke retires the user's unused tokens for purpose.
+func (r *AccountTokenRepository) Revoke(ctx context.Context, userID string, purpose model.AccountTokenPurpose) error {
+	query := `UPDATE account_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID, purpose)
+	return err
+}
 
-	countQuery := `SELECT COUNT(*) FROM projects WHERE user_id = $1`
-	err := r.db.GetContext(ctx, &total, countQuery, userID)
+const sessionColumns = `id, user_id, ip_address, user_agent, created_at, last_used_at, expires_at, revoked_at, revoked_reason`
+
+type SessionRepository struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepository(db *sqlx.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create starts a session with its first refresh token and records the
+// sign-in as a user_login usage event.
+func (r *SessionRepository) Create(ctx context.Context, session *model.AuthSession, token *model.RefreshToken) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
+	defer tx.Rollback()
 
-	query := `
-		SELECT id, user_id, avatar_id, title, product_name, product_description, product_url, product_image_url,
-		       script, language, format, video_duration, status, progress_percent, error_message,
-		       external_task_id, external_provider, video_url, thumbnail_url,
-		       created_at, updated_at, started_at, completed_at
-		FROM projects
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO auth_sessions (id, user_id, expires_at, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, last_used_at
+	`, session.ID, session.UserID, session.ExpiresAt, session.IPAddress, session.UserAgent).
+		Scan(&session.CreatedAt, &session.LastUsedAt)
+	if err != nil {
+		return err
+	}
 
-	err = r.db.SelectContext(ctx, &projects, query, userID, limit, offset)
+	token.SessionID = session.ID
+	if err := insertRefreshToken(ctx, tx, token); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO usage_logs (user_id, event, description, metadata, ip_address, user_agent)
+		VALUES ($1, 'user_login', 'Signed in', jsonb_build_object('session_id', $2::text), $3, $4)
+	`, session.UserID, session.ID, session.IPAddress, session.UserAgent)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 
-	return projects, total, nil
+	return tx.Commit()
 }
 
-func (r *ProjectRepository) UpdateStatus(ctx context.Context, id string, status model.ProjectStatus, progress int) error {
-	query := `
-		UPDATE projects
-		SET status = $2, progress_percent = $3, updated_at = NOW()
+func insertRefreshToken(ctx context.Context, tx *sqlx.Tx, token *model.RefreshToken) error {
+	return tx.QueryRowxContext(ctx, `
+		INSERT INTO refresh_tokens (id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`, token.ID, token.SessionID, token.TokenHash, token.ExpiresAt).Scan(&token.CreatedAt)
+}
+
+// Rotate exchanges the refresh token with hash usedHash for next and
+// returns the session, now seen from client. A token that was already
+// exchanged revokes its session and returns ErrTokenReused; unknown,
+// expired and revoked tokens return ErrNotFound.
+func (r *SessionRepository) Rotate(ctx context.Context, usedHash string, next *model.RefreshToken, client model.ClientInfo) (*model.AuthSession, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		ID        string     `db:"id"`
+		SessionID string     `db:"session_id"`
+		ExpiresAt time.Time  `db:"expires_at"`
+		UsedAt    *time.Time `db:"used_at"`
+	}
+	err = tx.GetContext(ctx, &current, `
+		SELECT id, session_id, expires_at, used_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, usedHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	session := &model.AuthSession{}
+	err = tx.GetContext(ctx, session, `
+		SELECT `+sessionColumns+`
+		FROM auth_sessions
+		WHERE id = $1
+		FOR UPDATE
+	`, current.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if session.RevokedAt != nil || !current.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	if current.UsedAt != nil {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE auth_sessions SET revoked_at = NOW(), revoked_reason = $2 WHERE id = $1
+		`, session.ID, model.SessionRevokedTokenReuse); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, current.ID); err != nil {
+		return nil, err
+	}
+	next.SessionID = session.ID
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return nil, err
+	}
+	err = tx.QueryRowxContext(ctx, `
+		UPDATE auth_sessions
+		SET last_used_at = NOW(), expires_at = $2,
+		    ip_address = COALESCE(NULLIF($3, '')::inet, ip_address),
+		    user_agent = COALESCE(NULLIF($4, ''), user_agent)
 		WHERE id = $1
+		RETURNING `+sessionColumns+`
+	`, session.ID, next.ExpiresAt, client.IPAddress, client.UserAgent).StructScan(session)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetActive returns the user's session unless it was revoked or expired,
+// in which case it returns ErrNotFound.
+func (r *SessionRepository) GetActive(ctx context.Context, userID, sessionID string) (*model.AuthSession, error) {
+	session := &model.AuthSession{}
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM auth_sessions
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
 	`
-	_, err := r.db.ExecContext(ctx, query, id, status, progress)
-	return err
+	err := r.db.GetContext(ctx, session, query, sessionID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return session, err
 }
 
-func (r *ProjectRepository) SetProcessing(ctx context.Context, id string, taskID, provider string) error {
+// ListActive returns the user's signed-in sessions, most recently used
+// first.
+func (r *SessionRepository) ListActive(ctx context.Context, userID string) ([]model.AuthSession, error) {
+	sessions := []model.AuthSession{}
 	query := `
-		UPDATE projects
-		SET status = 'processing', external_task_id = $2, external_provider = $3,
-		    started_at = NOW(), updated_at = NOW()
-		WHERE id = $1
+		SELECT ` + sessionColumns + `
+		FROM auth_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
 	`
-	_, err := r.db.ExecContext(ctx, query, id, taskID, provider)
+	err := r.db.SelectContext(ctx, &sessions, query, userID)
+	return sessions, err
+}
+
+// Touch records that the session was used now.
+func (r *SessionRepository) Touch(ctx context.Context, sessionID string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_sessions SET last_used_at = NOW() WHERE id = $1`, sessionID)
 	return err
 }
 
-func (r *ProjectRepository) SetCompleted(ctx context.Context, id string, videoURL, thumbnailURL string) error {
+// Revoke revokes one of the user's active sessions. It returns ErrNotFound
+// when the session is not the user's or has already ended.
+func (r *SessionRepository) Revoke(ctx context.Context, userID, sessionID, reason string) error {
 	query := `
-		UPDATE projects
-		SET status = 'completed', video_url = $2, thumbnail_url = $3,
-		    progress_percent = 100, completed_at = NOW(), updated_at = NOW()
-		WHERE id = $1
+		UPDATE auth_sessions SET revoked_at = NOW(), revoked_reason = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
 	`
-	_, err := r.db.ExecContext(ctx, query, id, videoURL, thumbnailURL)
-	return err
+	result, err := r.db.ExecContext(ctx, query, sessionID, userID, reason)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-func (r *ProjectRepository) SetFailed(ctx context.Context, id string, errMsg string) error {
+// RevokeByToken revokes the session a refresh token belongs to. Unknown
+// tokens are ignored.
+func (r *SessionRepository) RevokeByToken(ctx context.Context, tokenHash, reason string) error {
 	query := `
-		UPDATE projects
-		SET status = 'failed', error_message = $2, updated_at = NOW()
-		WHERE id = $1
+		UPDATE auth_sessions SET revoked_at = NOW(), revoked_reason = $2
+		WHERE id = (SELECT session_id FROM refresh_tokens WHERE token_hash = $1)
+		  AND revoked_at IS NULL
 	`
-	_, err := r.db.ExecContext(ctx, query, id, errMsg)
+	_, err := r.db.ExecContext(ctx, query, tokenHash, reason)
 	return err
 }
 
-func (r *ProjectRepository) Delete(ctx context.Context, id, userID string) error {
-	query := `DELETE FROM projects WHERE id = $1 AND user_id = $2`
-	result, err := r.db.ExecContext(ctx, query, id, userID)
+// RevokeAll revokes every active session of the user except keepID, which
+// may be empty, and returns how many were revoked.
+func (r *SessionRepository) RevokeAll(ctx context.Context, userID, keepID, reason string) (int64, error) {
+	query := `
+		UPDATE auth_sessions SET revoked_at = NOW(), revoked_reason = $3
+		WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2
+	`
+	result, err := r.db.ExecContext(ctx, query, userID, keepID, reason)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return result.RowsAffected()
+}
 
-	rows, err := result.RowsAffected()
+// DeleteEnded removes sessions, with their tokens, that expired or were
+// revoked before the cutoff.
+func (r *SessionRepository) DeleteEnded(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM auth_sessions WHERE expires_at < $1 OR revoked_at < $1`
+	result, err := r.db.ExecContext(ctx, query, before)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if rows == 0 {
-		return ErrNotFound
+	return result.RowsAffected()
+}
+
+type MFARepository struct {
+	db *sqlx.DB
+}
+
+func NewMFARepository(db *sqlx.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// GetTOTP returns the user's authenticator, confirmed or pending.
+func (r *MFARepository) GetTOTP(ctx context.Context, userID string) (*model.TOTPFactor, error) {
+	factor := &model.TOTPFactor{}
+	query := `SELECT user_id, secret, confirmed_at, last_used_step, created_at FROM user_totp WHERE user_id = $1`
+	err := r.db.GetContext(ctx, factor, query, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
 	}
+	return factor, err
+}
 
-	return nil
+// IsEnabled reports whether the user has a confirmed authenticator.
+func (r *MFARepository) IsEnabled(ctx context.Context, userID string) (bool, error) {
+	var enabled bool
+	query := `SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)`
+	err := r.db.GetContext(ctx, &enabled, query, userID)
+	return enabled, err
+}
+
+// SaveTOTP stores a pending authenticator, replacing an earlier pending
+// one. It returns ErrConflict when the user already has a confirmed one.
+func (r *MFARepository) SaveTOTP(ctx context.Context, factor *model.TOTPFactor) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL
+		RETURNING created_at
+	`
+	err := r.db.QueryRowxContext(ctx, query, factor.UserID, factor.Secret).Scan(&factor.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	return err
+}
+
+// ConfirmTOTP enables the pending authenticator with the step of its first
+// code and stores the user's recovery codes.
+func (r *MFARepository) ConfirmTOTP(ctx context.Context, userID string, step int64, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code of the step was accepted. It reports
+// false when that or a later step was already used.
+func (r *MFARepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp SET last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2
+	`
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes for new ones.
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used and reports
+// whether there was one.
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *MFARepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.db.GetContext(ctx, &count, query, userID)
+	return count, err
+}
+
+// Disable removes the user's authenticator, recovery codes and open
+// challenges.
+func (r *MFARepository) Disable(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM mfa_challenges WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *MFARepository) CreateChallenge(ctx context.Context, challenge *model.MFAChallenge) error {
+	query := `
+		INSERT INTO mfa_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRowxContext(ctx, query, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt).
+		Scan(&challenge.ID, &challenge.CreatedAt)
+}
+
+// AttemptChallenge counts an attempt against an open challenge before its
+// code is checked, so parallel guesses share the limit. Used, expired and
+// exhausted challenges return ErrNotFound.
+func (r *MFARepository) AttemptChallenge(ctx context.Context, tokenHash string, maxAttempts int) (*model.MFAChallenge, error) {
+	challenge := &model.MFAChallenge{}
+	query := `
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < $2
+		RETURNING id, user_id, token_hash, attempts, expires_at, used_at, created_at
+	`
+	err := r.db.GetContext(ctx, challenge, query, tokenHash, maxAttempts)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return challenge, err
+}
+
+// ConsumeChallenge uses up a challenge and reports whether it was still
+// open.
+func (r *MFARepository) ConsumeChallenge(ctx context.Context, id string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *MFARepository) DeleteExpiredChallenges(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM mfa_challenges WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type UsageLogRepository struct {
+	db *sqlx.DB
+}
+
+func NewUsageLogRepository(db *sqlx.DB) *UsageLogRepository {
+	return &UsageLogRepository{db: db}
+}
+
+func (r *UsageLogRepository) Create(ctx context.Context, entry *model.UsageLog) error {
+	metadata := "{}"
+	if len(entry.Metadata) > 0 {
+		metadata = string(entry.Metadata)
+	}
+
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO usage_logs (user_id, project_id, event, description, metadata, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, entry.UserID, entry.ProjectID, entry.Event, entry.Description, metadata, entry.IPAddress, entry.UserAgent).
+		Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// ListByUser returns the user's events, newest first.
+func (r *UsageLogRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]model.UsageLog, int, error) {
+	var total int
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM usage_logs WHERE user_id = $1`, userID); err != nil {
+		return nil, 0, err
+	}
+
+	entries := []model.UsageLog{}
+	query := `
+		SELECT id, user_id, project_id, event, description, COALESCE(metadata, '{}') AS metadata, ip_address, user_agent, created_at
+		FROM usage_logs
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	if err := r.db.SelectContext(ctx, &entries, query, userID, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+type APIKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, user_id, name, key_hash, key_prefix, scopes, rate_limit, is_active, last_used_at, expires_at, created_at`
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, key_hash, key_prefix, scopes, rate_limit, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, is_active, created_at
+	`
+
+	return r.db.QueryRowxContext(
+		ctx,
+		query,
+		key.UserID,
+		key.Name,
+		key.KeyHash,
+		key.KeyPrefix,
+		key.Scopes,
+		key.RateLimit,
+		key.ExpiresAt,
+	).Scan(&key.ID, &key.IsActive, &key.CreatedAt)
+}
+
+// GetByHash returns the key with the hash, whether or not it is usable.
+// Keys of disabled accounts are not found.
+func (r *APIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	query := `
+		SELECT ` + apiKeyColumns + ` FROM api_keys
+		WHERE key_hash = $1
+		  AND NOT EXISTS (SELECT 1 FROM profiles WHERE id = api_keys.user_id AND disabled_at IS NOT NULL)
+	`
+
+	if err := r.db.GetContext(ctx, key, query, keyHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (r *APIKeyRepository) ListByUser(ctx context.Context, userID string) ([]model.APIKey, error) {
+	keys := []model.APIKey{}
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+
+	err := r.db.SelectContext(ctx, &keys, query, userID)
+	return keys, err
+}
+
+// CountActive counts the user's keys that have not been revoked.
+func (r *APIKeyRepository) CountActive(ctx context.Context, userID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND is_active`
+	err := r.db.GetContext(ctx, &count, query, userID)
+	return count, err
+}
+
+// Revoke deactivates one of the user's keys.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id, userID string) error {
+	query := `UPDATE api_keys SET is_active = false WHERE id = $1 AND user_id = $2 AND is_active`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Touch records a use of the key, at most once a minute to keep busy keys
+// from writing on every request.
+func (r *APIKeyRepository) Touch(ctx context.Context, id string) error {
+	query := `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+type JWTKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewJWTKeyRepository(db *sqlx.DB) *JWTKeyRepository {
+	return &JWTKeyRepository{db: db}
+}
+
+// ListSigningKeys returns the keys that have not expired, oldest first.
+func (r *JWTKeyRepository) ListSigningKeys(ctx context.Context) ([]model.JWTSigningKey, error) {
+	keys := []model.JWTSigningKey{}
+	query := `
+		SELECT kid, algorithm, private_key, public_key, activates_at, retires_at, expires_at, created_at
+		FROM jwt_signing_keys
+		WHERE expires_at > NOW()
+		ORDER BY activates_at
+	`
+	err := r.db.SelectContext(ctx, &keys, query)
+	return keys, err
+}
+
+// CreateSigningKey stores key unless a key with the same algorithm already
+// signs at key.ActivatesAt, and reports whether it was stored. Instances
+// rotating at the same time add a single key.
+func (r *JWTKeyRepository) CreateSigningKey(ctx context.Context, key *model.JWTSigningKey) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('jwt_signing_keys'))`); err != nil {
+		return false, err
+	}
+
+	var covered bool
+	err = tx.GetContext(ctx, &covered, `
+		SELECT EXISTS (
+			SELECT 1 FROM jwt_signing_keys
+			WHERE algorithm = $1 AND activates_at <= $2 AND retires_at > $2
+		)
+	`, key.Algorithm, key.ActivatesAt)
+	if err != nil {
+		return false, err
+	}
+	if covered {
+		return false, nil
+	}
+
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO jwt_signing_keys (kid, algorithm, private_key, public_key, activates_at, retires_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`, key.KID, key.Algorithm, key.PrivateKey, key.PublicKey, key.ActivatesAt, key.RetiresAt, key.ExpiresAt).
+		Scan(&key.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// DeleteExpiredSigningKeys removes keys no token can still be signed with.
+func (r *JWTKeyRepository) DeleteExpiredSigningKeys(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM jwt_signing_keys WHERE expires_at <= NOW()`)
+	return err
+}
+
+type ProjectRepository struct {
+	db *sqlx.DB
+}
+
+func NewProjectRepository(db *sqlx.DB) *ProjectRepository {
+	return &ProjectRepository{db: db}
+}
+
+func (r *ProjectRepository) Create(ctx context.Context, project *model.Project) error {
+	query := `
+		INSERT INTO projects (id, user_id, product_name, product_description, product_url, product_image_url,
+		                      product_image_asset_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 'draft')
+		RETURNING id, created_at, updated_at
+	`
+
+	if project.ID == "" {
+		project.ID = uuid.New().String()
+	}
+
+	err := r.db.QueryRowxContext(
+		ctx,
+		query,
+		project.ID,
+		project.UserID,
+		project.ProductName,
+		project.ProductDescription,
+		project.ProductURL,
+		project.ProductImageURL,
+		project.ProductImageID,
+	).Scan(&project.ID, &project.CreatedAt, &project.UpdatedAt)
+
+	return err
+}
+
+func (r *ProjectRepository) GetByID(ctx context.Context, id string) (*model.Project, error) {
+	project := &model.Project{}
+	query := `
+		SELECT id, user_id, avatar_id, title, product_name, product_description, product_url, product_image_url,
+		       product_image_asset_id, script, language, format, video_duration, style_preset, status,
+		       progress_percent, error_message, external_task_id, external_provider, video_url, thumbnail_url,
+		       created_at, updated_at, started_at, completed_at, expires_at
+		FROM projects
+		WHERE id = $1
+	`
+
+	err := r.db.GetContext(ctx, project, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return project, nil
+}
+
+func (r *ProjectRepository) GetByUserID(ctx context.Context, userID string, limit, offset int) ([]model.Project, int, error) {
+	var projects []model.Project
+	var total int
+
+	countQuery := `SELECT COUNT(*) FROM projects WHERE user_id = $1`
+	err := r.db.GetContext(ctx, &total, countQuery, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, user_id, avatar_id, title, product_name, product_description, product_url, product_image_url,
+		       product_image_asset_id, script, language, format, video_duration, style_preset, status,
+		       progress_percent, error_message, external_task_id, external_provider, video_url, thumbnail_url,
+		       created_at, updated_at, started_at, completed_at, expires_at
+		FROM projects
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	err = r.db.SelectContext(ctx, &projects, query, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return projects, total, nil
+}
+
+func (r *ProjectRepository) UpdateStatus(ctx context.Context, id string, status model.ProjectStatus, progress int) error {
+	query := `
+		UPDATE projects
+		SET status = $2, progress_percent = $3, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, status, progress)
+	return err
+}
+
+func (r *ProjectRepository) SetProcessing(ctx context.Context, id string, taskID, provider string) error {
+	query := `
+		UPDATE projects
+		SET status = 'processing', external_task_id = $2, external_provider = $3,
+		    started_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, taskID, provider)
+	return err
+}
+
+func (r *ProjectRepository) SetCompleted(ctx context.Context, id string, videoURL, thumbnailURL string) error {
+	query := `
+		UPDATE projects
+		SET status = 'completed', video_url = $2, thumbnail_url = $3,
+		    progress_percent = 100, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, videoURL, thumbnailURL)
+	return err
+}
+
+// SetProductImage points the project at an image asset, or clears it when
+// assetID is nil.
+func (r *ProjectRepository) SetProductImage(ctx context.Context, id string, assetID, url *string) error {
+	query := `UPDATE projects SET product_image_asset_id = $2, product_image_url = $3, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, assetID, url)
+	return err
+}
+
+// ClearProductImage unlinks an asset that is about to be deleted from every
+// project using it.
+func (r *ProjectRepository) ClearProductImage(ctx context.Context, assetID string) error {
+	query := `
+		UPDATE projects SET product_image_asset_id = NULL, product_image_url = NULL, updated_at = NOW()
+		WHERE product_image_asset_id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, assetID)
+	return err
+}
+
+// SetMedia replaces the video and thumbnail URLs without touching status.
+func (r *ProjectRepository) SetMedia(ctx context.Context, id string, videoURL, thumbnailURL *string) error {
+	query := `UPDATE projects SET video_url = $2, thumbnail_url = $3, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, videoURL, thumbnailURL)
+	return err
+}
+
+// ListCompletedAfter pages through completed projects by ID, for jobs that
+// walk the whole table.
+func (r *ProjectRepository) ListCompletedAfter(ctx context.Context, afterID string, limit int) ([]model.Project, error) {
+	var projects []model.Project
+	query := `
+		SELECT id, user_id, avatar_id, title, product_name, product_description, product_url, product_image_url,
+		       product_image_asset_id, script, language, format, video_duration, style_preset, status,
+		       progress_percent, error_message, external_task_id, external_provider, video_url, thumbnail_url,
+		       created_at, updated_at, started_at, completed_at, expires_at
+		FROM projects
+		WHERE status = 'completed' AND id::text > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	if err := r.db.SelectContext(ctx, &projects, query, afterID, limit); err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+func (r *ProjectRepository) SetExpiry(ctx context.Context, id string, expiresAt *time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE projects SET expires_at = $2 WHERE id = $1`, id, expiresAt)
+	return err
+}
+
+// AssignExpiry gives completed projects of a tier that have no expiry one
+// retentionDays after completion.
+func (r *ProjectRepository) AssignExpiry(ctx context.Context, tier string, retentionDays int) (int64, error) {
+	query := `
+		UPDATE projects p
+		SET expires_at = COALESCE(p.completed_at, p.updated_at) + make_interval(days => $2)
+		FROM profiles u
+		WHERE u.id = p.user_id AND u.subscription_tier = $1
+		  AND p.status = 'completed' AND p.expires_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, tier, retentionDays)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListExpired returns finished projects past their expiry whose media has
+// not been removed yet.
+func (r *ProjectRepository) ListExpired(ctx context.Context, limit int) ([]model.Project, error) {
+	var projects []model.Project
+	query := `
+		SELECT id, user_id, avatar_id, title, product_name, product_description, product_url, product_image_url,
+		       product_image_asset_id, script, language, format, video_duration, style_preset, status,
+		       progress_percent, error_message, external_task_id, external_provider, video_url, thumbnail_url,
+		       created_at, updated_at, started_at, completed_at, expires_at
+		FROM projects
+		WHERE expires_at < NOW() AND status IN ('completed', 'failed', 'canceled')
+		ORDER BY expires_at
+		LIMIT $1
+	`
+
+	if err := r.db.SelectContext(ctx, &projects, query, limit); err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// SetExpired marks a project expired and forgets the media URLs of the
+// project, its renders and their segments.
+func (r *ProjectRepository) SetExpired(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`UPDATE render_segments SET video_url = NULL
+		 WHERE render_id IN (SELECT id FROM renders WHERE project_id = $1)`,
+		`UPDATE renders SET video_url = NULL, thumbnail_url = NULL, timeline = NULL, updated_at = NOW()
+		 WHERE project_id = $1`,
+		`DELETE FROM assets WHERE project_id = $1 AND purpose IN ('generated_video', 'thumbnail')`,
+		`UPDATE projects SET status = 'expired', video_url = NULL, thumbnail_url = NULL, updated_at = NOW()
+		 WHERE id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListStuck returns queued or processing projects that have not changed
+// since idleSince, oldest first.
+func (r *ProjectRepository) ListStuck(ctx context.Context, idleSince time.Time, limit int) ([]model.Project, error) {
+	projects := []model.Project{}
+	query := `
+		SELECT id, user_id, avatar_id, title, product_name, product_description, product_url, product_image_url,
+		       product_image_asset_id, script, language, format, video_duration, style_preset, status,
+		       progress_percent, error_message, external_task_id, external_provider, video_url, thumbnail_url,
+		       created_at, updated_at, started_at, completed_at, expires_at
+		FROM projects
+		WHERE status IN ('queued', 'processing') AND updated_at < $1
+		ORDER BY updated_at
+		LIMIT $2
+	`
+
+	if err := r.db.SelectContext(ctx, &projects, query, idleSince, limit); err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// ClaimCompleted queues a completed project for another render. It returns
+// ErrConflict when the project is not completed, so two concurrent
+// extensions of one project cannot both start.
+func (r *ProjectRepository) ClaimCompleted(ctx context.Context, id string) error {
+	query := `
+		UPDATE projects
+		SET status = 'queued', progress_percent = 0, error_message = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'completed'
+	`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// ClaimStuck puts a stuck project back in the queue. It returns ErrConflict
+// when the project is not queued or processing, or changed since idleSince,
+// so two requeues of one project cannot both start it.
+func (r *ProjectRepository) ClaimStuck(ctx context.Context, id string, idleSince time.Time) error {
+	query := `
+		UPDATE projects
+		SET status = 'queued', progress_percent = 0, error_message = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('queued', 'processing') AND updated_at < $2
+	`
+	result, err := r.db.ExecContext(ctx, query, id, idleSince)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// FailStuck fails a stuck project with errMsg. Like ClaimStuck it returns
+// ErrConflict when the project is not queued or processing, or changed
+// since idleSince, so a project is failed and refunded only once.
+func (r *ProjectRepository) FailStuck(ctx context.Context, id string, idleSince time.Time, errMsg string) error {
+	query := `
+		UPDATE projects
+		SET status = 'failed', error_message = $3, updated_at = NOW()
+		WHERE id = $1 AND status IN ('queued', 'processing') AND updated_at < $2
+	`
+	result, err := r.db.ExecContext(ctx, query, id, idleSince, errMsg)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+func (r *ProjectRepository) SetFailed(ctx context.Context, id string, errMsg string) error {
+	query := `
+		UPDATE projects
+		SET status = 'failed', error_message = $2, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, errMsg)
+	return err
+}
+
+func (r *ProjectRepository) Delete(ctx context.Context, id, userID string) error {
+	query := `DELETE FROM projects WHERE id = $1 AND user_id = $2`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *ProjectRepository) UpdateGenerationSettings(ctx context.Context, project *model.Project) error {
+	query := `
+		UPDATE projects
+		SET script = $2, language = $3, format = $4, video_duration = $5, avatar_id = $6, style_preset = $7, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, project.ID, project.Script, project.Language, project.Format, project.VideoDuration,
+		project.AvatarID, project.StylePreset)
+	return err
+}
+
+type RenderRepository struct {
+	db *sqlx.DB
+}
+
+func NewRenderRepository(db *sqlx.DB) *RenderRepository {
+	return &RenderRepository{db: db}
+}
+
+func (r *RenderRepository) Create(ctx context.Context, render *model.Render) error {
+	query := `
+		INSERT INTO renders (id, project_id, user_id, mode, status, format, duration_seconds, credits_charged, options,
+		                     parent_render_id, timeline)
+		VALUES ($1, $2, $3, $4, 'queued', $5, $6, $7, $8, $9, $10)
+		RETURNING created_at, updated_at
+	`
+
+	if render.ID == "" {
+		render.ID = uuid.New().String()
+	}
+	options := "{}"
+	if len(render.Options) > 0 {
+		options = string(render.Options)
+	}
+	var timeline *string
+	if render.Timeline != nil {
+		t := string(*render.Timeline)
+		timeline = &t
+	}
+
+	err := r.db.QueryRowxContext(
+		ctx,
+		query,
+		render.ID,
+		render.ProjectID,
+		render.UserID,
+		render.Mode,
+		render.Format,
+		render.DurationSeconds,
+		render.CreditsCharged,
+		options,
+		render.ParentRenderID,
+		timeline,
+	).Scan(&render.CreatedAt, &render.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	render.Status = model.ProjectStatusQueued
+	return nil
+}
+
+func (r *RenderRepository) GetByID(ctx context.Context, id string) (*model.Render, error) {
+	render := &model.Render{}
+	query := `
+		SELECT id, project_id, user_id, mode, status, format, duration_seconds, credits_charged, options,
+		       parent_render_id, timeline, video_url, thumbnail_url, error_message, created_at, updated_at, completed_at
+		FROM renders
+		WHERE id = $1
+	`
+
+	err := r.db.GetContext(ctx, render, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return render, nil
+}
+
+func (r *RenderRepository) GetByProjectID(ctx context.Context, projectID string) ([]model.Render, error) {
+	var renders []model.Render
+	query := `
+		SELECT id, project_id, user_id, mode, status, format, duration_seconds, credits_charged, options,
+		       parent_render_id, timeline, video_url, thumbnail_url, error_message, created_at, updated_at, completed_at
+		FROM renders
+		WHERE project_id = $1
+		ORDER BY created_at DESC
+	`
+
+	if err := r.db.SelectContext(ctx, &renders, query, projectID); err != nil {
+		return nil, err
+	}
+
+	return renders, nil
+}
+
+func (r *RenderRepository) GetLatestCompleted(ctx context.Context, projectID string) (*model.Render, error) {
+	render := &model.Render{}
+	query := `
+		SELECT id, project_id, user_id, mode, status, format, duration_seconds, credits_charged, options,
+		       parent_render_id, timeline, video_url, thumbnail_url, error_message, created_at, updated_at, completed_at
+		FROM renders
+		WHERE project_id = $1 AND status = 'completed'
+		ORDER BY completed_at DESC
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, render, query, projectID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return render, nil
+}
+
+func (r *RenderRepository) UpdateStatus(ctx context.Context, id string, status model.ProjectStatus) error {
+	query := `UPDATE renders SET status = $2, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, status)
+	return err
+}
+
+func (r *RenderRepository) SetCompleted(ctx context.Context, id string, videoURL, thumbnailURL string) error {
+	query := `
+		UPDATE renders
+		SET status = 'completed', video_url = $2, thumbnail_url = $3, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, videoURL, thumbnailURL)
+	return err
+}
+
+func (r *RenderRepository) SetFailed(ctx context.Context, id string, errMsg string) error {
+	query := `
+		UPDATE renders
+		SET status = 'failed', error_message = $2, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, errMsg)
+	return err
+}
+
+// SetDuration records the length of the finished video once it is known.
+func (r *RenderRepository) SetDuration(ctx context.Context, id string, seconds int) error {
+	query := `UPDATE renders SET duration_seconds = $2, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, seconds)
+	return err
+}
+
+func (r *RenderRepository) SetMedia(ctx context.Context, id string, videoURL, thumbnailURL *string) error {
+	query := `UPDATE renders SET video_url = $2, thumbnail_url = $3, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, videoURL, thumbnailURL)
+	return err
+}
+
+func (r *RenderRepository) SetSegmentVideo(ctx context.Context, id, videoURL string) error {
+	query := `UPDATE render_segments SET video_url = $2 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, videoURL)
+	return err
+}
+
+func (r *RenderRepository) SaveTimeline(ctx context.Context, id string, timeline []byte) error {
+	query := `UPDATE renders SET timeline = $2, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, string(timeline))
+	return err
+}
+
+func (r *RenderRepository) AddSegment(ctx context.Context, segment *model.RenderSegment) error {
+	query := `
+		INSERT INTO render_segments (id, render_id, scene_id, style_preset, prompt_template_id, position, prompt,
+		                             external_task_id, video_url, duration_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at
+	`
+
+	if segment.ID == "" {
+		segment.ID = uuid.New().String()
+	}
+
+	return r.db.QueryRowxContext(
+		ctx,
+		query,
+		segment.ID,
+		segment.RenderID,
+		segment.SceneID,
+		segment.StylePreset,
+		segment.PromptTemplateID,
+		segment.Position,
+		segment.Prompt,
+		segment.ExternalTaskID,
+		segment.VideoURL,
+		segment.DurationSeconds,
+	).Scan(&segment.CreatedAt)
+}
+
+func (r *RenderRepository) GetSegment(ctx context.Context, id string) (*model.RenderSegment, error) {
+	segment := &model.RenderSegment{}
+	query := `
+		SELECT id, render_id, scene_id, style_preset, prompt_template_id, position, prompt, external_task_id,
+		       video_url, duration_seconds, created_at
+		FROM render_segments
+		WHERE id = $1
+	`
+
+	err := r.db.GetContext(ctx, segment, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return segment, nil
+}
+
+// DeleteSegments removes the render's segments, before it is started again.
+func (r *RenderRepository) DeleteSegments(ctx context.Context, renderID string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM render_segments WHERE render_id = $1`, renderID)
+	return err
+}
+
+func (r *RenderRepository) GetSegments(ctx context.Context, renderID string) ([]model.RenderSegment, error) {
+	var segments []model.RenderSegment
+	query := `
+		SELECT id, render_id, scene_id, style_preset, prompt_template_id, position, prompt, external_task_id,
+		       video_url, duration_seconds, created_at
+		FROM render_segments
+		WHERE render_id = $1
+		ORDER BY position
+	`
+
+	if err := r.db.SelectContext(ctx, &segments, query, renderID); err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+type StoryboardRepository struct {
+	db *sqlx.DB
+}
+
+func NewStoryboardRepository(db *sqlx.DB) *StoryboardRepository {
+	return &StoryboardRepository{db: db}
+}
+
+// ReplaceScenes swaps a project's storyboard for a freshly parsed one.
+func (r *StoryboardRepository) ReplaceScenes(ctx context.Context, projectID string, scenes []model.StoryboardScene) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM storyboard_scenes WHERE project_id = $1`, projectID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO storyboard_scenes (id, project_id, position, role, script, visual_prompt, speech_seconds, duration_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at, updated_at
+	`
+	for i := range scenes {
+		scene := &scenes[i]
+		if scene.ID == "" {
+			scene.ID = uuid.New().String()
+		}
+		scene.ProjectID = projectID
+
+		err := tx.QueryRowxContext(
+			ctx,
+			query,
+			scene.ID,
+			scene.ProjectID,
+			scene.Position,
+			scene.Role,
+			scene.Script,
+			scene.VisualPrompt,
+			scene.SpeechSeconds,
+			scene.DurationSeconds,
+		).Scan(&scene.CreatedAt, &scene.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *StoryboardRepository) GetByProjectID(ctx context.Context, projectID string) ([]model.StoryboardScene, error) {
+	var scenes []model.StoryboardScene
+	query := `
+		SELECT id, project_id, position, role, script, visual_prompt, COALESCE(speech_seconds, 0) AS speech_seconds,
+		       duration_seconds, created_at, updated_at
+		FROM storyboard_scenes
+		WHERE project_id = $1
+		ORDER BY position
+	`
+
+	if err := r.db.SelectContext(ctx, &scenes, query, projectID); err != nil {
+		return nil, err
+	}
+
+	return scenes, nil
+}
+
+func (r *StoryboardRepository) GetScene(ctx context.Context, id string) (*model.StoryboardScene, error) {
+	scene := &model.StoryboardScene{}
+	query := `
+		SELECT id, project_id, position, role, script, visual_prompt, COALESCE(speech_seconds, 0) AS speech_seconds,
+		       duration_seconds, created_at, updated_at
+		FROM storyboard_scenes
+		WHERE id = $1
+	`
+
+	err := r.db.GetContext(ctx, scene, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return scene, nil
+}
+
+func (r *StoryboardRepository) UpdateScene(ctx context.Context, scene *model.StoryboardScene) error {
+	query := `
+		UPDATE storyboard_scenes
+		SET role = $2, script = $3, visual_prompt = $4, speech_seconds = $5, duration_seconds = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	return r.db.QueryRowxContext(
+		ctx,
+		query,
+		scene.ID,
+		scene.Role,
+		scene.Script,
+		scene.VisualPrompt,
+		scene.SpeechSeconds,
+		scene.DurationSeconds,
+	).Scan(&scene.UpdatedAt)
+}
+
+type AvatarRepository struct {
+	db *sqlx.DB
+}
+
+func NewAvatarRepository(db *sqlx.DB) *AvatarRepository {
+	return &AvatarRepository{db: db}
+}
+
+func (r *AvatarRepository) GetByID(ctx context.Context, id string) (*model.Avatar, error) {
+	avatar := &model.Avatar{}
+	query := `
+		SELECT id, name, display_name, gender, age_range, ethnicity, style, preview_video_url, thumbnail_url,
+		       is_premium, usage_count
+		FROM avatars
+		WHERE id = $1 AND is_active = true
+	`
+
+	err := r.db.GetContext(ctx, avatar, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return avatar, nil
+}
+
+type PromptRepository struct {
+	db *sqlx.DB
+}
+
+func NewPromptRepository(db *sqlx.DB) *PromptRepository {
+	return &PromptRepository{db: db}
+}
+
+func (r *PromptRepository) ListPresets(ctx context.Context) ([]model.StylePreset, error) {
+	var presets []model.StylePreset
+	query := `
+		SELECT id, slug, name, description, camera, lighting, setting, mood, is_default
+		FROM style_presets
+		WHERE is_active = true
+		ORDER BY sort_order, name
+	`
+
+	if err := r.db.SelectContext(ctx, &presets, query); err != nil {
+		return nil, err
+	}
+
+	return presets, nil
+}
+
+// GetPreset returns the preset with the given slug, or the default preset
+// when slug is empty.
+func (r *PromptRepository) GetPreset(ctx context.Context, slug string) (*model.StylePreset, error) {
+	preset := &model.StylePreset{}
+	query := `
+		SELECT id, slug, name, description, camera, lighting, setting, mood, is_default
+		FROM style_presets
+		WHERE is_active = true AND (slug = $1 OR ($1 = '' AND is_default = true))
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, preset, query, slug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return preset, nil
+}
+
+// GetTemplate returns the template for a scene role, falling back to the
+// role-less default template.
+func (r *PromptRepository) GetTemplate(ctx context.Context, role string) (*model.PromptTemplate, error) {
+	tmpl := &model.PromptTemplate{}
+	query := `
+		SELECT id, name, role, body
+		FROM prompt_templates
+		WHERE is_active = true AND (role::text = $1 OR role IS NULL)
+		ORDER BY role NULLS LAST, updated_at DESC
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, tmpl, query, role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+type AssetRepository struct {
+	db *sqlx.DB
+}
+
+func NewAssetRepository(db *sqlx.DB) *AssetRepository {
+	return &AssetRepository{db: db}
+}
+
+func (r *AssetRepository) Create(ctx context.Context, asset *model.Asset) error {
+	query := `
+		INSERT INTO assets (id, project_id, render_id, user_id, type, purpose, filename, original_filename, url,
+		                    thumbnail_url, storage_key, checksum_sha256, source_url, file_size_bytes, mime_type,
+		                    width, height, duration_seconds, alt_text, is_primary, blob_sha256)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		RETURNING created_at, updated_at
+	`
+
+	if asset.ID == "" {
+		asset.ID = uuid.New().String()
+	}
+
+	return r.db.QueryRowxContext(
+		ctx,
+		query,
+		asset.ID,
+		asset.ProjectID,
+		asset.RenderID,
+		asset.UserID,
+		asset.Type,
+		asset.Purpose,
+		asset.Filename,
+		asset.OriginalFilename,
+		asset.URL,
+		asset.ThumbnailURL,
+		asset.StorageKey,
+		asset.ChecksumSHA256,
+		asset.SourceURL,
+		asset.FileSizeBytes,
+		asset.MimeType,
+		asset.Width,
+		asset.Height,
+		asset.DurationSeconds,
+		asset.AltText,
+		asset.IsPrimary,
+		asset.BlobSHA256,
+	).Scan(&asset.CreatedAt, &asset.UpdatedAt)
+}
+
+const assetColumns = `id, project_id, render_id, user_id, type, purpose, filename, original_filename, url,
+		thumbnail_url, storage_key, checksum_sha256, source_url, file_size_bytes, mime_type,
+		width, height, duration_seconds, alt_text, COALESCE(is_primary, false) AS is_primary,
+		blob_sha256, created_at, updated_at`
+
+func (r *AssetRepository) GetByID(ctx context.Context, id string) (*model.Asset, error) {
+	asset := &model.Asset{}
+	query := `SELECT ` + assetColumns + ` FROM assets WHERE id = $1`
+
+	if err := r.db.GetContext(ctx, asset, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return asset, nil
+}
+
+// GetByStorageKey finds the user's asset stored under key.
+func (r *AssetRepository) GetByStorageKey(ctx context.Context, userID, key string) (*model.Asset, error) {
+	asset := &model.Asset{}
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE user_id = $1 AND storage_key = $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	if err := r.db.GetContext(ctx, asset, query, userID, key); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return asset, nil
+}
+
+func (r *AssetRepository) List(ctx context.Context, userID string, filter model.AssetListFilter, limit, offset int) ([]model.Asset, int, error) {
+	where := `user_id = $1 AND ($2 = '' OR purpose::text = $2) AND ($3 = '' OR project_id::text = $3)`
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM assets WHERE ` + where
+	if err := r.db.GetContext(ctx, &total, countQuery, userID, string(filter.Purpose), filter.ProjectID); err != nil {
+		return nil, 0, err
+	}
+
+	assets := []model.Asset{}
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE ` + where + `
+		ORDER BY created_at DESC
+		LIMIT $4 OFFSET $5
+	`
+	if err := r.db.SelectContext(ctx, &assets, query, userID, string(filter.Purpose), filter.ProjectID, limit, offset); err != nil {
+		return nil, 0, err
+	}
+
+	return assets, total, nil
+}
+
+func (r *AssetRepository) UpdateAltText(ctx context.Context, id string, altText *string) error {
+	query := `UPDATE assets SET alt_text = $2 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, altText)
+	return err
+}
+
+// SetPrimary marks the asset as the primary one for its project and purpose,
+// clearing the flag on the others.
+func (r *AssetRepository) SetPrimary(ctx context.Context, asset *model.Asset) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE assets SET is_primary = false WHERE project_id = $1 AND purpose = $2 AND is_primary AND id <> $3`,
+		asset.ProjectID, asset.Purpose, asset.ID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE assets SET is_primary = true WHERE id = $1`, asset.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *AssetRepository) ClearPrimary(ctx context.Context, id string) error {
+	query := `UPDATE assets SET is_primary = false WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// AttachToProject assigns an unattached asset to a project.
+func (r *AssetRepository) AttachToProject(ctx context.Context, id, projectID string) error {
+	query := `UPDATE assets SET project_id = $2 WHERE id = $1 AND (project_id IS NULL OR project_id = $2)`
+	result, err := r.db.ExecContext(ctx, query, id, projectID)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *AssetRepository) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM assets WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// StorageUsage sums the bytes of a user's stored files and variants. Files
+// shared by several assets count once.
+func (r *AssetRepository) StorageUsage(ctx context.Context, userID string) (int64, error) {
+	var used int64
+	query := `
+		SELECT COALESCE(SUM(size), 0) FROM (
+			SELECT COALESCE(storage_key, id::text) AS key, COALESCE(file_size_bytes, 0) AS size
+			FROM assets WHERE user_id = $1
+			UNION
+			SELECT v.storage_key, COALESCE(v.file_size_bytes, 0)
+			FROM asset_variants v JOIN assets a ON a.id = v.asset_id
+			WHERE a.user_id = $1
+		) stored
+	`
+
+	if err := r.db.GetContext(ctx, &used, query, userID); err != nil {
+		return 0, err
+	}
+	return used, nil
+}
+
+// ListOrphaned returns assets of a tier's users that no project uses:
+// render output whose project was deleted, and unattached uploads created
+// before cutoff. A zero cutoff keeps unattached uploads.
+func (r *AssetRepository) ListOrphaned(ctx context.Context, tier string, cutoff time.Time, limit int) ([]model.Asset, error) {
+	assets := []model.Asset{}
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE id IN (
+			SELECT a.id
+			FROM assets a
+			JOIN profiles u ON u.id = a.user_id
+			WHERE u.subscription_tier = $1 AND a.project_id IS NULL
+			  AND (
+			        (a.purpose IN ('generated_video', 'thumbnail') AND a.render_id IS NULL)
+			     OR ($2::timestamptz IS NOT NULL AND a.created_at < $2)
+			  )
+			  AND NOT EXISTS (SELECT 1 FROM projects p WHERE p.product_image_asset_id = a.id)
+			ORDER BY a.created_at
+			LIMIT $3
+		)
+		ORDER BY created_at
+	`
+
+	var before *time.Time
+	if !cutoff.IsZero() {
+		before = &cutoff
+	}
+	if err := r.db.SelectContext(ctx, &assets, query, tier, before, limit); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// ListByBlob returns the user's assets stored in the blob, newest first.
+func (r *AssetRepository) ListByBlob(ctx context.Context, userID, sha256 string) ([]model.Asset, error) {
+	assets := []model.Asset{}
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE user_id = $1 AND blob_sha256 = $2
+		ORDER BY created_at DESC
+	`
+
+	if err := r.db.SelectContext(ctx, &assets, query, userID, sha256); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (r *AssetRepository) GetBlob(ctx context.Context, userID, sha256 string) (*model.AssetBlob, error) {
+	blob := &model.AssetBlob{}
+	query := `
+		SELECT user_id, sha256, storage_key, size_bytes, ref_count, created_at, updated_at
+		FROM asset_blobs
+		WHERE user_id = $1 AND sha256 = $2
+	`
+
+	if err := r.db.GetContext(ctx, blob, query, userID, sha256); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return blob, nil
+}
+
+// ListUnreferencedBlobs returns blobs whose last asset is gone.
+func (r *AssetRepository) ListUnreferencedBlobs(ctx context.Context, limit int) ([]model.AssetBlob, error) {
+	blobs := []model.AssetBlob{}
+	query := `
+		SELECT user_id, sha256, storage_key, size_bytes, ref_count, created_at, updated_at
+		FROM asset_blobs
+		WHERE ref_count = 0
+		ORDER BY updated_at
+		LIMIT $1
+	`
+
+	if err := r.db.SelectContext(ctx, &blobs, query, limit); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// DeleteBlob removes a blob that no asset references. remove runs while the
+// row is locked, so an upload of the same content waits until the stored
+// objects are gone. It reports false when the blob is still referenced.
+func (r *AssetRepository) DeleteBlob(ctx context.Context, userID, sha256 string, remove func(*model.AssetBlob) error) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	blob := &model.AssetBlob{}
+	query := `
+		SELECT user_id, sha256, storage_key, size_bytes, ref_count, created_at, updated_at
+		FROM asset_blobs
+		WHERE user_id = $1 AND sha256 = $2 AND ref_count = 0
+		FOR UPDATE
+	`
+	if err := tx.GetContext(ctx, blob, query, userID, sha256); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := remove(blob); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM asset_blobs WHERE user_id = $1 AND sha256 = $2`, userID, sha256); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// SaveVariant stores a variant, replacing an earlier one for the same format.
+func (r *AssetRepository) SaveVariant(ctx context.Context, variant *model.AssetVariant) error {
+	query := `
+		INSERT INTO asset_variants (id, asset_id, format, fit, url, storage_key, width, height, file_size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (asset_id, format) DO UPDATE SET
+			fit = EXCLUDED.fit,
+			url = EXCLUDED.url,
+			storage_key = EXCLUDED.storage_key,
+			width = EXCLUDED.width,
+			height = EXCLUDED.height,
+			file_size_bytes = EXCLUDED.file_size_bytes
+		RETURNING id, created_at
+	`
+
+	if variant.ID == "" {
+		variant.ID = uuid.New().String()
+	}
+
+	return r.db.QueryRowxContext(
+		ctx,
+		query,
+		variant.ID,
+		variant.AssetID,
+		variant.Format,
+		variant.Fit,
+		variant.URL,
+		variant.StorageKey,
+		variant.Width,
+		variant.Height,
+		variant.FileSizeBytes,
+	).Scan(&variant.ID, &variant.CreatedAt)
+}
+
+func (r *AssetRepository) ListVariants(ctx context.Context, assetID string) ([]model.AssetVariant, error) {
+	variants := []model.AssetVariant{}
+	query := `
+		SELECT id, asset_id, format, fit, url, storage_key, width, height, file_size_bytes, created_at
+		FROM asset_variants
+		WHERE asset_id = $1
+		ORDER BY format
+	`
+
+	if err := r.db.SelectContext(ctx, &variants, query, assetID); err != nil {
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+func (r *AssetRepository) GetVariant(ctx context.Context, assetID string, format model.VideoFormat) (*model.AssetVariant, error) {
+	variant := &model.AssetVariant{}
+	query := `
+		SELECT id, asset_id, format, fit, url, storage_key, width, height, file_size_bytes, created_at
+		FROM asset_variants
+		WHERE asset_id = $1 AND format = $2
+	`
+
+	if err := r.db.GetContext(ctx, variant, query, assetID, format); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return variant, nil
+}
+
+type UploadRepository struct {
+	db *sqlx.DB
+}
+
+func NewUploadRepository(db *sqlx.DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+const uploadSessionColumns = `id, user_id, project_id, purpose, filename, upload_length, upload_offset,
+		status, asset_id, error, expires_at, created_at, updated_at`
+
+func (r *UploadRepository) Create(ctx context.Context, session *model.UploadSession) error {
+	query := `
+		INSERT INTO upload_sessions (id, user_id, project_id, purpose, filename, upload_length, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING upload_offset, status, created_at, updated_at
+	`
+
+	session.ID = uuid.New().String()
+	return r.db.QueryRowxContext(
+		ctx,
+		query,
+		session.ID,
+		session.UserID,
+		session.ProjectID,
+		session.Purpose,
+		session.Filename,
+		session.UploadLength,
+		session.ExpiresAt,
+	).Scan(&session.UploadOffset, &session.Status, &session.CreatedAt, &session.UpdatedAt)
+}
+
+func (r *UploadRepository) GetByID(ctx context.Context, id string) (*model.UploadSession, error) {
+	session := &model.UploadSession{}
+	query := `SELECT ` + uploadSessionColumns + ` FROM upload_sessions WHERE id = $1`
+
+	if err := r.db.GetContext(ctx, session, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// AppendChunk records a stored chunk and advances the offset, provided no
+// other request moved it first. It returns ErrConflict otherwise.
+func (r *UploadRepository) AppendChunk(ctx context.Context, chunk *model.UploadChunk) (*model.UploadSession, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session := &model.UploadSession{}
+	query := `
+		UPDATE upload_sessions
+		SET upload_offset = upload_offset + $3
+		WHERE id = $1 AND upload_offset = $2 AND status = 'uploading'
+			AND upload_offset + $3 <= upload_length
+		RETURNING ` + uploadSessionColumns
+
+	if err := tx.GetContext(ctx, session, query, chunk.SessionID, chunk.Offset, chunk.Size); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO upload_chunks (session_id, chunk_offset, size, storage_key) VALUES ($1, $2, $3, $4)`,
+		chunk.SessionID, chunk.Offset, chunk.Size, chunk.StorageKey,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *UploadRepository) ListChunks(ctx context.Context, sessionID string) ([]model.UploadChunk, error) {
+	chunks := []model.UploadChunk{}
+	query := `
+		SELECT session_id, chunk_offset, size, storage_key
+		FROM upload_chunks
+		WHERE session_id = $1
+		ORDER BY chunk_offset
+	`
+
+	if err := r.db.SelectContext(ctx, &chunks, query, sessionID); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// SetStatus moves a session from one status to another. It returns
+// ErrConflict when the session was not in the expected status.
+func (r *UploadRepository) SetStatus(ctx context.Context, id string, from, to model.UploadStatus) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET status = $3 WHERE id = $1 AND status = $2`,
+		id, from, to,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *UploadRepository) Complete(ctx context.Context, id, assetID string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET status = 'completed', asset_id = $2, error = NULL WHERE id = $1`,
+		id, assetID,
+	)
+	return err
+}
+
+func (r *UploadRepository) Fail(ctx context.Context, id, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET status = 'failed', error = $2 WHERE id = $1`,
+		id, reason,
+	)
+	return err
+}
+
+// FailStale fails sessions still processing since before idleSince and
+// returns how many there were.
+func (r *UploadRepository) FailStale(ctx context.Context, idleSince time.Time, reason string) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET status = 'failed', error = $2 WHERE status = 'processing' AND updated_at < $1`,
+		idleSince, reason,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteChunks forgets a session's chunks once their objects are removed.
+func (r *UploadRepository) DeleteChunks(ctx context.Context, sessionID string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM upload_chunks WHERE session_id = $1`, sessionID)
+	return err
+}
+
+func (r *UploadRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = $1`, id)
+	return err
+}
+
+// PendingBytes is the space reserved by a user's uploads in progress.
+func (r *UploadRepository) PendingBytes(ctx context.Context, userID string) (int64, error) {
+	var pending int64
+	query := `SELECT COALESCE(SUM(upload_length), 0) FROM upload_sessions WHERE user_id = $1 AND status = 'uploading'`
+
+	if err := r.db.GetContext(ctx, &pending, query, userID); err != nil {
+		return 0, err
+	}
+	return pending, nil
+}
+
+// ListExpired returns unfinished or failed sessions past their expiry.
+func (r *UploadRepository) ListExpired(ctx context.Context, limit int) ([]model.UploadSession, error) {
+	sessions := []model.UploadSession{}
+	query := `
+		SELECT ` + uploadSessionColumns + `
+		FROM upload_sessions
+		WHERE status IN ('uploading', 'failed') AND expires_at < NOW()
+		ORDER BY expires_at
+		LIMIT $1
+	`
+
+	if err := r.db.SelectContext(ctx, &sessions, query, limit); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+type AdminRepository struct {
+	db *sqlx.DB
+}
+
+func NewAdminRepository(db *sqlx.DB) *AdminRepository {
+	return &AdminRepository{db: db}
+}
+
+const adminAuditColumns = `id, actor_id, action, target_user_id, target_project_id, reason,
+		COALESCE(metadata, '{}') AS metadata, ip_address, user_agent, created_at`
+
+// SearchUsers returns the profiles matching filter, newest first.
+func (r *AdminRepository) SearchUsers(ctx context.Context, filter model.AdminUserFilter, limit, offset int) ([]model.Profile, int, error) {
+	where := `($1 = '' OR id::text = $1 OR email ILIKE '%' || $1 || '%' OR full_name ILIKE '%' || $1 || '%')
+		AND ($2 = '' OR role = $2) AND ($3 = '' OR subscription_tier = $3)
+		AND ($4::boolean IS NULL OR (disabled_at IS NOT NULL) = $4)`
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM profiles WHERE ` + where
+	if err := r.db.GetContext(ctx, &total, countQuery, filter.Query, filter.Role, filter.Tier, filter.Disabled); err != nil {
+		return nil, 0, err
+	}
+
+	profiles := []model.Profile{}
+	query := `
+		SELECT ` + profileColumns + `
+		FROM profiles
+		WHERE ` + where + `
+		ORDER BY created_at DESC
+		LIMIT $5 OFFSET $6
+	`
+	if err := r.db.SelectContext(ctx, &profiles, query, filter.Query, filter.Role, filter.Tier, filter.Disabled, limit, offset); err != nil {
+		return nil, 0, err
+	}
+
+	return profiles, total, nil
+}
+
+// AdjustCredits adds amount, which may be negative, to the user's balance
+// and returns the new balance. The change is audited and shown in the
+// user's usage log. A balance cannot go below zero: ErrNoCredits.
+func (r *AdminRepository) AdjustCredits(ctx context.Context, userID string, amount int, entry *model.AdminAuditEntry) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var balance int
+	err = tx.QueryRowxContext(ctx, `
+		UPDATE profiles SET credits_remaining = credits_remaining + $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING credits_remaining
+	`, userID, amount).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if balance < 0 {
+		return 0, ErrNoCredits
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO usage_logs (user_id, event, description, metadata)
+		VALUES ($1, 'credit_adjusted', 'Credits adjusted by support', jsonb_build_object('amount', $2::int, 'balance', $3::int))
+	`, userID, amount, balance)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertAuditEntry(ctx, tx, entry); err != nil {
+		return 0, err
+	}
+	return balance, tx.Commit()
+}
+
+// SetTier changes the user's subscription tier and audits it.
+func (r *AdminRepository) SetTier(ctx context.Context, userID, tier string, entry *model.AdminAuditEntry) error {
+	return r.updateProfile(ctx, `UPDATE profiles SET subscription_tier = $2, updated_at = NOW() WHERE id = $1`,
+		userID, tier, "", entry)
+}
+
+// SetRole changes the user's role and audits it. The user's sessions are
+// revoked, so no token carries the old role.
+func (r *AdminRepository) SetRole(ctx context.Context, userID, role string, entry *model.AdminAuditEntry) error {
+	return r.updateProfile(ctx, `UPDATE profiles SET role = $2, updated_at = NOW() WHERE id = $1`,
+		userID, role, model.SessionRevokedRoleChange, entry)
+}
+
+// SetDisabled disables or re-enables the user's account and audits it.
+// Disabling revokes every session.
+func (r *AdminRepository) SetDisabled(ctx context.Context, userID string, disabled bool, entry *model.AdminAuditEntry) error {
+	query := `
+		UPDATE profiles
+		SET disabled_at = CASE WHEN $2::boolean THEN COALESCE(disabled_at, NOW()) END, updated_at = NOW()
+		WHERE id = $1
+	`
+	revokeReason := ""
+	if disabled {
+		revokeReason = model.SessionRevokedDisabled
+	}
+	return r.updateProfile(ctx, query, userID, disabled, revokeReason, entry)
+}
+
+// updateProfile runs an update of one profile, taking the profile ID and a
+// value, then revokes the profile's sessions when revokeReason is set and
+// records entry, all in one transaction.
+func (r *AdminRepository) updateProfile(ctx context.Context, query, userID string, value interface{}, revokeReason string, entry *model.AdminAuditEntry) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userID, value)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+
+	if revokeReason != "" {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE auth_sessions SET revoked_at = NOW(), revoked_reason = $2
+			WHERE user_id = $1 AND revoked_at IS NULL
+		`, userID, revokeReason)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := insertAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Record audits an action whose change was made elsewhere.
+func (r *AdminRepository) Record(ctx context.Context, entry *model.AdminAuditEntry) error {
+	return insertAuditEntry(ctx, r.db, entry)
+}
+
+// ListAudit returns the audit entries matching filter, newest first.
+func (r *AdminRepository) ListAudit(ctx context.Context, filter model.AdminAuditFilter, limit, offset int) ([]model.AdminAuditEntry, int, error) {
+	where := `($1 = '' OR actor_id::text = $1) AND ($2 = '' OR target_user_id::text = $2) AND ($3 = '' OR action = $3)`
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM admin_audit_log WHERE ` + where
+	if err := r.db.GetContext(ctx, &total, countQuery, filter.ActorID, filter.TargetUserID, filter.Action); err != nil {
+		return nil, 0, err
+	}
+
+	entries := []model.AdminAuditEntry{}
+	query := `
+		SELECT ` + adminAuditColumns + `
+		FROM admin_audit_log
+		WHERE ` + where + `
+		ORDER BY created_at DESC
+		LIMIT $4 OFFSET $5
+	`
+	if err := r.db.SelectContext(ctx, &entries, query, filter.ActorID, filter.TargetUserID, filter.Action, limit, offset); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+func insertAuditEntry(ctx context.Context, q sqlx.QueryerContext, entry *model.AdminAuditEntry) error {
+	metadata := "{}"
+	if len(entry.Metadata) > 0 {
+		metadata = string(entry.Metadata)
+	}
+
+	return q.QueryRowxContext(ctx, `
+		INSERT INTO admin_audit_log (actor_id, action, target_user_id, target_project_id, reason, metadata, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, entry.ActorID, entry.Action, entry.TargetUserID, entry.TargetProjectID, entry.Reason, metadata, entry.IPAddress, entry.UserAgent).
+		Scan(&entry.ID, &entry.CreatedAt)
 }
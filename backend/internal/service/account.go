@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/mailer"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/pkg/auth"
+)
+
+var (
+	ErrInvalidAccountToken  = errors.New("link is invalid, expired or already used")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrTooManyEmails        = errors.New("too many emails sent to this address; try again later")
+)
+
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+
+	// At most accountEmailLimit links of each kind are sent to an address
+	// per accountEmailWindow.
+	accountEmailLimit  = 3
+	accountEmailWindow = time.Hour
+
+	mailTimeout = 30 * time.Second
+)
+
+// AccountService sends and confirms the emailed links that verify an
+// address and reset a forgotten password.
+type AccountService struct {
+	profileRepo *repository.ProfileRepository
+	tokenRepo   *repository.AccountTokenRepository
+	sessionRepo *repository.SessionRepository
+	mailer      mailer.Mailer
+	cfg         *config.Config
+}
+
+func NewAccountService(profileRepo *repository.ProfileRepository, tokenRepo *repository.AccountTokenRepository, sessionRepo *repository.SessionRepository, mailer mailer.Mailer, cfg *config.Config) *AccountService {
+	return &AccountService{
+		profileRepo: profileRepo,
+		tokenRepo:   tokenRepo,
+		sessionRepo: sessionRepo,
+		mailer:      mailer,
+		cfg:         cfg,
+	}
+}
+
+// SendVerification emails a verification link to the profile's address.
+func (s *AccountService) SendVerification(ctx context.Context, profile *model.Profile) error {
+	if profile.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issueToken(ctx, profile, model.AccountTokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.link("/verify-email", token)
+	s.deliver(&mailer.Message{
+		To:      profile.Email,
+		Subject: "Confirm your Genvid email",
+		Text: "Confirm your email address to start using Genvid and receive your free credits:\n\n" +
+			link + "\n\nThe link expires in 48 hours. If you did not create an account, ignore this email.\n",
+		HTML: emailHTML("Confirm your email address to start using Genvid and receive your free credits.",
+			"Confirm email", link, "The link expires in 48 hours. If you did not create an account, ignore this email."),
+	})
+	return nil
+}
+
+// ResendVerification sends a new verification link to the signed-in user.
+func (s *AccountService) ResendVerification(ctx context.Context, userID string) error {
+	profile, err := s.profileRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.SendVerification(ctx, profile)
+}
+
+// VerifyEmail confirms the address a verification link was sent to and
+// grants the free credits on the first confirmation.
+func (s *AccountService) VerifyEmail(ctx context.Context, rawToken string) (*model.Profile, error) {
+	token, err := s.tokenRepo.Consume(ctx, hashToken(rawToken), model.AccountTokenVerifyEmail)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.profileRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// The link confirms the address it was sent to, not a later one.
+	if profile.Email != token.Email {
+		return nil, ErrInvalidAccountToken
+	}
+	if _, err := s.profileRepo.VerifyEmail(ctx, profile.ID, token.Email); err != nil {
+		return nil, err
+	}
+
+	return s.profileRepo.GetByID(ctx, profile.ID)
+}
+
+// ForgotPassword emails a password reset link. It returns nil for unknown
+// addresses so callers cannot tell which emails have accounts.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	profile, err := s.profileRepo.GetByEmail(ctx, strings.TrimSpace(email))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, profile, model.AccountTokenResetPassword, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.link("/reset-password", token)
+	s.deliver(&mailer.Message{
+		To:      profile.Email,
+		Subject: "Reset your Genvid password",
+		Text: "Someone asked to reset the password of your Genvid account. Choose a new password here:\n\n" +
+			link + "\n\nThe link expires in 1 hour. If you did not ask for this, ignore this email; your password is unchanged.\n",
+		HTML: emailHTML("Someone asked to reset the password of your Genvid account.",
+			"Choose a new password", link, "The link expires in 1 hour. If you did not ask for this, ignore this email; your password is unchanged."),
+	})
+	return nil
+}
+
+// NotifyLockout tells the owner that sign-in to their account is paused
+// after repeated failed attempts, in case someone is guessing the password.
+func (s *AccountService) NotifyLockout(profile *model.Profile, failures int, lockout time.Duration) {
+	link := strings.TrimSuffix(s.cfg.Server.AppURL, "/") + "/forgot-password"
+	intro := fmt.Sprintf("Sign-in to your Genvid account was paused for %d minutes after %d failed attempts.", int(lockout.Minutes()), failures)
+	s.deliver(&mailer.Message{
+		To:      profile.Email,
+		Subject: "Sign-in to your Genvid account was paused",
+		Text: intro + " If this was not you, someone may be guessing your password; choose a new one here:\n\n" +
+			link + "\n\nIf it was you, wait and try again.\n",
+		HTML: emailHTML(intro+" If this was not you, someone may be guessing your password.",
+			"Choose a new password", link, "If it was you, wait and try again."),
+	})
+}
+
+// ResetPassword sets a new password with a reset link's token and signs out
+// every session. Following the link also proves the address, so an
+// unverified email is verified.
+func (s *AccountService) ResetPassword(ctx context.Context, req *model.ResetPasswordRequest) error {
+	// Hash first so a rejected password does not use up the link.
+	passwordHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.tokenRepo.Consume(ctx, hashToken(req.Token), model.AccountTokenResetPassword)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidAccountToken
+	}
+	if err != nil {
+		return err
+	}
+
+	profile, err := s.profileRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return err
+	}
+	if profile.Email != token.Email {
+		return ErrInvalidAccountToken
+	}
+
+	if err := s.profileRepo.SetPassword(ctx, profile.ID, passwordHash); err != nil {
+		return err
+	}
+	if _, err := s.sessionRepo.RevokeAll(ctx, profile.ID, "", model.SessionRevokedPasswordReset); err != nil {
+		return err
+	}
+	if _, err := s.profileRepo.VerifyEmail(ctx, profile.ID, profile.Email); err != nil {
+		log.Printf("Failed to verify email of %s after password reset: %v", profile.ID, err)
+	}
+	return nil
+}
+
+// issueToken stores a new token for the profile's address, unless the
+// address has had too many links of this kind recently.
+func (s *AccountService) issueToken(ctx context.Context, profile *model.Profile, purpose model.AccountTokenPurpose, ttl time.Duration) (string, error) {
+	sent, err := s.tokenRepo.CountSince(ctx, profile.Email, purpose, time.Now().Add(-accountEmailWindow))
+	if err != nil {
+		return "", err
+	}
+	if sent >= accountEmailLimit {
+		return "", ErrTooManyEmails
+	}
+
+	raw := randomToken()
+	err = s.tokenRepo.Create(ctx, &model.AccountToken{
+		UserID:    profile.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(raw),
+		Email:     profile.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// deliver sends the message in the background, so the response does not
+// wait for the mail provider or reveal by its timing that an account
+// exists.
+func (s *AccountService) deliver(msg *mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// link builds a frontend URL carrying the token.
+func (s *AccountService) link(path, token string) string {
+	return strings.TrimSuffix(s.cfg.Server.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// hashToken is how emailed links and refresh tokens are stored.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func emailHTML(intro, action, link, footer string) string {
+	return fmt.Sprintf(`<p>%s</p>
+<p><a href="%s" style="display:inline-block;padding:10px 18px;background:#111;color:#fff;text-decoration:none;border-radius:6px">%s</a></p>
+<p style="color:#666;font-size:13px">%s<br>%s</p>
+`, html.EscapeString(intro), html.EscapeString(link), html.EscapeString(action), html.EscapeString(footer), html.EscapeString(link))
+}
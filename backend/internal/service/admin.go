@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrReasonRequired     = errors.New("a reason of at most 500 characters is required")
+	ErrInvalidCreditDelta = errors.New("amount must be non-zero and at most 10000 either way")
+	ErrInvalidTier        = errors.New("unknown subscription tier")
+	ErrInvalidRole        = errors.New("role must be user, support or admin")
+	ErrSelfAdminAction    = errors.New("staff cannot change their own role or disable their own account")
+)
+
+const (
+	maxAdminReason      = 500
+	maxCreditAdjustment = 10000
+	maxStuckProjects    = 100
+)
+
+// AdminAction is who is acting through the admin API, and why.
+type AdminAction struct {
+	ActorID string
+	Reason  string
+	Client  model.ClientInfo
+}
+
+// AdminService lets support staff look up accounts and fix them. Every
+// change is recorded in the admin audit log with its actor and reason, and
+// every read of account data with its actor.
+type AdminService struct {
+	adminRepo      *repository.AdminRepository
+	profileRepo    *repository.ProfileRepository
+	projectRepo    *repository.ProjectRepository
+	sessionRepo    *repository.SessionRepository
+	mfaRepo        *repository.MFARepository
+	usageLogRepo   *repository.UsageLogRepository
+	projectService *ProjectService
+	storageService *StorageService
+}
+
+func NewAdminService(adminRepo *repository.AdminRepository, profileRepo *repository.ProfileRepository, projectRepo *repository.ProjectRepository, sessionRepo *repository.SessionRepository, mfaRepo *repository.MFARepository, usageLogRepo *repository.UsageLogRepository, projectService *ProjectService, storageService *StorageService) *AdminService {
+	return &AdminService{
+		adminRepo:      adminRepo,
+		profileRepo:    profileRepo,
+		projectRepo:    projectRepo,
+		sessionRepo:    sessionRepo,
+		mfaRepo:        mfaRepo,
+		usageLogRepo:   usageLogRepo,
+		projectService: projectService,
+		storageService: storageService,
+	}
+}
+
+// SearchUsers finds accounts. Searches are audited with their filter.
+func (s *AdminService) SearchUsers(ctx context.Context, filter model.AdminUserFilter, page, limit int, action AdminAction) ([]model.Profile, int, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	metadata := map[string]interface{}{"query": filter.Query, "role": filter.Role, "tier": filter.Tier, "page": page}
+	if filter.Disabled != nil {
+		metadata["disabled"] = *filter.Disabled
+	}
+	if err := s.recordRead(ctx, model.AdminActionSearchUsers, "", action, metadata); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	return s.adminRepo.SearchUsers(ctx, filter, limit, offset)
+}
+
+// GetUser returns the account with its storage, second factor and
+// signed-in devices.
+func (s *AdminService) GetUser(ctx context.Context, userID string, action AdminAction) (*model.AdminUser, error) {
+	profile, err := s.getProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recordRead(ctx, model.AdminActionViewUser, userID, action, nil); err != nil {
+		return nil, err
+	}
+
+	user := &model.AdminUser{Profile: *profile}
+	if user.Storage, err = s.storageService.Usage(ctx, userID); err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled, err = s.mfaRepo.IsEnabled(ctx, userID); err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessionRepo.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.ActiveSessions = len(sessions)
+	return user, nil
+}
+
+func (s *AdminService) ListProjects(ctx context.Context, userID string, page, limit int, action AdminAction) ([]model.Project, int, error) {
+	if _, err := s.getProfile(ctx, userID); err != nil {
+		return nil, 0, err
+	}
+	if err := s.recordRead(ctx, model.AdminActionViewProjects, userID, action, map[string]interface{}{"page": page}); err != nil {
+		return nil, 0, err
+	}
+	projects, total, err := s.projectRepo.GetByUserID(ctx, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.projectService.SignProjects(ctx, projects), total, nil
+}
+
+// ListUsage returns the user's usage log: generations, credit changes and
+// sign-ins.
+func (s *AdminService) ListUsage(ctx context.Context, userID string, page, limit int, action AdminAction) ([]model.UsageLog, int, error) {
+	if _, err := s.getProfile(ctx, userID); err != nil {
+		return nil, 0, err
+	}
+	if err := s.recordRead(ctx, model.AdminActionViewUsage, userID, action, map[string]interface{}{"page": page}); err != nil {
+		return nil, 0, err
+	}
+	return s.usageLogRepo.ListByUser(ctx, userID, limit, (page-1)*limit)
+}
+
+// AdjustCredits adds amount, which may be negative, to the user's balance
+// and returns the updated profile.
+func (s *AdminService) AdjustCredits(ctx context.Context, userID string, amount int, action AdminAction) (*model.Profile, error) {
+	if amount == 0 || amount > maxCreditAdjustment || amount < -maxCreditAdjustment {
+		return nil, ErrInvalidCreditDelta
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, repository.ErrNotFound
+	}
+	entry, err := s.auditEntry(model.AdminActionAdjustCredits, userID, "", action, map[string]interface{}{
+		"amount": amount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := s.adminRepo.AdjustCredits(ctx, userID, amount, entry)
+	if errors.Is(err, repository.ErrNoCredits) {
+		return nil, ErrInsufficientCredits
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.profileRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	profile.CreditsRemaining = balance
+	return profile, nil
+}
+
+// ChangeTier sets the user's subscription tier without billing them.
+func (s *AdminService) ChangeTier(ctx context.Context, userID, tier string, action AdminAction) (*model.Profile, error) {
+	if !containsString(model.SubscriptionTiers, tier) {
+		return nil, ErrInvalidTier
+	}
+	profile, err := s.getProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.auditEntry(model.AdminActionChangeTier, userID, "", action, map[string]interface{}{
+		"from": profile.SubscriptionTier,
+		"to":   tier,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.adminRepo.SetTier(ctx, userID, tier, entry); err != nil {
+		return nil, err
+	}
+	return s.profileRepo.GetByID(ctx, userID)
+}
+
+// ChangeRole grants or removes staff access. The user is signed out
+// everywhere, so the new role applies at once.
+func (s *AdminService) ChangeRole(ctx context.Context, userID, role string, action AdminAction) (*model.Profile, error) {
+	if !containsString(model.Roles, role) {
+		return nil, ErrInvalidRole
+	}
+	if userID == action.ActorID {
+		return nil, ErrSelfAdminAction
+	}
+	profile, err := s.getProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.auditEntry(model.AdminActionChangeRole, userID, "", action, map[string]interface{}{
+		"from": profile.Role,
+		"to":   role,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.adminRepo.SetRole(ctx, userID, role, entry); err != nil {
+		return nil, err
+	}
+	return s.profileRepo.GetByID(ctx, userID)
+}
+
+// SetDisabled disables an account, signing it out everywhere and stopping
+// its API keys, or enables it again.
+func (s *AdminService) SetDisabled(ctx context.Context, userID string, disabled bool, action AdminAction) (*model.Profile, error) {
+	if userID == action.ActorID {
+		return nil, ErrSelfAdminAction
+	}
+	name := model.AdminActionEnable
+	if disabled {
+		name = model.AdminActionDisable
+	}
+	entry, err := s.auditEntry(name, userID, "", action, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.getProfile(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.adminRepo.SetDisabled(ctx, userID, disabled, entry); err != nil {
+		return nil, err
+	}
+	return s.profileRepo.GetByID(ctx, userID)
+}
+
+// ListStuckProjects returns projects that stopped progressing.
+func (s *AdminService) ListStuckProjects(ctx context.Context, action AdminAction) ([]model.Project, error) {
+	if err := s.recordRead(ctx, model.AdminActionViewStuck, "", action, nil); err != nil {
+		return nil, err
+	}
+	projects, err := s.projectService.ListStuck(ctx, maxStuckProjects)
+	if err != nil {
+		return nil, err
+	}
+	return s.projectService.SignProjects(ctx, projects), nil
+}
+
+// RequeueProject starts a stuck project's render again.
+func (s *AdminService) RequeueProject(ctx context.Context, projectID string, action AdminAction) (*model.Render, error) {
+	if err := checkReason(action.Reason); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(projectID); err != nil {
+		return nil, repository.ErrNotFound
+	}
+
+	render, err := s.projectService.RequeueStuck(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordProjectAction(ctx, model.AdminActionRequeue, projectID, render, action)
+	return render, nil
+}
+
+// FailProject fails a stuck project and refunds its render.
+func (s *AdminService) FailProject(ctx context.Context, projectID string, action AdminAction) (*model.Project, error) {
+	if err := checkReason(action.Reason); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(projectID); err != nil {
+		return nil, repository.ErrNotFound
+	}
+
+	render, err := s.projectService.FailStuck(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordProjectAction(ctx, model.AdminActionFail, projectID, render, action)
+
+	project, err := s.projectRepo.GetByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return s.projectService.SignProject(ctx, project), nil
+}
+
+func (s *AdminService) ListAudit(ctx context.Context, filter model.AdminAuditFilter, page, limit int) ([]model.AdminAuditEntry, int, error) {
+	return s.adminRepo.ListAudit(ctx, filter, limit, (page-1)*limit)
+}
+
+// recordProjectAction audits a change ProjectService already made, so a
+// failure to record it is logged rather than undoing the change.
+func (s *AdminService) recordProjectAction(ctx context.Context, name, projectID string, render *model.Render, action AdminAction) {
+	metadata := map[string]interface{}{}
+	var userID string
+	if render != nil {
+		metadata["render_id"] = render.ID
+		metadata["mode"] = render.Mode
+		metadata["credits_charged"] = render.CreditsCharged
+		userID = render.UserID
+	} else if project, err := s.projectRepo.GetByID(ctx, projectID); err == nil {
+		userID = project.UserID
+	}
+
+	entry, err := s.auditEntry(name, userID, projectID, action, metadata)
+	if err == nil {
+		err = s.adminRepo.Record(ctx, entry)
+	}
+	if err != nil {
+		log.Printf("Failed to audit %s of project %s: %v", name, projectID, err)
+	}
+}
+
+// recordRead audits staff reading account data. A reason is optional for
+// reads; nothing is returned when the read cannot be recorded.
+func (s *AdminService) recordRead(ctx context.Context, name, userID string, action AdminAction, metadata map[string]interface{}) error {
+	if len([]rune(strings.TrimSpace(action.Reason))) > maxAdminReason {
+		return ErrReasonRequired
+	}
+	entry, err := newAuditEntry(name, userID, "", action, metadata)
+	if err != nil {
+		return err
+	}
+	return s.adminRepo.Record(ctx, entry)
+}
+
+func (s *AdminService) getProfile(ctx context.Context, userID string) (*model.Profile, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.profileRepo.GetByID(ctx, userID)
+}
+
+// auditEntry checks the action's reason and builds its audit entry.
+func (s *AdminService) auditEntry(name, userID, projectID string, action AdminAction, metadata map[string]interface{}) (*model.AdminAuditEntry, error) {
+	if err := checkReason(action.Reason); err != nil {
+		return nil, err
+	}
+	return newAuditEntry(name, userID, projectID, action, metadata)
+}
+
+func newAuditEntry(name, userID, projectID string, action AdminAction, metadata map[string]interface{}) (*model.AdminAuditEntry, error) {
+	entry := &model.AdminAuditEntry{
+		ActorID:         optionalString(action.ActorID),
+		Action:          name,
+		TargetUserID:    optionalString(userID),
+		TargetProjectID: optionalString(projectID),
+		Reason:          strings.TrimSpace(action.Reason),
+		IPAddress:       optionalString(action.Client.IPAddress),
+		UserAgent:       optionalString(action.Client.UserAgent),
+	}
+	if len(metadata) > 0 {
+		raw, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, err
+		}
+		entry.Metadata = raw
+	}
+	return entry, nil
+}
+
+func checkReason(reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len([]rune(reason)) > maxAdminReason {
+		return ErrReasonRequired
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestAdminService(t *testing.T, db *sqlx.DB) *AdminService {
+	t.Helper()
+	store := newTestStore(t)
+	return NewAdminService(
+		repository.NewAdminRepository(db),
+		repository.NewProfileRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSessionRepository(db),
+		repository.NewMFARepository(db),
+		repository.NewUsageLogRepository(db),
+		newTestProjectService(t, db, store),
+		newTestStorageService(db, store),
+	)
+}
+
+func TestAdminReadsAreAudited(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAdminService(t, db)
+	ctx := context.Background()
+
+	actor := createTestProfile(t, db)
+	user := createTestProfile(t, db)
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM admin_audit_log WHERE actor_id = $1`, actor.ID)
+	})
+	action := AdminAction{
+		ActorID: actor.ID,
+		Reason:  "ticket 1234",
+		Client:  model.ClientInfo{IPAddress: "203.0.113.7", UserAgent: "admin-test"},
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		read   func(AdminAction) error
+	}{
+		{model.AdminActionSearchUsers, "", func(a AdminAction) error {
+			_, _, err := s.SearchUsers(ctx, model.AdminUserFilter{Query: user.Email}, 1, 20, a)
+			return err
+		}},
+		{model.AdminActionViewUser, user.ID, func(a AdminAction) error {
+			_, err := s.GetUser(ctx, user.ID, a)
+			return err
+		}},
+		{model.AdminActionViewProjects, user.ID, func(a AdminAction) error {
+			_, _, err := s.ListProjects(ctx, user.ID, 1, 20, a)
+			return err
+		}},
+		{model.AdminActionViewUsage, user.ID, func(a AdminAction) error {
+			_, _, err := s.ListUsage(ctx, user.ID, 1, 20, a)
+			return err
+		}},
+		{model.AdminActionViewStuck, "", func(a AdminAction) error {
+			_, err := s.ListStuckProjects(ctx, a)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.read(action); err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+
+			filter := model.AdminAuditFilter{ActorID: actor.ID, Action: tt.name}
+			entries, total, err := s.adminRepo.ListAudit(ctx, filter, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 1 {
+				t.Fatalf("%d audit entries, want 1", total)
+			}
+			entry := entries[0]
+			if entry.Reason != action.Reason {
+				t.Errorf("reason = %q, want %q", entry.Reason, action.Reason)
+			}
+			if got := derefString(entry.TargetUserID); got != tt.target {
+				t.Errorf("target_user_id = %q, want %q", got, tt.target)
+			}
+			if got := derefString(entry.UserAgent); got != action.Client.UserAgent {
+				t.Errorf("user_agent = %q, want %q", got, action.Client.UserAgent)
+			}
+
+			// A read that cannot be recorded returns nothing.
+			long := action
+			long.Reason = strings.Repeat("x", maxAdminReason+1)
+			if err := tt.read(long); !errors.Is(err, ErrReasonRequired) {
+				t.Errorf("read with an overlong reason error = %v, want ErrReasonRequired", err)
+			}
+			if _, total, _ := s.adminRepo.ListAudit(ctx, filter, 10, 0); total != 1 {
+				t.Errorf("%d audit entries after a rejected read, want 1", total)
+			}
+		})
+	}
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
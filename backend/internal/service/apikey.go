@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/ratelimit"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/pkg/auth"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidScope      = errors.New("unknown API key scope")
+	ErrInvalidRateLimit  = errors.New("rate limit out of range")
+	ErrInvalidExpiry     = errors.New("expiry must be in the future")
+	ErrTooManyAPIKeys    = errors.New("too many active API keys")
+	ErrInvalidAPIKeyName = errors.New("API key name must be 1-100 characters")
+)
+
+const (
+	maxAPIKeysPerUser = 20
+	maxAPIKeyRate     = 10000
+	maxAPIKeyName     = 100
+)
+
+// APIKeyService creates API keys and authenticates requests made with them.
+type APIKeyService struct {
+	apiKeyRepo *repository.APIKeyRepository
+	limiter    ratelimit.Limiter
+	cfg        *config.Config
+}
+
+func NewAPIKeyService(apiKeyRepo *repository.APIKeyRepository, limiter ratelimit.Limiter, cfg *config.Config) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+		limiter:    limiter,
+		cfg:        cfg,
+	}
+}
+
+// Create makes a key for the user. The plaintext key is only in the result.
+func (s *APIKeyService) Create(ctx context.Context, userID string, req *model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len([]rune(name)) > maxAPIKeyName {
+		return nil, ErrInvalidAPIKeyName
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{model.APIKeyScopeRead, model.APIKeyScopeWrite}
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimit := req.RateLimit
+	if rateLimit == 0 {
+		rateLimit = s.cfg.RateLimit.Requests
+	}
+	if rateLimit < 1 || rateLimit > maxAPIKeyRate {
+		return nil, ErrInvalidRateLimit
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	active, err := s.apiKeyRepo.CountActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	raw := model.APIKeyPrefix + randomToken()
+	key := model.APIKey{
+		UserID:    userID,
+		Name:      name,
+		KeyHash:   hashToken(raw),
+		KeyPrefix: raw[:8],
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.apiKeyRepo.Create(ctx, &key); err != nil {
+		return nil, err
+	}
+
+	return &model.CreatedAPIKey{APIKey: key, Key: raw}, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, userID string) ([]model.APIKey, error) {
+	return s.apiKeyRepo.ListByUser(ctx, userID)
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return repository.ErrNotFound
+	}
+	return s.apiKeyRepo.Revoke(ctx, id, userID)
+}
+
+// AuthenticateAPIKey resolves a presented key and counts the request
+// against the key's rate limit. A request over the limit returns the key
+// with a result that is not Allowed.
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, raw string) (*model.APIKey, *ratelimit.Result, error) {
+	if !strings.HasPrefix(raw, model.APIKeyPrefix) {
+		return nil, nil, auth.ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.GetByHash(ctx, hashToken(raw))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !key.IsActive || (key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now())) {
+		return nil, nil, auth.ErrInvalidAPIKey
+	}
+
+	result, err := s.limiter.Allow(ctx, "apikey:"+key.ID, key.RateLimit, s.cfg.RateLimit.Window)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rate limit: %w", err)
+	}
+	if result.Allowed {
+		if err := s.apiKeyRepo.Touch(ctx, key.ID); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", key.ID, err)
+		}
+	}
+
+	return key, result, nil
+}
+
+// normalizeScopes checks scopes against the known ones and drops repeats.
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		valid := false
+		for _, known := range model.APIKeyScopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
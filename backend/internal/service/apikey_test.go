@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/middleware"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/ratelimit"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/pkg/auth"
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestAPIKeyService(db *sqlx.DB) *APIKeyService {
+	var apiKeyRepo *repository.APIKeyRepository
+	if db != nil {
+		apiKeyRepo = repository.NewAPIKeyRepository(db)
+	}
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{Requests: 100, Window: time.Minute}}
+	return NewAPIKeyService(apiKeyRepo, ratelimit.NewMemory(), cfg)
+}
+
+func TestAuthenticateAPIKeyRejectsMalformed(t *testing.T) {
+	s := newTestAPIKeyService(nil)
+	for _, raw := range []string{"", "not-a-key", "sk_live_123"} {
+		if _, _, err := s.AuthenticateAPIKey(context.Background(), raw); !errors.Is(err, auth.ErrInvalidAPIKey) {
+			t.Errorf("AuthenticateAPIKey(%q) error = %v, want ErrInvalidAPIKey", raw, err)
+		}
+	}
+}
+
+func TestAPIKeyStoresOnlyHash(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAPIKeyService(db)
+	ctx := context.Background()
+	profile := createTestProfile(t, db)
+
+	created, err := s.Create(ctx, profile.ID, &model.CreateAPIKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Key, model.APIKeyPrefix) {
+		t.Fatalf("Create() key = %q, want prefix %s", created.Key, model.APIKeyPrefix)
+	}
+
+	var stored struct {
+		KeyHash   string `db:"key_hash"`
+		KeyPrefix string `db:"key_prefix"`
+	}
+	if err := db.Get(&stored, `SELECT key_hash, key_prefix FROM api_keys WHERE id = $1`, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored.KeyHash != hashToken(created.Key) {
+		t.Errorf("key_hash = %q, want the hash of the key", stored.KeyHash)
+	}
+	if strings.Contains(stored.KeyHash, created.Key) || len(stored.KeyPrefix) >= len(created.Key) {
+		t.Errorf("stored key_hash %q and key_prefix %q hold the plaintext", stored.KeyHash, stored.KeyPrefix)
+	}
+
+	// The plaintext is only returned at creation.
+	keys, err := s.List(ctx, profile.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || strings.Contains(string(listed), created.Key) || strings.Contains(string(listed), stored.KeyHash) {
+		t.Errorf("List() = %s, want one key without its plaintext or hash", listed)
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAPIKeyService(db)
+	ctx := context.Background()
+	profile := createTestProfile(t, db)
+
+	readOnly, err := s.Create(ctx, profile.ID, &model.CreateAPIKeyRequest{Name: "read only", Scopes: []string{model.APIKeyScopeRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := s.Create(ctx, profile.ID, &model.CreateAPIKeyRequest{Name: "revoked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, profile.ID, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := func(scope string) http.Handler {
+		return middleware.AuthMiddleware(nil, nil, s)(middleware.RequireScope(scope)(ok))
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		scope string
+		want  int
+	}{
+		{"granted scope", readOnly.Key, model.APIKeyScopeRead, http.StatusOK},
+		{"missing scope", readOnly.Key, model.APIKeyScopeWrite, http.StatusForbidden},
+		{"revoked key", revoked.Key, model.APIKeyScopeRead, http.StatusUnauthorized},
+		{"unknown key", model.APIKeyPrefix + "unknown", model.APIKeyScopeRead, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/projects", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			rec := httptest.NewRecorder()
+			handler(tt.scope).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,553 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/media"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/safehttp"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAssetNotFound    = errors.New("asset not found")
+	ErrInvalidAsset     = errors.New("invalid asset")
+	ErrAssetTooLarge    = errors.New("file exceeds the size limit for its type")
+	ErrUnsupportedMedia = errors.New("unsupported file type")
+	ErrAssetInUse       = errors.New("asset belongs to a render and is removed with its project")
+	ErrBlockedURL       = errors.New("url is not allowed")
+	ErrRemoteFetch      = errors.New("could not fetch the remote file")
+)
+
+// RemoteFetchTimeout bounds the download of an import from a URL,
+// redirects included. Handlers that import extend their write deadline past
+// it.
+const RemoteFetchTimeout = 30 * time.Second
+
+// uploadKinds lists the media kinds users may upload for each purpose.
+// Generated videos and thumbnails are only created by renders.
+var uploadKinds = map[model.AssetPurpose][]string{
+	model.AssetPurposeProductImage: {media.KindImage},
+	model.AssetPurposeProductVideo: {media.KindVideo},
+	model.AssetPurposeMusic:        {media.KindAudio},
+	model.AssetPurposeVoiceover:    {media.KindAudio},
+	model.AssetPurposeOther:        {media.KindImage, media.KindVideo, media.KindAudio},
+}
+
+var assetTypes = map[string]model.AssetType{
+	media.KindImage: model.AssetTypeImage,
+	media.KindVideo: model.AssetTypeVideo,
+	media.KindAudio: model.AssetTypeAudio,
+}
+
+var contentTypeExts = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"video/mp4":       ".mp4",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"audio/wav":       ".wav",
+	"audio/x-wav":     ".wav",
+	"audio/mp4":       ".m4a",
+	"audio/aac":       ".aac",
+	"audio/ogg":       ".ogg",
+}
+
+type AssetService struct {
+	assetRepo      *repository.AssetRepository
+	projectRepo    *repository.ProjectRepository
+	projectService *ProjectService
+	storageService *StorageService
+	store          storage.Storage
+	fetcher        *safehttp.Client
+	cfg            *config.Config
+}
+
+func NewAssetService(assetRepo *repository.AssetRepository, projectRepo *repository.ProjectRepository, projectService *ProjectService, storageService *StorageService, store storage.Storage, cfg *config.Config) *AssetService {
+	return &AssetService{
+		assetRepo:      assetRepo,
+		projectRepo:    projectRepo,
+		projectService: projectService,
+		storageService: storageService,
+		store:          store,
+		fetcher:        safehttp.NewClient(RemoteFetchTimeout),
+		cfg:            cfg,
+	}
+}
+
+// Upload stores a user file, reads its metadata and records it as an asset.
+func (s *AssetService) Upload(ctx context.Context, userID string, r io.Reader, filename string, req *model.UploadAssetRequest) (*model.Asset, error) {
+	kinds, ok := uploadKinds[req.Purpose]
+	if !ok {
+		return nil, fmt.Errorf("%w: purpose %q cannot be uploaded", ErrInvalidAsset, req.Purpose)
+	}
+
+	var project *model.Project
+	if req.ProjectID != nil && *req.ProjectID != "" {
+		p, err := s.projectService.GetByID(ctx, *req.ProjectID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: project not found", ErrInvalidAsset)
+		}
+		project = p
+	} else if req.IsPrimary {
+		return nil, fmt.Errorf("%w: a primary asset needs a project", ErrInvalidAsset)
+	}
+
+	// Spool to disk so the file can be sniffed, probed and hashed without
+	// holding it in memory.
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(tempDir, "asset-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	maxSize := media.MaxSize[media.KindVideo]
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(r, maxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidAsset)
+	}
+
+	head, err := readHead(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	contentType := media.Sniff(head, filename)
+	kind := media.Kind(contentType)
+	if kind == "" || !containsString(kinds, kind) {
+		return nil, ErrUnsupportedMedia
+	}
+	if size > media.MaxSize[kind] {
+		return nil, ErrAssetTooLarge
+	}
+
+	// Uploads are stored once per user under the hash of their bytes.
+	// Content the user has uploaded before is answered from the database.
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if asset, err := s.reuseBlob(ctx, userID, sum, project, req); asset != nil || err != nil {
+		return asset, err
+	}
+
+	if err := s.storageService.CheckQuota(ctx, userID, size); err != nil {
+		return nil, err
+	}
+
+	// Images are stored upright, without metadata and within provider
+	// limits; the original bytes are not kept.
+	var img image.Image
+	if kind == media.KindImage {
+		normalized, err := normalizeImageFile(tmp.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAsset, err)
+		}
+		contentType, img = normalized.ContentType, normalized.Image
+	}
+
+	meta, err := media.Probe(tmp.Name(), contentType)
+	if err != nil {
+		if kind == media.KindImage {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAsset, err)
+		}
+		// Video and audio stay usable without ffprobe; metadata is optional.
+		log.Printf("Failed to probe %s upload: %v", kind, err)
+	}
+
+	name := sum + contentTypeExts[contentType]
+	key := "uploads/" + userID + "/" + name
+	stored, err := storage.PutFile(ctx, s.store, key, tmp.Name(), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	original := filepath.Base(filename)
+	asset := &model.Asset{
+		UserID:           userID,
+		Type:             assetTypes[kind],
+		Purpose:          req.Purpose,
+		Filename:         name,
+		OriginalFilename: &original,
+		URL:              stored.URL,
+		StorageKey:       &stored.Key,
+		ChecksumSHA256:   &stored.SHA256,
+		FileSizeBytes:    &stored.Size,
+		MimeType:         &stored.ContentType,
+		AltText:          req.AltText,
+		BlobSHA256:       &sum,
+	}
+	if project != nil {
+		asset.ProjectID = &project.ID
+	}
+	if meta.Width > 0 && meta.Height > 0 {
+		asset.Width, asset.Height = &meta.Width, &meta.Height
+	}
+	if meta.Duration > 0 {
+		asset.DurationSeconds = &meta.Duration
+	}
+
+	if err := s.assetRepo.Create(ctx, asset); err != nil {
+		// The same file may have been stored for a concurrent upload.
+		if _, blobErr := s.assetRepo.GetBlob(ctx, userID, sum); errors.Is(blobErr, repository.ErrNotFound) {
+			_ = s.store.Delete(ctx, key)
+		}
+		return nil, err
+	}
+
+	// A blob released while this upload was stored takes the file with it;
+	// the reference taken above keeps a second copy.
+	if _, err := s.store.Stat(ctx, key); errors.Is(err, storage.ErrNotFound) {
+		if _, err := storage.PutFile(ctx, s.store, key, tmp.Name(), contentType); err != nil {
+			return nil, err
+		}
+	}
+
+	if img != nil && req.Purpose == model.AssetPurposeProductImage {
+		asset.Variants = s.createVariants(ctx, asset, img)
+	}
+
+	if req.IsPrimary {
+		if err := s.makePrimary(ctx, asset); err != nil {
+			return nil, err
+		}
+	}
+
+	return asset, nil
+}
+
+// reuseBlob answers an upload of content the user has stored before. The
+// same file for the same purpose and project is the existing asset; any
+// other use gets a new asset sharing the stored file. It returns nil when
+// the content is new or its file is no longer stored.
+func (s *AssetService) reuseBlob(ctx context.Context, userID, sum string, project *model.Project, req *model.UploadAssetRequest) (*model.Asset, error) {
+	existing, err := s.assetRepo.ListByBlob(ctx, userID, sum)
+	if err != nil || len(existing) == 0 {
+		return nil, err
+	}
+
+	var projectID *string
+	if project != nil {
+		projectID = &project.ID
+	}
+
+	for i := range existing {
+		asset := &existing[i]
+		if asset.Purpose != req.Purpose || !sameProject(asset.ProjectID, projectID) {
+			continue
+		}
+		if req.AltText != nil {
+			if err := s.assetRepo.UpdateAltText(ctx, asset.ID, req.AltText); err != nil {
+				return nil, err
+			}
+		}
+		if req.IsPrimary && !asset.IsPrimary {
+			if err := s.makePrimary(ctx, asset); err != nil {
+				return nil, err
+			}
+		}
+		return s.Get(ctx, asset.ID, userID)
+	}
+
+	asset, err := shareAsset(ctx, s.assetRepo, s.store, &existing[0], req.Purpose, projectID, req.AltText)
+	if err != nil {
+		log.Printf("Failed to share stored file %s: %v", sum, err)
+		return nil, nil
+	}
+
+	if req.Purpose == model.AssetPurposeProductImage && len(asset.Variants) == 0 {
+		data, err := s.projectService.readImage(ctx, *asset.StorageKey)
+		if err == nil {
+			var normalized *media.Normalized
+			if normalized, err = media.NormalizeImage(bytes.NewReader(data)); err == nil {
+				asset.Variants = s.createVariants(ctx, asset, normalized.Image)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to create variants of asset %s: %v", asset.ID, err)
+		}
+	}
+
+	if req.IsPrimary {
+		if err := s.makePrimary(ctx, asset); err != nil {
+			return nil, err
+		}
+	}
+
+	return asset, nil
+}
+
+// UploadFromURL downloads a remote image and stores it like an upload. The
+// fetch only reaches public addresses, redirects included.
+func (s *AssetService) UploadFromURL(ctx context.Context, userID, rawURL string, req *model.UploadAssetRequest) (*model.Asset, error) {
+	resp, err := s.fetcher.Get(ctx, rawURL, "image/*", media.MaxSize[media.KindImage])
+	switch {
+	case errors.Is(err, safehttp.ErrBlockedURL):
+		return nil, fmt.Errorf("%w: %v", ErrBlockedURL, err)
+	case errors.Is(err, safehttp.ErrTooLarge):
+		return nil, ErrAssetTooLarge
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrRemoteFetch, err)
+	}
+
+	filename := path.Base(resp.URL.Path)
+	if filename == "/" || filename == "." {
+		filename = resp.URL.Hostname()
+	}
+	return s.Upload(ctx, userID, bytes.NewReader(resp.Body), filename, req)
+}
+
+func (s *AssetService) List(ctx context.Context, userID string, filter model.AssetListFilter, page, limit int) ([]model.Asset, int, error) {
+	if filter.Purpose != "" && !isKnownPurpose(filter.Purpose) {
+		return nil, 0, fmt.Errorf("%w: unknown purpose %q", ErrInvalidAsset, filter.Purpose)
+	}
+	if filter.ProjectID != "" {
+		if _, err := uuid.Parse(filter.ProjectID); err != nil {
+			return nil, 0, fmt.Errorf("%w: invalid project_id", ErrInvalidAsset)
+		}
+	}
+
+	offset := (page - 1) * limit
+	return s.assetRepo.List(ctx, userID, filter, limit, offset)
+}
+
+func (s *AssetService) Get(ctx context.Context, id, userID string) (*model.Asset, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrAssetNotFound
+	}
+
+	asset, err := s.assetRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrAssetNotFound
+		}
+		return nil, err
+	}
+	if asset.UserID != userID {
+		return nil, ErrAssetNotFound
+	}
+
+	if asset.Variants, err = s.assetRepo.ListVariants(ctx, asset.ID); err != nil {
+		return nil, err
+	}
+
+	return asset, nil
+}
+
+func (s *AssetService) Update(ctx context.Context, id, userID string, req *model.UpdateAssetRequest) (*model.Asset, error) {
+	asset, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.AltText != nil {
+		if len([]rune(*req.AltText)) > 500 {
+			return nil, fmt.Errorf("%w: alt_text is limited to 500 characters", ErrInvalidAsset)
+		}
+		if err := s.assetRepo.UpdateAltText(ctx, asset.ID, req.AltText); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.IsPrimary != nil && *req.IsPrimary != asset.IsPrimary {
+		if *req.IsPrimary {
+			if asset.ProjectID == nil {
+				return nil, fmt.Errorf("%w: a primary asset needs a project", ErrInvalidAsset)
+			}
+			if err := s.makePrimary(ctx, asset); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := s.assetRepo.ClearPrimary(ctx, asset.ID); err != nil {
+				return nil, err
+			}
+			if asset.Purpose == model.AssetPurposeProductImage {
+				if err := s.projectRepo.ClearProductImage(ctx, asset.ID); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return s.Get(ctx, asset.ID, userID)
+}
+
+// Delete removes the asset and, unless another asset shares it, its stored
+// file. Render outputs are kept
+// until their project is deleted.
+func (s *AssetService) Delete(ctx context.Context, id, userID string) error {
+	asset, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if asset.RenderID != nil {
+		return ErrAssetInUse
+	}
+
+	return s.remove(ctx, asset)
+}
+
+// DeleteUpload removes an upload by its filename, for clients of the older
+// /api/upload endpoint.
+func (s *AssetService) DeleteUpload(ctx context.Context, userID, filename string) error {
+	key := "uploads/" + userID + "/" + filepath.Base(filename)
+	if storage.ValidateKey(key) != nil {
+		return ErrAssetNotFound
+	}
+
+	asset, err := s.assetRepo.GetByStorageKey(ctx, userID, key)
+	if err == nil {
+		return s.remove(ctx, asset)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	// Uploads from before the assets API have no row.
+	if err := s.store.Delete(ctx, key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrAssetNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// SignAsset returns a copy of asset with signed URLs.
+func (s *AssetService) SignAsset(ctx context.Context, asset *model.Asset) *model.Asset {
+	signed := *asset
+	signed.URL = s.projectService.SignURL(ctx, asset.URL, "")
+	signed.ThumbnailURL = s.projectService.signURLPtr(ctx, asset.ThumbnailURL)
+	if asset.Variants != nil {
+		signed.Variants = make([]model.AssetVariant, len(asset.Variants))
+		for i, variant := range asset.Variants {
+			variant.URL = s.projectService.SignURL(ctx, variant.URL, "")
+			signed.Variants[i] = variant
+		}
+	}
+	return &signed
+}
+
+func (s *AssetService) SignAssets(ctx context.Context, assets []model.Asset) []model.Asset {
+	signed := make([]model.Asset, len(assets))
+	for i := range assets {
+		signed[i] = *s.SignAsset(ctx, &assets[i])
+	}
+	return signed
+}
+
+func (s *AssetService) remove(ctx context.Context, asset *model.Asset) error {
+	if asset.Purpose == model.AssetPurposeProductImage {
+		if err := s.projectRepo.ClearProductImage(ctx, asset.ID); err != nil {
+			return err
+		}
+	}
+	variants, err := s.assetRepo.ListVariants(ctx, asset.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.assetRepo.Delete(ctx, asset.ID); err != nil {
+		return err
+	}
+
+	// A shared file stays until its last asset is gone.
+	if asset.BlobSHA256 != nil {
+		if err := releaseBlob(ctx, s.assetRepo, s.store, asset.UserID, *asset.BlobSHA256); err != nil {
+			log.Printf("Failed to release stored file %s: %v", *asset.BlobSHA256, err)
+		}
+		return nil
+	}
+
+	keys := make([]string, 0, len(variants)+1)
+	if asset.StorageKey != nil {
+		keys = append(keys, *asset.StorageKey)
+	}
+	for _, variant := range variants {
+		keys = append(keys, variant.StorageKey)
+	}
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to delete stored file %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// makePrimary flags the asset as its project's primary one for the purpose.
+// A primary product image becomes the project's product image.
+func (s *AssetService) makePrimary(ctx context.Context, asset *model.Asset) error {
+	if err := s.assetRepo.SetPrimary(ctx, asset); err != nil {
+		return err
+	}
+	asset.IsPrimary = true
+
+	if asset.Purpose == model.AssetPurposeProductImage {
+		return s.projectRepo.SetProductImage(ctx, *asset.ProjectID, &asset.ID, &asset.URL)
+	}
+	return nil
+}
+
+func readHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+func isKnownPurpose(purpose model.AssetPurpose) bool {
+	switch purpose {
+	case model.AssetPurposeProductImage, model.AssetPurposeProductVideo, model.AssetPurposeGeneratedVideo,
+		model.AssetPurposeThumbnail, model.AssetPurposeMusic, model.AssetPurposeVoiceover, model.AssetPurposeOther:
+		return true
+	}
+	return false
+}
+
+func sameProject(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
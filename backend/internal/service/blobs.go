@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+)
+
+// blobKeys are the objects stored for a blob: the file and the variants
+// derived from it.
+func blobKeys(blob *model.AssetBlob) []string {
+	keys := []string{blob.StorageKey}
+	for _, format := range variantFormats {
+		keys = append(keys, variantKey(blob.StorageKey, format))
+	}
+	return keys
+}
+
+// releaseBlob deletes a blob's objects once no asset references it.
+func releaseBlob(ctx context.Context, assetRepo *repository.AssetRepository, store storage.Storage, userID, sha256 string) error {
+	_, err := assetRepo.DeleteBlob(ctx, userID, sha256, func(blob *model.AssetBlob) error {
+		for _, key := range blobKeys(blob) {
+			if err := store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// shareAsset records another use of src's stored file as a new asset, e.g.
+// the same product photo in a second project. No bytes are copied; the blob
+// keeps the file until the last asset using it is deleted.
+func shareAsset(ctx context.Context, assetRepo *repository.AssetRepository, store storage.Storage, src *model.Asset, purpose model.AssetPurpose, projectID, altText *string) (*model.Asset, error) {
+	if src.BlobSHA256 == nil || src.StorageKey == nil {
+		return nil, errors.New("asset has no shared file")
+	}
+
+	asset := *src
+	asset.ID = ""
+	asset.ProjectID = projectID
+	asset.RenderID = nil
+	asset.Purpose = purpose
+	asset.AltText = altText
+	asset.IsPrimary = false
+	asset.Variants = nil
+	if err := assetRepo.Create(ctx, &asset); err != nil {
+		return nil, err
+	}
+
+	// The last reference may have been released, and the file removed,
+	// just before this one was added.
+	if _, err := store.Stat(ctx, *asset.StorageKey); err != nil {
+		_ = assetRepo.Delete(ctx, asset.ID)
+		return nil, err
+	}
+
+	// Variants are stored next to the file and shared with it.
+	if purpose == model.AssetPurposeProductImage {
+		variants, err := assetRepo.ListVariants(ctx, src.ID)
+		if err != nil {
+			log.Printf("Failed to list variants of asset %s: %v", src.ID, err)
+		}
+		for _, variant := range variants {
+			variant.ID = ""
+			variant.AssetID = asset.ID
+			if err := assetRepo.SaveVariant(ctx, &variant); err != nil {
+				log.Printf("Failed to share %s variant with asset %s: %v", variant.Format, asset.ID, err)
+				continue
+			}
+			asset.Variants = append(asset.Variants, variant)
+		}
+	}
+
+	return &asset, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+)
+
+// createTestBlobAsset stores content as a product image of the user, with
+// a variant for each format, and records it as an asset of its blob.
+func createTestBlobAsset(t *testing.T, assetRepo *repository.AssetRepository, store storage.Storage, userID, content string) *model.Asset {
+	t.Helper()
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	key := "uploads/" + userID + "/" + hash + ".jpg"
+	size := int64(len(content))
+
+	blob := &model.AssetBlob{StorageKey: key}
+	for _, k := range blobKeys(blob) {
+		if err := store.Put(ctx, k, strings.NewReader(content), size, "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	asset := &model.Asset{
+		UserID:        userID,
+		Type:          model.AssetTypeImage,
+		Purpose:       model.AssetPurposeProductImage,
+		Filename:      hash + ".jpg",
+		URL:           key,
+		StorageKey:    &key,
+		BlobSHA256:    &hash,
+		FileSizeBytes: &size,
+	}
+	if err := assetRepo.Create(ctx, asset); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range variantFormats {
+		variant := &model.AssetVariant{
+			AssetID:    asset.ID,
+			Format:     format,
+			Fit:        "cover",
+			URL:        variantKey(key, format),
+			StorageKey: variantKey(key, format),
+			Width:      100,
+			Height:     100,
+		}
+		if err := assetRepo.SaveVariant(ctx, variant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return asset
+}
+
+func TestSharedBlobRelease(t *testing.T) {
+	db := openTestDB(t)
+	store := newTestStore(t)
+	assetRepo := repository.NewAssetRepository(db)
+	ctx := context.Background()
+	profile := createTestProfile(t, db)
+
+	first := createTestBlobAsset(t, assetRepo, store, profile.ID, "product photo")
+	second, err := shareAsset(ctx, assetRepo, store, first, model.AssetPurposeProductImage, nil, nil)
+	if err != nil {
+		t.Fatalf("shareAsset() error = %v", err)
+	}
+	if len(second.Variants) != len(variantFormats) {
+		t.Errorf("shared asset has %d variants, want %d", len(second.Variants), len(variantFormats))
+	}
+
+	blob, err := assetRepo.GetBlob(ctx, profile.ID, *first.BlobSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.RefCount != 2 {
+		t.Fatalf("ref_count = %d after sharing, want 2", blob.RefCount)
+	}
+	keys := blobKeys(blob)
+
+	// Deleting one of the two assets keeps the file and its variants.
+	if err := assetRepo.Delete(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseBlob(ctx, assetRepo, store, profile.ID, *first.BlobSHA256); err != nil {
+		t.Fatalf("releaseBlob() error = %v", err)
+	}
+	for _, key := range keys {
+		if _, err := store.Stat(ctx, key); err != nil {
+			t.Errorf("Stat(%s) with an asset left error = %v", key, err)
+		}
+	}
+	if blob, err := assetRepo.GetBlob(ctx, profile.ID, *first.BlobSHA256); err != nil || blob.RefCount != 1 {
+		t.Fatalf("GetBlob() with an asset left = %+v, %v, want ref_count 1", blob, err)
+	}
+
+	// Deleting the last asset removes the file, every variant and the blob.
+	if err := assetRepo.Delete(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseBlob(ctx, assetRepo, store, profile.ID, *second.BlobSHA256); err != nil {
+		t.Fatalf("releaseBlob() error = %v", err)
+	}
+	for _, key := range keys {
+		if _, err := store.Stat(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Stat(%s) after the last asset error = %v, want ErrNotFound", key, err)
+		}
+	}
+	if _, err := assetRepo.GetBlob(ctx, profile.ID, *second.BlobSHA256); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetBlob() after the last asset error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestShareAssetOfReleasedBlob(t *testing.T) {
+	db := openTestDB(t)
+	store := newTestStore(t)
+	assetRepo := repository.NewAssetRepository(db)
+	ctx := context.Background()
+	profile := createTestProfile(t, db)
+
+	// The file went away between finding the asset and sharing it.
+	src := createTestBlobAsset(t, assetRepo, store, profile.ID, "removed photo")
+	if err := store.Delete(ctx, *src.StorageKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shareAsset(ctx, assetRepo, store, src, model.AssetPurposeProductImage, nil, nil); err == nil {
+		t.Fatal("shareAsset() of a removed file succeeded")
+	}
+	if blob, err := assetRepo.GetBlob(ctx, profile.ID, *src.BlobSHA256); err != nil || blob.RefCount != 1 {
+		t.Errorf("GetBlob() after a failed share = %+v, %v, want ref_count 1", blob, err)
+	}
+}
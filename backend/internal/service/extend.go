@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/genvid/backend/internal/video"
+	"github.com/genvid/backend/internal/zhipu"
+)
+
+var ErrInvalidExtension = errors.New("extension must be between 1 and 30 seconds")
+
+const continuationPreamble = "Continue this shot seamlessly from the exact frame in the image. Keep the same product, setting, lighting, framing and camera movement; do not cut to a new scene. "
+
+// ExtendVideo continues the project's current video from its final frame.
+// Only the added provider segments are billed, and the result is stored as a
+// new render whose first segment is the previous video.
+func (s *ProjectService) ExtendVideo(ctx context.Context, projectID, userID string, req *model.ExtendVideoRequest) (*model.Render, error) {
+	if req.Seconds < 1 || req.Seconds > 30 {
+		return nil, ErrInvalidExtension
+	}
+
+	project, err := s.GetByID(ctx, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if project.Status != model.ProjectStatusCompleted || project.VideoURL == nil || *project.VideoURL == "" {
+		return nil, ErrRenderNotReady
+	}
+
+	// Projects generated before render history existed have no parent render.
+	var parentID *string
+	parent, err := s.renderRepo.GetLatestCompleted(ctx, projectID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if parent != nil {
+		parentID = &parent.ID
+	}
+
+	durations := extensionSegments(req.Seconds)
+	segments := len(durations)
+
+	// Claim the project before charging so concurrent extensions cannot both
+	// pay for and start a render.
+	if err := s.projectRepo.ClaimCompleted(ctx, projectID); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return nil, ErrRenderNotReady
+		}
+		return nil, err
+	}
+
+	if err := s.authService.UseCredits(ctx, userID, segments); err != nil {
+		s.releaseClaim(ctx, projectID)
+		return nil, err
+	}
+
+	render := &model.Render{
+		ProjectID:       projectID,
+		UserID:          userID,
+		Mode:            model.GenerationModeExtend,
+		Format:          project.Format,
+		DurationSeconds: project.VideoDuration + totalSeconds(durations),
+		CreditsCharged:  segments,
+		ParentRenderID:  parentID,
+	}
+	render.Options, _ = json.Marshal(req)
+
+	if err := s.renderRepo.Create(ctx, render); err != nil {
+		s.refundRender(ctx, render)
+		s.releaseClaim(ctx, projectID)
+		return nil, err
+	}
+
+	go func() {
+		s.processExtension(context.Background(), project, render, durations, req.Prompt)
+	}()
+
+	return render, nil
+}
+
+// releaseClaim puts a claimed project back to completed when the extension
+// could not be started.
+func (s *ProjectService) releaseClaim(ctx context.Context, projectID string) {
+	if err := s.projectRepo.UpdateStatus(ctx, projectID, model.ProjectStatusCompleted, 100); err != nil {
+		log.Printf("Failed to release project %s: %v", projectID, err)
+	}
+}
+
+// extensionSegments splits an extension by seconds into provider segments.
+// The provider makes 5 or 10 second clips, so every segment is 10 seconds
+// except the last, which is rounded up to 5 or 10.
+func extensionSegments(seconds int) []int {
+	var durations []int
+	for ; seconds > 10; seconds -= 10 {
+		durations = append(durations, 10)
+	}
+	if seconds <= 5 {
+		return append(durations, 5)
+	}
+	return append(durations, 10)
+}
+
+func totalSeconds(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func (s *ProjectService) processExtension(ctx context.Context, project *model.Project, render *model.Render, durations []int, userPrompt string) {
+	segments := len(durations)
+	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 5)
+	_ = s.renderRepo.UpdateStatus(ctx, render.ID, model.ProjectStatusProcessing)
+
+	if err := video.CheckFFmpeg(); err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return
+	}
+
+	merger := s.newMerger()
+	var temporary []string
+	defer func() {
+		for _, f := range temporary {
+			os.Remove(f)
+		}
+	}()
+
+	sourceURL := *project.VideoURL
+	sourcePath, downloaded, err := s.localVideoPath(merger, sourceURL, render.ID+"_source.mp4")
+	if err != nil {
+		s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Failed to load current video: %s", err.Error()))
+		return
+	}
+	if downloaded {
+		temporary = append(temporary, sourcePath)
+	}
+
+	sourceDuration, err := video.ProbeDuration(sourcePath)
+	if err != nil {
+		sourceDuration = float64(project.VideoDuration)
+	}
+	_ = s.renderRepo.AddSegment(ctx, &model.RenderSegment{
+		RenderID:        render.ID,
+		Position:        0,
+		VideoURL:        &sourceURL,
+		DurationSeconds: &sourceDuration,
+	})
+
+	compiler := s.newPromptCompiler(ctx, project, false)
+	var direction *string
+	if strings.TrimSpace(userPrompt) != "" {
+		direction = &userPrompt
+	}
+	compiled, templateID := compiler.Compile(ctx, "demo", direction)
+	prompt := continuationPreamble + compiled
+	size := s.getVideoSize(string(project.Format))
+
+	// Each new segment starts from the last frame of whatever precedes it.
+	lastVideo := sourcePath
+	mergeInputs := []string{sourcePath}
+	for i := 0; i < segments; i++ {
+		progress := 10 + (i * 70 / segments)
+		_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, progress)
+
+		framePath := filepath.Join(tempDir, fmt.Sprintf("%s_frame_%d.jpg", render.ID, i))
+		if _, err := video.ExtractFrame(lastVideo, -0.1, framePath); err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Failed to extract final frame: %s", err.Error()))
+			return
+		}
+		temporary = append(temporary, framePath)
+
+		frameData, err := os.ReadFile(framePath)
+		if err != nil {
+			s.handleVideoFailure(ctx, project, render, err.Error())
+			return
+		}
+
+		req := zhipu.VideoGenerationRequest{
+			Model:    s.cfg.External.Zhipu.Model,
+			Prompt:   prompt,
+			ImageURL: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(frameData),
+			Quality:  "speed",
+			Size:     size,
+			Duration: durations[i],
+		}
+
+		resp, err := s.zhipuClient.GenerateVideo(req)
+		if err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Extension segment %d failed: %s", i+1, err.Error()))
+			return
+		}
+
+		result, err := s.zhipuClient.WaitForCompletion(resp.ID, 10*time.Minute)
+		if err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Extension segment %d completion failed: %s", i+1, err.Error()))
+			return
+		}
+		if result.VideoResult == nil || result.VideoResult.URL == "" {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Extension segment %d returned no video", i+1))
+			return
+		}
+
+		segmentPath := filepath.Join(tempDir, fmt.Sprintf("%s_ext_%d.mp4", render.ID, i))
+		if err := downloadVerified(ctx, result.VideoResult.URL, segmentPath); err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Extension segment %d download failed: %s", i+1, err.Error()))
+			return
+		}
+		temporary = append(temporary, segmentPath)
+
+		segmentObj, err := storage.PutFile(ctx, s.store, renderSegmentKey(render.ID, i+1), segmentPath, "video/mp4")
+		if err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Extension segment %d storage failed: %s", i+1, err.Error()))
+			return
+		}
+
+		_ = s.renderRepo.AddSegment(ctx, &model.RenderSegment{
+			RenderID:         render.ID,
+			StylePreset:      compiler.slug,
+			PromptTemplateID: templateID,
+			Position:         i + 1,
+			Prompt:           &req.Prompt,
+			ExternalTaskID:   &resp.ID,
+			VideoURL:         &segmentObj.URL,
+			DurationSeconds:  &result.VideoResult.Duration,
+		})
+
+		mergeInputs = append(mergeInputs, segmentPath)
+		lastVideo = segmentPath
+	}
+
+	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 90)
+
+	outputPath := filepath.Join(tempDir, render.ID+"_extended.mp4")
+	if _, err := merger.MergeVideos(mergeInputs, outputPath); err != nil {
+		// Stream copy fails when the earlier render was encoded differently
+		// (slideshow or edit); re-encode through the editor instead.
+		if err := s.reencodeConcat(mergeInputs, render, outputPath); err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Failed to append extension: %s", err.Error()))
+			return
+		}
+	}
+
+	// The provider's clips rarely run exactly as long as asked.
+	if duration, err := video.ProbeDuration(outputPath); err == nil {
+		render.DurationSeconds = int(math.Round(duration))
+		_ = s.renderRepo.SetDuration(ctx, render.ID, render.DurationSeconds)
+	}
+
+	videoObj, err := merger.Publish(ctx, outputPath, renderVideoKey(render.ID), "video/mp4")
+	if err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return
+	}
+
+	project.VideoDuration = render.DurationSeconds
+	_ = s.projectRepo.UpdateGenerationSettings(ctx, project)
+
+	// The opening frame is unchanged, so the current thumbnail still fits.
+	s.completeRender(ctx, project, render, videoObj, nil)
+}
+
+func (s *ProjectService) reencodeConcat(inputs []string, render *model.Render, outputPath string) error {
+	clips := make([]video.EditClip, 0, len(inputs))
+	for _, in := range inputs {
+		duration, err := video.ProbeDuration(in)
+		if err != nil {
+			return err
+		}
+		clips = append(clips, video.EditClip{Path: in, In: 0, Out: duration})
+	}
+
+	width, height := s.getVideoDimensions(string(render.Format))
+	_, err := video.NewEditor().Render(clips, width, height, outputPath)
+	return err
+}
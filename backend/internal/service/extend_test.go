@@ -0,0 +1,28 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtensionSegments(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    []int
+	}{
+		{1, []int{5}},
+		{5, []int{5}},
+		{6, []int{10}},
+		{10, []int{10}},
+		{12, []int{10, 5}},
+		{17, []int{10, 10}},
+		{20, []int{10, 10}},
+		{25, []int{10, 10, 5}},
+		{30, []int{10, 10, 10}},
+	}
+	for _, tt := range tests {
+		if got := extensionSegments(tt.seconds); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("extensionSegments(%d) = %v, want %v", tt.seconds, got, tt.want)
+		}
+	}
+}
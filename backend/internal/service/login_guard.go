@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/captcha"
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/ratelimit"
+	"github.com/genvid/backend/internal/repository"
+)
+
+var (
+	ErrCaptchaRequired = errors.New("a CAPTCHA is required")
+	ErrInvalidCaptcha  = errors.New("CAPTCHA was not solved")
+)
+
+// After loginFreeFailures failed sign-ins an email waits loginBaseDelay
+// before the next attempt, doubling with each failure up to loginMaxDelay,
+// until it is locked.
+const (
+	loginFreeFailures = 3
+	loginBaseDelay    = time.Second
+	loginMaxDelay     = time.Minute
+)
+
+// ThrottledError refuses an attempt until RetryAfter has passed. Locked
+// marks a lockout after too many failures rather than a delay.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed attempts; sign-in is temporarily locked"
+	}
+	return "too many attempts; try again later"
+}
+
+// LoginGuard slows down password guessing. Failed sign-ins are counted per
+// email and per IP address: they add growing delays, then require a
+// CAPTCHA, then lock the email or address for a while. Sign-ups are
+// limited per address.
+type LoginGuard struct {
+	store          ratelimit.Store
+	captcha        captcha.Verifier
+	profileRepo    *repository.ProfileRepository
+	usageLogRepo   *repository.UsageLogRepository
+	accountService *AccountService
+	cfg            *config.Config
+}
+
+func NewLoginGuard(store ratelimit.Store, verifier captcha.Verifier, profileRepo *repository.ProfileRepository, usageLogRepo *repository.UsageLogRepository, accountService *AccountService, cfg *config.Config) *LoginGuard {
+	return &LoginGuard{
+		store:          store,
+		captcha:        verifier,
+		profileRepo:    profileRepo,
+		usageLogRepo:   usageLogRepo,
+		accountService: accountService,
+		cfg:            cfg,
+	}
+}
+
+// CheckLogin refuses a sign-in while the email or address is locked or
+// delayed, and requires a solved CAPTCHA after repeated failures.
+func (g *LoginGuard) CheckLogin(ctx context.Context, email string, client model.ClientInfo, captchaToken string) error {
+	if err := g.CheckThrottled(ctx, email, client.IPAddress); err != nil {
+		return err
+	}
+
+	failures, _, err := g.store.Get(ctx, loginEmailKey(email)+":failures")
+	if err != nil {
+		return err
+	}
+	if client.IPAddress != "" {
+		ipFailures, _, err := g.store.Get(ctx, loginIPKey(client.IPAddress)+":failures")
+		if err != nil {
+			return err
+		}
+		failures = max(failures, ipFailures)
+	}
+	if failures < g.cfg.Login.CaptchaAfter {
+		return nil
+	}
+	return g.verifyCaptcha(ctx, captchaToken, client.IPAddress)
+}
+
+// CheckThrottled refuses an attempt while the email or address is locked
+// or delayed. Second factors are checked with it, as they have no CAPTCHA.
+func (g *LoginGuard) CheckThrottled(ctx context.Context, email, ip string) error {
+	keys := []string{loginEmailKey(email)}
+	if ip != "" {
+		keys = append(keys, loginIPKey(ip))
+	}
+	for _, key := range keys {
+		locked, until, err := g.store.Get(ctx, key+":lock")
+		if err != nil {
+			return err
+		}
+		if locked > 0 {
+			return &ThrottledError{RetryAfter: time.Until(until), Locked: true}
+		}
+	}
+
+	delayed, until, err := g.store.Get(ctx, loginEmailKey(email)+":delay")
+	if err != nil {
+		return err
+	}
+	if delayed > 0 {
+		return &ThrottledError{RetryAfter: time.Until(until)}
+	}
+	return nil
+}
+
+// LoginFailed counts a wrong password or second factor for the email and
+// address, and delays or locks them. Counting errors are logged, so the
+// caller still reports the failure itself.
+func (g *LoginGuard) LoginFailed(ctx context.Context, email string, client model.ClientInfo) {
+	key := loginEmailKey(email)
+	failures, _, err := g.store.Add(ctx, key+":failures", g.cfg.Login.FailureWindow)
+	if err != nil {
+		log.Printf("Failed to count failed sign-in: %v", err)
+		return
+	}
+	if failures >= g.cfg.Login.MaxFailures {
+		g.lock(ctx, key, "email", failures, email, client)
+	} else if delay := loginDelay(failures); delay > 0 {
+		if _, _, err := g.store.Add(ctx, key+":delay", delay); err != nil {
+			log.Printf("Failed to delay sign-in: %v", err)
+		}
+	}
+
+	if client.IPAddress == "" {
+		return
+	}
+	key = loginIPKey(client.IPAddress)
+	failures, _, err = g.store.Add(ctx, key+":failures", g.cfg.Login.FailureWindow)
+	if err != nil {
+		log.Printf("Failed to count failed sign-in: %v", err)
+		return
+	}
+	if failures >= g.cfg.Login.MaxIPFailures {
+		g.lock(ctx, key, "ip", failures, email, client)
+	}
+}
+
+// LoginSucceeded forgets the email's failures. The address keeps its
+// count, so one working account does not reset guessing at others.
+func (g *LoginGuard) LoginSucceeded(ctx context.Context, email string) {
+	key := loginEmailKey(email)
+	for _, k := range []string{key + ":failures", key + ":delay"} {
+		if err := g.store.Reset(ctx, k); err != nil {
+			log.Printf("Failed to reset sign-in failures: %v", err)
+		}
+	}
+}
+
+// CheckSignup counts a sign-up from the client's address, requires a
+// solved CAPTCHA after a few and refuses them beyond the limit.
+func (g *LoginGuard) CheckSignup(ctx context.Context, client model.ClientInfo, captchaToken string) error {
+	if client.IPAddress == "" {
+		return nil
+	}
+
+	result, err := g.store.Allow(ctx, "signup:ip:"+client.IPAddress, g.cfg.Login.MaxSignups, g.cfg.Login.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if !result.Allowed {
+		return &ThrottledError{RetryAfter: result.RetryAfter()}
+	}
+	if result.Limit-result.Remaining <= g.cfg.Login.CaptchaSignups {
+		return nil
+	}
+	return g.verifyCaptcha(ctx, captchaToken, client.IPAddress)
+}
+
+func (g *LoginGuard) verifyCaptcha(ctx context.Context, token, ip string) error {
+	if strings.TrimSpace(token) == "" {
+		return ErrCaptchaRequired
+	}
+	err := g.captcha.Verify(ctx, token, ip)
+	if errors.Is(err, captcha.ErrInvalid) {
+		return ErrInvalidCaptcha
+	}
+	return err
+}
+
+// lock refuses the email or address for the lockout time and records it
+// in the audit log. The owner of a locked email is told the first time in
+// a failure window.
+func (g *LoginGuard) lock(ctx context.Context, key, scope string, failures int, email string, client model.ClientInfo) {
+	count, until, err := g.store.Add(ctx, key+":lock", g.cfg.Login.Lockout)
+	if err != nil {
+		log.Printf("Failed to lock sign-in: %v", err)
+		return
+	}
+	// A concurrent failure already locked it.
+	if count > 1 {
+		return
+	}
+
+	var profile *model.Profile
+	if scope == "email" {
+		profile, err = g.profileRepo.GetByEmail(ctx, strings.TrimSpace(email))
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("Failed to look up locked account: %v", err)
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"scope":        scope,
+		"failures":     failures,
+		"locked_until": until.UTC(),
+	}
+	if scope == "email" {
+		metadata["email"] = strings.TrimSpace(email)
+	}
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("Failed to encode lockout: %v", err)
+		return
+	}
+	description := "Sign-in locked after repeated failures"
+	entry := &model.UsageLog{
+		Event:       model.UsageEventLoginLocked,
+		Description: &description,
+		Metadata:    raw,
+		IPAddress:   optionalString(client.IPAddress),
+		UserAgent:   optionalString(client.UserAgent),
+	}
+	if profile != nil {
+		entry.UserID = &profile.ID
+	}
+	if err := g.usageLogRepo.Create(ctx, entry); err != nil {
+		log.Printf("Failed to record sign-in lockout: %v", err)
+	}
+
+	if profile != nil && failures == g.cfg.Login.MaxFailures {
+		g.accountService.NotifyLockout(profile, failures, g.cfg.Login.Lockout)
+	}
+}
+
+// loginDelay is how long an email waits after its nth failed sign-in.
+func loginDelay(failures int) time.Duration {
+	if failures <= loginFreeFailures {
+		return 0
+	}
+	delay := loginBaseDelay
+	for i := loginFreeFailures + 1; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, loginMaxDelay)
+}
+
+// Emails are hashed so the store does not hold addresses, and lowercased
+// so changing case does not reset the count.
+func loginEmailKey(email string) string {
+	return "login:email:" + hashToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+func loginIPKey(ip string) string {
+	return "login:ip:" + ip
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genvid/backend/internal/captcha"
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/ratelimit"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{9, 32 * time.Second},
+		{10, time.Minute},
+		{11, time.Minute},
+		{1000, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures); got != tt.want {
+			t.Errorf("loginDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// newTestLoginGuard returns a guard on an in-memory store. Its limits are
+// high enough that no lockout is reached, since recording one needs the
+// database.
+func newTestLoginGuard() *LoginGuard {
+	cfg := &config.Config{Login: config.LoginConfig{
+		FailureWindow:  time.Hour,
+		CaptchaAfter:   5,
+		MaxFailures:    100,
+		MaxIPFailures:  100,
+		Lockout:        time.Hour,
+		MaxSignups:     3,
+		CaptchaSignups: 1,
+	}}
+	return NewLoginGuard(ratelimit.NewMemory(), captcha.NewStub("solved"), nil, nil, nil, cfg)
+}
+
+func TestLoginGuardDelaysAndCaptcha(t *testing.T) {
+	g := newTestLoginGuard()
+	ctx := context.Background()
+	client := model.ClientInfo{IPAddress: "203.0.113.9"}
+	const email = "victim@example.com"
+
+	for i := 1; i <= loginFreeFailures; i++ {
+		g.LoginFailed(ctx, email, client)
+		if err := g.CheckLogin(ctx, email, client, ""); err != nil {
+			t.Fatalf("CheckLogin() after %d failures error = %v", i, err)
+		}
+	}
+
+	g.LoginFailed(ctx, email, client)
+	var throttled *ThrottledError
+	if err := g.CheckLogin(ctx, email, client, ""); !errors.As(err, &throttled) || throttled.Locked {
+		t.Fatalf("CheckLogin() after %d failures error = %v, want a delay", loginFreeFailures+1, err)
+	}
+	if throttled.RetryAfter <= 0 || throttled.RetryAfter > loginBaseDelay {
+		t.Errorf("RetryAfter = %v, want at most %v", throttled.RetryAfter, loginBaseDelay)
+	}
+
+	// The delay follows the email, whatever its case, but not other emails.
+	if err := g.CheckLogin(ctx, " Victim@Example.com", model.ClientInfo{}, ""); !errors.As(err, &throttled) {
+		t.Errorf("CheckLogin() with another case error = %v, want a delay", err)
+	}
+	if err := g.CheckLogin(ctx, "other@example.com", model.ClientInfo{}, ""); err != nil {
+		t.Errorf("CheckLogin() of another email error = %v", err)
+	}
+
+	// The address has failed as often as the email, so other emails from
+	// it need a CAPTCHA once CaptchaAfter is reached.
+	g.LoginFailed(ctx, email, client)
+	if err := g.store.Reset(ctx, loginEmailKey(email)+":delay"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CheckLogin(ctx, "other@example.com", client, ""); !errors.Is(err, ErrCaptchaRequired) {
+		t.Errorf("CheckLogin() from a failing address error = %v, want ErrCaptchaRequired", err)
+	}
+	if err := g.CheckLogin(ctx, email, client, "wrong"); !errors.Is(err, ErrInvalidCaptcha) {
+		t.Errorf("CheckLogin() with a wrong CAPTCHA error = %v, want ErrInvalidCaptcha", err)
+	}
+	if err := g.CheckLogin(ctx, email, client, "solved"); err != nil {
+		t.Errorf("CheckLogin() with a solved CAPTCHA error = %v", err)
+	}
+
+	// Success forgets the email's failures but not the address's.
+	g.LoginSucceeded(ctx, email)
+	if err := g.CheckLogin(ctx, email, model.ClientInfo{}, ""); err != nil {
+		t.Errorf("CheckLogin() after success error = %v", err)
+	}
+	if err := g.CheckLogin(ctx, email, client, ""); !errors.Is(err, ErrCaptchaRequired) {
+		t.Errorf("CheckLogin() from the address after success error = %v, want ErrCaptchaRequired", err)
+	}
+}
+
+func TestLoginGuardSignups(t *testing.T) {
+	g := newTestLoginGuard()
+	ctx := context.Background()
+	client := model.ClientInfo{IPAddress: "203.0.113.10"}
+
+	if err := g.CheckSignup(ctx, client, ""); err != nil {
+		t.Fatalf("first CheckSignup() error = %v", err)
+	}
+	if err := g.CheckSignup(ctx, client, ""); !errors.Is(err, ErrCaptchaRequired) {
+		t.Fatalf("second CheckSignup() error = %v, want ErrCaptchaRequired", err)
+	}
+	if err := g.CheckSignup(ctx, client, "solved"); err != nil {
+		t.Fatalf("third CheckSignup() error = %v", err)
+	}
+	var throttled *ThrottledError
+	if err := g.CheckSignup(ctx, client, "solved"); !errors.As(err, &throttled) {
+		t.Fatalf("fourth CheckSignup() error = %v, want ThrottledError", err)
+	}
+	if err := g.CheckSignup(ctx, model.ClientInfo{}, ""); err != nil {
+		t.Errorf("CheckSignup() without an address error = %v", err)
+	}
+}
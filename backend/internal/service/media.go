@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/genvid/backend/internal/video"
+)
+
+// tempDir holds scratch files for ffmpeg jobs. Nothing in it outlives the
+// job; finished media is published to the store.
+const tempDir = "./temp_videos"
+
+const maxInlineImageBytes = 10 << 20
+
+func (s *ProjectService) newMerger() *video.Merger {
+	return video.NewMerger(tempDir, s.store)
+}
+
+func renderVideoKey(renderID string) string {
+	return "renders/" + renderID + "/video.mp4"
+}
+
+func renderThumbnailKey(renderID string) string {
+	return "renders/" + renderID + "/thumbnail.jpg"
+}
+
+// publishRender stores a locally rendered video and a thumbnail taken from
+// its first frame. A missing thumbnail is not an error.
+func (s *ProjectService) publishRender(ctx context.Context, render *model.Render, localPath string) (*storage.Stored, *storage.Stored, error) {
+	merger := s.newMerger()
+
+	var thumbnail *storage.Stored
+	thumbPath := strings.TrimSuffix(localPath, filepath.Ext(localPath)) + "_thumb.jpg"
+	if _, err := video.ExtractFrame(localPath, 0, thumbPath); err == nil {
+		if stored, err := merger.Publish(ctx, thumbPath, renderThumbnailKey(render.ID), "image/jpeg"); err == nil {
+			thumbnail = stored
+		}
+		os.Remove(thumbPath)
+	}
+
+	videoObj, err := merger.Publish(ctx, localPath, renderVideoKey(render.ID), "video/mp4")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return videoObj, thumbnail, nil
+}
+
+// uploadKey maps an upload URL to its storage key, accepting only objects in
+// the user's own upload prefix. URLs from before the storage package
+// ("…/uploads/{userID}/{file}") map onto the same keys.
+func (s *ProjectService) uploadKey(ctx context.Context, userID, url string) (string, error) {
+	key, ok := s.storedKey(url)
+	if !ok {
+		return "", ErrMediaNotFound
+	}
+
+	if !strings.HasPrefix(key, "uploads/"+userID+"/") || storage.ValidateKey(key) != nil {
+		return "", ErrMediaNotFound
+	}
+	if _, err := s.store.Stat(ctx, key); err != nil {
+		return "", ErrMediaNotFound
+	}
+
+	return key, nil
+}
+
+// storedKey maps a URL saved on a record to its storage key, including
+// "…/uploads/{userID}/{file}" URLs saved before the storage package.
+func (s *ProjectService) storedKey(url string) (string, bool) {
+	if key, ok := s.store.KeyFromURL(url); ok {
+		return key, true
+	}
+	idx := strings.Index(url, "/uploads/")
+	if idx < 0 {
+		return "", false
+	}
+	key := url[idx+1:]
+	if i := strings.IndexByte(key, '?'); i >= 0 {
+		key = key[:i]
+	}
+	return key, storage.ValidateKey(key) == nil
+}
+
+// fetchUpload copies one of the user's uploads into the temp directory.
+func (s *ProjectService) fetchUpload(ctx context.Context, userID, url, filename string) (string, error) {
+	key, err := s.uploadKey(ctx, userID, url)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(tempDir, filename+filepath.Ext(key))
+	if err := storage.Download(ctx, s.store, key, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// localVideoPath returns a local file for a video URL, downloading stored
+// and provider hosted videos into the temp directory. The bool reports
+// whether the file is a temporary copy.
+func (s *ProjectService) localVideoPath(merger *video.Merger, url, filename string) (string, bool, error) {
+	// Renders from before the storage package live in the temp directory.
+	if strings.HasPrefix(url, "/temp_videos/") {
+		return filepath.Join(tempDir, filepath.Base(url)), false, nil
+	}
+
+	path, err := merger.DownloadVideo(url, filename)
+	return path, err == nil, err
+}
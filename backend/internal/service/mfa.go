@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/pkg/auth"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrNoTOTPEnrollment  = errors.New("no authenticator is being set up; start again")
+	ErrMFACodeRequired   = errors.New("an authentication code is required")
+	ErrInvalidMFACode    = errors.New("invalid or already used authentication code")
+	ErrInvalidMFAToken   = errors.New("sign-in challenge is invalid, expired or used up")
+	ErrRecentLogin       = errors.New("sign in again to confirm it is you")
+)
+
+const (
+	mfaChallengeTTL      = 5 * time.Minute
+	mfaChallengeAttempts = 5
+	// A new authenticator must be confirmed within this time.
+	totpEnrollmentTTL = 15 * time.Minute
+	// Accounts without a password and second factor prove who they are by
+	// having signed in this recently.
+	recentLoginWindow = 10 * time.Minute
+
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// MFA methods a challenge accepts.
+var mfaMethods = []string{"totp", "recovery_code"}
+
+// MFARequiredError is returned instead of tokens when the account has
+// two-factor authentication; the challenge is exchanged with a code at
+// MFAService.Verify.
+type MFARequiredError struct {
+	Challenge *model.MFAChallengeResponse
+}
+
+func (e *MFARequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+// MFAService enrolls TOTP authenticators and checks second factors.
+type MFAService struct {
+	mfaRepo     *repository.MFARepository
+	profileRepo *repository.ProfileRepository
+	authService *AuthService
+	sealer      *auth.Sealer
+	cfg         *config.Config
+}
+
+func NewMFAService(mfaRepo *repository.MFARepository, profileRepo *repository.ProfileRepository, authService *AuthService, cfg *config.Config) (*MFAService, error) {
+	sealer, err := auth.NewSealer(cfg.MFA.KeySecret, "totp secret")
+	if err != nil {
+		return nil, err
+	}
+	return &MFAService{
+		mfaRepo:     mfaRepo,
+		profileRepo: profileRepo,
+		authService: authService,
+		sealer:      sealer,
+		cfg:         cfg,
+	}, nil
+}
+
+func (s *MFAService) Status(ctx context.Context, userID string) (*model.MFAStatus, error) {
+	status := &model.MFAStatus{}
+	factor, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && factor.ConfirmedAt == nil) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status.Enabled, status.EnabledAt = true, factor.ConfirmedAt
+	status.RecoveryCodesRemaining, err = s.mfaRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// StartTOTP creates a pending authenticator after checking the password.
+// It protects sign-in once ConfirmTOTP accepts a code from it.
+func (s *MFAService) StartTOTP(ctx context.Context, userID, sessionID string, req *model.MFAReauthRequest, client model.ClientInfo) (*model.TOTPEnrollment, error) {
+	profile, err := s.reauthenticate(ctx, userID, sessionID, req, false, client)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealer.Seal([]byte(secret), userID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.mfaRepo.SaveTOTP(ctx, &model.TOTPFactor{UserID: userID, Secret: sealed})
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPURI(s.cfg.MFA.Issuer, profile.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the pending authenticator with its first code and
+// returns the recovery codes, which are not shown again.
+func (s *MFAService) ConfirmTOTP(ctx context.Context, userID, code string) (*model.RecoveryCodesResponse, error) {
+	factor, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrNoTOTPEnrollment
+	}
+	if err != nil {
+		return nil, err
+	}
+	if factor.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if time.Since(factor.CreatedAt) > totpEnrollmentTTL {
+		return nil, ErrNoTOTPEnrollment
+	}
+
+	secret, err := s.sealer.Open(factor.Secret, userID)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := auth.ValidateTOTP(string(secret), strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.mfaRepo.ConfirmTOTP(ctx, userID, step, hashes)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrNoTOTPEnrollment
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &model.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// Disable turns two-factor authentication off after checking the password
+// and a current code.
+func (s *MFAService) Disable(ctx context.Context, userID, sessionID string, req *model.MFAReauthRequest, client model.ClientInfo) error {
+	if _, err := s.reauthenticate(ctx, userID, sessionID, req, true, client); err != nil {
+		return err
+	}
+	return s.mfaRepo.Disable(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking the
+// password and a current code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID, sessionID string, req *model.MFAReauthRequest, client model.ClientInfo) (*model.RecoveryCodesResponse, error) {
+	if _, err := s.reauthenticate(ctx, userID, sessionID, req, true, client); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return &model.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// Verify exchanges a sign-in challenge and a TOTP or recovery code for
+// tokens. A challenge allows a few attempts and works once; wrong codes
+// count as failed sign-ins of the account's email.
+func (s *MFAService) Verify(ctx context.Context, req *model.MFAVerifyRequest, client model.ClientInfo) (*model.AuthResponse, error) {
+	challenge, err := s.mfaRepo.AttemptChallenge(ctx, hashToken(req.MFAToken), mfaChallengeAttempts)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.profileRepo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	guard := s.authService.guard
+	if err := guard.CheckThrottled(ctx, profile.Email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCode(ctx, challenge.UserID, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			guard.LoginFailed(ctx, profile.Email, client)
+		}
+		return nil, err
+	}
+
+	consumed, err := s.mfaRepo.ConsumeChallenge(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidMFAToken
+	}
+
+	guard.LoginSucceeded(ctx, profile.Email)
+	if err := s.profileRepo.UpdateLastLogin(ctx, profile.ID); err != nil {
+		return nil, err
+	}
+	return s.authService.issueTokens(ctx, profile, client)
+}
+
+// PruneChallenges deletes expired sign-in challenges.
+func (s *MFAService) PruneChallenges(ctx context.Context) (int64, error) {
+	return s.mfaRepo.DeleteExpiredChallenges(ctx)
+}
+
+// reauthenticate checks the password of accounts that have one and, when
+// requireCode is set, a code from an enabled second factor. Accounts
+// without a password must give a code if they have a second factor, and
+// otherwise have signed in to this session recently. Wrong passwords and
+// codes count as failed sign-ins, like those at Verify.
+func (s *MFAService) reauthenticate(ctx context.Context, userID, sessionID string, req *model.MFAReauthRequest, requireCode bool, client model.ClientInfo) (*model.Profile, error) {
+	profile, err := s.profileRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	guard := s.authService.guard
+	if err := guard.CheckThrottled(ctx, profile.Email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.mfaRepo.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.PasswordHash != nil {
+		if err := auth.CheckPassword(req.Password, *profile.PasswordHash); err != nil {
+			guard.LoginFailed(ctx, profile.Email, client)
+			return nil, ErrWrongPassword
+		}
+	} else if enabled {
+		requireCode = true
+	} else if !requireCode {
+		if err := s.checkRecentLogin(ctx, userID, sessionID); err != nil {
+			return nil, err
+		}
+	}
+	if !requireCode {
+		return profile, nil
+	}
+
+	if !enabled {
+		return nil, ErrMFANotEnabled
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		return nil, ErrMFACodeRequired
+	}
+	if err := s.checkCode(ctx, userID, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			guard.LoginFailed(ctx, profile.Email, client)
+		}
+		return nil, err
+	}
+	return profile, nil
+}
+
+// checkRecentLogin returns ErrRecentLogin unless the session began within
+// recentLoginWindow.
+func (s *MFAService) checkRecentLogin(ctx context.Context, userID, sessionID string) error {
+	if sessionID == "" {
+		return ErrRecentLogin
+	}
+	session, err := s.authService.sessionRepo.GetActive(ctx, userID, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrRecentLogin
+	}
+	if err != nil {
+		return err
+	}
+	if time.Since(session.CreatedAt) > recentLoginWindow {
+		return ErrRecentLogin
+	}
+	return nil
+}
+
+// checkCode accepts a TOTP code of a step not used before, or an unused
+// recovery code, and uses it up.
+func (s *MFAService) checkCode(ctx context.Context, userID, code string) error {
+	code = strings.TrimSpace(code)
+	if !auth.IsTOTPCode(code) {
+		used, err := s.mfaRepo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	factor, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+	if factor.ConfirmedAt == nil {
+		return ErrInvalidMFACode
+	}
+
+	secret, err := s.sealer.Open(factor.Secret, userID)
+	if err != nil {
+		return err
+	}
+	step, ok := auth.ValidateTOTP(string(secret), code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	fresh, err := s.mfaRepo.UseTOTPStep(ctx, userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// newRecoveryCodes returns codes formatted as xxxxx-xxxxx and the hashes
+// to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := range codes {
+		b := make([]byte, 10)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = recoveryCodeAlphabet[n.Int64()]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		hashes[i] = hashToken(string(b))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes, which users add
+// and drop when copying codes.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+)
+
+const (
+	mirrorAttempts = 3
+	maxMirrorBytes = 1 << 30
+)
+
+var mirrorClient = &http.Client{Timeout: 5 * time.Minute}
+
+// BackfillReport summarises a BackfillMedia run.
+type BackfillReport struct {
+	Scanned  int
+	Mirrored int
+	Skipped  int
+	Failed   int
+}
+
+func renderSegmentKey(renderID string, position int) string {
+	return fmt.Sprintf("renders/%s/segments/%d.mp4", renderID, position)
+}
+
+// downloadVerified fetches url into path, checking the byte count against
+// Content-Length. Transient failures are retried.
+func downloadVerified(ctx context.Context, url, path string) error {
+	var lastErr error
+	for attempt := 1; attempt <= mirrorAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 2 * time.Second):
+			}
+		}
+
+		lastErr = downloadOnce(ctx, url, path)
+		if lastErr == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(lastErr, &permanent) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// permanentError marks download failures that retrying cannot fix, such as
+// an expired provider link.
+type permanentError struct{ status int }
+
+func (e *permanentError) Error() string {
+	return fmt.Sprintf("download failed: status %d", e.status)
+}
+
+func downloadOnce(ctx context.Context, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := mirrorClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return &permanentError{status: resp.StatusCode}
+		}
+		return fmt.Errorf("download failed: status %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(out, io.LimitReader(resp.Body, maxMirrorBytes+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > maxMirrorBytes {
+		err = fmt.Errorf("download exceeds %d bytes", maxMirrorBytes)
+	}
+	if err == nil && resp.ContentLength >= 0 && written != resp.ContentLength {
+		err = fmt.Errorf("download truncated: got %d of %d bytes", written, resp.ContentLength)
+	}
+	if err == nil && written == 0 {
+		err = errors.New("download was empty")
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+// mirrorRemote copies a provider hosted file into our storage.
+func (s *ProjectService) mirrorRemote(ctx context.Context, url, key, contentType string) (*storage.Stored, error) {
+	localPath := filepath.Join(tempDir, strings.ReplaceAll(key, "/", "_"))
+	defer os.Remove(localPath)
+
+	if err := downloadVerified(ctx, url, localPath); err != nil {
+		return nil, err
+	}
+	return storage.PutFile(ctx, s.store, key, localPath, contentType)
+}
+
+// recordRenderAssets registers a render's stored video and thumbnail in the
+// assets table. Failures are logged; the media itself is already safe.
+func (s *ProjectService) recordRenderAssets(ctx context.Context, project *model.Project, render *model.Render, videoObj, thumbnail *storage.Stored, sourceURLs ...string) {
+	record := func(obj *storage.Stored, assetType model.AssetType, purpose model.AssetPurpose, sourceURL string) {
+		if obj == nil {
+			return
+		}
+
+		asset := &model.Asset{
+			ProjectID:      &project.ID,
+			UserID:         project.UserID,
+			Type:           assetType,
+			Purpose:        purpose,
+			Filename:       path.Base(obj.Key),
+			URL:            obj.URL,
+			StorageKey:     &obj.Key,
+			ChecksumSHA256: &obj.SHA256,
+			FileSizeBytes:  &obj.Size,
+			MimeType:       &obj.ContentType,
+		}
+		if render != nil {
+			asset.RenderID = &render.ID
+		}
+		if sourceURL != "" {
+			asset.SourceURL = &sourceURL
+		}
+		if assetType == model.AssetTypeVideo && render != nil {
+			duration := float64(render.DurationSeconds)
+			asset.DurationSeconds = &duration
+		}
+
+		if err := s.assetRepo.Create(ctx, asset); err != nil {
+			log.Printf("Failed to record %s asset for project %s: %v", purpose, project.ID, err)
+		}
+	}
+
+	var videoSource, thumbnailSource string
+	if len(sourceURLs) > 0 {
+		videoSource = sourceURLs[0]
+	}
+	if len(sourceURLs) > 1 {
+		thumbnailSource = sourceURLs[1]
+	}
+
+	record(videoObj, model.AssetTypeVideo, model.AssetPurposeGeneratedVideo, videoSource)
+	record(thumbnail, model.AssetTypeImage, model.AssetPurposeThumbnail, thumbnailSource)
+}
+
+// BackfillMedia copies the video and thumbnail of completed projects that
+// still point at provider or legacy temp URLs into our storage, and
+// rewrites the project and its render to our own URLs. Links that have
+// already expired are reported as failures and left untouched.
+func (s *ProjectService) BackfillMedia(ctx context.Context, batchSize int, dryRun bool) (*BackfillReport, error) {
+	report := &BackfillReport{}
+	afterID := ""
+
+	for {
+		projects, err := s.projectRepo.ListCompletedAfter(ctx, afterID, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(projects) == 0 {
+			return report, nil
+		}
+
+		for i := range projects {
+			project := &projects[i]
+			afterID = project.ID
+			report.Scanned++
+
+			if !s.needsMirror(project.VideoURL) && !s.needsMirror(project.ThumbnailURL) {
+				report.Skipped++
+				continue
+			}
+			if dryRun {
+				log.Printf("Would mirror media for project %s", project.ID)
+				report.Mirrored++
+				continue
+			}
+
+			if err := s.backfillProject(ctx, project); err != nil {
+				log.Printf("Failed to mirror media for project %s: %v", project.ID, err)
+				report.Failed++
+				continue
+			}
+			report.Mirrored++
+		}
+	}
+}
+
+func (s *ProjectService) backfillProject(ctx context.Context, project *model.Project) error {
+	// Prefer the render that produced the current video so its keys and
+	// history line up with new renders.
+	var render *model.Render
+	latest, err := s.renderRepo.GetLatestCompleted(ctx, project.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	if latest != nil && latest.VideoURL != nil && project.VideoURL != nil && *latest.VideoURL == *project.VideoURL {
+		render = latest
+	}
+
+	videoKey := "projects/" + project.ID + "/video.mp4"
+	thumbnailKey := "projects/" + project.ID + "/thumbnail.jpg"
+	if render != nil {
+		videoKey = renderVideoKey(render.ID)
+		thumbnailKey = renderThumbnailKey(render.ID)
+	}
+
+	videoURL, thumbnailURL := project.VideoURL, project.ThumbnailURL
+	var videoObj, thumbnailObj *storage.Stored
+	var videoSource, thumbnailSource string
+
+	if s.needsMirror(project.VideoURL) {
+		videoSource = *project.VideoURL
+		videoObj, err = s.mirrorLegacy(ctx, videoSource, videoKey, "video/mp4")
+		if err != nil {
+			return fmt.Errorf("video: %w", err)
+		}
+		videoURL = &videoObj.URL
+	}
+	if s.needsMirror(project.ThumbnailURL) {
+		thumbnailSource = *project.ThumbnailURL
+		thumbnailObj, err = s.mirrorLegacy(ctx, thumbnailSource, thumbnailKey, "image/jpeg")
+		if err != nil {
+			// A video without a thumbnail is still worth saving.
+			log.Printf("Failed to mirror thumbnail for project %s: %v", project.ID, err)
+			thumbnailURL = nil
+		} else {
+			thumbnailURL = &thumbnailObj.URL
+		}
+	}
+
+	if err := s.projectRepo.SetMedia(ctx, project.ID, videoURL, thumbnailURL); err != nil {
+		return err
+	}
+	if render != nil {
+		if err := s.renderRepo.SetMedia(ctx, render.ID, videoURL, thumbnailURL); err != nil {
+			return err
+		}
+	}
+
+	s.recordRenderAssets(ctx, project, render, videoObj, thumbnailObj, videoSource, thumbnailSource)
+	return nil
+}
+
+// mirrorLegacy stores a remote URL or a file left in the temp directory by
+// renders that predate the storage package.
+func (s *ProjectService) mirrorLegacy(ctx context.Context, url, key, contentType string) (*storage.Stored, error) {
+	if strings.HasPrefix(url, "/temp_videos/") {
+		return storage.PutFile(ctx, s.store, key, filepath.Join(tempDir, filepath.Base(url)), contentType)
+	}
+	return s.mirrorRemote(ctx, url, key, contentType)
+}
+
+func (s *ProjectService) needsMirror(url *string) bool {
+	if url == nil || *url == "" {
+		return false
+	}
+	_, ours := s.store.KeyFromURL(*url)
+	return !ours
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/oidc"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrOAuthDisabled    = errors.New("sign-in with this provider is not configured")
+	ErrOAuthState       = errors.New("sign-in state is missing, expired or does not match")
+	ErrOAuthExchange    = errors.New("could not complete sign-in with the provider")
+	ErrEmailNotVerified = errors.New("the provider has not verified this email")
+)
+
+const (
+	ProviderGoogle = "google"
+
+	// oauthStateTTL is how long a user has to finish signing in at the
+	// provider.
+	oauthStateTTL        = 10 * time.Minute
+	oauthProviderTimeout = 15 * time.Second
+)
+
+// OAuthService signs users in with an OpenID Connect provider using the
+// authorization code flow with state, nonce and PKCE. The values the
+// callback checks travel in a signed cookie, so any instance can finish a
+// sign-in another one started.
+type OAuthService struct {
+	authService  *AuthService
+	profileRepo  *repository.ProfileRepository
+	identityRepo *repository.IdentityRepository
+	cfg          *config.Config
+	client       *http.Client
+
+	mu     sync.Mutex
+	google *oidc.Provider
+}
+
+func NewOAuthService(authService *AuthService, profileRepo *repository.ProfileRepository, identityRepo *repository.IdentityRepository, cfg *config.Config) *OAuthService {
+	return &OAuthService{
+		authService:  authService,
+		profileRepo:  profileRepo,
+		identityRepo: identityRepo,
+		cfg:          cfg,
+		client:       &http.Client{Timeout: oauthProviderTimeout},
+	}
+}
+
+// oauthState is what the callback needs to finish a sign-in.
+type oauthState struct {
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// StartGoogle returns the URL that sends the user to Google and the signed
+// state to keep in a cookie until the callback.
+func (s *OAuthService) StartGoogle(ctx context.Context) (authURL, state string, err error) {
+	conf, _, err := s.googleConfig(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	st := oauthState{
+		State:     randomToken(),
+		Nonce:     randomToken(),
+		Verifier:  oauth2.GenerateVerifier(),
+		ExpiresAt: time.Now().Add(oauthStateTTL).Unix(),
+	}
+	authURL = conf.AuthCodeURL(st.State,
+		oauth2.S256ChallengeOption(st.Verifier),
+		oauth2.SetAuthURLParam("nonce", st.Nonce),
+		oauth2.SetAuthURLParam("prompt", "select_account"),
+	)
+	return authURL, s.signState(&st), nil
+}
+
+// FinishGoogle exchanges the callback's code, verifies the ID token and
+// signs the user in: an account already linked to the Google subject, else
+// the profile with the same verified email, else a new profile. Accounts
+// with two-factor authentication get an *MFARequiredError, as with Login.
+func (s *OAuthService) FinishGoogle(ctx context.Context, code, state, signedState string, client model.ClientInfo) (*model.AuthResponse, error) {
+	st, err := s.parseState(signedState)
+	if err != nil || subtle.ConstantTimeCompare([]byte(st.State), []byte(state)) != 1 {
+		return nil, ErrOAuthState
+	}
+
+	conf, provider, err := s.googleConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.client)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuthExchange, err)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrOAuthExchange)
+	}
+	claims, err := provider.Verify(ctx, rawIDToken, conf.ClientID, st.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuthExchange, err)
+	}
+
+	profile, err := s.signIn(ctx, ProviderGoogle, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.signIn(ctx, profile, client)
+}
+
+// signIn finds or creates the profile for a verified identity. Linking by
+// email requires the provider to have verified it; otherwise anyone could
+// take over an account by registering its address at the provider.
+func (s *OAuthService) signIn(ctx context.Context, provider string, claims *oidc.Claims) (*model.Profile, error) {
+	var email *string
+	if claims.Email != "" {
+		email = &claims.Email
+	}
+
+	identity, err := s.identityRepo.Get(ctx, provider, claims.Subject)
+	if err == nil {
+		_ = s.identityRepo.Touch(ctx, provider, claims.Subject, email)
+		return s.profileRepo.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if email == nil || !claims.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	profile, err := s.profileRepo.GetByEmail(ctx, claims.Email)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		now := time.Now()
+		profile = &model.Profile{
+			ID:              uuid.New().String(),
+			Email:           claims.Email,
+			EmailVerifiedAt: &now,
+		}
+		if claims.Name != "" {
+			profile.FullName = &claims.Name
+		}
+		err = s.profileRepo.Create(ctx, profile)
+	case err == nil && profile.EmailVerifiedAt == nil:
+		// The provider has verified the address for us. Whoever registered
+		// the profile never proved they own it, so anything they set up is
+		// removed before the owner is linked in: otherwise they could
+		// register the address first and keep signing in with their own
+		// password after the owner arrives.
+		var verified bool
+		if verified, err = s.profileRepo.ClaimEmail(ctx, profile.ID, profile.Email); verified {
+			profile, err = s.profileRepo.GetByID(ctx, profile.ID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.identityRepo.Create(ctx, &model.OAuthIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		UserID:   profile.ID,
+		Email:    email,
+	})
+	if errors.Is(err, repository.ErrDuplicate) {
+		// Linked by a concurrent callback for the same account.
+		identity, err := s.identityRepo.Get(ctx, provider, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+		return s.profileRepo.GetByID(ctx, identity.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// googleConfig discovers Google's endpoints on first use. A failed
+// discovery is retried on the next sign-in.
+func (s *OAuthService) googleConfig(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	google := s.cfg.OAuth.Google
+	if google.ClientID == "" || google.ClientSecret == "" || google.RedirectURL == "" {
+		return nil, nil, ErrOAuthDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.google == nil {
+		provider, err := oidc.Discover(ctx, google.IssuerURL, s.client)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrOAuthExchange, err)
+		}
+		s.google = provider
+	}
+
+	return &oauth2.Config{
+		ClientID:     google.ClientID,
+		ClientSecret: google.ClientSecret,
+		RedirectURL:  google.RedirectURL,
+		Endpoint:     s.google.Endpoint,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, s.google, nil
+}
+
+// signState encodes the state as base64url(JSON).base64url(HMAC-SHA256).
+func (s *OAuthService) signState(st *oauthState) string {
+	payload, _ := json.Marshal(st)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.stateMAC(encoded))
+}
+
+func (s *OAuthService) parseState(signed string) (*oauthState, error) {
+	encoded, sig, ok := strings.Cut(signed, ".")
+	if !ok {
+		return nil, ErrOAuthState
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.stateMAC(encoded)) {
+		return nil, ErrOAuthState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrOAuthState
+	}
+	st := &oauthState{}
+	if err := json.Unmarshal(payload, st); err != nil {
+		return nil, ErrOAuthState
+	}
+	if time.Now().Unix() > st.ExpiresAt {
+		return nil, ErrOAuthState
+	}
+	return st, nil
+}
+
+func (s *OAuthService) stateMAC(encoded string) []byte {
+	mac := hmac.New(sha256.New, []byte(s.cfg.OAuth.StateSecret))
+	mac.Write([]byte("oauth-state:" + encoded))
+	return mac.Sum(nil)
+}
+
+// randomToken returns 32 random bytes, base64url encoded.
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/oidc/oidctest"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/pkg/auth"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const testRedirectURL = "http://app.test/api/auth/google/callback"
+
+// newOAuthTest serves a fake provider and returns an OAuthService that signs
+// in with it. Without a database only the steps before the profile lookup
+// can run.
+func newOAuthTest(t *testing.T, db *sqlx.DB) (*OAuthService, *oidctest.Provider) {
+	t.Helper()
+	provider, err := oidctest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(provider)
+	t.Cleanup(server.Close)
+	provider.Issuer = server.URL
+
+	cfg := &config.Config{
+		JWT: testJWTConfig,
+		OAuth: config.OAuthConfig{
+			Google: config.GoogleOAuthConfig{
+				ClientID:     "test-client",
+				ClientSecret: "test-secret",
+				RedirectURL:  testRedirectURL,
+				IssuerURL:    server.URL,
+			},
+			StateSecret: "test-state-secret",
+		},
+	}
+
+	if db == nil {
+		return NewOAuthService(nil, nil, nil, cfg), provider
+	}
+
+	jwtService, err := auth.NewJWTService(cfg.JWT, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileRepo := repository.NewProfileRepository(db)
+	authService := NewAuthService(profileRepo, repository.NewSessionRepository(db), repository.NewMFARepository(db), jwtService, nil, cfg)
+	return NewOAuthService(authService, profileRepo, repository.NewIdentityRepository(db), cfg), provider
+}
+
+// authorize starts a sign-in and follows it to the provider, which approves
+// it at once. edit may change the authorization request first, as an
+// attacker could. It returns the callback's code and state and the signed
+// state cookie.
+func authorize(t *testing.T, s *OAuthService, edit func(url.Values)) (code, state, signedState string) {
+	t.Helper()
+	authURL, signedState, err := s.StartGoogle(context.Background())
+	if err != nil {
+		t.Fatalf("StartGoogle() error = %v", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		query := u.Query()
+		edit(query)
+		u.RawQuery = query.Encode()
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", resp.StatusCode)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(callback.String(), testRedirectURL) {
+		t.Fatalf("authorize redirected to %q", resp.Header.Get("Location"))
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state"), signedState
+}
+
+func TestStartGoogleRequest(t *testing.T) {
+	s, _ := newOAuthTest(t, nil)
+	authURL, signedState, err := s.StartGoogle(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	st, err := s.parseState(signedState)
+	if err != nil {
+		t.Fatalf("parseState() error = %v", err)
+	}
+	if query.Get("state") != st.State || query.Get("nonce") != st.Nonce {
+		t.Errorf("state and nonce in %s do not match the cookie", authURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("%s has no S256 code challenge", authURL)
+	}
+	if strings.Contains(authURL, st.Verifier) {
+		t.Error("the PKCE verifier was sent to the provider")
+	}
+}
+
+func TestFinishGoogleRejectsMismatches(t *testing.T) {
+	ctx := context.Background()
+	client := model.ClientInfo{IPAddress: "203.0.113.1"}
+
+	t.Run("state parameter", func(t *testing.T) {
+		s, _ := newOAuthTest(t, nil)
+		code, _, signedState := authorize(t, s, nil)
+		_, err := s.FinishGoogle(ctx, code, "forged-state", signedState, client)
+		if !errors.Is(err, ErrOAuthState) {
+			t.Fatalf("FinishGoogle() error = %v, want ErrOAuthState", err)
+		}
+	})
+
+	t.Run("state cookie from another sign-in", func(t *testing.T) {
+		s, _ := newOAuthTest(t, nil)
+		code, state, _ := authorize(t, s, nil)
+		_, _, otherState := authorize(t, s, nil)
+		_, err := s.FinishGoogle(ctx, code, state, otherState, client)
+		if !errors.Is(err, ErrOAuthState) {
+			t.Fatalf("FinishGoogle() error = %v, want ErrOAuthState", err)
+		}
+	})
+
+	t.Run("tampered state cookie", func(t *testing.T) {
+		s, _ := newOAuthTest(t, nil)
+		code, state, signedState := authorize(t, s, nil)
+		payload, sig, _ := strings.Cut(signedState, ".")
+		tampered := payload + "x." + sig
+		_, err := s.FinishGoogle(ctx, code, state, tampered, client)
+		if !errors.Is(err, ErrOAuthState) {
+			t.Fatalf("FinishGoogle() error = %v, want ErrOAuthState", err)
+		}
+	})
+
+	t.Run("state signed with another secret", func(t *testing.T) {
+		s, _ := newOAuthTest(t, nil)
+		other, _ := newOAuthTest(t, nil)
+		other.cfg.OAuth.StateSecret = "another-secret"
+		code, state, _ := authorize(t, s, nil)
+		forged := other.signState(&oauthState{State: state, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+		_, err := s.FinishGoogle(ctx, code, state, forged, client)
+		if !errors.Is(err, ErrOAuthState) {
+			t.Fatalf("FinishGoogle() error = %v, want ErrOAuthState", err)
+		}
+	})
+
+	t.Run("expired state", func(t *testing.T) {
+		s, _ := newOAuthTest(t, nil)
+		code, state, signedState := authorize(t, s, nil)
+		st, _ := s.parseState(signedState)
+		st.ExpiresAt = time.Now().Add(-time.Second).Unix()
+		_, err := s.FinishGoogle(ctx, code, state, s.signState(st), client)
+		if !errors.Is(err, ErrOAuthState) {
+			t.Fatalf("FinishGoogle() error = %v, want ErrOAuthState", err)
+		}
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		// A code obtained for another nonce, e.g. injected from the
+		// attacker's own sign-in, yields an ID token for that nonce.
+		s, _ := newOAuthTest(t, nil)
+		code, state, signedState := authorize(t, s, func(q url.Values) { q.Set("nonce", "attacker-nonce") })
+		_, err := s.FinishGoogle(ctx, code, state, signedState, client)
+		if !errors.Is(err, ErrOAuthExchange) || !strings.Contains(err.Error(), "nonce") {
+			t.Fatalf("FinishGoogle() error = %v, want a nonce mismatch", err)
+		}
+	})
+
+	t.Run("PKCE", func(t *testing.T) {
+		s, _ := newOAuthTest(t, nil)
+		code, state, signedState := authorize(t, s, func(q url.Values) {
+			q.Set("code_challenge", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+		})
+		_, err := s.FinishGoogle(ctx, code, state, signedState, client)
+		if !errors.Is(err, ErrOAuthExchange) || !strings.Contains(err.Error(), "PKCE") {
+			t.Fatalf("FinishGoogle() error = %v, want a PKCE failure", err)
+		}
+	})
+}
+
+// TestFinishGoogleLinking needs a database; see openTestDB.
+func TestFinishGoogleLinking(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	client := model.ClientInfo{IPAddress: "203.0.113.1", UserAgent: "oauth-test"}
+	profileRepo := repository.NewProfileRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+
+	newEmail := func(t *testing.T) string {
+		email := "oauth-" + uuid.New().String() + "@example.com"
+		t.Cleanup(func() {
+			_, _ = db.Exec(`DELETE FROM profiles WHERE email = $1`, email)
+		})
+		return email
+	}
+	createProfile := func(t *testing.T, email string, verified bool) *model.Profile {
+		hash, err := auth.HashPassword("attacker-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile := &model.Profile{ID: uuid.New().String(), Email: email, PasswordHash: &hash}
+		if verified {
+			now := time.Now()
+			profile.EmailVerifiedAt = &now
+		}
+		if err := profileRepo.Create(ctx, profile); err != nil {
+			t.Fatal(err)
+		}
+		return profile
+	}
+	finish := func(t *testing.T, s *OAuthService, email string) (*model.AuthResponse, error) {
+		code, state, signedState := authorize(t, s, func(q url.Values) { q.Set("login_hint", email) })
+		return s.FinishGoogle(ctx, code, state, signedState, client)
+	}
+
+	t.Run("new user", func(t *testing.T) {
+		s, _ := newOAuthTest(t, db)
+		email := newEmail(t)
+		resp, err := finish(t, s, email)
+		if err != nil {
+			t.Fatalf("FinishGoogle() error = %v", err)
+		}
+		if resp.User.Email != email || resp.User.EmailVerifiedAt == nil || resp.User.PasswordSet {
+			t.Errorf("new profile = %+v", resp.User)
+		}
+
+		again, err := finish(t, s, email)
+		if err != nil || again.User.ID != resp.User.ID {
+			t.Fatalf("second sign-in = %v, %v; want profile %s", again, err, resp.User.ID)
+		}
+	})
+
+	t.Run("verified account is linked", func(t *testing.T) {
+		s, _ := newOAuthTest(t, db)
+		email := newEmail(t)
+		profile := createProfile(t, email, true)
+
+		resp, err := finish(t, s, email)
+		if err != nil {
+			t.Fatalf("FinishGoogle() error = %v", err)
+		}
+		if resp.User.ID != profile.ID || !resp.User.PasswordSet {
+			t.Errorf("linked profile = %+v, want %s with its password", resp.User, profile.ID)
+		}
+	})
+
+	t.Run("email not verified by the provider", func(t *testing.T) {
+		s, provider := newOAuthTest(t, db)
+		provider.EmailVerified = false
+		email := newEmail(t)
+		createProfile(t, email, true)
+
+		if _, err := finish(t, s, email); !errors.Is(err, ErrEmailNotVerified) {
+			t.Fatalf("FinishGoogle() error = %v, want ErrEmailNotVerified", err)
+		}
+	})
+
+	t.Run("pre-registered unverified account", func(t *testing.T) {
+		// Someone registered the victim's address and signed in before
+		// the victim ever used Google.
+		s, _ := newOAuthTest(t, db)
+		email := newEmail(t)
+		profile := createProfile(t, email, false)
+		if _, err := s.authService.issueTokens(ctx, profile, client); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := finish(t, s, email)
+		if err != nil {
+			t.Fatalf("FinishGoogle() error = %v", err)
+		}
+		if resp.User.ID != profile.ID || resp.User.EmailVerifiedAt == nil {
+			t.Fatalf("profile = %+v, want %s verified", resp.User, profile.ID)
+		}
+
+		claimed, err := profileRepo.GetByID(ctx, profile.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed.PasswordHash != nil {
+			t.Error("the pre-registered password still works")
+		}
+		sessions, err := sessionRepo.ListActive(ctx, profile.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 1 {
+			t.Errorf("%d active sessions, want only the Google one", len(sessions))
+		}
+	})
+}
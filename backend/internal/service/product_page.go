@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/productpage"
+	"github.com/genvid/backend/internal/safehttp"
+)
+
+var ErrProductPage = errors.New("could not read a product from the page")
+
+const (
+	maxProductPageBytes = 5 << 20
+	productPageTimeout  = 20 * time.Second
+	// ProductPageBudget bounds Parse as a whole: the page fetch and the
+	// image imports after it. Handlers that call Parse extend their write
+	// deadline past it.
+	ProductPageBudget = 45 * time.Second
+	// maxImageAttempts bounds how many page images are tried when the first
+	// cannot be imported.
+	maxImageAttempts = 3
+)
+
+// ProductPageService reads product details from shop pages to prefill
+// projects.
+type ProductPageService struct {
+	assetService *AssetService
+	fetcher      *safehttp.Client
+}
+
+func NewProductPageService(assetService *AssetService) *ProductPageService {
+	return &ProductPageService{
+		assetService: assetService,
+		fetcher:      safehttp.NewClient(productPageTimeout),
+	}
+}
+
+// Parse fetches a product page and extracts its product. With importImage
+// the main image is stored as one of the user's product_image assets.
+func (s *ProductPageService) Parse(ctx context.Context, userID, pageURL string, importImage bool) (*model.ProductPageInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, ProductPageBudget)
+	defer cancel()
+
+	resp, err := s.fetcher.Get(ctx, pageURL, "text/html,application/xhtml+xml", maxProductPageBytes)
+	switch {
+	case errors.Is(err, safehttp.ErrBlockedURL):
+		return nil, fmt.Errorf("%w: %v", ErrBlockedURL, err)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrRemoteFetch, err)
+	}
+
+	product, err := productpage.Extract(resp.URL, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProductPage, err)
+	}
+
+	info := &model.ProductPageInfo{
+		ProductURL:         resp.URL.String(),
+		ProductName:        product.Name,
+		ProductDescription: product.Description,
+		Brand:              product.Brand,
+		Price:              product.Price,
+		Currency:           product.Currency,
+		Images:             product.Images,
+	}
+	if info.Images == nil {
+		info.Images = []string{}
+	}
+
+	if importImage {
+		for i, imageURL := range info.Images {
+			if i == maxImageAttempts || ctx.Err() != nil {
+				break
+			}
+			asset, err := s.assetService.UploadFromURL(ctx, userID, imageURL, &model.UploadAssetRequest{
+				Purpose: model.AssetPurposeProductImage,
+			})
+			if err != nil {
+				log.Printf("Failed to import product image %s: %v", imageURL, err)
+				continue
+			}
+			info.ProductImage = asset
+			break
+		}
+	}
+
+	return info, nil
+}
+
+// Prefill fills the blank fields of a project request from its product_url.
+// A page that cannot be read only fails the request when the product name
+// was left for it to fill.
+func (s *ProductPageService) Prefill(ctx context.Context, userID string, req *model.CreateProjectRequest) error {
+	if req.ProductURL == nil || *req.ProductURL == "" {
+		return nil
+	}
+
+	hasImage := (req.ProductImageID != nil && *req.ProductImageID != "") ||
+		(req.ProductImageURL != nil && *req.ProductImageURL != "")
+	if req.ProductName != "" && req.ProductDescription != nil && hasImage {
+		return nil
+	}
+
+	info, err := s.Parse(ctx, userID, *req.ProductURL, !hasImage)
+	if err != nil {
+		if req.ProductName == "" {
+			return err
+		}
+		log.Printf("Failed to prefill project from %s: %v", *req.ProductURL, err)
+		return nil
+	}
+
+	if req.ProductName == "" {
+		req.ProductName = info.ProductName
+	}
+	if req.ProductDescription == nil && info.ProductDescription != "" {
+		req.ProductDescription = &info.ProductDescription
+	}
+	if !hasImage && info.ProductImage != nil {
+		req.ProductImageID = &info.ProductImage.ID
+	}
+	return nil
+}
+
+// SignInfo signs the imported image's URLs for a response.
+func (s *ProductPageService) SignInfo(ctx context.Context, info *model.ProductPageInfo) *model.ProductPageInfo {
+	signed := *info
+	if info.ProductImage != nil {
+		signed.ProductImage = s.assetService.SignAsset(ctx, info.ProductImage)
+	}
+	return &signed
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/prompt"
+	"github.com/genvid/backend/internal/repository"
+)
+
+var (
+	ErrInvalidPreset = errors.New("unknown style preset")
+	ErrInvalidAvatar = errors.New("unknown avatar")
+)
+
+func (s *ProjectService) ListStylePresets(ctx context.Context) ([]model.StylePreset, error) {
+	return s.promptRepo.ListPresets(ctx)
+}
+
+// promptCompiler compiles every scene of one render with the same preset,
+// persona and product, loading each role's template once.
+type promptCompiler struct {
+	repo      *repository.PromptRepository
+	preset    prompt.Preset
+	slug      *string
+	persona   *prompt.Persona
+	product   prompt.Product
+	templates map[string]*model.PromptTemplate
+}
+
+// newPromptCompiler loads the project's style preset and avatar persona.
+// Missing presets or templates fall back to the built-in defaults so a
+// misconfigured catalogue never blocks generation.
+func (s *ProjectService) newPromptCompiler(ctx context.Context, project *model.Project, hasImage bool) *promptCompiler {
+	c := &promptCompiler{
+		repo:      s.promptRepo,
+		preset:    prompt.DefaultPreset,
+		templates: make(map[string]*model.PromptTemplate),
+	}
+
+	slug := ""
+	if project.StylePreset != nil {
+		slug = *project.StylePreset
+	}
+	if preset, err := s.promptRepo.GetPreset(ctx, slug); err == nil {
+		c.preset = prompt.Preset{
+			Name:     preset.Name,
+			Camera:   preset.Camera,
+			Lighting: preset.Lighting,
+			Setting:  preset.Setting,
+			Mood:     preset.Mood,
+		}
+		c.slug = &preset.Slug
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Failed to load style preset %q: %v", slug, err)
+	}
+
+	if project.AvatarID != nil {
+		if avatar, err := s.avatarRepo.GetByID(ctx, *project.AvatarID); err == nil {
+			c.persona = &prompt.Persona{Style: avatar.Style}
+			if avatar.Gender != nil {
+				c.persona.Gender = *avatar.Gender
+			}
+			if avatar.AgeRange != nil {
+				c.persona.AgeRange = *avatar.AgeRange
+			}
+			if avatar.Ethnicity != nil {
+				c.persona.Ethnicity = *avatar.Ethnicity
+			}
+		}
+	}
+
+	if project.ProductName != nil {
+		c.product.Name = *project.ProductName
+	}
+	if project.ProductDescription != nil {
+		c.product.Description = *project.ProductDescription
+	}
+	c.product.HasImage = hasImage
+
+	return c
+}
+
+// Compile returns the provider prompt for a scene and the template used, if
+// it came from the database.
+func (c *promptCompiler) Compile(ctx context.Context, role string, direction *string) (string, *string) {
+	tmpl, ok := c.templates[role]
+	if !ok {
+		var err error
+		tmpl, err = c.repo.GetTemplate(ctx, role)
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				log.Printf("Failed to load prompt template for %q: %v", role, err)
+			}
+			tmpl = nil
+		}
+		c.templates[role] = tmpl
+	}
+
+	in := prompt.Input{
+		Role:    role,
+		Persona: c.persona,
+		Product: c.product,
+		Preset:  c.preset,
+	}
+	if direction != nil {
+		in.Direction = *direction
+	}
+
+	if tmpl != nil {
+		compiled, err := prompt.Compile(tmpl.Body, in)
+		if err == nil {
+			return compiled, &tmpl.ID
+		}
+		log.Printf("Prompt template %s failed, using default: %v", tmpl.ID, err)
+	}
+
+	compiled, _ := prompt.Compile(prompt.DefaultTemplate, in)
+	return compiled, nil
+}
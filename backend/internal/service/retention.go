@@ -0,0 +1,379 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// TierPolicy is how much a subscription tier may store and for how long.
+// Zero means unlimited.
+type TierPolicy struct {
+	QuotaBytes    int64
+	RetentionDays int
+}
+
+var tierPolicies = map[string]TierPolicy{
+	"free":       {QuotaBytes: 1 << 30, RetentionDays: 30},
+	"starter":    {QuotaBytes: 10 << 30, RetentionDays: 90},
+	"pro":        {QuotaBytes: 50 << 30, RetentionDays: 180},
+	"business":   {QuotaBytes: 200 << 30, RetentionDays: 365},
+	"enterprise": {},
+}
+
+// policyFor returns the tier's policy; unknown tiers get the free one.
+func policyFor(tier string) TierPolicy {
+	if policy, ok := tierPolicies[tier]; ok {
+		return policy
+	}
+	return tierPolicies["free"]
+}
+
+// expiry is when media finished at from expires, or nil if it never does.
+func (p TierPolicy) expiry(from time.Time) *time.Time {
+	if p.RetentionDays == 0 {
+		return nil
+	}
+	t := from.AddDate(0, 0, p.RetentionDays)
+	return &t
+}
+
+// SweepReport summarizes one storage sweep.
+type SweepReport struct {
+	DryRun          bool
+	ProjectsExpired int
+	AssetsDeleted   int
+	UploadsExpired  int
+	BlobsDeleted    int
+	ObjectsDeleted  int
+	BytesReclaimed  int64
+	Failed          int
+}
+
+// StorageService accounts for what users store, enforces tier quotas and
+// removes media once retention runs out.
+type StorageService struct {
+	profileRepo *repository.ProfileRepository
+	projectRepo *repository.ProjectRepository
+	renderRepo  *repository.RenderRepository
+	assetRepo   *repository.AssetRepository
+	uploadRepo  *repository.UploadRepository
+	store       storage.Storage
+}
+
+func NewStorageService(
+	profileRepo *repository.ProfileRepository,
+	projectRepo *repository.ProjectRepository,
+	renderRepo *repository.RenderRepository,
+	assetRepo *repository.AssetRepository,
+	uploadRepo *repository.UploadRepository,
+	store storage.Storage,
+) *StorageService {
+	return &StorageService{
+		profileRepo: profileRepo,
+		projectRepo: projectRepo,
+		renderRepo:  renderRepo,
+		assetRepo:   assetRepo,
+		uploadRepo:  uploadRepo,
+		store:       store,
+	}
+}
+
+// Usage counts the user's assets, their variants and space reserved by
+// resumable uploads in progress.
+func (s *StorageService) Usage(ctx context.Context, userID string) (*model.StorageUsage, error) {
+	profile, err := s.profileRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := s.assetRepo.StorageUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.uploadRepo.PendingBytes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := policyFor(profile.SubscriptionTier)
+	return &model.StorageUsage{
+		Tier:          profile.SubscriptionTier,
+		UsedBytes:     used + pending,
+		QuotaBytes:    policy.QuotaBytes,
+		RetentionDays: policy.RetentionDays,
+	}, nil
+}
+
+// CheckQuota returns ErrQuotaExceeded when storing size more bytes would
+// take the user over their tier's quota.
+func (s *StorageService) CheckQuota(ctx context.Context, userID string, size int64) error {
+	usage, err := s.Usage(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if usage.QuotaBytes > 0 && usage.UsedBytes+size > usage.QuotaBytes {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, usage.UsedBytes, usage.QuotaBytes)
+	}
+	return nil
+}
+
+// Sweep removes the media of expired projects, orphaned assets, abandoned
+// resumable uploads and stored files no asset uses, up to batchSize of
+// each. A dry run only reports what would be removed.
+func (s *StorageService) Sweep(ctx context.Context, batchSize int, dryRun bool) (*SweepReport, error) {
+	report := &SweepReport{DryRun: dryRun}
+
+	// Projects finished before retention existed, or while the sweeper was
+	// down, get their expiry first.
+	if !dryRun {
+		for tier, policy := range tierPolicies {
+			if policy.RetentionDays == 0 {
+				continue
+			}
+			if _, err := s.projectRepo.AssignExpiry(ctx, tier, policy.RetentionDays); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	projects, err := s.projectRepo.ListExpired(ctx, batchSize)
+	if err != nil {
+		return report, err
+	}
+	for i := range projects {
+		if err := s.expireProject(ctx, &projects[i], report); err != nil {
+			log.Printf("Failed to expire project %s: %v", projects[i].ID, err)
+			report.Failed++
+			continue
+		}
+		report.ProjectsExpired++
+	}
+
+	for tier, policy := range tierPolicies {
+		var cutoff time.Time
+		if policy.RetentionDays > 0 {
+			cutoff = time.Now().AddDate(0, 0, -policy.RetentionDays)
+		}
+		assets, err := s.assetRepo.ListOrphaned(ctx, tier, cutoff, batchSize)
+		if err != nil {
+			return report, err
+		}
+		for i := range assets {
+			if err := s.removeAsset(ctx, &assets[i], report); err != nil {
+				log.Printf("Failed to remove orphaned asset %s: %v", assets[i].ID, err)
+				report.Failed++
+				continue
+			}
+			report.AssetsDeleted++
+		}
+	}
+
+	// Files whose last asset went without releasing them, e.g. when a
+	// process stopped in between.
+	blobs, err := s.assetRepo.ListUnreferencedBlobs(ctx, batchSize)
+	if err != nil {
+		return report, err
+	}
+	for i := range blobs {
+		removed, err := s.removeBlob(ctx, &blobs[i], report)
+		if err != nil {
+			log.Printf("Failed to remove stored file %s: %v", blobs[i].StorageKey, err)
+			report.Failed++
+			continue
+		}
+		if removed {
+			report.BlobsDeleted++
+		}
+	}
+
+	// Uploads are finished in the background by the instance that took the
+	// last chunk. If it stopped first, the session would stay processing
+	// for good; failing it lets the client see that and lets it expire.
+	if !dryRun {
+		stale, err := s.uploadRepo.FailStale(ctx, time.Now().Add(-staleUploadAfter), uploadInterrupted)
+		if err != nil {
+			return report, err
+		}
+		if stale > 0 {
+			log.Printf("Failed %d uploads whose processing was interrupted", stale)
+		}
+	}
+
+	sessions, err := s.uploadRepo.ListExpired(ctx, batchSize)
+	if err != nil {
+		return report, err
+	}
+	for _, session := range sessions {
+		if err := s.removeUpload(ctx, session.ID, report); err != nil {
+			log.Printf("Failed to remove expired upload %s: %v", session.ID, err)
+			report.Failed++
+			continue
+		}
+		report.UploadsExpired++
+	}
+
+	return report, nil
+}
+
+// expireProject deletes a project's rendered media: final videos,
+// thumbnails and segments of every render. The project row, its script and
+// its product image stay.
+func (s *StorageService) expireProject(ctx context.Context, project *model.Project, report *SweepReport) error {
+	urls := []*string{project.VideoURL, project.ThumbnailURL}
+
+	renders, err := s.renderRepo.GetByProjectID(ctx, project.ID)
+	if err != nil {
+		return err
+	}
+	for _, render := range renders {
+		urls = append(urls, render.VideoURL, render.ThumbnailURL)
+
+		segments, err := s.renderRepo.GetSegments(ctx, render.ID)
+		if err != nil {
+			return err
+		}
+		for _, segment := range segments {
+			urls = append(urls, segment.VideoURL)
+		}
+	}
+
+	assets, _, err := s.assetRepo.List(ctx, project.UserID, model.AssetListFilter{ProjectID: project.ID}, 1000, 0)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, asset := range assets {
+		if asset.Purpose == model.AssetPurposeGeneratedVideo || asset.Purpose == model.AssetPurposeThumbnail {
+			if asset.StorageKey != nil {
+				keys = append(keys, *asset.StorageKey)
+			}
+		}
+	}
+	for _, url := range urls {
+		// Provider URLs are not ours to delete.
+		if url == nil {
+			continue
+		}
+		if key, ok := s.store.KeyFromURL(*url); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	if err := s.deleteObjects(ctx, keys, report); err != nil {
+		return err
+	}
+	if report.DryRun {
+		return nil
+	}
+	return s.projectRepo.SetExpired(ctx, project.ID)
+}
+
+func (s *StorageService) removeAsset(ctx context.Context, asset *model.Asset, report *SweepReport) error {
+	// A shared file goes with the last asset using it.
+	if asset.BlobSHA256 != nil {
+		blob, err := s.assetRepo.GetBlob(ctx, asset.UserID, *asset.BlobSHA256)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if !report.DryRun {
+			if err := s.assetRepo.Delete(ctx, asset.ID); err != nil {
+				return err
+			}
+		}
+		if blob == nil || blob.RefCount > 1 {
+			return nil
+		}
+		_, err = s.removeBlob(ctx, blob, report)
+		return err
+	}
+
+	variants, err := s.assetRepo.ListVariants(ctx, asset.ID)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	if asset.StorageKey != nil {
+		keys = append(keys, *asset.StorageKey)
+	}
+	for _, variant := range variants {
+		keys = append(keys, variant.StorageKey)
+	}
+
+	if err := s.deleteObjects(ctx, keys, report); err != nil {
+		return err
+	}
+	if report.DryRun {
+		return nil
+	}
+	return s.assetRepo.Delete(ctx, asset.ID)
+}
+
+func (s *StorageService) removeUpload(ctx context.Context, sessionID string, report *SweepReport) error {
+	chunks, err := s.uploadRepo.ListChunks(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		keys[i] = chunk.StorageKey
+	}
+
+	if err := s.deleteObjects(ctx, keys, report); err != nil {
+		return err
+	}
+	if report.DryRun {
+		return nil
+	}
+	return s.uploadRepo.Delete(ctx, sessionID)
+}
+
+// removeBlob deletes the objects of a blob no asset references any more.
+// It reports false when the blob gained a reference in the meantime.
+func (s *StorageService) removeBlob(ctx context.Context, blob *model.AssetBlob, report *SweepReport) (bool, error) {
+	if report.DryRun {
+		return true, s.deleteObjects(ctx, blobKeys(blob), report)
+	}
+	return s.assetRepo.DeleteBlob(ctx, blob.UserID, blob.SHA256, func(locked *model.AssetBlob) error {
+		return s.deleteObjects(ctx, blobKeys(locked), report)
+	})
+}
+
+// deleteObjects removes keys from the store, counting the bytes freed.
+// Objects that are already gone are skipped.
+func (s *StorageService) deleteObjects(ctx context.Context, keys []string, report *SweepReport) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		info, err := s.store.Stat(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !report.DryRun {
+			if err := s.store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+		}
+		report.ObjectsDeleted++
+		report.BytesReclaimed += info.Size
+	}
+	return nil
+}
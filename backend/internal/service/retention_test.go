@@ -0,0 +1,190 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestAssetService(t *testing.T, db *sqlx.DB, store storage.Storage, storageService *StorageService) *AssetService {
+	t.Helper()
+	return NewAssetService(
+		repository.NewAssetRepository(db),
+		repository.NewProjectRepository(db),
+		newTestProjectService(t, db, store),
+		storageService,
+		store,
+		&config.Config{JWT: testJWTConfig},
+	)
+}
+
+// fillStorage records an asset of size bytes for the user, without a
+// stored file, so the user's usage grows by size.
+func fillStorage(t *testing.T, assetRepo *repository.AssetRepository, userID string, size int64) {
+	t.Helper()
+	key := "uploads/" + userID + "/" + uuid.New().String()
+	asset := &model.Asset{
+		UserID:        userID,
+		Type:          model.AssetTypeVideo,
+		Purpose:       model.AssetPurposeOther,
+		Filename:      "filler.mp4",
+		URL:           key,
+		StorageKey:    &key,
+		FileSizeBytes: &size,
+	}
+	if err := assetRepo.Create(context.Background(), asset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckQuota(t *testing.T) {
+	db := openTestDB(t)
+	store := newTestStore(t)
+	assetRepo := repository.NewAssetRepository(db)
+	s := newTestStorageService(db, store)
+	ctx := context.Background()
+	profile := createTestProfile(t, db)
+
+	usage, err := s.Usage(ctx, profile.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.QuotaBytes == 0 {
+		t.Fatalf("tier %s has no quota", usage.Tier)
+	}
+	fillStorage(t, assetRepo, profile.ID, usage.QuotaBytes-usage.UsedBytes-100)
+
+	tests := []struct {
+		name    string
+		size    int64
+		wantErr error
+	}{
+		{"under the quota", 99, nil},
+		{"exactly at the quota", 100, nil},
+		{"one byte over", 101, ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		if err := s.CheckQuota(ctx, profile.ID, tt.size); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CheckQuota(%d) error = %v, want %v", tt.name, tt.size, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUploadReuseIgnoresQuota(t *testing.T) {
+	db := openTestDB(t)
+	store := newTestStore(t)
+	assetRepo := repository.NewAssetRepository(db)
+	storageService := newTestStorageService(db, store)
+	s := newTestAssetService(t, db, store, storageService)
+	ctx := context.Background()
+	profile := createTestProfile(t, db)
+
+	content := testPNG(t)
+	existing := createTestBlobAsset(t, assetRepo, store, profile.ID, string(content))
+
+	usage, err := storageService.Usage(ctx, profile.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillStorage(t, assetRepo, profile.ID, usage.QuotaBytes-usage.UsedBytes)
+
+	// Content stored before is shared, which takes no space.
+	req := &model.UploadAssetRequest{Purpose: model.AssetPurposeOther}
+	asset, err := s.Upload(ctx, profile.ID, bytes.NewReader(content), "again.png", req)
+	if err != nil {
+		t.Fatalf("Upload() of stored content at the quota error = %v", err)
+	}
+	if asset.ID == existing.ID || *asset.BlobSHA256 != *existing.BlobSHA256 {
+		t.Errorf("Upload() = asset %s of blob %s, want a new asset of blob %s", asset.ID, *asset.BlobSHA256, *existing.BlobSHA256)
+	}
+
+	// New content is checked against the quota.
+	other := append(testPNG(t), 0)
+	if _, err := s.Upload(ctx, profile.ID, bytes.NewReader(other), "new.png", req); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Upload() of new content at the quota error = %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestSweepRemovesOnlyExpiredUnreferenced(t *testing.T) {
+	db := openTestDB(t)
+	store := newTestStore(t)
+	assetRepo := repository.NewAssetRepository(db)
+	s := newTestStorageService(db, store)
+	ctx := context.Background()
+	profile := createTestProfile(t, db)
+
+	// A file still used by a recent upload.
+	kept := createTestBlobAsset(t, assetRepo, store, profile.ID, "kept")
+	// A file whose last asset was deleted without releasing it.
+	released := createTestBlobAsset(t, assetRepo, store, profile.ID, "released")
+	if err := assetRepo.Delete(ctx, released.ID); err != nil {
+		t.Fatal(err)
+	}
+	// An upload never used by a project and older than the free retention.
+	expired := createTestBlobAsset(t, assetRepo, store, profile.ID, "expired")
+	if _, err := db.Exec(`UPDATE assets SET created_at = NOW() - INTERVAL '31 days' WHERE id = $1`, expired.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	keysOf := func(asset *model.Asset) []string {
+		return blobKeys(&model.AssetBlob{StorageKey: *asset.StorageKey})
+	}
+	assertStored := func(t *testing.T, asset *model.Asset, want bool) {
+		t.Helper()
+		for _, key := range keysOf(asset) {
+			_, err := store.Stat(ctx, key)
+			if stored := err == nil; stored != want {
+				t.Errorf("%s stored = %v (%v), want %v", key, stored, err, want)
+			}
+		}
+	}
+
+	report, err := s.Sweep(ctx, 1000, true)
+	if err != nil {
+		t.Fatalf("Sweep() dry run error = %v", err)
+	}
+	if report.ObjectsDeleted < 2*len(keysOf(expired)) {
+		t.Errorf("dry run reported %d objects, want at least %d", report.ObjectsDeleted, 2*len(keysOf(expired)))
+	}
+	for _, asset := range []*model.Asset{kept, released, expired} {
+		assertStored(t, asset, true)
+	}
+
+	if _, err := s.Sweep(ctx, 1000, false); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	assertStored(t, kept, true)
+	assertStored(t, released, false)
+	assertStored(t, expired, false)
+
+	if _, err := assetRepo.GetByID(ctx, kept.ID); err != nil {
+		t.Errorf("GetByID() of the kept asset error = %v", err)
+	}
+	if _, err := assetRepo.GetByID(ctx, expired.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetByID() of the expired asset error = %v, want ErrNotFound", err)
+	}
+	for _, asset := range []*model.Asset{released, expired} {
+		if _, err := assetRepo.GetBlob(ctx, profile.ID, *asset.BlobSHA256); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("GetBlob(%s) after the sweep error = %v, want ErrNotFound", *asset.BlobSHA256, err)
+		}
+	}
+}
@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
-	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,6 +14,8 @@ import (
 	"github.com/genvid/backend/internal/config"
 	"github.com/genvid/backend/internal/model"
 	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/genvid/backend/internal/storyboard"
 	"github.com/genvid/backend/internal/video"
 	"github.com/genvid/backend/internal/zhipu"
 	"github.com/genvid/backend/pkg/auth"
@@ -21,25 +24,46 @@ import (
 
 var (
 	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrWrongPassword       = errors.New("current password is incorrect")
+	ErrInvalidRefreshToken = errors.New("invalid, expired or revoked refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
 	ErrEmailExists         = errors.New("email already registered")
 	ErrInsufficientCredits = errors.New("insufficient credits")
+	ErrInvalidMode         = errors.New("invalid generation mode")
+	ErrNoSlideshowImages   = errors.New("slideshow requires at least one product image")
+	ErrInvalidTransition   = errors.New("unsupported slideshow transition")
+	ErrMediaNotFound       = errors.New("referenced image or music track not found")
+	ErrAccountDisabled     = errors.New("account has been disabled")
 )
 
+// A session's last_used_at is updated by requests at most this often.
+const sessionTouchInterval = time.Minute
+
 type AuthService struct {
 	profileRepo *repository.ProfileRepository
+	sessionRepo *repository.SessionRepository
+	mfaRepo     *repository.MFARepository
 	jwtService  *auth.JWTService
+	guard       *LoginGuard
 	cfg         *config.Config
 }
 
-func NewAuthService(profileRepo *repository.ProfileRepository, jwtService *auth.JWTService, cfg *config.Config) *AuthService {
+func NewAuthService(profileRepo *repository.ProfileRepository, sessionRepo *repository.SessionRepository, mfaRepo *repository.MFARepository, jwtService *auth.JWTService, guard *LoginGuard, cfg *config.Config) *AuthService {
 	return &AuthService{
 		profileRepo: profileRepo,
+		sessionRepo: sessionRepo,
+		mfaRepo:     mfaRepo,
 		jwtService:  jwtService,
+		guard:       guard,
 		cfg:         cfg,
 	}
 }
 
-func (s *AuthService) Register(ctx context.Context, req *model.RegisterRequest) (*model.AuthResponse, error) {
+func (s *AuthService) Register(ctx context.Context, req *model.RegisterRequest, client model.ClientInfo) (*model.AuthResponse, error) {
+	if err := s.guard.CheckSignup(ctx, client, req.CaptchaToken); err != nil {
+		return nil, err
+	}
+
 	existing, _ := s.profileRepo.GetByEmail(ctx, req.Email)
 	if existing != nil {
 		return nil, ErrEmailExists
@@ -50,11 +74,10 @@ func (s *AuthService) Register(ctx context.Context, req *model.RegisterRequest)
 		return nil, err
 	}
 
-	_ = passwordHash
-
 	profile := &model.Profile{
-		ID:    uuid.New().String(),
-		Email: req.Email,
+		ID:           uuid.New().String(),
+		Email:        req.Email,
+		PasswordHash: &passwordHash,
 	}
 
 	if req.FullName != "" {
@@ -65,97 +88,247 @@ func (s *AuthService) Register(ctx context.Context, req *model.RegisterRequest)
 		return nil, err
 	}
 
-	accessToken, expiresIn, err := s.jwtService.GenerateAccessToken(
-		profile.ID,
-		profile.Email,
-		profile.SubscriptionTier,
-	)
-	if err != nil {
-		return nil, err
-	}
+	_ = s.profileRepo.UpdateLastLogin(ctx, profile.ID)
 
-	refreshToken, err := s.jwtService.GenerateRefreshToken(profile.ID)
-	if err != nil {
+	return s.issueTokens(ctx, profile, client)
+}
+
+// Login checks the email and password. Unknown emails and accounts without
+// a password spend the same bcrypt time as a wrong password. Accounts with
+// two-factor authentication get an *MFARequiredError instead of tokens.
+// Repeated failures are throttled by the LoginGuard.
+func (s *AuthService) Login(ctx context.Context, req *model.LoginRequest, client model.ClientInfo) (*model.AuthResponse, error) {
+	if err := s.guard.CheckLogin(ctx, req.Email, client, req.CaptchaToken); err != nil {
 		return nil, err
 	}
 
-	_ = s.profileRepo.UpdateLastLogin(ctx, profile.ID)
-
-	return &model.AuthResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-		User:         *profile,
-	}, nil
+	resp, err := s.login(ctx, req, client)
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		s.guard.LoginFailed(ctx, req.Email, client)
+	case err == nil:
+		s.guard.LoginSucceeded(ctx, req.Email)
+	}
+	return resp, err
 }
 
-func (s *AuthService) Login(ctx context.Context, req *model.LoginRequest) (*model.AuthResponse, error) {
+func (s *AuthService) login(ctx context.Context, req *model.LoginRequest, client model.ClientInfo) (*model.AuthResponse, error) {
 	profile, err := s.profileRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
+			_ = auth.RejectPassword(req.Password)
 			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
+	// Accounts without a password answer like a wrong one, so sign-in does
+	// not reveal them; their owners set one through the reset email.
+	if profile.PasswordHash == nil {
+		_ = auth.RejectPassword(req.Password)
+		return nil, ErrInvalidCredentials
+	}
+	if err := auth.CheckPassword(req.Password, *profile.PasswordHash); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.signIn(ctx, profile, client)
+}
+
+// signIn finishes a first factor: it issues tokens, or a challenge when the
+// account also needs a TOTP or recovery code.
+func (s *AuthService) signIn(ctx context.Context, profile *model.Profile, client model.ClientInfo) (*model.AuthResponse, error) {
+	if profile.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	enabled, err := s.mfaRepo.IsEnabled(ctx, profile.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		raw := randomToken()
+		challenge := &model.MFAChallenge{
+			UserID:    profile.ID,
+			TokenHash: hashToken(raw),
+			ExpiresAt: time.Now().Add(mfaChallengeTTL),
+		}
+		if err := s.mfaRepo.CreateChallenge(ctx, challenge); err != nil {
+			return nil, err
+		}
+		return nil, &MFARequiredError{Challenge: &model.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    raw,
+			ExpiresIn:   int64(mfaChallengeTTL.Seconds()),
+			Methods:     mfaMethods,
+		}}
+	}
+
 	if err := s.profileRepo.UpdateLastLogin(ctx, profile.ID); err != nil {
 		return nil, err
 	}
+	return s.issueTokens(ctx, profile, client)
+}
 
-	accessToken, expiresIn, err := s.jwtService.GenerateAccessToken(
-		profile.ID,
-		profile.Email,
-		profile.SubscriptionTier,
-	)
+// issueTokens starts a session on the client's device and signs its first
+// access and refresh tokens. Disabled accounts cannot sign in.
+func (s *AuthService) issueTokens(ctx context.Context, profile *model.Profile, client model.ClientInfo) (*model.AuthResponse, error) {
+	if profile.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	session := &model.AuthSession{
+		ID:        uuid.New().String(),
+		UserID:    profile.ID,
+		IPAddress: optionalString(client.IPAddress),
+		UserAgent: optionalString(client.UserAgent),
+	}
+	refreshToken, refreshClaims, err := s.jwtService.GenerateRefreshToken(profile.ID, session.ID)
 	if err != nil {
 		return nil, err
 	}
+	session.ExpiresAt = refreshClaims.ExpiresAt.Time
 
-	refreshToken, err := s.jwtService.GenerateRefreshToken(profile.ID)
-	if err != nil {
+	stored := storedRefreshToken(refreshToken, refreshClaims)
+	if err := s.sessionRepo.Create(ctx, session, stored); err != nil {
 		return nil, err
 	}
 
-	return &model.AuthResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-		User:         *profile,
-	}, nil
+	return s.authResponse(profile, session.ID, refreshToken)
 }
 
-func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*model.AuthResponse, error) {
-	accessToken, expiresIn, err := s.jwtService.RefreshAccessToken(refreshToken)
+// RefreshToken rotates a refresh token: the presented token is used up and
+// a new pair is returned. Presenting a used token again revokes the whole
+// session, since either it or its successor has leaked.
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, client model.ClientInfo) (*model.AuthResponse, error) {
+	claims, err := s.jwtService.ValidateRefreshToken(refreshToken)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidRefreshToken
 	}
 
-	claims, err := s.jwtService.ValidateToken(refreshToken)
+	next, nextClaims, err := s.jwtService.GenerateRefreshToken(claims.UserID, claims.SessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	profile, err := s.profileRepo.GetByID(ctx, claims.UserID)
+	session, err := s.sessionRepo.Rotate(ctx, hashToken(refreshToken), storedRefreshToken(next, nextClaims), client)
+	switch {
+	case errors.Is(err, repository.ErrTokenReused):
+		return nil, ErrRefreshTokenReused
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, ErrInvalidRefreshToken
+	case err != nil:
+		return nil, err
+	}
+
+	profile, err := s.profileRepo.GetByID(ctx, session.UserID)
 	if err != nil {
 		return nil, err
 	}
+	if profile.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	return s.authResponse(profile, session.ID, next)
+}
 
-	newRefreshToken, err := s.jwtService.GenerateRefreshToken(profile.ID)
+func (s *AuthService) authResponse(profile *model.Profile, sessionID, refreshToken string) (*model.AuthResponse, error) {
+	accessToken, expiresIn, err := s.jwtService.GenerateAccessToken(
+		profile.ID,
+		profile.Email,
+		profile.Role,
+		profile.SubscriptionTier,
+		sessionID,
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	return &model.AuthResponse{
 		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
+		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
 		ExpiresIn:    expiresIn,
 		User:         *profile,
 	}, nil
 }
 
+// Logout revokes the session of a refresh token. Unknown tokens are
+// ignored, so logging out twice succeeds.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	return s.sessionRepo.RevokeByToken(ctx, hashToken(refreshToken), model.SessionRevokedLogout)
+}
+
+// LogoutAll revokes every session of the user, including the current one.
+func (s *AuthService) LogoutAll(ctx context.Context, userID string) error {
+	_, err := s.sessionRepo.RevokeAll(ctx, userID, "", model.SessionRevokedLogoutAll)
+	return err
+}
+
+// SessionActive reports whether an access token's session is still signed
+// in, and records that it was seen, at most once a minute.
+func (s *AuthService) SessionActive(ctx context.Context, userID, sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	session, err := s.sessionRepo.GetActive(ctx, userID, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if time.Since(session.LastUsedAt) > sessionTouchInterval {
+		if err := s.sessionRepo.Touch(ctx, sessionID); err != nil {
+			log.Printf("Failed to record use of session %s: %v", sessionID, err)
+		}
+	}
+	return true, nil
+}
+
+// ListSessions returns the user's signed-in devices, marking the one of
+// the current request.
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentID string) ([]model.DeviceSession, error) {
+	sessions, err := s.sessionRepo.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]model.DeviceSession, len(sessions))
+	for i, session := range sessions {
+		devices[i] = model.DeviceSession{AuthSession: session, Current: session.ID == currentID}
+	}
+	return devices, nil
+}
+
+// RevokeSession signs out one of the user's devices. Its access tokens stop
+// working at once and its refresh token can no longer be used.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return repository.ErrNotFound
+	}
+	return s.sessionRepo.Revoke(ctx, userID, sessionID, model.SessionRevokedByUser)
+}
+
+// PruneSessions deletes sessions that ended more than a month ago.
+func (s *AuthService) PruneSessions(ctx context.Context) (int64, error) {
+	return s.sessionRepo.DeleteEnded(ctx, time.Now().AddDate(0, -1, 0))
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func storedRefreshToken(token string, claims *auth.Claims) *model.RefreshToken {
+	return &model.RefreshToken{
+		ID:        claims.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+}
+
 func (s *AuthService) GetProfile(ctx context.Context, userID string) (*model.Profile, error) {
 	return s.profileRepo.GetByID(ctx, userID)
 }
@@ -183,8 +356,40 @@ func (s *AuthService) UpdateProfile(ctx context.Context, userID string, updates
 	return profile, nil
 }
 
+// ChangePassword sets the user's password and signs out every other
+// session. Accounts from before passwords were stored set their first one
+// without a current password.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, sessionID string, req *model.ChangePasswordRequest) error {
+	profile, err := s.profileRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if profile.PasswordHash != nil {
+		if err := auth.CheckPassword(req.CurrentPassword, *profile.PasswordHash); err != nil {
+			return ErrWrongPassword
+		}
+	}
+
+	passwordHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.profileRepo.SetPassword(ctx, userID, passwordHash); err != nil {
+		return err
+	}
+
+	_, err = s.sessionRepo.RevokeAll(ctx, userID, sessionID, model.SessionRevokedPasswordChange)
+	return err
+}
+
 func (s *AuthService) ValidateAccessToken(token string) (*auth.Claims, error) {
-	return s.jwtService.ValidateToken(token)
+	return s.jwtService.ValidateAccessToken(token)
+}
+
+// JWKS returns the public keys other services verify access tokens with.
+func (s *AuthService) JWKS() *auth.JWKS {
+	return s.jwtService.JWKS()
 }
 
 func (s *AuthService) CheckCredits(ctx context.Context, userID string) (bool, error) {
@@ -204,21 +409,45 @@ func (s *AuthService) RefundCredit(ctx context.Context, userID string) error {
 	return s.profileRepo.IncrementCredits(ctx, userID, 1)
 }
 
+func (s *AuthService) UseCredits(ctx context.Context, userID string, amount int) error {
+	err := s.profileRepo.DecrementCreditsBy(ctx, userID, amount)
+	if errors.Is(err, repository.ErrNoCredits) {
+		return ErrInsufficientCredits
+	}
+	return err
+}
+
+func (s *AuthService) RefundCredits(ctx context.Context, userID string, amount int) error {
+	return s.profileRepo.IncrementCredits(ctx, userID, amount)
+}
+
 type ProjectService struct {
-	projectRepo *repository.ProjectRepository
-	profileRepo *repository.ProfileRepository
-	authService *AuthService
-	zhipuClient *zhipu.Client
-	cfg         *config.Config
+	projectRepo    *repository.ProjectRepository
+	profileRepo    *repository.ProfileRepository
+	renderRepo     *repository.RenderRepository
+	storyboardRepo *repository.StoryboardRepository
+	promptRepo     *repository.PromptRepository
+	avatarRepo     *repository.AvatarRepository
+	assetRepo      *repository.AssetRepository
+	store          storage.Storage
+	authService    *AuthService
+	zhipuClient    *zhipu.Client
+	cfg            *config.Config
 }
 
-func NewProjectService(projectRepo *repository.ProjectRepository, profileRepo *repository.ProfileRepository, authService *AuthService, zhipuClient *zhipu.Client, cfg *config.Config) *ProjectService {
+func NewProjectService(projectRepo *repository.ProjectRepository, profileRepo *repository.ProfileRepository, renderRepo *repository.RenderRepository, storyboardRepo *repository.StoryboardRepository, promptRepo *repository.PromptRepository, avatarRepo *repository.AvatarRepository, assetRepo *repository.AssetRepository, store storage.Storage, authService *AuthService, zhipuClient *zhipu.Client, cfg *config.Config) *ProjectService {
 	return &ProjectService{
-		projectRepo: projectRepo,
-		profileRepo: profileRepo,
-		authService: authService,
-		zhipuClient: zhipuClient,
-		cfg:         cfg,
+		projectRepo:    projectRepo,
+		profileRepo:    profileRepo,
+		renderRepo:     renderRepo,
+		storyboardRepo: storyboardRepo,
+		promptRepo:     promptRepo,
+		avatarRepo:     avatarRepo,
+		assetRepo:      assetRepo,
+		store:          store,
+		authService:    authService,
+		zhipuClient:    zhipuClient,
+		cfg:            cfg,
 	}
 }
 
@@ -228,16 +457,92 @@ func (s *ProjectService) Create(ctx context.Context, userID string, req *model.C
 		ProductName:        &req.ProductName,
 		ProductDescription: req.ProductDescription,
 		ProductURL:         req.ProductURL,
-		ProductImageURL:    req.ProductImageURL,
+	}
+
+	image, err := s.productImageAsset(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if image != nil {
+		project.ProductImageID = &image.ID
+		project.ProductImageURL = &image.URL
+	} else if req.ProductImageURL != nil && *req.ProductImageURL != "" {
+		// Uploads from before the assets API are referenced by URL only.
+		if _, err := s.uploadKey(ctx, userID, *req.ProductImageURL); err != nil {
+			return nil, err
+		}
+		project.ProductImageURL = s.canonicalURL(req.ProductImageURL)
 	}
 
 	if err := s.projectRepo.Create(ctx, project); err != nil {
 		return nil, err
 	}
 
+	if image != nil && image.ProjectID == nil {
+		if err := s.assetRepo.AttachToProject(ctx, image.ID, project.ID); err == nil {
+			image.ProjectID = &project.ID
+			_ = s.assetRepo.SetPrimary(ctx, image)
+		}
+	} else if image != nil && *image.ProjectID != project.ID && image.BlobSHA256 != nil {
+		// An image from another project gets its own asset sharing the
+		// stored file, so deleting either project leaves the other's intact.
+		shared, err := shareAsset(ctx, s.assetRepo, s.store, image, model.AssetPurposeProductImage, &project.ID, image.AltText)
+		if err != nil {
+			log.Printf("Failed to share product image %s with project %s: %v", image.ID, project.ID, err)
+		} else if err := s.assetRepo.SetPrimary(ctx, shared); err == nil {
+			_ = s.projectRepo.SetProductImage(ctx, project.ID, &shared.ID, &shared.URL)
+			project.ProductImageID = &shared.ID
+		}
+	}
+
 	return project, nil
 }
 
+// productImageAsset resolves the request's product image to one of the
+// user's image assets. URLs of uploads are accepted in place of an ID.
+func (s *ProjectService) productImageAsset(ctx context.Context, userID string, req *model.CreateProjectRequest) (*model.Asset, error) {
+	var asset *model.Asset
+	switch {
+	case req.ProductImageID != nil && *req.ProductImageID != "":
+		if _, err := uuid.Parse(*req.ProductImageID); err != nil {
+			return nil, ErrAssetNotFound
+		}
+		a, err := s.assetRepo.GetByID(ctx, *req.ProductImageID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrAssetNotFound
+			}
+			return nil, err
+		}
+		asset = a
+
+	case req.ProductImageURL != nil && *req.ProductImageURL != "":
+		key, err := s.uploadKey(ctx, userID, *req.ProductImageURL)
+		if err != nil {
+			return nil, err
+		}
+		a, err := s.assetRepo.GetByStorageKey(ctx, userID, key)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		asset = a
+
+	default:
+		return nil, nil
+	}
+
+	if asset.UserID != userID {
+		return nil, ErrAssetNotFound
+	}
+	if asset.Type != model.AssetTypeImage {
+		return nil, fmt.Errorf("%w: product image must be an image", ErrInvalidAsset)
+	}
+	return asset, nil
+}
+
 func (s *ProjectService) GetByID(ctx context.Context, id, userID string) (*model.Project, error) {
 	project, err := s.projectRepo.GetByID(ctx, id)
 	if err != nil {
@@ -256,17 +561,54 @@ func (s *ProjectService) ListByUser(ctx context.Context, userID string, page, li
 	return s.projectRepo.GetByUserID(ctx, userID, limit, offset)
 }
 
+// Delete removes the project with its assets. Uploaded files still used by
+// the user's other assets are kept.
 func (s *ProjectService) Delete(ctx context.Context, id, userID string) error {
-	return s.projectRepo.Delete(ctx, id, userID)
+	assets, _, err := s.assetRepo.List(ctx, userID, model.AssetListFilter{ProjectID: id}, 1000, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := s.projectRepo.Delete(ctx, id, userID); err != nil {
+		return err
+	}
+
+	for _, asset := range assets {
+		if asset.BlobSHA256 == nil {
+			continue
+		}
+		if err := releaseBlob(ctx, s.assetRepo, s.store, userID, *asset.BlobSHA256); err != nil {
+			log.Printf("Failed to release stored file %s: %v", *asset.BlobSHA256, err)
+		}
+	}
+	return nil
 }
 
-func (s *ProjectService) GenerateVideo(ctx context.Context, projectID, userID string, req *model.GenerateVideoRequest) (*model.Project, error) {
-	hasCredits, err := s.authService.CheckCredits(ctx, userID)
-	if err != nil {
+func (s *ProjectService) ListRenders(ctx context.Context, projectID, userID string) ([]model.Render, error) {
+	if _, err := s.GetByID(ctx, projectID, userID); err != nil {
 		return nil, err
 	}
-	if !hasCredits {
-		return nil, ErrInsufficientCredits
+	return s.renderRepo.GetByProjectID(ctx, projectID)
+}
+
+func (s *ProjectService) GenerateVideo(ctx context.Context, projectID, userID string, req *model.GenerateVideoRequest) (*model.Project, error) {
+	mode := model.GenerationMode(req.Mode)
+	if mode == "" {
+		mode = model.GenerationModeAI
+	}
+	if mode != model.GenerationModeAI && mode != model.GenerationModeSlideshow {
+		return nil, ErrInvalidMode
+	}
+
+	// Slideshows are rendered locally and cost no credits.
+	if mode == model.GenerationModeAI {
+		hasCredits, err := s.authService.CheckCredits(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !hasCredits {
+			return nil, ErrInsufficientCredits
+		}
 	}
 
 	project, err := s.projectRepo.GetByID(ctx, projectID)
@@ -278,9 +620,12 @@ func (s *ProjectService) GenerateVideo(ctx context.Context, projectID, userID st
 		return nil, repository.ErrUnauthorized
 	}
 
-	if err := s.authService.UseCredit(ctx, userID); err != nil {
-		return nil, err
+	var previousScript string
+	if project.Script != nil {
+		previousScript = *project.Script
 	}
+	previousLanguage := project.Language
+	previousDuration := project.VideoDuration
 
 	project.Script = &req.Script
 	project.Language = req.Language
@@ -293,8 +638,69 @@ func (s *ProjectService) GenerateVideo(ctx context.Context, projectID, userID st
 		project.VideoDuration = 5
 	}
 
+	if req.AvatarID != nil {
+		if _, err := s.avatarRepo.GetByID(ctx, *req.AvatarID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrInvalidAvatar
+			}
+			return nil, err
+		}
+		project.AvatarID = req.AvatarID
+	}
+	if req.StylePreset != "" {
+		if _, err := s.promptRepo.GetPreset(ctx, req.StylePreset); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrInvalidPreset
+			}
+			return nil, err
+		}
+		project.StylePreset = &req.StylePreset
+	}
+
+	var slideshow video.SlideshowSpec
+	var scenes []model.StoryboardScene
+	if mode == model.GenerationModeSlideshow {
+		slideshow, err = s.buildSlideshowSpec(ctx, project, req.Slideshow)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		scenes, err = s.prepareStoryboard(ctx, project, previousScript, previousLanguage, previousDuration, req.VideoDuration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	render := &model.Render{
+		ProjectID:       project.ID,
+		UserID:          userID,
+		Mode:            mode,
+		Format:          project.Format,
+		DurationSeconds: project.VideoDuration,
+	}
+	if req.Slideshow != nil {
+		render.Options, _ = json.Marshal(req.Slideshow)
+	}
+
+	if mode == model.GenerationModeAI {
+		if err := s.authService.UseCredit(ctx, userID); err != nil {
+			return nil, err
+		}
+		render.CreditsCharged = 1
+	}
+
+	if err := s.renderRepo.Create(ctx, render); err != nil {
+		s.refundRender(ctx, render)
+		return nil, err
+	}
+
+	if err := s.projectRepo.UpdateGenerationSettings(ctx, project); err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return nil, err
+	}
+
 	if err := s.projectRepo.UpdateStatus(ctx, projectID, model.ProjectStatusQueued, 0); err != nil {
-		_ = s.authService.RefundCredit(ctx, userID)
+		s.handleVideoFailure(ctx, project, render, err.Error())
 		return nil, err
 	}
 
@@ -302,73 +708,65 @@ func (s *ProjectService) GenerateVideo(ctx context.Context, projectID, userID st
 
 	go func() {
 		bgCtx := context.Background()
-		s.processVideoGeneration(bgCtx, project)
+		if mode == model.GenerationModeSlideshow {
+			s.processSlideshow(bgCtx, project, render, slideshow)
+			return
+		}
+		s.processVideoGeneration(bgCtx, project, render, scenes)
 	}()
 
 	return project, nil
 }
 
-func (s *ProjectService) processVideoGeneration(ctx context.Context, project *model.Project) {
+// processVideoGeneration renders one provider segment per storyboard scene.
+func (s *ProjectService) processVideoGeneration(ctx context.Context, project *model.Project, render *model.Render, scenes []model.StoryboardScene) {
 	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 5)
+	_ = s.renderRepo.UpdateStatus(ctx, render.ID, model.ProjectStatusProcessing)
 
-	duration := project.VideoDuration
-	if duration == 0 {
-		duration = 5
-	}
-
-	segments := 1
-	if duration > 10 {
-		segments = (duration + 9) / 10
-	}
-
-	prompt := ""
-	if project.ProductName != nil {
-		prompt = "Product: " + *project.ProductName + "\n\n"
-	}
-	if project.Script != nil {
-		prompt += *project.Script
-	}
-
+	segments := len(scenes)
 	size := s.getVideoSize(string(project.Format))
 
 	var imageURL string
 	if project.ProductImageURL != nil && *project.ProductImageURL != "" {
-		imageData, err := s.loadImageAsBase64(*project.ProductImageURL)
+		imageData, err := s.productImageData(ctx, project)
 		if err == nil {
 			imageURL = imageData
+		} else {
+			log.Printf("Failed to load product image for project %s: %v", project.ID, err)
 		}
 	}
 
-	var videoURLs []string
-	var lastThumbnailURL string
+	compiler := s.newPromptCompiler(ctx, project, imageURL != "")
+
+	// Provider links expire, so every segment is copied into our storage as
+	// soon as it finishes. The local copies feed the merge.
+	var segmentPaths []string
+	var segmentObjs []*storage.Stored
+	var thumbnail *storage.Stored
+	defer func() {
+		for _, path := range segmentPaths {
+			os.Remove(path)
+		}
+	}()
 
-	for i := 0; i < segments; i++ {
+	for i, scene := range scenes {
 		progress := 10 + (i * 60 / segments)
 		_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, progress)
 
-		segmentPrompt := prompt
-		if segments > 1 {
-			segmentPrompts := video.SplitScript(prompt, segments)
-			if i < len(segmentPrompts) {
-				segmentPrompt = segmentPrompts[i]
-			}
-		}
+		compiled, templateID := compiler.Compile(ctx, scene.Role, scene.VisualPrompt)
 
 		req := zhipu.VideoGenerationRequest{
-			Model:   s.cfg.External.Zhipu.Model,
-			Prompt:  segmentPrompt,
-			Quality: "speed",
-			Size:    size,
-		}
-
-		if imageURL != "" {
-			req.ImageURL = imageURL
-			req.Prompt = "Strictly preserve the exact appearance of the product in the image: maintain identical shape, size, colors, textures, materials, branding, logos, labels, and all visual details. Do not modify, distort, or alter the product in any way. Only animate the scene around the product. " + segmentPrompt
+			Model:    s.cfg.External.Zhipu.Model,
+			Prompt:   compiled,
+			ImageURL: imageURL,
+			Quality:  "speed",
+			Size:     size,
+			Duration: scene.DurationSeconds,
 		}
 
 		resp, err := s.zhipuClient.GenerateVideo(req)
 		if err != nil {
-			s.handleVideoFailure(ctx, project, fmt.Sprintf("Segment %d failed: %s", i+1, err.Error()))
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Segment %d failed: %s", i+1, err.Error()))
 			return
 		}
 
@@ -377,87 +775,230 @@ func (s *ProjectService) processVideoGeneration(ctx context.Context, project *mo
 
 		result, err := s.zhipuClient.WaitForCompletion(resp.ID, 10*time.Minute)
 		if err != nil {
-			s.handleVideoFailure(ctx, project, fmt.Sprintf("Segment %d completion failed: %s", i+1, err.Error()))
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Segment %d completion failed: %s", i+1, err.Error()))
+			return
+		}
+
+		if result.VideoResult == nil || result.VideoResult.URL == "" {
+			continue
+		}
+
+		key := renderSegmentKey(render.ID, i)
+		if segments == 1 {
+			key = renderVideoKey(render.ID)
+		}
+		segmentPath := filepath.Join(tempDir, fmt.Sprintf("%s_segment_%d.mp4", render.ID, i))
+		if err := downloadVerified(ctx, result.VideoResult.URL, segmentPath); err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Segment %d download failed: %s", i+1, err.Error()))
+			return
+		}
+		segmentPaths = append(segmentPaths, segmentPath)
+
+		segmentObj, err := storage.PutFile(ctx, s.store, key, segmentPath, "video/mp4")
+		if err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Segment %d storage failed: %s", i+1, err.Error()))
 			return
 		}
+		segmentObjs = append(segmentObjs, segmentObj)
 
-		if result.VideoResult != nil && result.VideoResult.URL != "" {
-			videoURLs = append(videoURLs, result.VideoResult.URL)
-			if i == 0 && result.VideoResult.CoverURL != "" {
-				lastThumbnailURL = result.VideoResult.CoverURL
+		if thumbnail == nil && result.VideoResult.CoverURL != "" {
+			thumbnail, err = s.mirrorRemote(ctx, result.VideoResult.CoverURL, renderThumbnailKey(render.ID), "image/jpeg")
+			if err != nil {
+				log.Printf("Failed to mirror cover for render %s: %v", render.ID, err)
 			}
 		}
+
+		segment := &model.RenderSegment{
+			RenderID:         render.ID,
+			SceneID:          &scenes[i].ID,
+			StylePreset:      compiler.slug,
+			PromptTemplateID: templateID,
+			Position:         i,
+			Prompt:           &req.Prompt,
+			ExternalTaskID:   &resp.ID,
+			VideoURL:         &segmentObj.URL,
+			DurationSeconds:  &result.VideoResult.Duration,
+		}
+		_ = s.renderRepo.AddSegment(ctx, segment)
 	}
 
 	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 90)
 
-	var finalVideoURL string
-	if len(videoURLs) == 0 {
-		s.handleVideoFailure(ctx, project, "No videos generated")
+	var finalVideo *storage.Stored
+	if len(segmentObjs) == 0 {
+		s.handleVideoFailure(ctx, project, render, "No videos generated")
 		return
-	} else if len(videoURLs) == 1 {
-		finalVideoURL = videoURLs[0]
+	} else if len(segmentObjs) == 1 {
+		finalVideo = segmentObjs[0]
 	} else {
-		mergedPath, err := s.mergeVideos(videoURLs, project.ID)
+		merged, err := s.mergeVideos(ctx, segmentPaths, render.ID)
 		if err != nil {
-			finalVideoURL = videoURLs[0]
+			finalVideo = segmentObjs[0]
 		} else {
-			finalVideoURL = mergedPath
+			finalVideo = merged
 		}
 	}
 
-	if err := s.projectRepo.SetCompleted(ctx, project.ID, finalVideoURL, lastThumbnailURL); err != nil {
-		_ = s.projectRepo.SetFailed(ctx, project.ID, err.Error())
-		_ = s.authService.RefundCredit(ctx, project.UserID)
-	}
+	s.completeRender(ctx, project, render, finalVideo, thumbnail)
 }
 
-func (s *ProjectService) mergeVideos(videoURLs []string, projectID string) (string, error) {
+func (s *ProjectService) processSlideshow(ctx context.Context, project *model.Project, render *model.Render, spec video.SlideshowSpec) {
+	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 10)
+	_ = s.renderRepo.UpdateStatus(ctx, render.ID, model.ProjectStatusProcessing)
+
 	if err := video.CheckFFmpeg(); err != nil {
-		return "", err
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return
+	}
+
+	// The spec carries upload URLs; fetch them for ffmpeg.
+	images := make([]string, len(spec.Images))
+	defer func() {
+		for _, path := range images {
+			if path != "" {
+				os.Remove(path)
+			}
+		}
+	}()
+	for i, url := range spec.Images {
+		path, err := s.fetchUpload(ctx, project.UserID, url, fmt.Sprintf("%s_image_%d", render.ID, i))
+		if err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Image %d unavailable: %s", i+1, err.Error()))
+			return
+		}
+		images[i] = path
 	}
+	spec.Images = images
 
-	merger := video.NewMerger("./temp_videos")
-	outputPath := merger.GetOutputPath(projectID)
+	renderer := video.NewSlideshowRenderer(tempDir)
+	outputPath, err := renderer.Render(spec, renderer.GetOutputPath(render.ID))
+	if err != nil {
+		s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Slideshow render failed: %s", err.Error()))
+		return
+	}
+
+	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 90)
 
-	finalPath, err := merger.MergeVideos(videoURLs, outputPath)
+	videoObj, thumbnail, err := s.publishRender(ctx, render, outputPath)
 	if err != nil {
-		return "", err
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return
+	}
+
+	segment := &model.RenderSegment{
+		RenderID:        render.ID,
+		Position:        0,
+		VideoURL:        &videoObj.URL,
+		DurationSeconds: &spec.Duration,
 	}
+	_ = s.renderRepo.AddSegment(ctx, segment)
 
-	return "/temp_videos/" + filepath.Base(finalPath), nil
+	s.completeRender(ctx, project, render, videoObj, thumbnail)
 }
 
-func (s *ProjectService) loadImageAsBase64(imagePath string) (string, error) {
-	if strings.HasPrefix(imagePath, "data:image") {
-		return imagePath, nil
+// buildSlideshowSpec resolves the slideshow inputs up front so that bad
+// image or music references fail the request instead of the background job.
+func (s *ProjectService) buildSlideshowSpec(ctx context.Context, project *model.Project, opts *model.SlideshowOptions) (video.SlideshowSpec, error) {
+	if opts == nil {
+		opts = &model.SlideshowOptions{}
 	}
 
-	filePath := strings.TrimPrefix(imagePath, "/uploads/")
-	filePath = filepath.Join("uploads", filePath)
+	imageURLs := opts.ImageURLs
+	if len(imageURLs) == 0 && project.ProductImageURL != nil && *project.ProductImageURL != "" {
+		imageURLs = []string{*project.ProductImageURL}
+	}
+	if len(imageURLs) == 0 {
+		return video.SlideshowSpec{}, ErrNoSlideshowImages
+	}
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", err
+	if !video.IsValidTransition(opts.Transition) {
+		return video.SlideshowSpec{}, ErrInvalidTransition
 	}
 
-	ext := strings.ToLower(filepath.Ext(filePath))
-	mimeType := "image/jpeg"
-	switch ext {
-	case ".png":
-		mimeType = "image/png"
-	case ".gif":
-		mimeType = "image/gif"
-	case ".webp":
-		mimeType = "image/webp"
+	images := make([]string, 0, len(imageURLs))
+	for _, u := range imageURLs {
+		key, err := s.uploadKey(ctx, project.UserID, u)
+		if err != nil {
+			return video.SlideshowSpec{}, err
+		}
+		images = append(images, s.store.URL(key))
+	}
+
+	captions := opts.Captions
+	if len(captions) == 0 && project.Script != nil && strings.TrimSpace(*project.Script) != "" {
+		captions = storyboard.Group(*project.Script, project.Language, len(images))
+	}
+
+	var musicPath string
+	if opts.MusicTrack != "" {
+		musicPath = filepath.Join(s.cfg.Media.MusicDir, filepath.Base(opts.MusicTrack))
+		if _, err := os.Stat(musicPath); err != nil {
+			return video.SlideshowSpec{}, ErrMediaNotFound
+		}
 	}
 
-	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+	width, height := s.getVideoDimensions(string(project.Format))
+
+	return video.SlideshowSpec{
+		Images:     images,
+		Captions:   captions,
+		MusicPath:  musicPath,
+		FontFile:   s.cfg.Media.FontFile,
+		Width:      width,
+		Height:     height,
+		Duration:   float64(project.VideoDuration),
+		Transition: opts.Transition,
+	}, nil
 }
 
-func (s *ProjectService) handleVideoFailure(ctx context.Context, project *model.Project, errMsg string) {
+// completeRender points the project and render at stored media and records
+// it as assets. A nil thumbnail keeps the project's current one.
+func (s *ProjectService) completeRender(ctx context.Context, project *model.Project, render *model.Render, videoObj, thumbnail *storage.Stored) {
+	var thumbnailURL string
+	if thumbnail != nil {
+		thumbnailURL = thumbnail.URL
+	} else if project.ThumbnailURL != nil {
+		thumbnailURL = *project.ThumbnailURL
+	}
+
+	if err := s.projectRepo.SetCompleted(ctx, project.ID, videoObj.URL, thumbnailURL); err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return
+	}
+	_ = s.renderRepo.SetCompleted(ctx, render.ID, videoObj.URL, thumbnailURL)
+
+	// Retention starts with each new video.
+	if profile, err := s.profileRepo.GetByID(ctx, project.UserID); err == nil {
+		_ = s.projectRepo.SetExpiry(ctx, project.ID, policyFor(profile.SubscriptionTier).expiry(time.Now()))
+	}
+
+	s.recordRenderAssets(ctx, project, render, videoObj, thumbnail)
+}
+
+func (s *ProjectService) mergeVideos(ctx context.Context, videoPaths []string, renderID string) (*storage.Stored, error) {
+	if err := video.CheckFFmpeg(); err != nil {
+		return nil, err
+	}
+
+	merger := s.newMerger()
+	finalPath, err := merger.MergeVideos(videoPaths, merger.GetOutputPath(renderID))
+	if err != nil {
+		return nil, err
+	}
+
+	return merger.Publish(ctx, finalPath, renderVideoKey(renderID), "video/mp4")
+}
+
+func (s *ProjectService) handleVideoFailure(ctx context.Context, project *model.Project, render *model.Render, errMsg string) {
 	_ = s.projectRepo.SetFailed(ctx, project.ID, errMsg)
-	_ = s.authService.RefundCredit(ctx, project.UserID)
+	_ = s.renderRepo.SetFailed(ctx, render.ID, errMsg)
+	s.refundRender(ctx, render)
+}
+
+func (s *ProjectService) refundRender(ctx context.Context, render *model.Render) {
+	if render.CreditsCharged > 0 {
+		_ = s.authService.RefundCredits(ctx, render.UserID, render.CreditsCharged)
+	}
 }
 
 func (s *ProjectService) getVideoSize(format string) string {
@@ -472,3 +1013,9 @@ func (s *ProjectService) getVideoSize(format string) string {
 	}
 	return "1080x1920"
 }
+
+func (s *ProjectService) getVideoDimensions(format string) (int, int) {
+	var width, height int
+	fmt.Sscanf(s.getVideoSize(format), "%dx%d", &width, &height)
+	return width, height
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/genvid/backend/internal/model"
+)
+
+// Records keep stable storage URLs, which the API does not serve. Responses
+// swap them for short-lived signed URLs issued to the owner.
+
+var unsafeFilenameChars = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// SignURL returns a time-limited URL for a stored object, or url unchanged
+// when it does not point into our storage. A non-empty filename makes the
+// URL download as an attachment.
+func (s *ProjectService) SignURL(ctx context.Context, url, filename string) string {
+	key, ok := s.storedKey(url)
+	if !ok {
+		return url
+	}
+	signed, err := s.store.Presign(ctx, key, s.cfg.Storage.URLExpiry, filename)
+	if err != nil {
+		return url
+	}
+	return signed
+}
+
+func (s *ProjectService) signURLPtr(ctx context.Context, url *string) *string {
+	if url == nil || *url == "" {
+		return url
+	}
+	signed := s.SignURL(ctx, *url, "")
+	return &signed
+}
+
+// SignProject returns a copy of project with signed media URLs.
+func (s *ProjectService) SignProject(ctx context.Context, project *model.Project) *model.Project {
+	signed := *project
+	signed.ProductImageURL = s.signURLPtr(ctx, project.ProductImageURL)
+	signed.VideoURL = s.signURLPtr(ctx, project.VideoURL)
+	signed.ThumbnailURL = s.signURLPtr(ctx, project.ThumbnailURL)
+	return &signed
+}
+
+func (s *ProjectService) SignProjects(ctx context.Context, projects []model.Project) []model.Project {
+	signed := make([]model.Project, len(projects))
+	for i := range projects {
+		signed[i] = *s.SignProject(ctx, &projects[i])
+	}
+	return signed
+}
+
+// SignRender returns a copy of render with signed media URLs.
+func (s *ProjectService) SignRender(ctx context.Context, render *model.Render) *model.Render {
+	signed := *render
+	signed.VideoURL = s.signURLPtr(ctx, render.VideoURL)
+	signed.ThumbnailURL = s.signURLPtr(ctx, render.ThumbnailURL)
+	return &signed
+}
+
+func (s *ProjectService) SignRenders(ctx context.Context, renders []model.Render) []model.Render {
+	signed := make([]model.Render, len(renders))
+	for i := range renders {
+		signed[i] = *s.SignRender(ctx, &renders[i])
+	}
+	return signed
+}
+
+// SignTimeline returns a copy of timeline with signed intro and outro URLs.
+func (s *ProjectService) SignTimeline(ctx context.Context, timeline *model.Timeline) *model.Timeline {
+	signed := *timeline
+	signed.Clips = make([]model.TimelineClip, len(timeline.Clips))
+	for i, clip := range timeline.Clips {
+		clip.AssetURL = s.signURLPtr(ctx, clip.AssetURL)
+		signed.Clips[i] = clip
+	}
+	return &signed
+}
+
+// DownloadURL returns a signed URL that downloads the project's video as an
+// attachment named after the product.
+func (s *ProjectService) DownloadURL(ctx context.Context, projectID, userID string) (string, error) {
+	project, err := s.GetByID(ctx, projectID, userID)
+	if err != nil {
+		return "", err
+	}
+	if project.VideoURL == nil || *project.VideoURL == "" {
+		return "", ErrRenderNotReady
+	}
+
+	name := "video"
+	if project.ProductName != nil {
+		if cleaned := strings.Trim(unsafeFilenameChars.ReplaceAllString(*project.ProductName, "-"), "-."); cleaned != "" {
+			name = cleaned
+		}
+	}
+
+	ext := path.Ext(*project.VideoURL)
+	if i := strings.IndexByte(ext, '?'); i >= 0 {
+		ext = ext[:i]
+	}
+	if ext == "" {
+		ext = ".mp4"
+	}
+
+	return s.SignURL(ctx, *project.VideoURL, name+ext), nil
+}
+
+// canonicalURL strips signatures from a URL a client sent back, so records
+// keep the stable URL of the object.
+func (s *ProjectService) canonicalURL(url *string) *string {
+	if url == nil {
+		return nil
+	}
+	key, ok := s.storedKey(*url)
+	if !ok {
+		return url
+	}
+	stable := s.store.URL(key)
+	return &stable
+}
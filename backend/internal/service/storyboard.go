@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storyboard"
+)
+
+var (
+	ErrSceneNotFound = errors.New("scene not found")
+	ErrInvalidScene  = errors.New("invalid scene")
+	ErrEmptyScript   = errors.New("script is empty")
+)
+
+// BuildStoryboard parses the script into scenes and replaces the project's
+// current storyboard. Any visual prompt edits on the old scenes are lost.
+func (s *ProjectService) BuildStoryboard(ctx context.Context, projectID, userID string, req *model.BuildStoryboardRequest) ([]model.StoryboardScene, error) {
+	project, err := s.GetByID(ctx, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Script != "" {
+		project.Script = &req.Script
+	}
+	if req.Language != "" {
+		project.Language = req.Language
+	}
+	if project.Language == "" {
+		project.Language = "zh"
+	}
+	if project.Script == nil || strings.TrimSpace(*project.Script) == "" {
+		return nil, ErrEmptyScript
+	}
+
+	scenes, err := s.rebuildStoryboard(ctx, project, req.VideoDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.projectRepo.UpdateGenerationSettings(ctx, project); err != nil {
+		return nil, err
+	}
+
+	return scenes, nil
+}
+
+func (s *ProjectService) GetStoryboard(ctx context.Context, projectID, userID string) ([]model.StoryboardScene, error) {
+	if _, err := s.GetByID(ctx, projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.storyboardRepo.GetByProjectID(ctx, projectID)
+}
+
+// UpdateScene edits one scene before generation. The project's duration
+// follows the sum of its scene durations.
+func (s *ProjectService) UpdateScene(ctx context.Context, projectID, userID, sceneID string, req *model.UpdateSceneRequest) (*model.StoryboardScene, error) {
+	project, err := s.GetByID(ctx, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	scene, err := s.storyboardRepo.GetScene(ctx, sceneID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSceneNotFound
+		}
+		return nil, err
+	}
+	if scene.ProjectID != project.ID {
+		return nil, ErrSceneNotFound
+	}
+
+	if req.Role != nil {
+		switch storyboard.SceneRole(*req.Role) {
+		case storyboard.RoleHook, storyboard.RoleProblem, storyboard.RoleDemo, storyboard.RoleCTA:
+			scene.Role = *req.Role
+		default:
+			return nil, ErrInvalidScene
+		}
+	}
+	if req.Script != nil {
+		if strings.TrimSpace(*req.Script) == "" {
+			return nil, ErrInvalidScene
+		}
+		scene.Script = strings.TrimSpace(*req.Script)
+		scene.SpeechSeconds = storyboard.EstimateSpeechSeconds(scene.Script, project.Language)
+	}
+	if req.VisualPrompt != nil {
+		prompt := strings.TrimSpace(*req.VisualPrompt)
+		scene.VisualPrompt = &prompt
+		if prompt == "" {
+			scene.VisualPrompt = nil
+		}
+	}
+	if req.DurationSeconds != nil {
+		if *req.DurationSeconds != storyboard.ShortSegmentSeconds && *req.DurationSeconds != storyboard.LongSegmentSeconds {
+			return nil, ErrInvalidScene
+		}
+		scene.DurationSeconds = *req.DurationSeconds
+	}
+
+	if err := s.storyboardRepo.UpdateScene(ctx, scene); err != nil {
+		return nil, err
+	}
+
+	scenes, err := s.storyboardRepo.GetByProjectID(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	}
+	project.VideoDuration = storyboardDuration(scenes)
+	if err := s.projectRepo.UpdateGenerationSettings(ctx, project); err != nil {
+		return nil, err
+	}
+
+	return scene, nil
+}
+
+// prepareStoryboard returns the scenes to generate. A stored storyboard is
+// reused, edits included, unless the script, language or requested duration
+// changed since it was built.
+func (s *ProjectService) prepareStoryboard(ctx context.Context, project *model.Project, previousScript, previousLanguage string, previousDuration, requestedDuration int) ([]model.StoryboardScene, error) {
+	scenes, err := s.storyboardRepo.GetByProjectID(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := len(scenes) == 0 ||
+		*project.Script != previousScript ||
+		project.Language != previousLanguage ||
+		(requestedDuration != 0 && requestedDuration != previousDuration)
+	if !stale {
+		project.VideoDuration = storyboardDuration(scenes)
+		return scenes, nil
+	}
+
+	return s.rebuildStoryboard(ctx, project, requestedDuration)
+}
+
+func (s *ProjectService) rebuildStoryboard(ctx context.Context, project *model.Project, targetSeconds int) ([]model.StoryboardScene, error) {
+	parsed := storyboard.Build(*project.Script, project.Language, targetSeconds)
+	if len(parsed) == 0 {
+		return nil, ErrEmptyScript
+	}
+
+	scenes := make([]model.StoryboardScene, len(parsed))
+	for i, p := range parsed {
+		scenes[i] = model.StoryboardScene{
+			Position:        i,
+			Role:            string(p.Role),
+			Script:          p.Script,
+			SpeechSeconds:   p.SpeechSeconds,
+			DurationSeconds: p.Duration,
+		}
+	}
+
+	if err := s.storyboardRepo.ReplaceScenes(ctx, project.ID, scenes); err != nil {
+		return nil, err
+	}
+
+	project.VideoDuration = storyboardDuration(scenes)
+	return scenes, nil
+}
+
+func storyboardDuration(scenes []model.StoryboardScene) int {
+	total := 0
+	for _, scene := range scenes {
+		total += scene.DurationSeconds
+	}
+	return total
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+)
+
+var (
+	ErrProjectNotStuck = errors.New("project is not stuck in the queue")
+	ErrCannotRequeue   = errors.New("the project's render cannot be started again; fail it instead")
+)
+
+// A queued or processing project that has not changed for this long is
+// stuck, usually because the server restarted during its render. Renders
+// wait up to 10 minutes for each provider segment, updating progress
+// between them.
+const stuckProjectAfter = 30 * time.Minute
+
+// stuckFailureMessage is what the owner sees on a render failed by staff.
+const stuckFailureMessage = "Generation stopped responding and was cancelled; your credits were refunded"
+
+// ListStuck returns projects that have been queued or processing without
+// change for too long, oldest first.
+func (s *ProjectService) ListStuck(ctx context.Context, limit int) ([]model.Project, error) {
+	return s.projectRepo.ListStuck(ctx, time.Now().Add(-stuckProjectAfter), limit)
+}
+
+// RequeueStuck starts a stuck project's unfinished render again from its
+// saved inputs. The render was paid for when it was queued, so nothing
+// is charged.
+func (s *ProjectService) RequeueStuck(ctx context.Context, projectID string) (*model.Render, error) {
+	project, render, err := s.stuckRender(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if render == nil {
+		return nil, ErrCannotRequeue
+	}
+
+	// Inputs are resolved before the project is claimed, so a render that
+	// cannot restart leaves it as it was.
+	start, err := s.restartRender(ctx, project, render)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.projectRepo.ClaimStuck(ctx, project.ID, time.Now().Add(-stuckProjectAfter))
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, ErrProjectNotStuck
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.renderRepo.DeleteSegments(ctx, render.ID); err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return nil, err
+	}
+	if err := s.renderRepo.UpdateStatus(ctx, render.ID, model.ProjectStatusQueued); err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return nil, err
+	}
+	render.Status = model.ProjectStatusQueued
+
+	go start(context.Background())
+
+	return render, nil
+}
+
+// FailStuck fails a stuck project and its unfinished render, refunding the
+// credits the render was charged. The render may be nil for projects
+// queued before render history existed. The project is claimed first, so
+// two staff failing it at once, or a requeue racing a fail, refund once.
+func (s *ProjectService) FailStuck(ctx context.Context, projectID string) (*model.Render, error) {
+	project, render, err := s.stuckRender(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.projectRepo.FailStuck(ctx, project.ID, time.Now().Add(-stuckProjectAfter), stuckFailureMessage)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, ErrProjectNotStuck
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if render == nil {
+		return nil, nil
+	}
+	s.handleVideoFailure(ctx, project, render, stuckFailureMessage)
+	render.Status = model.ProjectStatusFailed
+	return render, nil
+}
+
+// stuckRender returns a stuck project and its newest unfinished render, or
+// a nil render if it has none.
+func (s *ProjectService) stuckRender(ctx context.Context, projectID string) (*model.Project, *model.Render, error) {
+	project, err := s.projectRepo.GetByID(ctx, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if project.Status != model.ProjectStatusQueued && project.Status != model.ProjectStatusProcessing {
+		return nil, nil, ErrProjectNotStuck
+	}
+	if time.Since(project.UpdatedAt) < stuckProjectAfter {
+		return nil, nil, ErrProjectNotStuck
+	}
+
+	renders, err := s.renderRepo.GetByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range renders {
+		if renders[i].Status == model.ProjectStatusQueued || renders[i].Status == model.ProjectStatusProcessing {
+			return project, &renders[i], nil
+		}
+	}
+	return project, nil, nil
+}
+
+// restartRender loads what the render's mode needs and returns a function
+// that runs it in the background.
+func (s *ProjectService) restartRender(ctx context.Context, project *model.Project, render *model.Render) (func(context.Context), error) {
+	switch render.Mode {
+	case model.GenerationModeAI:
+		scenes, err := s.storyboardRepo.GetByProjectID(ctx, project.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(scenes) == 0 {
+			return nil, ErrCannotRequeue
+		}
+		return func(ctx context.Context) { s.processVideoGeneration(ctx, project, render, scenes) }, nil
+
+	case model.GenerationModeSlideshow:
+		var opts *model.SlideshowOptions
+		if len(render.Options) > 0 {
+			if err := json.Unmarshal(render.Options, &opts); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCannotRequeue, err)
+			}
+		}
+		spec, err := s.buildSlideshowSpec(ctx, project, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCannotRequeue, err)
+		}
+		return func(ctx context.Context) { s.processSlideshow(ctx, project, render, spec) }, nil
+
+	case model.GenerationModeExtend:
+		var req model.ExtendVideoRequest
+		if err := json.Unmarshal(render.Options, &req); err != nil || req.Seconds < 1 {
+			return nil, ErrCannotRequeue
+		}
+		if project.VideoURL == nil || *project.VideoURL == "" {
+			return nil, ErrCannotRequeue
+		}
+		durations := extensionSegments(req.Seconds)
+		return func(ctx context.Context) { s.processExtension(ctx, project, render, durations, req.Prompt) }, nil
+
+	case model.GenerationModeEdit:
+		var opts struct {
+			Timeline []model.TimelineClip `json:"timeline"`
+		}
+		if err := json.Unmarshal(render.Options, &opts); err != nil || len(opts.Timeline) == 0 {
+			return nil, ErrCannotRequeue
+		}
+		return func(ctx context.Context) { s.processEdit(ctx, project, render, opts.Timeline) }, nil
+	}
+	return nil, ErrCannotRequeue
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/video"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidTimeline = errors.New("invalid timeline edit")
+	ErrClipNotFound    = errors.New("timeline clip not found")
+	ErrRenderNotReady  = errors.New("render is not completed")
+)
+
+const (
+	maxTimelineClips = 50
+	minClipSeconds   = 0.1
+	maxStillSeconds  = 10.0
+)
+
+func (s *ProjectService) GetTimeline(ctx context.Context, renderID, userID string) (*model.Timeline, error) {
+	render, err := s.getOwnedRender(ctx, renderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.loadTimeline(ctx, render)
+}
+
+func (s *ProjectService) TrimClip(ctx context.Context, renderID, userID, clipID string, req *model.TrimClipRequest) (*model.Timeline, error) {
+	return s.editTimeline(ctx, renderID, userID, func(render *model.Render, timeline *model.Timeline) error {
+		idx := findClip(timeline.Clips, clipID)
+		if idx < 0 {
+			return ErrClipNotFound
+		}
+
+		clip := timeline.Clips[idx]
+		clip.InPoint = req.InPoint
+		clip.OutPoint = req.OutPoint
+		if err := s.validateClip(ctx, render, &clip); err != nil {
+			return err
+		}
+
+		timeline.Clips[idx] = clip
+		return nil
+	})
+}
+
+func (s *ProjectService) ReorderClips(ctx context.Context, renderID, userID string, req *model.ReorderClipsRequest) (*model.Timeline, error) {
+	return s.editTimeline(ctx, renderID, userID, func(render *model.Render, timeline *model.Timeline) error {
+		reordered, err := reorderClips(timeline.Clips, req.ClipIDs)
+		if err != nil {
+			return err
+		}
+
+		timeline.Clips = reordered
+		return nil
+	})
+}
+
+func (s *ProjectService) DropClip(ctx context.Context, renderID, userID, clipID string) (*model.Timeline, error) {
+	return s.editTimeline(ctx, renderID, userID, func(render *model.Render, timeline *model.Timeline) error {
+		idx := findClip(timeline.Clips, clipID)
+		if idx < 0 {
+			return ErrClipNotFound
+		}
+
+		timeline.Clips = append(timeline.Clips[:idx], timeline.Clips[idx+1:]...)
+		return nil
+	})
+}
+
+func (s *ProjectService) InsertClip(ctx context.Context, renderID, userID string, req *model.InsertClipRequest) (*model.Timeline, error) {
+	return s.editTimeline(ctx, renderID, userID, func(render *model.Render, timeline *model.Timeline) error {
+		clip := model.TimelineClip{
+			ID:        newClipID(),
+			Source:    req.Source,
+			SegmentID: req.SegmentID,
+			AssetURL:  s.canonicalURL(req.AssetURL),
+			InPoint:   req.InPoint,
+			OutPoint:  req.OutPoint,
+		}
+		if err := s.validateClip(ctx, render, &clip); err != nil {
+			return err
+		}
+
+		timeline.Clips = insertClip(timeline.Clips, clip, req.Position)
+		return nil
+	})
+}
+
+// Rerender applies the render's timeline with ffmpeg and stores the result as
+// a new render. No provider call is made, so no credits are charged. A
+// render still queued or processing cannot be rendered again until it ends.
+func (s *ProjectService) Rerender(ctx context.Context, renderID, userID string) (*model.Render, error) {
+	parent, err := s.getOwnedRender(ctx, renderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Status != model.ProjectStatusCompleted && parent.Status != model.ProjectStatusFailed {
+		return nil, ErrRenderNotReady
+	}
+
+	timeline, err := s.loadTimeline(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := s.projectRepo.GetByID(ctx, parent.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := json.Marshal(map[string]interface{}{"timeline": timeline.Clips})
+	if err != nil {
+		return nil, err
+	}
+
+	render := &model.Render{
+		ProjectID:       parent.ProjectID,
+		UserID:          userID,
+		Mode:            model.GenerationModeEdit,
+		Format:          parent.Format,
+		DurationSeconds: int(math.Round(timeline.Duration)),
+		Options:         options,
+		ParentRenderID:  &parent.ID,
+	}
+	if err := s.renderRepo.Create(ctx, render); err != nil {
+		return nil, err
+	}
+
+	if err := s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusQueued, 0); err != nil {
+		_ = s.renderRepo.SetFailed(ctx, render.ID, err.Error())
+		return nil, err
+	}
+
+	go func() {
+		s.processEdit(context.Background(), project, render, timeline.Clips)
+	}()
+
+	return render, nil
+}
+
+func (s *ProjectService) processEdit(ctx context.Context, project *model.Project, render *model.Render, clips []model.TimelineClip) {
+	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 10)
+	_ = s.renderRepo.UpdateStatus(ctx, render.ID, model.ProjectStatusProcessing)
+
+	if err := video.CheckFFmpeg(); err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return
+	}
+
+	var downloaded []string
+	defer func() {
+		for _, f := range downloaded {
+			os.Remove(f)
+		}
+	}()
+
+	editClips := make([]video.EditClip, 0, len(clips))
+	for i, clip := range clips {
+		path, temporary, err := s.clipMediaPath(ctx, render, clip, i)
+		if err != nil {
+			s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Clip %d unavailable: %s", i+1, err.Error()))
+			return
+		}
+		if temporary {
+			downloaded = append(downloaded, path)
+		}
+
+		editClips = append(editClips, video.EditClip{
+			Path:  path,
+			Still: clip.Source != model.ClipSourceSegment,
+			In:    clip.InPoint,
+			Out:   clip.OutPoint,
+		})
+	}
+
+	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 50)
+
+	width, height := s.getVideoDimensions(string(render.Format))
+	outputPath := filepath.Join(tempDir, render.ID+"_edit.mp4")
+	if _, err := video.NewEditor().Render(editClips, width, height, outputPath); err != nil {
+		s.handleVideoFailure(ctx, project, render, fmt.Sprintf("Edit render failed: %s", err.Error()))
+		return
+	}
+
+	_ = s.projectRepo.UpdateStatus(ctx, project.ID, model.ProjectStatusProcessing, 90)
+
+	videoObj, thumbnail, err := s.publishRender(ctx, render, outputPath)
+	if err != nil {
+		s.handleVideoFailure(ctx, project, render, err.Error())
+		return
+	}
+
+	duration := timelineDuration(clips)
+	segment := &model.RenderSegment{
+		RenderID:        render.ID,
+		Position:        0,
+		VideoURL:        &videoObj.URL,
+		DurationSeconds: &duration,
+	}
+	_ = s.renderRepo.AddSegment(ctx, segment)
+
+	s.completeRender(ctx, project, render, videoObj, thumbnail)
+}
+
+// clipMediaPath returns a local file for the clip, downloading stored and
+// provider hosted media into the temp directory when needed.
+func (s *ProjectService) clipMediaPath(ctx context.Context, render *model.Render, clip model.TimelineClip, index int) (string, bool, error) {
+	if clip.Source != model.ClipSourceSegment {
+		path, err := s.fetchUpload(ctx, render.UserID, *clip.AssetURL, fmt.Sprintf("%s_asset_%d", render.ID, index))
+		return path, err == nil, err
+	}
+
+	segment, err := s.renderRepo.GetSegment(ctx, *clip.SegmentID)
+	if err != nil {
+		return "", false, err
+	}
+	if segment.VideoURL == nil {
+		return "", false, ErrMediaNotFound
+	}
+
+	return s.localVideoPath(s.newMerger(), *segment.VideoURL, fmt.Sprintf("%s_clip_%d.mp4", render.ID, index))
+}
+
+func (s *ProjectService) editTimeline(ctx context.Context, renderID, userID string, edit func(*model.Render, *model.Timeline) error) (*model.Timeline, error) {
+	render, err := s.getOwnedRender(ctx, renderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline, err := s.loadTimeline(ctx, render)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := edit(render, timeline); err != nil {
+		return nil, err
+	}
+
+	if len(timeline.Clips) == 0 {
+		return nil, fmt.Errorf("%w: a timeline needs at least one clip", ErrInvalidTimeline)
+	}
+	if len(timeline.Clips) > maxTimelineClips {
+		return nil, fmt.Errorf("%w: at most %d clips allowed", ErrInvalidTimeline, maxTimelineClips)
+	}
+
+	data, err := json.Marshal(timeline.Clips)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.renderRepo.SaveTimeline(ctx, render.ID, data); err != nil {
+		return nil, err
+	}
+
+	timeline.Duration = timelineDuration(timeline.Clips)
+	return timeline, nil
+}
+
+// loadTimeline returns the saved timeline, or a default one that plays every
+// segment of the render in full.
+func (s *ProjectService) loadTimeline(ctx context.Context, render *model.Render) (*model.Timeline, error) {
+	timeline := &model.Timeline{RenderID: render.ID, Clips: []model.TimelineClip{}}
+
+	if render.Timeline != nil {
+		if err := json.Unmarshal(*render.Timeline, &timeline.Clips); err != nil {
+			return nil, err
+		}
+		timeline.Duration = timelineDuration(timeline.Clips)
+		return timeline, nil
+	}
+
+	if render.Status != model.ProjectStatusCompleted {
+		return nil, ErrRenderNotReady
+	}
+
+	segments, err := s.renderRepo.GetSegments(ctx, render.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range segments {
+		segment := segments[i]
+		if segment.VideoURL == nil {
+			continue
+		}
+
+		out := float64(render.DurationSeconds) / float64(len(segments))
+		if segment.DurationSeconds != nil && *segment.DurationSeconds > 0 {
+			out = *segment.DurationSeconds
+		}
+
+		// Default clips take their ID from the segment so they stay stable
+		// until the first edit is saved.
+		timeline.Clips = append(timeline.Clips, model.TimelineClip{
+			ID:        segment.ID[:8],
+			Source:    model.ClipSourceSegment,
+			SegmentID: &segment.ID,
+			InPoint:   0,
+			OutPoint:  out,
+		})
+	}
+
+	timeline.Duration = timelineDuration(timeline.Clips)
+	return timeline, nil
+}
+
+func (s *ProjectService) validateClip(ctx context.Context, render *model.Render, clip *model.TimelineClip) error {
+	if clip.InPoint < 0 || clip.OutPoint-clip.InPoint < minClipSeconds {
+		return fmt.Errorf("%w: out_point must be at least %.1fs after in_point", ErrInvalidTimeline, minClipSeconds)
+	}
+
+	switch clip.Source {
+	case model.ClipSourceSegment:
+		if clip.SegmentID == nil {
+			return fmt.Errorf("%w: segment_id is required", ErrInvalidTimeline)
+		}
+		clip.AssetURL = nil
+
+		segment, err := s.renderRepo.GetSegment(ctx, *clip.SegmentID)
+		if err != nil || segment.RenderID != render.ID {
+			return fmt.Errorf("%w: segment does not belong to this render", ErrInvalidTimeline)
+		}
+		if segment.DurationSeconds != nil && clip.OutPoint > *segment.DurationSeconds+0.01 {
+			return fmt.Errorf("%w: out_point exceeds segment length of %.2fs", ErrInvalidTimeline, *segment.DurationSeconds)
+		}
+	case model.ClipSourceIntro, model.ClipSourceOutro:
+		if clip.AssetURL == nil {
+			return fmt.Errorf("%w: asset_url is required", ErrInvalidTimeline)
+		}
+		clip.SegmentID = nil
+
+		if _, err := s.uploadKey(ctx, render.UserID, *clip.AssetURL); err != nil {
+			return fmt.Errorf("%w: asset not found", ErrInvalidTimeline)
+		}
+		if clip.OutPoint-clip.InPoint > maxStillSeconds {
+			return fmt.Errorf("%w: intro and outro cards are limited to %.0fs", ErrInvalidTimeline, maxStillSeconds)
+		}
+	default:
+		return fmt.Errorf("%w: source must be segment, intro or outro", ErrInvalidTimeline)
+	}
+
+	return nil
+}
+
+func (s *ProjectService) getOwnedRender(ctx context.Context, renderID, userID string) (*model.Render, error) {
+	if _, err := uuid.Parse(renderID); err != nil {
+		return nil, repository.ErrNotFound
+	}
+
+	render, err := s.renderRepo.GetByID(ctx, renderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if render.UserID != userID {
+		return nil, repository.ErrUnauthorized
+	}
+
+	return render, nil
+}
+
+func findClip(clips []model.TimelineClip, id string) int {
+	for i, c := range clips {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// reorderClips returns the clips in the order of ids, which must list every
+// clip exactly once.
+func reorderClips(clips []model.TimelineClip, ids []string) ([]model.TimelineClip, error) {
+	if len(ids) != len(clips) {
+		return nil, fmt.Errorf("%w: clip_ids must list every clip exactly once", ErrInvalidTimeline)
+	}
+
+	reordered := make([]model.TimelineClip, 0, len(clips))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		idx := findClip(clips, id)
+		if idx < 0 || seen[id] {
+			return nil, fmt.Errorf("%w: clip_ids must list every clip exactly once", ErrInvalidTimeline)
+		}
+		seen[id] = true
+		reordered = append(reordered, clips[idx])
+	}
+	return reordered, nil
+}
+
+// insertClip inserts clip before the given position, counting from 0.
+// Without a position, or with one past the end, the clip is appended.
+func insertClip(clips []model.TimelineClip, clip model.TimelineClip, position *int) []model.TimelineClip {
+	at := len(clips)
+	if position != nil && *position >= 0 && *position < at {
+		at = *position
+	}
+
+	clips = append(clips, model.TimelineClip{})
+	copy(clips[at+1:], clips[at:])
+	clips[at] = clip
+	return clips
+}
+
+func timelineDuration(clips []model.TimelineClip) float64 {
+	var total float64
+	for _, c := range clips {
+		total += c.OutPoint - c.InPoint
+	}
+	return total
+}
+
+func newClipID() string {
+	return uuid.New().String()[:8]
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+)
+
+func clipIDs(clips []model.TimelineClip) []string {
+	ids := make([]string, len(clips))
+	for i, c := range clips {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+func testClips(ids ...string) []model.TimelineClip {
+	clips := make([]model.TimelineClip, len(ids))
+	for i, id := range ids {
+		clips[i] = model.TimelineClip{ID: id, Source: model.ClipSourceSegment, OutPoint: 5}
+	}
+	return clips
+}
+
+func TestInsertClip(t *testing.T) {
+	pos := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		position *int
+		want     []string
+	}{
+		{"no position appends", nil, []string{"a", "b", "c", "new"}},
+		{"start", pos(0), []string{"new", "a", "b", "c"}},
+		{"middle", pos(2), []string{"a", "b", "new", "c"}},
+		{"end", pos(3), []string{"a", "b", "c", "new"}},
+		{"past the end appends", pos(9), []string{"a", "b", "c", "new"}},
+		{"negative appends", pos(-1), []string{"a", "b", "c", "new"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := insertClip(testClips("a", "b", "c"), model.TimelineClip{ID: "new"}, tt.position)
+			if ids := clipIDs(got); !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("insertClip() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	if got := insertClip(nil, model.TimelineClip{ID: "new"}, pos(0)); !reflect.DeepEqual(clipIDs(got), []string{"new"}) {
+		t.Errorf("insertClip() into an empty timeline = %v", clipIDs(got))
+	}
+}
+
+func TestReorderClips(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "reversed", ids: []string{"c", "b", "a"}, want: []string{"c", "b", "a"}},
+		{name: "unchanged", ids: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+		{name: "missing clip", ids: []string{"a", "b"}, wantErr: true},
+		{name: "duplicate clip", ids: []string{"a", "a", "b"}, wantErr: true},
+		{name: "unknown clip", ids: []string{"a", "b", "x"}, wantErr: true},
+		{name: "extra clip", ids: []string{"a", "b", "c", "c"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reorderClips(testClips("a", "b", "c"), tt.ids)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTimeline) {
+					t.Fatalf("reorderClips() error = %v, want ErrInvalidTimeline", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reorderClips() error = %v", err)
+			}
+			if ids := clipIDs(got); !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("reorderClips() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimelineDuration(t *testing.T) {
+	clips := []model.TimelineClip{
+		{InPoint: 0, OutPoint: 5},
+		{InPoint: 1.5, OutPoint: 4},
+		{InPoint: 0, OutPoint: 2.25},
+	}
+	if got := timelineDuration(clips); got != 9.75 {
+		t.Errorf("timelineDuration() = %v, want 9.75", got)
+	}
+	if got := timelineDuration(nil); got != 0 {
+		t.Errorf("timelineDuration(nil) = %v, want 0", got)
+	}
+}
+
+// The cases below are rejected before the clip's segment or asset is looked
+// up, so they need no repositories.
+func TestValidateClipRejects(t *testing.T) {
+	segmentID := "segment"
+	assetURL := "/uploads/intro.png"
+
+	tests := []struct {
+		name string
+		clip model.TimelineClip
+	}{
+		{"negative in point", model.TimelineClip{Source: model.ClipSourceSegment, SegmentID: &segmentID, InPoint: -1, OutPoint: 2}},
+		{"out before in", model.TimelineClip{Source: model.ClipSourceSegment, SegmentID: &segmentID, InPoint: 3, OutPoint: 2}},
+		{"too short", model.TimelineClip{Source: model.ClipSourceSegment, SegmentID: &segmentID, InPoint: 1, OutPoint: 1.05}},
+		{"segment without id", model.TimelineClip{Source: model.ClipSourceSegment, AssetURL: &assetURL, OutPoint: 2}},
+		{"intro without asset", model.TimelineClip{Source: model.ClipSourceIntro, SegmentID: &segmentID, OutPoint: 2}},
+		{"outro without asset", model.TimelineClip{Source: model.ClipSourceOutro, OutPoint: 2}},
+		{"unknown source", model.TimelineClip{Source: "music", OutPoint: 2}},
+	}
+
+	s := &ProjectService{}
+	render := &model.Render{ID: "render", UserID: "user"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clip := tt.clip
+			if err := s.validateClip(context.Background(), render, &clip); !errors.Is(err, ErrInvalidTimeline) {
+				t.Errorf("validateClip() error = %v, want ErrInvalidTimeline", err)
+			}
+		})
+	}
+}
+
+func TestGetOwnedRenderMalformedID(t *testing.T) {
+	s := &ProjectService{}
+	if _, err := s.getOwnedRender(context.Background(), "not-a-uuid", "user"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("getOwnedRender() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/media"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+	"github.com/genvid/backend/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadExpired        = errors.New("upload has expired")
+	ErrUploadOffset         = errors.New("upload offset does not match")
+	ErrUploadClosed         = errors.New("upload is no longer accepting data")
+	ErrChecksumMismatch     = errors.New("chunk checksum does not match")
+	ErrUnsupportedChecksum  = errors.New("unsupported checksum algorithm")
+	ErrChunkTooLarge        = errors.New("checksummed chunk exceeds the chunk size limit or the upload length")
+	ErrUploadStillFinishing = errors.New("upload is still being processed")
+)
+
+const (
+	// uploadSessionTTL is how long an unfinished upload can be resumed.
+	uploadSessionTTL = 24 * time.Hour
+	// maxChunkSize caps one PATCH. Larger requests are cut short and the
+	// client continues from the returned offset.
+	maxChunkSize = 64 << 20
+	// staleUploadAfter is how long an upload may stay processing before the
+	// instance finishing it is taken to have stopped.
+	staleUploadAfter = time.Hour
+	// uploadInterrupted is the error of an upload failed for that reason.
+	uploadInterrupted = "processing was interrupted; upload the file again"
+)
+
+// checksumAlgorithms are the tus checksum extension algorithms accepted in
+// Upload-Checksum.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// UploadService implements resumable uploads. Every PATCH is written to the
+// store as its own chunk, so an upload survives restarts and can continue on
+// any instance. When the last byte arrives the chunks are streamed through
+// AssetService.Upload and removed.
+type UploadService struct {
+	uploadRepo   *repository.UploadRepository
+	assetService *AssetService
+	store        storage.Storage
+}
+
+func NewUploadService(uploadRepo *repository.UploadRepository, assetService *AssetService, store storage.Storage) *UploadService {
+	return &UploadService{
+		uploadRepo:   uploadRepo,
+		assetService: assetService,
+		store:        store,
+	}
+}
+
+// Create starts an upload of length bytes. metadata carries the tus
+// Upload-Metadata pairs: filename, purpose and project_id.
+func (s *UploadService) Create(ctx context.Context, userID string, length int64, metadata map[string]string) (*model.UploadSession, error) {
+	purpose := model.AssetPurpose(metadata["purpose"])
+	if purpose == "" {
+		purpose = model.AssetPurposeProductVideo
+	}
+	kinds, ok := uploadKinds[purpose]
+	if !ok {
+		return nil, fmt.Errorf("%w: purpose %q cannot be uploaded", ErrInvalidAsset, purpose)
+	}
+
+	var maxLength int64
+	for _, kind := range kinds {
+		maxLength = max(maxLength, media.MaxSize[kind])
+	}
+	if length <= 0 {
+		return nil, fmt.Errorf("%w: upload length must be positive", ErrInvalidAsset)
+	}
+	if length > maxLength {
+		return nil, ErrAssetTooLarge
+	}
+	if err := s.assetService.storageService.CheckQuota(ctx, userID, length); err != nil {
+		return nil, err
+	}
+
+	session := &model.UploadSession{
+		UserID:       userID,
+		Purpose:      purpose,
+		Filename:     filepath.Base(metadata["filename"]),
+		UploadLength: length,
+		ExpiresAt:    time.Now().Add(uploadSessionTTL),
+	}
+	if session.Filename == "." || session.Filename == "/" {
+		session.Filename = "upload"
+	}
+	if projectID := metadata["project_id"]; projectID != "" {
+		if _, err := s.assetService.projectService.GetByID(ctx, projectID, userID); err != nil {
+			return nil, fmt.Errorf("%w: project not found", ErrInvalidAsset)
+		}
+		session.ProjectID = &projectID
+	}
+
+	if err := s.uploadRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Get returns one of the user's uploads, with its asset once completed.
+func (s *UploadService) Get(ctx context.Context, id, userID string) (*model.UploadSession, error) {
+	session, err := s.get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.AssetID != nil {
+		asset, err := s.assetService.Get(ctx, *session.AssetID, userID)
+		if err != nil && !errors.Is(err, ErrAssetNotFound) {
+			return nil, err
+		}
+		session.Asset = asset
+	}
+	return session, nil
+}
+
+// WriteChunk appends the bytes at offset. checksum is an optional tus
+// Upload-Checksum value ("<algorithm> <base64 digest>"). Without a checksum
+// a body that breaks off is kept up to the last byte received, so the client
+// can resume from there.
+func (s *UploadService) WriteChunk(ctx context.Context, id, userID string, offset int64, r io.Reader, checksum string) (*model.UploadSession, error) {
+	session, err := s.get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != model.UploadStatusUploading {
+		return nil, ErrUploadClosed
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	if offset != session.UploadOffset {
+		return nil, ErrUploadOffset
+	}
+
+	remaining := session.UploadLength - offset
+	limit := min(remaining, maxChunkSize)
+
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(tempDir, "chunk-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, copyErr := copyChunk(tmp, r, limit, checksum)
+	if closeErr := tmp.Close(); closeErr != nil {
+		return nil, closeErr
+	}
+	if copyErr != nil {
+		if checksum != "" || size == 0 {
+			return nil, copyErr
+		}
+		log.Printf("Upload %s: body broke off after %d bytes: %v", id, size, copyErr)
+	}
+	if size == 0 {
+		return session, nil
+	}
+
+	key := fmt.Sprintf("uploads/%s/sessions/%s/%015d-%s", userID, id, offset, uuid.New().String()[:8])
+	if _, err := storage.PutFile(ctx, s.store, key, tmp.Name(), "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	session, err = s.uploadRepo.AppendChunk(ctx, &model.UploadChunk{
+		SessionID:  id,
+		Offset:     offset,
+		Size:       size,
+		StorageKey: key,
+	})
+	if err != nil {
+		_ = s.store.Delete(ctx, key)
+		if errors.Is(err, repository.ErrConflict) {
+			return nil, ErrUploadOffset
+		}
+		return nil, err
+	}
+
+	if session.UploadOffset == session.UploadLength {
+		if err := s.uploadRepo.SetStatus(ctx, id, model.UploadStatusUploading, model.UploadStatusProcessing); err == nil {
+			session.Status = model.UploadStatusProcessing
+			go s.finish(context.Background(), session)
+		}
+	}
+
+	return session, nil
+}
+
+// Delete cancels an upload and removes its chunks. A completed upload's
+// asset is kept.
+func (s *UploadService) Delete(ctx context.Context, id, userID string) error {
+	session, err := s.get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if session.Status == model.UploadStatusProcessing && time.Since(session.UpdatedAt) < staleUploadAfter {
+		return ErrUploadStillFinishing
+	}
+
+	if err := s.removeChunks(ctx, id); err != nil {
+		return err
+	}
+	return s.uploadRepo.Delete(ctx, id)
+}
+
+// finish joins the chunks into an asset. Type detection, size limits and
+// metadata extraction are the same as for a direct upload.
+func (s *UploadService) finish(ctx context.Context, session *model.UploadSession) {
+	chunks, err := s.uploadRepo.ListChunks(ctx, session.ID)
+	if err == nil {
+		err = checkChunks(chunks, session.UploadLength)
+	}
+
+	var asset *model.Asset
+	if err == nil {
+		reader := &chunkReader{ctx: ctx, store: s.store, chunks: chunks}
+		asset, err = s.assetService.Upload(ctx, session.UserID, reader, session.Filename, &model.UploadAssetRequest{
+			Purpose:   session.Purpose,
+			ProjectID: session.ProjectID,
+		})
+		reader.Close()
+	}
+
+	if err != nil {
+		log.Printf("Failed to finish upload %s: %v", session.ID, err)
+		_ = s.uploadRepo.Fail(ctx, session.ID, uploadFailure(err))
+	} else if err := s.uploadRepo.Complete(ctx, session.ID, asset.ID); err != nil {
+		log.Printf("Failed to complete upload %s: %v", session.ID, err)
+	}
+
+	if err := s.removeChunks(ctx, session.ID); err != nil {
+		log.Printf("Failed to remove chunks of upload %s: %v", session.ID, err)
+	}
+}
+
+func (s *UploadService) get(ctx context.Context, id, userID string) (*model.UploadSession, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	session, err := s.uploadRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+func (s *UploadService) removeChunks(ctx context.Context, sessionID string) error {
+	chunks, err := s.uploadRepo.ListChunks(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := s.store.Delete(ctx, chunk.StorageKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return s.uploadRepo.DeleteChunks(ctx, sessionID)
+}
+
+// copyChunk copies at most limit bytes of r to w. checksum is an optional
+// tus Upload-Checksum value ("<algorithm> <base64 digest>"); it covers the
+// whole body, which must then arrive intact and fit in limit. Without one, a
+// body that breaks off returns the read error along with the bytes copied.
+func copyChunk(w io.Writer, r io.Reader, limit int64, checksum string) (int64, error) {
+	var sum hash.Hash
+	var want []byte
+	if checksum != "" {
+		algorithm, digest, _ := strings.Cut(checksum, " ")
+		newHash, ok := checksumAlgorithms[strings.ToLower(algorithm)]
+		if !ok {
+			return 0, ErrUnsupportedChecksum
+		}
+		var err error
+		if want, err = base64.StdEncoding.DecodeString(strings.TrimSpace(digest)); err != nil {
+			return 0, ErrChecksumMismatch
+		}
+		sum = newHash()
+		w = io.MultiWriter(w, sum)
+	}
+
+	size, err := io.Copy(w, io.LimitReader(r, limit))
+	if sum == nil || err != nil {
+		return size, err
+	}
+
+	if n, _ := io.CopyN(io.Discard, r, 1); n > 0 {
+		return size, ErrChunkTooLarge
+	}
+	if string(sum.Sum(nil)) != string(want) {
+		return size, ErrChecksumMismatch
+	}
+	return size, nil
+}
+
+// checkChunks verifies that the chunks cover the upload without gaps.
+func checkChunks(chunks []model.UploadChunk, length int64) error {
+	var next int64
+	for _, chunk := range chunks {
+		if chunk.Offset != next {
+			return fmt.Errorf("chunk at %d, expected %d", chunk.Offset, next)
+		}
+		next += chunk.Size
+	}
+	if next != length {
+		return fmt.Errorf("chunks hold %d of %d bytes", next, length)
+	}
+	return nil
+}
+
+// uploadFailure is the reason shown to the client for a failed upload.
+func uploadFailure(err error) string {
+	for _, known := range []error{ErrUnsupportedMedia, ErrAssetTooLarge, ErrQuotaExceeded, ErrInvalidAsset} {
+		if errors.Is(err, known) {
+			return err.Error()
+		}
+	}
+	return "failed to process upload"
+}
+
+// chunkReader reads an upload's chunks back from the store in order.
+type chunkReader struct {
+	ctx    context.Context
+	store  storage.Storage
+	chunks []model.UploadChunk
+	body   io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.body == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			body, _, err := c.store.Get(c.ctx, c.chunks[0].StorageKey)
+			if err != nil {
+				return 0, err
+			}
+			c.body = body
+			c.chunks = c.chunks[1:]
+		}
+
+		n, err := c.body.Read(p)
+		if err == io.EOF {
+			c.body.Close()
+			c.body = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.body != nil {
+		return c.body.Close()
+	}
+	return nil
+}
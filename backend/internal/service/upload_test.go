@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/storage"
+)
+
+func TestCopyChunk(t *testing.T) {
+	body := "the quick brown fox"
+	sha1Sum := sha1.Sum([]byte(body))
+	sha256Sum := sha256.Sum256([]byte(body))
+	md5Sum := md5.Sum([]byte(body))
+	b64 := base64.StdEncoding.EncodeToString
+
+	broken := func() io.Reader {
+		return io.MultiReader(strings.NewReader(body[:9]), iotest.ErrReader(io.ErrUnexpectedEOF))
+	}
+
+	tests := []struct {
+		name     string
+		r        io.Reader
+		limit    int64
+		checksum string
+		wantSize int64
+		wantErr  error
+	}{
+		{name: "no checksum", r: strings.NewReader(body), limit: 64, wantSize: 19},
+		{name: "cut at the limit", r: strings.NewReader(body), limit: 9, wantSize: 9},
+		{name: "broken body is kept", r: broken(), limit: 64, wantSize: 9, wantErr: io.ErrUnexpectedEOF},
+		{name: "sha1", r: strings.NewReader(body), limit: 64, checksum: "sha1 " + b64(sha1Sum[:]), wantSize: 19},
+		{name: "sha256", r: strings.NewReader(body), limit: 64, checksum: "sha256 " + b64(sha256Sum[:]), wantSize: 19},
+		{name: "md5 upper case", r: strings.NewReader(body), limit: 64, checksum: "MD5 " + b64(md5Sum[:]), wantSize: 19},
+		{name: "exactly the limit", r: strings.NewReader(body), limit: 19, checksum: "sha1 " + b64(sha1Sum[:]), wantSize: 19},
+		{name: "mismatch", r: strings.NewReader(body + "!"), limit: 64, checksum: "sha1 " + b64(sha1Sum[:]), wantSize: 20, wantErr: ErrChecksumMismatch},
+		{name: "bad base64", r: strings.NewReader(body), limit: 64, checksum: "sha1 ???", wantErr: ErrChecksumMismatch},
+		{name: "unsupported algorithm", r: strings.NewReader(body), limit: 64, checksum: "crc32 AAAAAA==", wantErr: ErrUnsupportedChecksum},
+		{name: "over the limit", r: strings.NewReader(body), limit: 9, checksum: "sha1 " + b64(sha1Sum[:]), wantSize: 9, wantErr: ErrChunkTooLarge},
+		{name: "broken body with checksum", r: broken(), limit: 64, checksum: "sha1 " + b64(sha1Sum[:]), wantSize: 9, wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			size, err := copyChunk(&buf, tt.r, tt.limit, tt.checksum)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("copyChunk() error = %v, want %v", err, tt.wantErr)
+			}
+			if size != tt.wantSize || int64(buf.Len()) != size {
+				t.Errorf("copyChunk() = %d bytes, wrote %d, want %d", size, buf.Len(), tt.wantSize)
+			}
+			if tt.wantErr == nil && buf.String() != body[:size] {
+				t.Errorf("copyChunk() wrote %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestCheckChunks(t *testing.T) {
+	chunk := func(offset, size int64) model.UploadChunk {
+		return model.UploadChunk{Offset: offset, Size: size}
+	}
+
+	tests := []struct {
+		name    string
+		chunks  []model.UploadChunk
+		length  int64
+		wantErr bool
+	}{
+		{name: "one chunk", chunks: []model.UploadChunk{chunk(0, 10)}, length: 10},
+		{name: "several chunks", chunks: []model.UploadChunk{chunk(0, 4), chunk(4, 4), chunk(8, 2)}, length: 10},
+		{name: "gap", chunks: []model.UploadChunk{chunk(0, 4), chunk(5, 5)}, length: 10, wantErr: true},
+		{name: "overlap", chunks: []model.UploadChunk{chunk(0, 6), chunk(4, 6)}, length: 10, wantErr: true},
+		{name: "missing start", chunks: []model.UploadChunk{chunk(2, 8)}, length: 10, wantErr: true},
+		{name: "short", chunks: []model.UploadChunk{chunk(0, 4), chunk(4, 4)}, length: 10, wantErr: true},
+		{name: "long", chunks: []model.UploadChunk{chunk(0, 12)}, length: 10, wantErr: true},
+		{name: "none", length: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkChunks(tt.chunks, tt.length); (err != nil) != tt.wantErr {
+				t.Errorf("checkChunks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var chunks []model.UploadChunk
+	var offset int64
+	for i, part := range []string{"resumable ", "", "uploads ", "work"} {
+		key := "uploads/u1/sessions/s1/" + string(rune('a'+i))
+		if err := store.Put(ctx, key, strings.NewReader(part), int64(len(part)), ""); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, model.UploadChunk{Offset: offset, Size: int64(len(part)), StorageKey: key})
+		offset += int64(len(part))
+	}
+
+	reader := &chunkReader{ctx: ctx, store: store, chunks: chunks}
+	got, err := io.ReadAll(iotest.OneByteReader(reader))
+	reader.Close()
+	if err != nil || string(got) != "resumable uploads work" {
+		t.Fatalf("ReadAll() = %q, %v", got, err)
+	}
+
+	reader = &chunkReader{ctx: ctx, store: store, chunks: []model.UploadChunk{{StorageKey: "uploads/u1/sessions/s1/missing"}}}
+	if _, err := io.ReadAll(reader); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("ReadAll() of a missing chunk error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUploadFailure(t *testing.T) {
+	if got := uploadFailure(ErrAssetTooLarge); got != ErrAssetTooLarge.Error() {
+		t.Errorf("uploadFailure(ErrAssetTooLarge) = %q", got)
+	}
+	if got := uploadFailure(errors.New("dial tcp 10.0.0.5:5432: connection refused")); got != "failed to process upload" {
+		t.Errorf("uploadFailure() leaks %q", got)
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/genvid/backend/internal/media"
+	"github.com/genvid/backend/internal/model"
+	"github.com/genvid/backend/internal/repository"
+)
+
+// variantFormats are the output formats a product image is prepared for.
+var variantFormats = []model.VideoFormat{
+	model.VideoFormat916,
+	model.VideoFormat11,
+	model.VideoFormat169,
+}
+
+// normalizeImageFile rewrites an uploaded image in place with its
+// normalized encoding.
+func normalizeImageFile(filePath string) (*media.Normalized, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := media.NormalizeImage(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filePath, normalized.Data, 0644); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// variantKey places a variant next to its original, e.g.
+// uploads/{user}/{name}_9x16.jpg.
+func variantKey(key string, format model.VideoFormat) string {
+	base := strings.TrimSuffix(key, path.Ext(key))
+	return base + "_" + strings.ReplaceAll(string(format), ":", "x") + ".jpg"
+}
+
+// createVariants stores a copy of a product image shaped for each video
+// format. Failures are logged; generation falls back to shaping the
+// original on the fly.
+func (s *AssetService) createVariants(ctx context.Context, asset *model.Asset, img image.Image) []model.AssetVariant {
+	if asset.StorageKey == nil {
+		return nil
+	}
+
+	variants := make([]model.AssetVariant, 0, len(variantFormats))
+	for _, format := range variantFormats {
+		width, height := s.projectService.getVideoDimensions(string(format))
+		shaped, fit := media.Variant(img, width, height)
+		data, err := media.EncodeJPEG(shaped)
+		if err != nil {
+			log.Printf("Failed to encode %s variant of asset %s: %v", format, asset.ID, err)
+			continue
+		}
+
+		key := variantKey(*asset.StorageKey, format)
+		if err := s.store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+			log.Printf("Failed to store %s variant of asset %s: %v", format, asset.ID, err)
+			continue
+		}
+
+		size := int64(len(data))
+		variant := model.AssetVariant{
+			AssetID:       asset.ID,
+			Format:        format,
+			Fit:           string(fit),
+			URL:           s.store.URL(key),
+			StorageKey:    key,
+			Width:         width,
+			Height:        height,
+			FileSizeBytes: &size,
+		}
+		if err := s.assetRepo.SaveVariant(ctx, &variant); err != nil {
+			log.Printf("Failed to save %s variant of asset %s: %v", format, asset.ID, err)
+			// Variants of a shared file are removed with its blob.
+			if asset.BlobSHA256 == nil {
+				_ = s.store.Delete(ctx, key)
+			}
+			continue
+		}
+		variants = append(variants, variant)
+	}
+	return variants
+}
+
+// productImageData returns the project's product image as a data URI shaped
+// for the project's format. The stored variant is used when there is one;
+// older uploads are normalized and shaped in memory.
+func (s *ProjectService) productImageData(ctx context.Context, project *model.Project) (string, error) {
+	if project.ProductImageURL == nil || *project.ProductImageURL == "" {
+		return "", errors.New("project has no product image")
+	}
+	imageURL := *project.ProductImageURL
+	if strings.HasPrefix(imageURL, "data:image") {
+		return imageURL, nil
+	}
+
+	format := project.Format
+	if format == "" {
+		format = model.VideoFormat916
+	}
+
+	if project.ProductImageID != nil {
+		variant, err := s.assetRepo.GetVariant(ctx, *project.ProductImageID, format)
+		switch {
+		case err == nil:
+			data, err := s.readImage(ctx, variant.StorageKey)
+			if err == nil {
+				return jpegDataURI(data), nil
+			}
+			log.Printf("Failed to read %s variant of asset %s: %v", format, *project.ProductImageID, err)
+		case !errors.Is(err, repository.ErrNotFound):
+			log.Printf("Failed to look up %s variant of asset %s: %v", format, *project.ProductImageID, err)
+		}
+	}
+
+	key, err := s.uploadKey(ctx, project.UserID, imageURL)
+	if err != nil {
+		return "", err
+	}
+	data, err := s.readImage(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	normalized, err := media.NormalizeImage(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	width, height := s.getVideoDimensions(string(format))
+	shaped, _ := media.Variant(normalized.Image, width, height)
+	if data, err = media.EncodeJPEG(shaped); err != nil {
+		return "", err
+	}
+	return jpegDataURI(data), nil
+}
+
+func (s *ProjectService) readImage(ctx context.Context, key string) ([]byte, error) {
+	body, _, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxInlineImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxInlineImageBytes {
+		return nil, fmt.Errorf("image %s is too large", key)
+	}
+	return data, nil
+}
+
+func jpegDataURI(data []byte) string {
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalPathPrefix is the URL path under which the API serves local objects.
+const LocalPathPrefix = "/files/"
+
+// The server's write timeout suits API responses, not videos, so ServeHTTP
+// gives each download time to send the whole object at minDownloadRate.
+const (
+	minDownloadRate  = 128 << 10 // bytes per second
+	downloadDeadline = 30 * time.Second
+)
+
+// Local stores objects as files under a root directory. It suits single
+// instance deployments and development; use S3 when running several
+// instances. Objects are only served through URLs signed with secret.
+type Local struct {
+	root      string
+	publicURL string
+	secret    []byte
+}
+
+func NewLocal(root, publicURL, secret string) (*Local, error) {
+	if secret == "" {
+		return nil, errors.New("local storage needs a signing secret")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{root: root, publicURL: strings.TrimSuffix(publicURL, "/"), secret: []byte(secret)}, nil
+}
+
+// Root is the directory objects are stored in.
+func (l *Local) Root() string {
+	return l.root
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so readers never see a partial object.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	info, err := l.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path, _ := l.path(key)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, mapLocalError(err)
+	}
+
+	return f, info, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, mapLocalError(err)
+	}
+	if fi.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	return &ObjectInfo{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	return mapLocalError(os.Remove(path))
+}
+
+// Presign returns a URL served by ServeHTTP, signed with HMAC-SHA256 over
+// the key, expiry and download filename.
+func (l *Local) Presign(ctx context.Context, key string, expiry time.Duration, filename string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	if expiry <= 0 {
+		return "", errors.New("presign expiry must be positive")
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	if filename != "" {
+		query.Set("filename", filename)
+	}
+	query.Set("signature", l.sign(key, expires, filename))
+
+	return l.URL(key) + "?" + query.Encode(), nil
+}
+
+// ServeHTTP serves objects under LocalPathPrefix to holders of a valid,
+// unexpired signature. Range requests are supported.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, LocalPathPrefix)
+	if !ok || ValidateKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	expires, filename := query.Get("expires"), query.Get("filename")
+	if !l.verify(key, expires, filename, query.Get("signature")) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	body, info, err := l.Get(r.Context(), key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer body.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if filename != "" {
+		w.Header().Set("Content-Disposition", ContentDisposition(filename))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(downloadTime(info.Size)))
+
+	http.ServeContent(w, r, path.Base(key), info.ModTime, body.(io.ReadSeeker))
+}
+
+// downloadTime is how long sending size bytes may take.
+func downloadTime(size int64) time.Duration {
+	return downloadDeadline + time.Duration(size/minDownloadRate)*time.Second
+}
+
+func (l *Local) sign(key, expires, filename string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(key + "\n" + expires + "\n" + filename))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) verify(key, expires, filename, signature string) bool {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(l.sign(key, expires, filename)))
+}
+
+func (l *Local) URL(key string) string {
+	return l.publicURL + LocalPathPrefix + key
+}
+
+func (l *Local) KeyFromURL(rawURL string) (string, bool) {
+	rest, ok := strings.CutPrefix(rawURL, l.publicURL+LocalPathPrefix)
+	if !ok {
+		rest, ok = strings.CutPrefix(rawURL, LocalPathPrefix)
+	}
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest = rest[:i]
+	}
+	if !ok || ValidateKey(rest) != nil {
+		return "", false
+	}
+	return rest, true
+}
+
+func (l *Local) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func mapLocalError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	t.Helper()
+	l, err := NewLocal(t.TempDir(), "http://api.example.com/", "storage-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Put(context.Background(), "uploads/u1/clip.mp4", strings.NewReader("0123456789"), 10, "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func serveLocal(l *Local, rawURL string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, rawURL, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNewLocalNeedsSecret(t *testing.T) {
+	if _, err := NewLocal(t.TempDir(), "", ""); err == nil {
+		t.Fatal("NewLocal() without a secret succeeded")
+	}
+}
+
+func TestLocalPresign(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	signed, err := l.Presign(ctx, "uploads/u1/clip.mp4", time.Minute, "my clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed, "http://api.example.com/files/uploads/u1/clip.mp4?") {
+		t.Fatalf("Presign() = %s", signed)
+	}
+
+	rec := serveLocal(l, signed, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("GET signed URL: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != ContentDisposition("my clip.mp4") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "video/mp4" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	rec = serveLocal(l, signed, http.Header{"Range": {"bytes=2-5"}})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Errorf("GET range: status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	if _, err := l.Presign(ctx, "../etc/passwd", time.Minute, ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Presign() of an invalid key error = %v", err)
+	}
+	if _, err := l.Presign(ctx, "uploads/u1/clip.mp4", 0, ""); err == nil {
+		t.Error("Presign() with no expiry succeeded")
+	}
+}
+
+func TestLocalRejectsBadSignatures(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	signed, err := l.Presign(ctx, "uploads/u1/clip.mp4", time.Minute, "clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+
+	other, err := NewLocal(l.Root(), "http://api.example.com", "another-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigned, _ := other.Presign(ctx, "uploads/u1/clip.mp4", time.Minute, "clip.mp4")
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+
+	tests := []struct {
+		name string
+		edit func(q url.Values) string
+	}{
+		{"no signature", func(q url.Values) string { q.Del("signature"); return u.Path }},
+		{"tampered signature", func(q url.Values) string { q.Set("signature", strings.Repeat("0", 64)); return u.Path }},
+		{"other key", func(q url.Values) string { return "/files/uploads/u1/other.mp4" }},
+		{"longer expiry", func(q url.Values) string {
+			q.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			return u.Path
+		}},
+		{"other filename", func(q url.Values) string { q.Set("filename", "evil.html"); return u.Path }},
+		{"dropped filename", func(q url.Values) string { q.Del("filename"); return u.Path }},
+		{"expired", func(q url.Values) string {
+			q.Set("expires", expired)
+			q.Set("signature", l.sign("uploads/u1/clip.mp4", expired, "clip.mp4"))
+			return u.Path
+		}},
+		{"other secret", func(q url.Values) string {
+			ou, _ := url.Parse(otherSigned)
+			for k, v := range ou.Query() {
+				q[k] = v
+			}
+			return u.Path
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := u.Query()
+			p := tt.edit(q)
+			rec := serveLocal(l, p+"?"+q.Encode(), nil)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", rec.Code)
+			}
+		})
+	}
+
+	if rec := serveLocal(l, "/files/../secret?"+u.RawQuery, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("path traversal status = %d, want 404", rec.Code)
+	}
+}
+
+func TestLocalObjects(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	rc, info, err := l.Get(ctx, "uploads/u1/clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != "0123456789" || info.Size != 10 || info.ContentType != "video/mp4" {
+		t.Errorf("Get() = %q, %+v", body, info)
+	}
+
+	if err := l.Delete(ctx, "uploads/u1/clip.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "uploads/u1/clip.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat() after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, "uploads/u1/clip.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete() error = %v, want ErrNotFound", err)
+	}
+	if _, err := l.Stat(ctx, "uploads"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat() of a directory error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalKeyFromURL(t *testing.T) {
+	l := newTestLocal(t)
+
+	tests := []struct {
+		url    string
+		key    string
+		wantOK bool
+	}{
+		{"http://api.example.com/files/uploads/u1/a.png", "uploads/u1/a.png", true},
+		{"http://api.example.com/files/uploads/u1/a.png?expires=1&signature=x", "uploads/u1/a.png", true},
+		{"/files/renders/r1/video.mp4", "renders/r1/video.mp4", true},
+		{"http://other.example.com/files/uploads/u1/a.png", "", false},
+		{"http://api.example.com/files/../a.png", "", false},
+		{"http://api.example.com/files/", "", false},
+	}
+	for _, tt := range tests {
+		key, ok := l.KeyFromURL(tt.url)
+		if key != tt.key || ok != tt.wantOK {
+			t.Errorf("KeyFromURL(%q) = %q, %v, want %q, %v", tt.url, key, ok, tt.key, tt.wantOK)
+		}
+	}
+}
+
+// TestLocalSlowDownload reads a signed URL more slowly than the server's
+// write timeout allows for a whole response.
+func TestLocalSlowDownload(t *testing.T) {
+	l := newTestLocal(t)
+	body := bytes.Repeat([]byte("v"), 8<<20)
+	if err := l.Put(context.Background(), "renders/r1/video.mp4", bytes.NewReader(body), int64(len(body)), "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := l.Presign(context.Background(), "renders/r1/video.mp4", time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+
+	server := httptest.NewUnstartedServer(l)
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + u.RequestURI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	time.Sleep(400 * time.Millisecond)
+	got, err := io.ReadAll(resp.Body)
+	if err != nil || len(got) != len(body) {
+		t.Fatalf("read %d of %d bytes: %v", len(got), len(body), err)
+	}
+}
+
+func TestDownloadTime(t *testing.T) {
+	if got := downloadTime(0); got != downloadDeadline {
+		t.Errorf("downloadTime(0) = %v", got)
+	}
+	if got := downloadTime(1 << 30); got < time.Hour || got > 3*time.Hour {
+		t.Errorf("downloadTime(1 GiB) = %v", got)
+	}
+}
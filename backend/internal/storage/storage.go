@@ -0,0 +1,167 @@
+// Package storage abstracts where uploaded and rendered media lives so that
+// several API instances can share it. Keys are slash-separated paths such as
+// "uploads/{userID}/{file}" or "renders/{renderID}/video.mp4".
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// Storage is a flat key/value blob store.
+type Storage interface {
+	// Put stores r under key. size may be -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// Presign returns a URL that grants read access to key until expiry.
+	// A non-empty filename makes the response an attachment with that name.
+	Presign(ctx context.Context, key string, expiry time.Duration, filename string) (string, error)
+	// URL returns the stable URL saved alongside records for key.
+	URL(key string) string
+	// KeyFromURL reverses URL; ok is false for URLs this store did not issue.
+	KeyFromURL(url string) (key string, ok bool)
+}
+
+// New builds the storage backend selected by STORAGE_DRIVER.
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Driver {
+	case "", "local":
+		return NewLocal(cfg.Storage.LocalDir, cfg.Storage.PublicURL, cfg.Storage.SigningSecret)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:        cfg.Storage.S3Endpoint,
+			Region:          cfg.AWS.Region,
+			Bucket:          cfg.AWS.S3Bucket,
+			AccessKeyID:     cfg.AWS.AccessKeyID,
+			SecretAccessKey: cfg.AWS.SecretAccessKey,
+			PathStyle:       cfg.Storage.S3PathStyle,
+			PublicURL:       cfg.Storage.S3PublicURL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// ValidateKey rejects keys that could escape the store's namespace.
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// Stored describes an object written by PutFile.
+type Stored struct {
+	Key         string
+	URL         string
+	ContentType string
+	Size        int64
+	SHA256      string
+}
+
+// PutFile uploads a local file and verifies that the store holds the same
+// number of bytes and, when it reports a plain MD5 ETag, the same content.
+func PutFile(ctx context.Context, s Storage, key, path, contentType string) (*Stored, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sha := sha256.New()
+	md := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha, md), f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if err := s.Put(ctx, key, f, size, contentType); err != nil {
+		return nil, err
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %w", key, err)
+	}
+	if info.Size != size {
+		return nil, fmt.Errorf("verify %s: stored %d bytes, expected %d", key, info.Size, size)
+	}
+	if etag := info.ETag; len(etag) == 32 && !strings.Contains(etag, "-") && etag != hex.EncodeToString(md.Sum(nil)) {
+		return nil, fmt.Errorf("verify %s: checksum mismatch", key)
+	}
+
+	return &Stored{
+		Key:         key,
+		URL:         s.URL(key),
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hex.EncodeToString(sha.Sum(nil)),
+	}, nil
+}
+
+// ContentDisposition formats an attachment header for filename.
+func ContentDisposition(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+// Download copies an object to a local file, creating parent directories.
+func Download(ctx context.Context, s Storage, key, path string) error {
+	body, _, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, body); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,326 @@
+// Package storyboard turns a free-text ad script into ordered scenes, each of
+// which maps to one provider segment.
+package storyboard
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// SceneRole is the narrative job a scene does in a short-form ad.
+type SceneRole string
+
+const (
+	RoleHook    SceneRole = "hook"
+	RoleProblem SceneRole = "problem"
+	RoleDemo    SceneRole = "demo"
+	RoleCTA     SceneRole = "cta"
+)
+
+// Provider segments come in two lengths; a scene always uses one of them.
+const (
+	ShortSegmentSeconds = 5
+	LongSegmentSeconds  = 10
+)
+
+// Scene is one parsed beat of the script.
+type Scene struct {
+	Role          SceneRole
+	Script        string
+	SpeechSeconds float64
+	Duration      int
+}
+
+// Speaking rates per language. CJK languages are measured in characters per
+// second, everything else in words per second.
+var (
+	charRates = map[string]float64{
+		"zh": 4.5,
+		"ja": 6.5,
+		"ko": 5.0,
+	}
+	wordRates = map[string]float64{
+		"en": 2.5,
+		"es": 2.8,
+		"pt": 2.7,
+		"fr": 2.7,
+		"it": 2.7,
+		"de": 2.3,
+	}
+)
+
+const (
+	defaultCharRate = 4.5
+	defaultWordRate = 2.5
+	sentencePause   = 0.3
+)
+
+var sentenceTerminators = map[rune]bool{
+	'.': true, '!': true, '?': true, '…': true,
+	'。': true, '！': true, '？': true, '；': true,
+}
+
+// Closing punctuation that belongs to the sentence it ends.
+var sentenceClosers = map[rune]bool{
+	'"': true, '\'': true, ')': true, ']': true,
+	'”': true, '’': true, '」': true, '』': true, '）': true, '】': true,
+}
+
+var problemKeywords = []string{
+	"tired of", "struggle", "struggling", "problem", "hate when", "sick of", "annoying", "frustrat", "no more",
+	"烦", "困扰", "头疼", "还在为", "难题", "痛点", "受够",
+}
+
+var ctaKeywords = []string{
+	"link in bio", "buy now", "shop now", "order now", "get yours", "click", "tap", "grab", "try it", "don't miss",
+	"点击", "下单", "购买", "抢购", "链接", "立即", "赶紧", "快来",
+}
+
+// SplitSentences splits text on Latin and CJK sentence punctuation and line
+// breaks. Periods between digits (prices, versions) do not end a sentence.
+func SplitSentences(text string) []string {
+	runes := []rune(text)
+	var sentences []string
+	var current strings.Builder
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			sentences = append(sentences, s)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' || r == '\r' {
+			flush()
+			continue
+		}
+
+		current.WriteRune(r)
+		if !sentenceTerminators[r] {
+			continue
+		}
+		if r == '.' && i > 0 && i+1 < len(runes) && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1]) {
+			continue
+		}
+
+		// Keep runs like "?!" or "..." and closing quotes with the sentence.
+		for i+1 < len(runes) && (sentenceTerminators[runes[i+1]] || sentenceClosers[runes[i+1]]) {
+			i++
+			current.WriteRune(runes[i])
+		}
+		flush()
+	}
+	flush()
+
+	return sentences
+}
+
+// EstimateSpeechSeconds estimates how long text takes to say aloud.
+func EstimateSpeechSeconds(text, language string) float64 {
+	charRate, ok := charRates[language]
+	if !ok {
+		charRate = defaultCharRate
+	}
+	wordRate, ok := wordRates[language]
+	if !ok {
+		wordRate = defaultWordRate
+	}
+
+	var cjkChars, words int
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			cjkChars++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+				inWord = true
+			}
+		default:
+			inWord = false
+		}
+	}
+
+	return float64(cjkChars)/charRate + float64(words)/wordRate
+}
+
+// Build parses a script into scenes. Without a target, sentences are grouped
+// greedily so each scene's speech fits in one long segment. With a target,
+// the script is split into as many scenes as the target needs, balanced by
+// speaking time, and short scenes are lengthened until the target is met.
+func Build(script, language string, targetSeconds int) []Scene {
+	sentences := SplitSentences(script)
+	if len(sentences) == 0 {
+		return nil
+	}
+
+	speech := make([]float64, len(sentences))
+	for i, s := range sentences {
+		speech[i] = EstimateSpeechSeconds(s, language) + sentencePause
+	}
+
+	var scenes []Scene
+	if targetSeconds > 0 {
+		n := int(math.Ceil(float64(targetSeconds) / LongSegmentSeconds))
+		scenes = partition(sentences, speech, n, language)
+	} else {
+		var current Scene
+		for i, sentence := range sentences {
+			if current.Script != "" && current.SpeechSeconds+speech[i] > LongSegmentSeconds {
+				scenes = append(scenes, current)
+				current = Scene{}
+			}
+			current.Script = joinSentences(current.Script, sentence, language)
+			current.SpeechSeconds += speech[i]
+		}
+		scenes = append(scenes, current)
+	}
+
+	for i := range scenes {
+		scenes[i].Duration = ShortSegmentSeconds
+		if scenes[i].SpeechSeconds > ShortSegmentSeconds {
+			scenes[i].Duration = LongSegmentSeconds
+		}
+	}
+
+	if targetSeconds > 0 {
+		if targetSeconds < LongSegmentSeconds {
+			// Short targets always get a single scene; keep it short too.
+			scenes[0].Duration = ShortSegmentSeconds
+		}
+		lengthenToTarget(scenes, targetSeconds)
+	}
+
+	assignRoles(scenes)
+	return scenes
+}
+
+// Group splits a script into n parts balanced by speaking time, for uses
+// such as slideshow captions where the number of parts is fixed.
+func Group(script, language string, n int) []string {
+	sentences := SplitSentences(script)
+	speech := make([]float64, len(sentences))
+	for i, s := range sentences {
+		speech[i] = EstimateSpeechSeconds(s, language) + sentencePause
+	}
+
+	scenes := partition(sentences, speech, n, language)
+	groups := make([]string, len(scenes))
+	for i, scene := range scenes {
+		groups[i] = scene.Script
+	}
+	return groups
+}
+
+// partition splits sentences into at most n contiguous scenes of roughly
+// equal speaking time. Every scene gets at least one sentence.
+func partition(sentences []string, speech []float64, n int, language string) []Scene {
+	if len(sentences) == 0 {
+		return nil
+	}
+	if n < 1 {
+		n = 1
+	}
+	if n > len(sentences) {
+		n = len(sentences)
+	}
+
+	var total float64
+	for _, s := range speech {
+		total += s
+	}
+
+	scenes := make([]Scene, 0, n)
+	var current Scene
+	var elapsed float64
+	for i, sentence := range sentences {
+		current.Script = joinSentences(current.Script, sentence, language)
+		current.SpeechSeconds += speech[i]
+		elapsed += speech[i]
+
+		remainingSentences := len(sentences) - i - 1
+		remainingScenes := n - len(scenes) - 1
+		boundary := total * float64(len(scenes)+1) / float64(n)
+		if remainingScenes > 0 && (elapsed >= boundary || remainingSentences == remainingScenes) {
+			scenes = append(scenes, current)
+			current = Scene{}
+		}
+	}
+	if current.Script != "" {
+		scenes = append(scenes, current)
+	}
+
+	return scenes
+}
+
+// lengthenToTarget promotes short scenes to long ones, wordiest first, until
+// the storyboard reaches the target length.
+func lengthenToTarget(scenes []Scene, targetSeconds int) {
+	for total(scenes) < targetSeconds {
+		idx := -1
+		for i := range scenes {
+			if scenes[i].Duration == ShortSegmentSeconds && (idx < 0 || scenes[i].SpeechSeconds > scenes[idx].SpeechSeconds) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			return
+		}
+		scenes[idx].Duration = LongSegmentSeconds
+	}
+}
+
+func assignRoles(scenes []Scene) {
+	for i := range scenes {
+		text := strings.ToLower(scenes[i].Script)
+		switch {
+		case i == 0:
+			scenes[i].Role = RoleHook
+		case i == len(scenes)-1 && (len(scenes) > 2 || containsAny(text, ctaKeywords)):
+			scenes[i].Role = RoleCTA
+		case containsAny(text, problemKeywords):
+			scenes[i].Role = RoleProblem
+		default:
+			scenes[i].Role = RoleDemo
+		}
+	}
+}
+
+func total(scenes []Scene) int {
+	sum := 0
+	for _, s := range scenes {
+		sum += s.Duration
+	}
+	return sum
+}
+
+func joinSentences(a, b, language string) string {
+	if a == "" {
+		return b
+	}
+	if language == "zh" || language == "ja" {
+		return a + b
+	}
+	return a + " " + b
+}
+
+func containsAny(text string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(text, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,183 @@
+package storyboard
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello there. How are you?", []string{"Hello there.", "How are you?"}},
+		{"Only $9.99 today! Version 2.0 is out.", []string{"Only $9.99 today!", "Version 2.0 is out."}},
+		{"Wait... what?! Really.", []string{"Wait...", "what?!", "Really."}},
+		{`She said "buy it." Then left.`, []string{`She said "buy it."`, "Then left."}},
+		{"第一句。第二句！第三句？", []string{"第一句。", "第二句！", "第三句？"}},
+		{"「すごい。」と言った。", []string{"「すごい。」", "と言った。"}},
+		{"line one\nline two\r\n\nline three", []string{"line one", "line two", "line three"}},
+		{"no terminator", []string{"no terminator"}},
+		{"  \n ", nil},
+	}
+	for _, tt := range tests {
+		if got := SplitSentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitSentences(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateSpeechSeconds(t *testing.T) {
+	tests := []struct {
+		text     string
+		language string
+		want     float64
+	}{
+		{"one two three four five", "en", 2},
+		{"eins zwei drei", "de", 3 / 2.3},
+		{"one two three four five", "xx", 2},
+		{"你好世界啊", "zh", 5 / 4.5},
+		{"こんにちは", "ja", 5 / 6.5},
+		{"只要 99 元", "zh", 3/4.5 + 1/defaultWordRate},
+		{"", "en", 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateSpeechSeconds(tt.text, tt.language); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("EstimateSpeechSeconds(%q, %q) = %v, want %v", tt.text, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestBuildWithoutTarget(t *testing.T) {
+	hook := "Tired of tangled cables?"                                                                        // 1.9s
+	demo := "This magnetic dock charges your phone, watch and earbuds at once, and it folds flat for travel." // 7.1s
+	how := "Just drop your phone on it and it starts charging in a second."                                   // 5.5s
+	cta := "Tap the link in bio to get yours today."                                                          // 3.9s
+
+	// Sentences are grouped while the scene still fits in one long segment.
+	scenes := Build(strings.Join([]string{hook, demo, how, cta}, " "), "en", 0)
+	want := []Scene{
+		{Role: RoleHook, Script: hook + " " + demo, SpeechSeconds: 9.0, Duration: LongSegmentSeconds},
+		{Role: RoleCTA, Script: how + " " + cta, SpeechSeconds: 9.4, Duration: LongSegmentSeconds},
+	}
+	assertScenes(t, scenes, want)
+
+	// Without a call to action the last of two scenes stays a demo.
+	scenes = Build(hook+"\n"+demo+" "+how, "en", 0)
+	want = []Scene{
+		{Role: RoleHook, Script: hook + " " + demo, SpeechSeconds: 9.0, Duration: LongSegmentSeconds},
+		{Role: RoleDemo, Script: how, SpeechSeconds: 5.5, Duration: LongSegmentSeconds},
+	}
+	assertScenes(t, scenes, want)
+
+	// A scene that is quick to say gets a short segment.
+	scenes = Build(cta, "en", 0)
+	want = []Scene{{Role: RoleHook, Script: cta, SpeechSeconds: 3.9, Duration: ShortSegmentSeconds}}
+	assertScenes(t, scenes, want)
+}
+
+func assertScenes(t *testing.T, got, want []Scene) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Build() returned %d scenes, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Role != w.Role || g.Script != w.Script || g.Duration != w.Duration || math.Abs(g.SpeechSeconds-w.SpeechSeconds) > 1e-9 {
+			t.Errorf("scene %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestBuildWithTarget(t *testing.T) {
+	script := "Meet the new kettle. It boils in two minutes. It keeps water warm for an hour. Order now."
+
+	tests := []struct {
+		target     int
+		wantScenes int
+		wantTotal  int
+	}{
+		{5, 1, 5},
+		{10, 1, 10},
+		{15, 2, 15},
+		{20, 2, 20},
+		{30, 3, 30},
+		{40, 4, 40},
+	}
+	for _, tt := range tests {
+		scenes := Build(script, "en", tt.target)
+		if len(scenes) != tt.wantScenes {
+			t.Errorf("Build(target %d) returned %d scenes, want %d", tt.target, len(scenes), tt.wantScenes)
+			continue
+		}
+		if got := total(scenes); got != tt.wantTotal {
+			t.Errorf("Build(target %d) lasts %ds, want %d", tt.target, got, tt.wantTotal)
+		}
+	}
+}
+
+func TestBuildChineseJoinsWithoutSpaces(t *testing.T) {
+	scenes := Build("还在为充电线烦恼吗？一个底座同时充三台设备。立即点击链接下单！", "zh", 0)
+	if len(scenes) != 1 {
+		t.Fatalf("Build() returned %d scenes, want 1", len(scenes))
+	}
+	if strings.Contains(scenes[0].Script, " ") {
+		t.Errorf("Script = %q, want sentences joined without spaces", scenes[0].Script)
+	}
+}
+
+func TestBuildEmpty(t *testing.T) {
+	if scenes := Build(" \n ", "en", 10); scenes != nil {
+		t.Errorf("Build() = %v, want nil", scenes)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	script := "One. Two. Three. Four. Five."
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{1, []string{"One. Two. Three. Four. Five."}},
+		{2, []string{"One. Two. Three.", "Four. Five."}},
+		{5, []string{"One.", "Two.", "Three.", "Four.", "Five."}},
+		{8, []string{"One.", "Two.", "Three.", "Four.", "Five."}},
+		{0, []string{"One. Two. Three. Four. Five."}},
+	}
+	for _, tt := range tests {
+		if got := Group(script, "en", tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Group(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAssignRoles(t *testing.T) {
+	tests := []struct {
+		scripts []string
+		want    []SceneRole
+	}{
+		{[]string{"Hi."}, []SceneRole{RoleHook}},
+		{[]string{"Hi.", "Look at this."}, []SceneRole{RoleHook, RoleDemo}},
+		{[]string{"Hi.", "Buy now."}, []SceneRole{RoleHook, RoleCTA}},
+		{[]string{"Hi.", "Sick of spills?", "It seals.", "See you."}, []SceneRole{RoleHook, RoleProblem, RoleDemo, RoleCTA}},
+		{[]string{"你好。", "还在为收纳头疼？", "一键折叠。"}, []SceneRole{RoleHook, RoleProblem, RoleCTA}},
+	}
+	for _, tt := range tests {
+		scenes := make([]Scene, len(tt.scripts))
+		for i, s := range tt.scripts {
+			scenes[i].Script = s
+		}
+		assignRoles(scenes)
+
+		got := make([]SceneRole, len(scenes))
+		for i, s := range scenes {
+			got[i] = s.Role
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("assignRoles(%q) = %v, want %v", tt.scripts, got, tt.want)
+		}
+	}
+}
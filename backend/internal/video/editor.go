@@ -0,0 +1,136 @@
+package video
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const editFPS = 30
+
+// EditClip is one cut of an edit. Video clips are trimmed to [In, Out);
+// still clips show the image for Out-In seconds.
+type EditClip struct {
+	Path  string
+	Still bool
+	In    float64
+	Out   float64
+}
+
+type Editor struct{}
+
+func NewEditor() *Editor {
+	return &Editor{}
+}
+
+// Render trims, scales and concatenates the clips into outputPath. Clips
+// without an audio track get silence so the concat stays in sync.
+func (e *Editor) Render(clips []EditClip, width, height int, outputPath string) (string, error) {
+	if len(clips) == 0 {
+		return "", fmt.Errorf("no clips to render")
+	}
+
+	args := []string{"-y"}
+	for _, c := range clips {
+		if c.Still {
+			args = append(args, "-loop", "1", "-t", formatSeconds(c.Out-c.In), "-i", c.Path)
+		} else {
+			args = append(args, "-i", c.Path)
+		}
+	}
+
+	var filters []string
+	var concatInputs strings.Builder
+	for i, c := range clips {
+		duration := c.Out - c.In
+		fit := fmt.Sprintf(
+			"scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%d,format=yuv420p",
+			width, height, width, height, editFPS,
+		)
+
+		if c.Still {
+			filters = append(filters, fmt.Sprintf("[%d:v]%s,trim=duration=%s,setpts=PTS-STARTPTS[v%d]", i, fit, formatSeconds(duration), i))
+		} else {
+			filters = append(filters, fmt.Sprintf("[%d:v]trim=start=%s:end=%s,setpts=PTS-STARTPTS,%s[v%d]",
+				i, formatSeconds(c.In), formatSeconds(c.Out), fit, i))
+		}
+
+		if !c.Still && HasAudio(c.Path) {
+			filters = append(filters, fmt.Sprintf("[%d:a]atrim=start=%s:end=%s,asetpts=PTS-STARTPTS,aresample=44100,aformat=channel_layouts=stereo[a%d]",
+				i, formatSeconds(c.In), formatSeconds(c.Out), i))
+		} else {
+			filters = append(filters, fmt.Sprintf("anullsrc=r=44100:cl=stereo,atrim=duration=%s[a%d]", formatSeconds(duration), i))
+		}
+
+		fmt.Fprintf(&concatInputs, "[v%d][a%d]", i, i)
+	}
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=1[vout][aout]", concatInputs.String(), len(clips)))
+
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", "[vout]",
+		"-map", "[aout]",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-movflags", "+faststart",
+		outputPath,
+	)
+
+	output, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %w, output: %s", err, string(output))
+	}
+
+	return outputPath, nil
+}
+
+// ProbeDuration returns the container duration of a media file in seconds.
+func ProbeDuration(path string) (float64, error) {
+	output, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	return strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+}
+
+// ProbeDimensions returns the width and height of the first video stream.
+func ProbeDimensions(path string) (int, int, error) {
+	output, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "csv=p=0:s=x",
+		path,
+	).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var width, height int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(output)), "%dx%d", &width, &height); err != nil {
+		return 0, 0, fmt.Errorf("unexpected ffprobe output %q", output)
+	}
+	return width, height, nil
+}
+
+// HasAudio reports whether the media file has at least one audio stream.
+func HasAudio(path string) bool {
+	output, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "a",
+		"-show_entries", "stream=index",
+		"-of", "csv=p=0",
+		path,
+	).Output()
+	return err == nil && strings.TrimSpace(string(output)) != ""
+}
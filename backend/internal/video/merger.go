@@ -1,6 +1,7 @@
 package video
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,18 +9,33 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/genvid/backend/internal/storage"
 )
 
+// Merger works on local scratch files in tempDir; finished outputs are
+// published to the shared store.
 type Merger struct {
 	tempDir string
+	store   storage.Storage
 }
 
-func NewMerger(tempDir string) *Merger {
+func NewMerger(tempDir string, store storage.Storage) *Merger {
 	os.MkdirAll(tempDir, 0755)
-	return &Merger{tempDir: tempDir}
+	return &Merger{tempDir: tempDir, store: store}
 }
 
+// DownloadVideo fetches a video into the temp directory. URLs issued by the
+// store are read through it; anything else is fetched over HTTP.
 func (m *Merger) DownloadVideo(url, filename string) (string, error) {
+	filePath := filepath.Join(m.tempDir, filename)
+	if key, ok := m.store.KeyFromURL(url); ok {
+		if err := storage.Download(context.Background(), m.store, key, filePath); err != nil {
+			return "", fmt.Errorf("failed to download video: %w", err)
+		}
+		return filePath, nil
+	}
+
 	resp, err := http.Get(url)
 	if err != nil {
 		return "", fmt.Errorf("failed to download video: %w", err)
@@ -30,7 +46,6 @@ func (m *Merger) DownloadVideo(url, filename string) (string, error) {
 		return "", fmt.Errorf("failed to download video: status %d", resp.StatusCode)
 	}
 
-	filePath := filepath.Join(m.tempDir, filename)
 	out, err := os.Create(filePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to create file: %w", err)
@@ -45,6 +60,8 @@ func (m *Merger) DownloadVideo(url, filename string) (string, error) {
 	return filePath, nil
 }
 
+// MergeVideos concatenates the inputs into outputPath. Inputs may be remote
+// or stored URLs, which are downloaded first, or paths to local files.
 func (m *Merger) MergeVideos(videoURLs []string, outputPath string) (string, error) {
 	if len(videoURLs) == 0 {
 		return "", fmt.Errorf("no videos to merge")
@@ -54,24 +71,35 @@ func (m *Merger) MergeVideos(videoURLs []string, outputPath string) (string, err
 		return videoURLs[0], nil
 	}
 
+	prefix := strings.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath))
 	localFiles := make([]string, len(videoURLs))
+	var downloaded []string
 	for i, url := range videoURLs {
-		filename := fmt.Sprintf("segment_%d.mp4", i)
+		if !isRemote(url) && !m.isStored(url) {
+			localFiles[i] = url
+			continue
+		}
+		filename := fmt.Sprintf("%s_segment_%d.mp4", prefix, i)
 		localPath, err := m.DownloadVideo(url, filename)
 		if err != nil {
-			m.cleanup(localFiles)
+			m.cleanup(downloaded)
 			return "", fmt.Errorf("failed to download segment %d: %w", i, err)
 		}
 		localFiles[i] = localPath
+		downloaded = append(downloaded, localPath)
 	}
 
-	listFile := filepath.Join(m.tempDir, "concat_list.txt")
+	listFile := filepath.Join(m.tempDir, prefix+"_concat_list.txt")
 	listContent := ""
 	for _, f := range localFiles {
-		listContent += fmt.Sprintf("file '%s'\n", f)
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			abs = f
+		}
+		listContent += fmt.Sprintf("file '%s'\n", abs)
 	}
 	if err := os.WriteFile(listFile, []byte(listContent), 0644); err != nil {
-		m.cleanup(localFiles)
+		m.cleanup(downloaded)
 		return "", fmt.Errorf("failed to create concat list: %w", err)
 	}
 
@@ -86,12 +114,12 @@ func (m *Merger) MergeVideos(videoURLs []string, outputPath string) (string, err
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		m.cleanup(localFiles)
+		m.cleanup(downloaded)
 		os.Remove(listFile)
 		return "", fmt.Errorf("ffmpeg failed: %w, output: %s", err, string(output))
 	}
 
-	m.cleanup(localFiles)
+	m.cleanup(downloaded)
 	os.Remove(listFile)
 
 	return outputPath, nil
@@ -107,71 +135,30 @@ func (m *Merger) GetOutputPath(projectID string) string {
 	return filepath.Join(m.tempDir, fmt.Sprintf("%s_merged.mp4", projectID))
 }
 
-func CheckFFmpeg() error {
-	cmd := exec.Command("ffmpeg", "-version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg not installed or not in PATH")
+// Publish uploads a finished local file to the store under key and removes
+// the local copy.
+func (m *Merger) Publish(ctx context.Context, localPath, key, contentType string) (*storage.Stored, error) {
+	stored, err := storage.PutFile(ctx, m.store, key, localPath, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store %s: %w", key, err)
 	}
-	return nil
+	os.Remove(localPath)
+	return stored, nil
 }
 
-func SplitScript(script string, segments int) []string {
-	if segments <= 1 {
-		return []string{script}
-	}
-
-	sentences := splitIntoSentences(script)
-	if len(sentences) < segments {
-		segments = len(sentences)
-		if segments == 0 {
-			return []string{script}
-		}
-	}
-
-	result := make([]string, segments)
-	perSegment := len(sentences) / segments
-	extra := len(sentences) % segments
-
-	idx := 0
-	for i := 0; i < segments; i++ {
-		count := perSegment
-		if i < extra {
-			count++
-		}
-		end := idx + count
-		if end > len(sentences) {
-			end = len(sentences)
-		}
-		result[i] = strings.Join(sentences[idx:end], " ")
-		idx = end
-	}
-
-	return result
+func (m *Merger) isStored(url string) bool {
+	_, ok := m.store.KeyFromURL(url)
+	return ok
 }
 
-func splitIntoSentences(text string) []string {
-	replacements := map[string]string{
-		"!":   "!|",
-		"?":   "?|",
-		".":   ".|",
-		"!\n": "!|\n",
-		"?\n": "?|\n",
-		".\n": ".|\n",
-	}
-
-	delimited := text
-	for old, new := range replacements {
-		delimited = strings.ReplaceAll(delimited, old, new)
-	}
+func isRemote(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
 
-	parts := strings.Split(delimited, "|")
-	var sentences []string
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			sentences = append(sentences, p)
-		}
+func CheckFFmpeg() error {
+	cmd := exec.Command("ffmpeg", "-version")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg not installed or not in PATH")
 	}
-
-	return sentences
+	return nil
 }
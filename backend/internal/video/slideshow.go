@@ -0,0 +1,249 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	slideshowFPS            = 30
+	slideshowTransitionSecs = 0.6
+	kenBurnsMaxZoom         = 1.25
+)
+
+var slideshowTransitions = map[string]bool{
+	"fade":       true,
+	"fadeblack":  true,
+	"fadewhite":  true,
+	"dissolve":   true,
+	"slideleft":  true,
+	"slideright": true,
+	"slideup":    true,
+	"wipeleft":   true,
+	"circleopen": true,
+	"smoothleft": true,
+}
+
+// SlideshowSpec describes a locally rendered product slideshow.
+type SlideshowSpec struct {
+	Images     []string // local image paths, in display order
+	Captions   []string // optional caption per image
+	MusicPath  string   // optional background track
+	FontFile   string   // optional font for captions; fontconfig default when empty
+	Width      int
+	Height     int
+	Duration   float64 // total output length in seconds
+	Transition string  // any xfade transition name, "fade" by default
+}
+
+type SlideshowRenderer struct {
+	tempDir string
+}
+
+func NewSlideshowRenderer(tempDir string) *SlideshowRenderer {
+	os.MkdirAll(tempDir, 0755)
+	return &SlideshowRenderer{tempDir: tempDir}
+}
+
+// IsValidTransition reports whether name is a supported slideshow transition.
+func IsValidTransition(name string) bool {
+	return name == "" || slideshowTransitions[name]
+}
+
+// Render builds the slideshow with ffmpeg and writes it to outputPath.
+func (r *SlideshowRenderer) Render(spec SlideshowSpec, outputPath string) (string, error) {
+	if len(spec.Images) == 0 {
+		return "", fmt.Errorf("no images for slideshow")
+	}
+	if spec.Width <= 0 || spec.Height <= 0 {
+		return "", fmt.Errorf("invalid slideshow size %dx%d", spec.Width, spec.Height)
+	}
+	if spec.Duration <= 0 {
+		spec.Duration = 5
+	}
+	transition := spec.Transition
+	if transition == "" {
+		transition = "fade"
+	}
+	if !IsValidTransition(transition) {
+		return "", fmt.Errorf("unsupported transition %q", transition)
+	}
+
+	n := len(spec.Images)
+	fade := slideshowTransitionSecs
+	clip := (spec.Duration + float64(n-1)*fade) / float64(n)
+	if n > 1 && clip < 2*fade {
+		return "", fmt.Errorf("duration %.1fs is too short for %d images", spec.Duration, n)
+	}
+
+	var captionFiles []string
+	defer func() { r.cleanup(captionFiles) }()
+
+	args := []string{"-y"}
+	// Each image is a single input frame; zoompan expands it to the full clip.
+	for _, img := range spec.Images {
+		args = append(args, "-i", img)
+	}
+	if spec.MusicPath != "" {
+		args = append(args, "-stream_loop", "-1", "-i", spec.MusicPath)
+	}
+
+	var filters []string
+	for i := range spec.Images {
+		filters = append(filters, fmt.Sprintf("[%d:v]%s[v%d]", i, kenBurnsFilter(i, clip, spec.Width, spec.Height), i))
+	}
+
+	last := "v0"
+	for i := 1; i < n; i++ {
+		out := fmt.Sprintf("x%d", i)
+		offset := float64(i) * (clip - fade)
+		filters = append(filters, fmt.Sprintf("[%s][v%d]xfade=transition=%s:duration=%s:offset=%s[%s]",
+			last, i, transition, formatSeconds(fade), formatSeconds(offset), out))
+		last = out
+	}
+
+	for i, caption := range spec.Captions {
+		if i >= n || strings.TrimSpace(caption) == "" {
+			continue
+		}
+		captionFile := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + fmt.Sprintf("_caption_%d.txt", i)
+		if err := os.WriteFile(captionFile, []byte(strings.TrimSpace(caption)), 0644); err != nil {
+			return "", fmt.Errorf("failed to write caption: %w", err)
+		}
+		captionFiles = append(captionFiles, captionFile)
+
+		start := float64(i) * (clip - fade)
+		end := start + clip
+		out := fmt.Sprintf("c%d", i)
+		filters = append(filters, fmt.Sprintf("[%s]%s[%s]", last, captionFilter(captionFile, spec.FontFile, spec.Height, start, end), out))
+		last = out
+	}
+
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", "["+last+"]",
+	)
+	if spec.MusicPath != "" {
+		fadeStart := spec.Duration - 1
+		if fadeStart < 0 {
+			fadeStart = 0
+		}
+		args = append(args,
+			"-map", fmt.Sprintf("%d:a", n),
+			"-af", fmt.Sprintf("afade=t=out:st=%s:d=1", formatSeconds(fadeStart)),
+			"-c:a", "aac",
+			"-b:a", "128k",
+		)
+	}
+	args = append(args,
+		"-t", formatSeconds(spec.Duration),
+		"-r", strconv.Itoa(slideshowFPS),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		outputPath,
+	)
+
+	output, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %w, output: %s", err, string(output))
+	}
+
+	return outputPath, nil
+}
+
+func (r *SlideshowRenderer) GetOutputPath(renderID string) string {
+	return filepath.Join(r.tempDir, fmt.Sprintf("%s_slideshow.mp4", renderID))
+}
+
+func (r *SlideshowRenderer) cleanup(files []string) {
+	for _, f := range files {
+		os.Remove(f)
+	}
+}
+
+// kenBurnsFilter fits an image onto the output canvas and applies a slow zoom
+// or pan. The motion cycles per image so consecutive slides don't look alike.
+func kenBurnsFilter(index int, clip float64, width, height int) string {
+	frames := int(clip*slideshowFPS) + 1
+	step := (kenBurnsMaxZoom - 1) / float64(frames)
+
+	var zoom, x, y string
+	centerX := "iw/2-(iw/zoom/2)"
+	centerY := "ih/2-(ih/zoom/2)"
+	switch index % 4 {
+	case 0:
+		zoom = fmt.Sprintf("min(zoom+%.5f,%.2f)", step, kenBurnsMaxZoom)
+		x, y = centerX, centerY
+	case 1:
+		zoom = fmt.Sprintf("if(eq(on,0),%.2f,max(zoom-%.5f,1))", kenBurnsMaxZoom, step)
+		x, y = centerX, centerY
+	case 2:
+		zoom = fmt.Sprintf("%.2f", kenBurnsMaxZoom)
+		x = fmt.Sprintf("(iw-iw/zoom)*on/%d", frames)
+		y = centerY
+	default:
+		zoom = fmt.Sprintf("%.2f", kenBurnsMaxZoom)
+		x = fmt.Sprintf("(iw-iw/zoom)*(1-on/%d)", frames)
+		y = centerY
+	}
+
+	// Upscale before zoompan to avoid the jitter it shows on small inputs.
+	return fmt.Sprintf(
+		"scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=white,"+
+			"scale=%d:%d,zoompan=z='%s':x='%s':y='%s':d=%d:s=%dx%d:fps=%d,setsar=1,format=yuv420p",
+		width, height, width, height,
+		width*2, height*2,
+		zoom, x, y, frames, width, height, slideshowFPS,
+	)
+}
+
+func captionFilter(textFile, fontFile string, height int, start, end float64) string {
+	opts := []string{
+		"textfile='" + escapeFilterPath(textFile) + "'",
+		"fontcolor=white",
+		fmt.Sprintf("fontsize=%d", height/24),
+		"box=1",
+		"boxcolor=black@0.45",
+		fmt.Sprintf("boxborderw=%d", height/80),
+		"x=(w-text_w)/2",
+		"y=h-text_h-h/8",
+		fmt.Sprintf("enable='between(t,%s,%s)'", formatSeconds(start), formatSeconds(end)),
+	}
+	if fontFile != "" {
+		opts = append([]string{"fontfile='" + escapeFilterPath(fontFile) + "'"}, opts...)
+	}
+	return "drawtext=" + strings.Join(opts, ":")
+}
+
+func escapeFilterPath(path string) string {
+	return strings.ReplaceAll(path, `'`, `'\''`)
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// ExtractFrame writes a single JPEG frame of the video at the given offset.
+// A negative offset is measured from the end of the video.
+func ExtractFrame(videoPath string, offset float64, outputPath string) (string, error) {
+	args := []string{"-y"}
+	if offset < 0 {
+		args = append(args, "-sseof", formatSeconds(offset))
+	} else {
+		args = append(args, "-ss", formatSeconds(offset))
+	}
+	args = append(args, "-i", videoPath, "-frames:v", "1", "-q:v", "2", outputPath)
+
+	output, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %w, output: %s", err, string(output))
+	}
+
+	return outputPath, nil
+}
@@ -25,6 +25,7 @@ type VideoGenerationRequest struct {
 	WithAudio bool   `json:"with_audio,omitempty"` // Generate AI sound effects
 	Size      string `json:"size,omitempty"`       // Resolution: 720x480, 1080x1920, etc.
 	FPS       int    `json:"fps,omitempty"`        // 30 or 60
+	Duration  int    `json:"duration,omitempty"`   // 5 or 10 seconds
 	RequestID string `json:"request_id,omitempty"`
 	UserID    string `json:"user_id,omitempty"`
 }
@@ -0,0 +1,56 @@
+-- Render history: every generation run of a project produces a render
+CREATE TYPE render_mode AS ENUM ('ai', 'slideshow');
+
+CREATE TABLE renders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+
+    mode render_mode NOT NULL DEFAULT 'ai',
+    status project_status DEFAULT 'queued',
+    format video_format DEFAULT '9:16',
+    duration_seconds INTEGER,
+    credits_charged INTEGER DEFAULT 0,
+    options JSONB DEFAULT '{}',
+
+    video_url TEXT,
+    thumbnail_url TEXT,
+    error_message TEXT,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_renders_project_id ON renders(project_id, created_at DESC);
+CREATE INDEX idx_renders_user_id ON renders(user_id);
+
+CREATE TRIGGER update_renders_updated_at
+    BEFORE UPDATE ON renders
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Render segments: one row per provider call (or locally rendered clip)
+CREATE TABLE render_segments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    render_id UUID NOT NULL REFERENCES renders(id) ON DELETE CASCADE,
+
+    position INTEGER NOT NULL,
+    prompt TEXT,
+    external_task_id VARCHAR(100),
+    video_url TEXT,
+    duration_seconds DECIMAL(10, 2),
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE (render_id, position)
+);
+
+CREATE INDEX idx_render_segments_render_id ON render_segments(render_id);
+
+ALTER TABLE renders ENABLE ROW LEVEL SECURITY;
+ALTER TABLE render_segments ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users can view own renders"
+    ON renders FOR SELECT
+    USING (auth.uid()::text = user_id::text);
@@ -0,0 +1,5 @@
+-- Timeline edits: re-cut a render's segments without calling the provider again
+ALTER TYPE render_mode ADD VALUE IF NOT EXISTS 'edit';
+
+ALTER TABLE renders ADD COLUMN IF NOT EXISTS parent_render_id UUID REFERENCES renders(id) ON DELETE SET NULL;
+ALTER TABLE renders ADD COLUMN IF NOT EXISTS timeline JSONB;
@@ -0,0 +1,2 @@
+-- Extensions continue a completed render from its final frame
+ALTER TYPE render_mode ADD VALUE IF NOT EXISTS 'extend';
@@ -0,0 +1,31 @@
+-- Storyboard scenes: a project's script parsed into editable beats
+CREATE TYPE scene_role AS ENUM ('hook', 'problem', 'demo', 'cta');
+
+CREATE TABLE storyboard_scenes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+
+    position INTEGER NOT NULL,
+    role scene_role NOT NULL DEFAULT 'demo',
+    script TEXT NOT NULL,
+    visual_prompt TEXT,
+
+    speech_seconds DECIMAL(6, 2),
+    duration_seconds INTEGER NOT NULL DEFAULT 5 CHECK (duration_seconds IN (5, 10)),
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE (project_id, position)
+);
+
+CREATE INDEX idx_storyboard_scenes_project_id ON storyboard_scenes(project_id);
+
+CREATE TRIGGER update_storyboard_scenes_updated_at
+    BEFORE UPDATE ON storyboard_scenes
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE render_segments ADD COLUMN IF NOT EXISTS scene_id UUID REFERENCES storyboard_scenes(id) ON DELETE SET NULL;
+
+ALTER TABLE storyboard_scenes ENABLE ROW LEVEL SECURITY;
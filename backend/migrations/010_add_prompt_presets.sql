@@ -0,0 +1,92 @@
+-- Style presets and prompt templates for the visual prompt compiler
+CREATE TABLE style_presets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+
+    camera TEXT NOT NULL,
+    lighting TEXT NOT NULL,
+    setting TEXT NOT NULL,
+    mood TEXT NOT NULL,
+
+    is_default BOOLEAN DEFAULT false,
+    is_active BOOLEAN DEFAULT true,
+    sort_order INTEGER DEFAULT 0,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_style_presets_default ON style_presets(is_default) WHERE is_default = true;
+
+CREATE TRIGGER update_style_presets_updated_at
+    BEFORE UPDATE ON style_presets
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Templates are Go text/template bodies. A NULL role is the fallback used
+-- for scenes whose role has no template of its own.
+CREATE TABLE prompt_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    role scene_role,
+    body TEXT NOT NULL,
+
+    is_active BOOLEAN DEFAULT true,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_prompt_templates_role ON prompt_templates(role) WHERE is_active = true;
+
+CREATE TRIGGER update_prompt_templates_updated_at
+    BEFORE UPDATE ON prompt_templates
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS style_preset VARCHAR(50);
+
+ALTER TABLE render_segments ADD COLUMN IF NOT EXISTS style_preset VARCHAR(50);
+ALTER TABLE render_segments ADD COLUMN IF NOT EXISTS prompt_template_id UUID REFERENCES prompt_templates(id) ON DELETE SET NULL;
+
+ALTER TABLE style_presets ENABLE ROW LEVEL SECURITY;
+ALTER TABLE prompt_templates ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Style presets are viewable by everyone" ON style_presets
+    FOR SELECT USING (is_active = true);
+
+INSERT INTO style_presets (slug, name, description, camera, lighting, setting, mood, is_default, sort_order) VALUES
+('ugc_selfie', 'UGC Selfie', 'Handheld phone footage filmed by a real customer',
+ 'handheld smartphone selfie angle at arm''s length, slight natural shake, vertical framing',
+ 'soft natural window light',
+ 'a lived-in bedroom or kitchen at home',
+ 'authentic, casual and enthusiastic, like a friend''s recommendation', true, 1),
+('studio_unboxing', 'Studio Unboxing', 'Clean tabletop unboxing on a seamless background',
+ 'locked-off top-down and 45-degree tabletop shots, slow push-ins on details',
+ 'bright even softbox lighting with gentle shadows',
+ 'a clean seamless studio backdrop on a minimal tabletop',
+ 'crisp, satisfying and premium', false, 2),
+('lifestyle_broll', 'Lifestyle B-roll', 'The product used naturally in everyday life',
+ 'smooth gimbal tracking shots and shallow depth of field cutaways',
+ 'warm golden-hour daylight',
+ 'a stylish real-world location that fits the product, such as a cafe, park or modern apartment',
+ 'aspirational, relaxed and warm', false, 3),
+('cinematic', 'Cinematic', 'Film-look hero shots with dramatic movement',
+ 'slow dolly and crane moves, anamorphic widescreen composition, macro product close-ups',
+ 'dramatic low-key lighting with rim light and haze',
+ 'a moody, art-directed set',
+ 'bold, epic and polished like a commercial', false, 4);
+
+INSERT INTO prompt_templates (name, role, body) VALUES
+('Hook', 'hook',
+ 'Opening shot: {{if .Direction}}{{.Direction}}{{else}}{{.Subject}} instantly grabs attention by revealing {{.Product.Name}} toward the camera with a surprised, excited expression{{end}}. Camera: {{.Preset.Camera}}. Setting: {{.Preset.Setting}}. Lighting: {{.Preset.Lighting}}. Mood: {{.Preset.Mood}}.'),
+('Problem', 'problem',
+ '{{if .Direction}}{{.Direction}}{{else}}{{.Subject}} shows visible frustration with an everyday annoyance that {{.Product.Name}} solves{{end}}. Camera: {{.Preset.Camera}}. Setting: {{.Preset.Setting}}. Lighting: {{.Preset.Lighting}}. Mood: slightly tense, then hopeful.'),
+('Demo', 'demo',
+ '{{if .Direction}}{{.Direction}}{{else}}{{.Subject}} uses {{.Product.Name}}, showing how it works with close-ups of its key details{{if .Product.Description}} ({{.Product.Description}}){{end}}{{end}}. Camera: {{.Preset.Camera}}. Setting: {{.Preset.Setting}}. Lighting: {{.Preset.Lighting}}. Mood: {{.Preset.Mood}}.'),
+('Call to action', 'cta',
+ 'Closing hero shot: {{if .Direction}}{{.Direction}}{{else}}{{.Subject}} holds {{.Product.Name}} up to the camera, smiles and nods approvingly, product clearly centered and in focus{{end}}. Camera: {{.Preset.Camera}}. Setting: {{.Preset.Setting}}. Lighting: {{.Preset.Lighting}}. Mood: {{.Preset.Mood}}.'),
+('Default', NULL,
+ '{{if .Direction}}{{.Direction}}{{else}}{{.Subject}} with {{.Product.Name}}{{end}}. Camera: {{.Preset.Camera}}. Setting: {{.Preset.Setting}}. Lighting: {{.Preset.Lighting}}. Mood: {{.Preset.Mood}}.');
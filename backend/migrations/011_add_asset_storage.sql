@@ -0,0 +1,8 @@
+-- Track where each asset lives in our storage and what it contained
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS render_id UUID REFERENCES renders(id) ON DELETE SET NULL;
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS storage_key TEXT;
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS checksum_sha256 VARCHAR(64);
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS source_url TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_assets_render_id ON assets(render_id);
+CREATE INDEX IF NOT EXISTS idx_assets_storage_key ON assets(storage_key);
@@ -0,0 +1,37 @@
+-- Projects reference their product image through the assets table.
+-- product_image_url stays as a copy of the asset URL for the render pipeline.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS product_image_asset_id UUID REFERENCES assets(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_projects_product_image_asset_id ON projects(product_image_asset_id);
+CREATE INDEX IF NOT EXISTS idx_assets_user_purpose ON assets(user_id, purpose, created_at DESC);
+
+-- At most one primary asset per project and purpose
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assets_primary
+    ON assets(project_id, purpose)
+    WHERE is_primary AND project_id IS NOT NULL;
+
+CREATE POLICY "Users can update own assets"
+    ON assets FOR UPDATE
+    USING (auth.uid()::text = user_id::text);
+
+-- Turn existing product image URLs into assets
+INSERT INTO assets (project_id, user_id, type, purpose, filename, url, storage_key, is_primary)
+SELECT p.id, p.user_id, 'image', 'product_image',
+       LEFT(regexp_replace(split_part(p.product_image_url, '?', 1), '^.*/', ''), 255),
+       p.product_image_url,
+       substring(split_part(p.product_image_url, '?', 1) FROM '/(uploads/[^/]+/[^/]+)$'),
+       true
+FROM projects p
+WHERE p.product_image_url IS NOT NULL AND p.product_image_url <> ''
+  AND NOT EXISTS (
+      SELECT 1 FROM assets a
+      WHERE a.project_id = p.id AND a.purpose = 'product_image' AND a.is_primary
+  );
+
+UPDATE projects p
+SET product_image_asset_id = a.id
+FROM assets a
+WHERE a.project_id = p.id
+  AND a.purpose = 'product_image'
+  AND a.is_primary
+  AND p.product_image_asset_id IS NULL;
@@ -0,0 +1,31 @@
+-- Derived copies of an image asset shaped for each video format, so the
+-- provider receives an image with the aspect ratio it renders
+CREATE TABLE asset_variants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+
+    format video_format NOT NULL,
+    fit VARCHAR(10) NOT NULL CHECK (fit IN ('pad', 'crop')),
+
+    url TEXT NOT NULL,
+    storage_key TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    file_size_bytes BIGINT,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE (asset_id, format)
+);
+
+CREATE INDEX idx_asset_variants_asset_id ON asset_variants(asset_id);
+
+ALTER TABLE asset_variants ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users can view own asset variants"
+    ON asset_variants FOR SELECT
+    USING (EXISTS (
+        SELECT 1 FROM assets
+        WHERE assets.id = asset_variants.asset_id
+          AND auth.uid()::text = assets.user_id::text
+    ));
@@ -0,0 +1,47 @@
+-- Resumable uploads (tus protocol). Each PATCH is stored as its own chunk
+-- object; the chunks are joined into an asset once the upload completes
+CREATE TABLE upload_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    project_id UUID REFERENCES projects(id) ON DELETE SET NULL,
+
+    purpose asset_purpose NOT NULL,
+    filename TEXT NOT NULL,
+    upload_length BIGINT NOT NULL CHECK (upload_length > 0),
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+
+    -- uploading → processing → completed | failed
+    status VARCHAR(20) NOT NULL DEFAULT 'uploading'
+        CHECK (status IN ('uploading', 'processing', 'completed', 'failed')),
+    asset_id UUID REFERENCES assets(id) ON DELETE SET NULL,
+    error TEXT,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE upload_chunks (
+    session_id UUID NOT NULL REFERENCES upload_sessions(id) ON DELETE CASCADE,
+    chunk_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (session_id, chunk_offset)
+);
+
+CREATE INDEX idx_upload_sessions_user_id ON upload_sessions(user_id);
+CREATE INDEX idx_upload_sessions_expires_at ON upload_sessions(expires_at) WHERE status IN ('uploading', 'failed');
+
+CREATE TRIGGER update_upload_sessions_updated_at
+    BEFORE UPDATE ON upload_sessions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE upload_sessions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE upload_chunks ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users can view own upload sessions"
+    ON upload_sessions FOR SELECT
+    USING (auth.uid()::text = user_id::text);
@@ -0,0 +1,6 @@
+-- Retention: completed projects get expires_at from the owner's tier, and
+-- the storage sweeper removes their media once it passes
+ALTER TYPE project_status ADD VALUE IF NOT EXISTS 'expired';
+
+CREATE INDEX IF NOT EXISTS idx_projects_expires_at ON projects(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_assets_unattached ON assets(user_id, created_at) WHERE project_id IS NULL;
@@ -0,0 +1,63 @@
+-- Content-addressed uploads: each user's files are stored once under the
+-- SHA-256 of the uploaded bytes, and every asset using a file holds a
+-- reference to it. The file is deleted when the last reference goes.
+CREATE TABLE asset_blobs (
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    sha256 VARCHAR(64) NOT NULL,
+
+    storage_key TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, sha256)
+);
+
+CREATE INDEX idx_asset_blobs_unreferenced ON asset_blobs(updated_at) WHERE ref_count = 0;
+
+-- Assets uploaded before this migration keep their own files and have no blob
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS blob_sha256 VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_assets_blob ON assets(user_id, blob_sha256) WHERE blob_sha256 IS NOT NULL;
+
+-- Reference counts follow the assets rows, including rows removed by
+-- cascades when a project or render is deleted
+CREATE OR REPLACE FUNCTION count_asset_blob_refs()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.blob_sha256 IS NOT NULL THEN
+            INSERT INTO asset_blobs (user_id, sha256, storage_key, size_bytes, ref_count)
+            VALUES (NEW.user_id, NEW.blob_sha256, NEW.storage_key, COALESCE(NEW.file_size_bytes, 0), 1)
+            ON CONFLICT (user_id, sha256) DO UPDATE
+                SET ref_count = asset_blobs.ref_count + 1, updated_at = NOW();
+        END IF;
+        RETURN NEW;
+    END IF;
+
+    IF OLD.blob_sha256 IS NOT NULL THEN
+        UPDATE asset_blobs
+        SET ref_count = GREATEST(ref_count - 1, 0), updated_at = NOW()
+        WHERE user_id = OLD.user_id AND sha256 = OLD.blob_sha256;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER count_asset_blob_refs
+    AFTER INSERT OR DELETE ON assets
+    FOR EACH ROW
+    EXECUTE FUNCTION count_asset_blob_refs();
+
+CREATE TRIGGER update_asset_blobs_updated_at
+    BEFORE UPDATE ON asset_blobs
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE asset_blobs ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users can view own asset blobs"
+    ON asset_blobs FOR SELECT
+    USING (auth.uid()::text = user_id::text);
@@ -0,0 +1,5 @@
+-- Email login verifies a bcrypt hash. Accounts created before passwords were
+-- stored have none: they cannot log in with a password until they set one
+-- through the password reset email (POST /api/auth/password/forgot)
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS password_hash TEXT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ;
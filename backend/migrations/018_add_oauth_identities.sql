@@ -0,0 +1,21 @@
+-- Accounts at external identity providers (Google) linked to profiles.
+-- A provider's subject identifies the account even if its email changes
+CREATE TABLE oauth_identities (
+    provider VARCHAR(20) NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+
+    email VARCHAR(255),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX idx_oauth_identities_user_id ON oauth_identities(user_id);
+
+ALTER TABLE oauth_identities ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users can view own identities"
+    ON oauth_identities FOR SELECT
+    USING (auth.uid()::text = user_id::text);
@@ -0,0 +1,26 @@
+-- Single-use links for email verification and password reset. Only a
+-- SHA-256 hash of each token is stored; the token itself is only in the email
+CREATE TABLE account_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    token_hash TEXT NOT NULL UNIQUE,
+
+    -- The address the link was sent to; it must still be the profile's
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_account_tokens_user_id ON account_tokens(user_id, purpose);
+CREATE INDEX idx_account_tokens_email ON account_tokens(lower(email), purpose, created_at);
+
+-- No policies: tokens are only read by the API
+ALTER TABLE account_tokens ENABLE ROW LEVEL SECURITY;
+
+-- Free credits are granted when the email is verified. Existing accounts
+-- already received theirs and count as verified
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+UPDATE profiles SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+ALTER TABLE profiles ALTER COLUMN credits_remaining SET DEFAULT 0;
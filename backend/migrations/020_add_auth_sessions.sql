@@ -0,0 +1,36 @@
+-- A session is one sign-in on one device. Access tokens carry its id, so
+-- revoking the session signs the device out at once
+CREATE TABLE auth_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ DEFAULT NOW(),
+    -- Expiry of the newest refresh token
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    -- logout, logout_all, token_reuse, password_change or password_reset
+    revoked_reason VARCHAR(20)
+);
+
+CREATE INDEX idx_auth_sessions_user_id ON auth_sessions(user_id) WHERE revoked_at IS NULL;
+
+-- Refresh tokens rotate on every use. Only a SHA-256 hash is stored; a
+-- used token presented again means it leaked, and revokes its session
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+
+ALTER TABLE auth_sessions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE refresh_tokens ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users can view own sessions"
+    ON auth_sessions FOR SELECT
+    USING (auth.uid()::text = user_id::text);
@@ -0,0 +1,10 @@
+-- API keys are looked up by the SHA-256 of the presented key. Keys are
+-- long random strings, so a fast hash is enough
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys(key_hash);
+
+-- rate_limit is the number of requests allowed per RATE_LIMIT_WINDOW
+COMMENT ON COLUMN api_keys.rate_limit IS 'requests per RATE_LIMIT_WINDOW';
+
+CREATE POLICY "Users can update own api keys"
+    ON api_keys FOR UPDATE
+    USING (auth.uid()::text = user_id::text);
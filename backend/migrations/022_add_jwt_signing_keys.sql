@@ -0,0 +1,22 @@
+-- Keys that sign access and refresh tokens with RS256 or EdDSA. Each key is
+-- published in /.well-known/jwks.json before it signs, signs until
+-- retires_at, and stays published until tokens it signed have expired
+CREATE TABLE jwt_signing_keys (
+    kid VARCHAR(32) PRIMARY KEY,
+    algorithm VARCHAR(10) NOT NULL CHECK (algorithm IN ('RS256', 'EdDSA')),
+
+    -- PKCS#8, encrypted with AES-GCM under JWT_KEY_SECRET
+    private_key BYTEA NOT NULL,
+    -- PKIX
+    public_key BYTEA NOT NULL,
+
+    activates_at TIMESTAMPTZ NOT NULL,
+    retires_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_jwt_signing_keys_expires_at ON jwt_signing_keys(expires_at);
+
+-- No policies: keys are only read by the API
+ALTER TABLE jwt_signing_keys ENABLE ROW LEVEL SECURITY;
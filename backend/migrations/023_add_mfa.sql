@@ -0,0 +1,41 @@
+-- TOTP authenticator of a user. It protects sign-in once confirmed with a
+-- first code; until then it is a pending enrollment
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES profiles(id) ON DELETE CASCADE,
+    -- Base32 secret, encrypted with AES-GCM under MFA_KEY_SECRET
+    secret BYTEA NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    -- Time step of the last accepted code, so each code works once
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- One-time codes for signing in without the authenticator. Only SHA-256
+-- hashes are stored
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
+
+-- Issued after the password (or Google) step of a sign-in, and exchanged
+-- with a code for tokens
+CREATE TABLE mfa_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
+
+-- No policies: MFA secrets and challenges are only read by the API
+ALTER TABLE user_totp ENABLE ROW LEVEL SECURITY;
+ALTER TABLE mfa_recovery_codes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE mfa_challenges ENABLE ROW LEVEL SECURITY;
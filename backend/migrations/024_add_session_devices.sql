@@ -0,0 +1,6 @@
+-- Where each session signed in from, so users can recognise their devices.
+-- Both are updated when the session refreshes its tokens
+ALTER TABLE auth_sessions ADD COLUMN ip_address INET;
+ALTER TABLE auth_sessions ADD COLUMN user_agent TEXT;
+
+CREATE INDEX idx_usage_logs_user_login ON usage_logs(user_id, created_at DESC) WHERE event = 'user_login';
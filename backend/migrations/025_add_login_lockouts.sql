@@ -0,0 +1,3 @@
+-- Temporary sign-in lockouts after repeated failures are kept in the audit
+-- log alongside sign-ins
+ALTER TYPE log_event ADD VALUE IF NOT EXISTS 'login_locked';
@@ -0,0 +1,37 @@
+-- Staff roles: support can look up accounts, adjust credits and recover
+-- stuck projects; admin can also change tiers and roles and disable
+-- accounts. Grant the first admin with:
+--   UPDATE profiles SET role = 'admin' WHERE email = '...';
+ALTER TABLE profiles ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'support', 'admin'));
+
+-- Disabled accounts cannot sign in and their API keys stop working
+ALTER TABLE profiles ADD COLUMN disabled_at TIMESTAMPTZ;
+
+CREATE INDEX idx_profiles_role ON profiles(role) WHERE role <> 'user';
+
+-- Credit changes made by staff show in the user's usage log
+ALTER TYPE log_event ADD VALUE IF NOT EXISTS 'credit_adjusted';
+
+-- Every change made through the admin API, with who made it and why
+CREATE TABLE admin_audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_id UUID REFERENCES profiles(id) ON DELETE SET NULL,
+    action VARCHAR(50) NOT NULL,
+    target_user_id UUID REFERENCES profiles(id) ON DELETE SET NULL,
+    target_project_id UUID REFERENCES projects(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    -- Values before and after the change
+    metadata JSONB DEFAULT '{}',
+
+    ip_address INET,
+    user_agent TEXT,
+
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_audit_log_created_at ON admin_audit_log(created_at DESC);
+CREATE INDEX idx_admin_audit_log_target_user_id ON admin_audit_log(target_user_id, created_at DESC);
+CREATE INDEX idx_admin_audit_log_actor_id ON admin_audit_log(actor_id, created_at DESC);
+
+ALTER TABLE admin_audit_log ENABLE ROW LEVEL SECURITY;
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,6 +16,11 @@ type Claims struct {
 	Email    string `json:"email"`
 	Role     string `json:"role"`
 	Tier     string `json:"tier"`
+	// Type separates access from refresh tokens; each is only accepted
+	// where its type is expected.
+	Type TokenType `json:"typ"`
+	// SessionID is the sign-in the token belongs to; signing out revokes it.
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -25,33 +32,78 @@ const (
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token expired")
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrExpiredToken   = errors.New("token expired")
+	ErrWrongTokenType = errors.New("wrong token type")
+	ErrInvalidAPIKey  = errors.New("invalid, revoked or expired API key")
 )
 
+// JWTService signs and verifies tokens. With HS256 it uses the shared
+// secret; with RS256 or EdDSA it signs with rotating keys from the store,
+// and anyone can verify tokens with the published key set.
 type JWTService struct {
 	secret        []byte
 	accessExpiry  time.Duration
 	refreshExpiry time.Duration
+
+	method   jwt.SigningMethod
+	store    KeyStore // nil for HS256
+	rotation time.Duration
+	sealer   *Sealer
+
+	mu       sync.Mutex
+	keys     []*signingKey
+	loadedAt time.Time
 }
 
-func NewJWTService(cfg config.JWTConfig) *JWTService {
-	return &JWTService{
+// NewJWTService configures the algorithm in cfg. The store is only used,
+// and only required, for RS256 and EdDSA; call RotateKeys before signing.
+func NewJWTService(cfg config.JWTConfig, store KeyStore) (*JWTService, error) {
+	s := &JWTService{
 		secret:        []byte(cfg.Secret),
 		accessExpiry:  cfg.Expiry,
 		refreshExpiry: cfg.RefreshExpiry,
 	}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		s.method = jwt.SigningMethodHS256
+		return s, nil
+	case "RS256":
+		s.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		s.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q; use RS256, EdDSA or HS256", cfg.Algorithm)
+	}
+
+	if store == nil {
+		return nil, fmt.Errorf("%s needs a key store", cfg.Algorithm)
+	}
+	if cfg.KeyRotation < time.Hour {
+		return nil, errors.New("JWT_KEY_ROTATION must be at least 1h")
+	}
+	sealer, err := NewSealer(cfg.KeySecret, "jwt signing key")
+	if err != nil {
+		return nil, err
+	}
+	s.store, s.rotation, s.sealer = store, cfg.KeyRotation, sealer
+	return s, nil
 }
 
-func (s *JWTService) GenerateAccessToken(userID, email, tier string) (string, int64, error) {
+// GenerateAccessToken signs an access token carrying the profile's role,
+// which staff routes check.
+func (s *JWTService) GenerateAccessToken(userID, email, role, tier, sessionID string) (string, int64, error) {
 	now := time.Now()
 	expiresAt := now.Add(s.accessExpiry)
 
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   "authenticated",
-		Tier:   tier,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		Tier:      tier,
+		Type:      AccessToken,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        uuid.New().String(),
 			Subject:   userID,
@@ -61,8 +113,7 @@ func (s *JWTService) GenerateAccessToken(userID, email, tier string) (string, in
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.secret)
+	tokenString, err := s.sign(claims)
 	if err != nil {
 		return "", 0, err
 	}
@@ -70,27 +121,74 @@ func (s *JWTService) GenerateAccessToken(userID, email, tier string) (string, in
 	return tokenString, int64(expiresAt.Sub(now).Seconds()), nil
 }
 
-func (s *JWTService) GenerateRefreshToken(userID string) (string, error) {
+// GenerateRefreshToken signs a refresh token for the session and returns
+// its claims, whose ID and expiry the server stores.
+func (s *JWTService) GenerateRefreshToken(userID, sessionID string) (string, *Claims, error) {
 	now := time.Now()
 	expiresAt := now.Add(s.refreshExpiry)
 
-	claims := &jwt.RegisteredClaims{
-		ID:        uuid.New().String(),
-		Subject:   userID,
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	claims := &Claims{
+		UserID:    userID,
+		Type:      RefreshToken,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	tokenString, err := s.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tokenString, claims, nil
+}
+
+// sign signs with the secret for HS256, otherwise with the current key,
+// named in the kid header.
+func (s *JWTService) sign(claims *Claims) (string, error) {
+	if s.store == nil {
+		return jwt.NewWithClaims(s.method, claims).SignedString(s.secret)
+	}
+
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
 	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// ValidateAccessToken accepts only access tokens.
+func (s *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
+	return s.validate(tokenString, AccessToken)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secret)
+// ValidateRefreshToken accepts only refresh tokens. Whether the token is
+// still current is up to the server's session store.
+func (s *JWTService) ValidateRefreshToken(tokenString string) (*Claims, error) {
+	return s.validate(tokenString, RefreshToken)
 }
 
-func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+func (s *JWTService) validate(tokenString string, want TokenType) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if s.store == nil {
+			if token.Method != jwt.SigningMethodHS256 {
+				return nil, ErrInvalidToken
+			}
+			return s.secret, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key := s.verificationKey(kid)
+		if key == nil || token.Method != key.method {
 			return nil, ErrInvalidToken
 		}
-		return s.secret, nil
+		return key.public, nil
 	})
 
 	if err != nil {
@@ -104,15 +202,9 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	if !ok || !token.Valid {
 		return nil, ErrInvalidToken
 	}
-
-	return claims, nil
-}
-
-func (s *JWTService) RefreshAccessToken(refreshToken string) (string, int64, error) {
-	claims, err := s.ValidateToken(refreshToken)
-	if err != nil {
-		return "", 0, err
+	if claims.Type != want {
+		return nil, ErrWrongTokenType
 	}
 
-	return s.GenerateAccessToken(claims.UserID, claims.Email, claims.Tier)
+	return claims, nil
 }
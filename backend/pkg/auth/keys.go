@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/genvid/backend/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyStore keeps the asymmetric signing keys shared by every API instance.
+type KeyStore interface {
+	ListSigningKeys(ctx context.Context) ([]model.JWTSigningKey, error)
+	// CreateSigningKey stores key unless a key with its algorithm already
+	// signs at key.ActivatesAt.
+	CreateSigningKey(ctx context.Context, key *model.JWTSigningKey) (bool, error)
+	DeleteExpiredSigningKeys(ctx context.Context) error
+}
+
+var ErrNoSigningKey = errors.New("no signing key available")
+
+const (
+	// A new key is published this long before it signs, so verifiers that
+	// cache the key set already have it.
+	keyPublishAhead = 24 * time.Hour
+	// An unknown kid reloads the keys at most this often.
+	minKeyReload    = 30 * time.Second
+	keyStoreTimeout = 5 * time.Second
+	rsaKeyBits      = 2048
+)
+
+type signingKey struct {
+	id          string
+	method      jwt.SigningMethod
+	private     crypto.Signer
+	public      crypto.PublicKey
+	activatesAt time.Time
+	retiresAt   time.Time
+}
+
+// JWK is a public key as published in the key set.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// RotateKeys makes sure a key signs now and, close to its retirement, that
+// its successor is published, then drops expired keys. Instances run it on
+// start and periodically; the store lets only one of them add each key.
+// It does nothing for HS256.
+func (s *JWTService) RotateKeys(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadKeys(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	current := s.currentKey(now)
+	var err error
+	switch {
+	case current == nil:
+		err = s.createKey(ctx, now)
+	case current.retiresAt.Sub(now) <= s.publishAhead():
+		err = s.createKey(ctx, current.retiresAt)
+	}
+	if err != nil {
+		return fmt.Errorf("create signing key: %w", err)
+	}
+
+	if err := s.store.DeleteExpiredSigningKeys(ctx); err != nil {
+		return err
+	}
+	return s.loadKeys(ctx)
+}
+
+// JWKS returns the public keys that verify tokens, including keys about to
+// start signing. It is empty for HS256, whose secret cannot be shared.
+func (s *JWTService) JWKS() *JWKS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := &JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// signingKey returns the key that signs now.
+func (s *JWTService) signingKey() (*signingKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if key := s.currentKey(now); key != nil {
+		return key, nil
+	}
+	if time.Since(s.loadedAt) >= minKeyReload {
+		if err := s.reloadKeys(); err != nil {
+			return nil, err
+		}
+		if key := s.currentKey(now); key != nil {
+			return key, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// verificationKey returns the key with the id, reloading the keys when
+// another instance may have added it.
+func (s *JWTService) verificationKey(kid string) *signingKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key := s.findKey(kid); key != nil {
+		return key
+	}
+	if time.Since(s.loadedAt) < minKeyReload {
+		return nil
+	}
+	if err := s.reloadKeys(); err != nil {
+		log.Printf("Failed to reload signing keys: %v", err)
+		return nil
+	}
+	return s.findKey(kid)
+}
+
+func (s *JWTService) findKey(kid string) *signingKey {
+	for _, key := range s.keys {
+		if key.id == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// currentKey is the newest key of the configured algorithm that signs at
+// now, or nil.
+func (s *JWTService) currentKey(now time.Time) *signingKey {
+	var current *signingKey
+	for _, key := range s.keys {
+		if key.method != s.method || key.activatesAt.After(now) || !key.retiresAt.After(now) {
+			continue
+		}
+		if current == nil || key.activatesAt.After(current.activatesAt) {
+			current = key
+		}
+	}
+	return current
+}
+
+// publishAhead is keyPublishAhead, shortened for rotation periods under
+// two days.
+func (s *JWTService) publishAhead() time.Duration {
+	if s.rotation/2 < keyPublishAhead {
+		return s.rotation / 2
+	}
+	return keyPublishAhead
+}
+
+func (s *JWTService) reloadKeys() error {
+	ctx, cancel := context.WithTimeout(context.Background(), keyStoreTimeout)
+	defer cancel()
+	return s.loadKeys(ctx)
+}
+
+func (s *JWTService) loadKeys(ctx context.Context) error {
+	stored, err := s.store.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(stored))
+	for i := range stored {
+		key, err := s.decodeKey(&stored[i])
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", stored[i].KID, err)
+		}
+		keys = append(keys, key)
+	}
+	s.keys, s.loadedAt = keys, time.Now()
+	return nil
+}
+
+// createKey generates a key of the configured algorithm that signs from
+// activatesAt for one rotation period and verifies until the last token it
+// signed has expired.
+func (s *JWTService) createKey(ctx context.Context, activatesAt time.Time) error {
+	var private crypto.Signer
+	var err error
+	switch s.method {
+	case jwt.SigningMethodRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case jwt.SigningMethodEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported algorithm %s", s.method.Alg())
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	public, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	kid := base64.RawURLEncoding.EncodeToString(id)
+
+	sealed, err := s.sealer.Seal(der, kid)
+	if err != nil {
+		return err
+	}
+
+	lifetime := s.refreshExpiry
+	if s.accessExpiry > lifetime {
+		lifetime = s.accessExpiry
+	}
+	retiresAt := activatesAt.Add(s.rotation)
+
+	key := &model.JWTSigningKey{
+		KID:         kid,
+		Algorithm:   s.method.Alg(),
+		PrivateKey:  sealed,
+		PublicKey:   public,
+		ActivatesAt: activatesAt,
+		RetiresAt:   retiresAt,
+		ExpiresAt:   retiresAt.Add(lifetime),
+	}
+	created, err := s.store.CreateSigningKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Created %s signing key %s, signing from %s", key.Algorithm, kid, activatesAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (s *JWTService) decodeKey(stored *model.JWTSigningKey) (*signingKey, error) {
+	key := &signingKey{
+		id:          stored.KID,
+		activatesAt: stored.ActivatesAt,
+		retiresAt:   stored.RetiresAt,
+	}
+	switch stored.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key.method = jwt.SigningMethodRS256
+	case jwt.SigningMethodEdDSA.Alg():
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", stored.Algorithm)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(stored.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key.public = public
+
+	der, err := s.sealer.Open(stored.PrivateKey, stored.KID)
+	if err != nil {
+		return nil, errors.New("cannot decrypt private key; was JWT_KEY_SECRET changed?")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	key.private = signer
+	return key, nil
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genvid/backend/internal/config"
+	"github.com/genvid/backend/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memKeyStore is a KeyStore in memory.
+type memKeyStore struct {
+	mu   sync.Mutex
+	keys []model.JWTSigningKey
+}
+
+func (m *memKeyStore) ListSigningKeys(ctx context.Context) ([]model.JWTSigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.JWTSigningKey(nil), m.keys...), nil
+}
+
+func (m *memKeyStore) CreateSigningKey(ctx context.Context, key *model.JWTSigningKey) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.keys {
+		if k.Algorithm == key.Algorithm && !k.ActivatesAt.After(key.ActivatesAt) && k.RetiresAt.After(key.ActivatesAt) {
+			return false, nil
+		}
+	}
+	m.keys = append(m.keys, *key)
+	return true, nil
+}
+
+func (m *memKeyStore) DeleteExpiredSigningKeys(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.keys[:0]
+	for _, k := range m.keys {
+		if k.ExpiresAt.After(time.Now()) {
+			kept = append(kept, k)
+		}
+	}
+	m.keys = kept
+	return nil
+}
+
+// update applies fn to every stored key, standing in for time passing.
+func (m *memKeyStore) update(fn func(*model.JWTSigningKey)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keys {
+		fn(&m.keys[i])
+	}
+}
+
+func newTestKeyService(t *testing.T, algorithm string) (*JWTService, *memKeyStore) {
+	t.Helper()
+	store := &memKeyStore{}
+	s, err := NewJWTService(config.JWTConfig{
+		Secret:        "test-jwt-secret",
+		Expiry:        time.Hour,
+		RefreshExpiry: 24 * time.Hour,
+		Algorithm:     algorithm,
+		KeyRotation:   24 * time.Hour,
+		KeySecret:     "test-key-secret",
+	}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RotateKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s, store
+}
+
+func tokenKID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyRotation(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			s, store := newTestKeyService(t, algorithm)
+			ctx := context.Background()
+
+			old, _, err := s.GenerateAccessToken("user", "user@example.com", "user", "free", "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The old key retires and a new one takes over signing.
+			store.update(func(k *model.JWTSigningKey) { k.RetiresAt = time.Now() })
+			if err := s.RotateKeys(ctx); err != nil {
+				t.Fatal(err)
+			}
+			current, _, err := s.GenerateAccessToken("user", "user@example.com", "user", "free", "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldKID := tokenKID(t, old)
+			if kid := tokenKID(t, current); kid == oldKID {
+				t.Fatalf("token signed after rotation has the old kid %s", kid)
+			}
+
+			// Tokens the old key signed verify until it expires.
+			if _, err := s.ValidateAccessToken(old); err != nil {
+				t.Errorf("ValidateAccessToken() of a token from the retired key error = %v", err)
+			}
+
+			store.update(func(k *model.JWTSigningKey) {
+				if k.KID == oldKID {
+					k.ExpiresAt = time.Now().Add(-time.Second)
+				}
+			})
+			if err := s.RotateKeys(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.ValidateAccessToken(old); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ValidateAccessToken() after the key was removed error = %v, want ErrInvalidToken", err)
+			}
+			if _, err := s.ValidateAccessToken(current); err != nil {
+				t.Errorf("ValidateAccessToken() of a current token error = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsWrongType(t *testing.T) {
+	for _, algorithm := range []string{"HS256", "RS256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			var s *JWTService
+			if algorithm == "HS256" {
+				var err error
+				s, err = NewJWTService(config.JWTConfig{Secret: "test-jwt-secret", Expiry: time.Hour, RefreshExpiry: time.Hour, Algorithm: algorithm}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				s, _ = newTestKeyService(t, algorithm)
+			}
+
+			access, _, err := s.GenerateAccessToken("user", "user@example.com", "user", "free", "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+			refresh, _, err := s.GenerateRefreshToken("user", "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name     string
+				validate func(string) (*Claims, error)
+				token    string
+			}{
+				{"refresh as access", s.ValidateAccessToken, refresh},
+				{"access as refresh", s.ValidateRefreshToken, access},
+			}
+			for _, tt := range tests {
+				if _, err := tt.validate(tt.token); !errors.Is(err, ErrWrongTokenType) {
+					t.Errorf("%s: error = %v, want ErrWrongTokenType", tt.name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		kty       string
+	}{
+		{"RS256", "RSA"},
+		{"EdDSA", "OKP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			s, _ := newTestKeyService(t, tt.algorithm)
+			token, _, err := s.GenerateAccessToken("user", "user@example.com", "user", "free", "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			set := s.JWKS()
+			if len(set.Keys) != 1 {
+				t.Fatalf("JWKS() has %d keys, want 1", len(set.Keys))
+			}
+			key := set.Keys[0]
+			if key.Kty != tt.kty || key.Alg != tt.algorithm || key.Use != "sig" {
+				t.Errorf("JWKS() key kty=%s alg=%s use=%s, want %s %s sig", key.Kty, key.Alg, key.Use, tt.kty, tt.algorithm)
+			}
+			if kid := tokenKID(t, token); key.Kid != kid {
+				t.Errorf("JWKS() kid = %s, want the signing kid %s", key.Kid, kid)
+			}
+			if key.N == "" && key.X == "" {
+				t.Error("JWKS() key has no public key material")
+			}
+		})
+	}
+
+	s, err := NewJWTService(config.JWTConfig{Secret: "test-jwt-secret", Algorithm: "HS256"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS() for HS256 has %d keys, want none", len(keys))
+	}
+}
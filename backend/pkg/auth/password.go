@@ -2,12 +2,14 @@ package auth
 
 import (
 	"errors"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrPasswordTooShort = errors.New("password must be at least 8 characters")
+	ErrPasswordTooLong  = errors.New("password must be at most 72 bytes")
 	ErrPasswordMismatch = errors.New("password does not match")
 )
 
@@ -15,6 +17,9 @@ func HashPassword(password string) (string, error) {
 	if len(password) < 8 {
 		return "", ErrPasswordTooShort
 	}
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
 
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -31,3 +36,16 @@ func CheckPassword(password, hash string) error {
 	}
 	return nil
 }
+
+// dummyHash is a hash of no one's password, generated on first use.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("no account has this password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// RejectPassword takes as long as CheckPassword and always fails. Logins
+// for unknown emails call it so their timing matches a wrong password.
+func RejectPassword(password string) error {
+	_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+	return ErrPasswordMismatch
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealerRoundTrip(t *testing.T) {
+	s, err := NewSealer("mfa-secret", "totp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("JBSWY3DPEHPK3PXP")
+
+	sealed, err := s.Seal(plaintext, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("Seal() output contains the plaintext")
+	}
+	opened, err := s.Open(sealed, "user-1")
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Open() = %q, %v", opened, err)
+	}
+
+	again, _ := s.Seal(plaintext, "user-1")
+	if bytes.Equal(again, sealed) {
+		t.Error("Seal() reused a nonce")
+	}
+
+	// A second sealer from the same secret and purpose, as after a restart,
+	// opens the value.
+	restarted, _ := NewSealer("mfa-secret", "totp")
+	if opened, err := restarted.Open(sealed, "user-1"); err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open() after restart = %q, %v", opened, err)
+	}
+}
+
+func TestSealerRejects(t *testing.T) {
+	s, _ := NewSealer("mfa-secret", "totp")
+	sealed, err := s.Seal([]byte("JBSWY3DPEHPK3PXP"), "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPurpose, _ := NewSealer("mfa-secret", "jwt-key")
+	otherSecret, _ := NewSealer("another-secret", "totp")
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name   string
+		sealer *Sealer
+		sealed []byte
+		id     string
+	}{
+		{"other id", s, sealed, "user-2"},
+		{"other purpose", otherPurpose, sealed, "user-1"},
+		{"other secret", otherSecret, sealed, "user-1"},
+		{"tampered", s, tampered, "user-1"},
+		{"truncated", s, sealed[:len(sealed)-1], "user-1"},
+		{"shorter than a nonce", s, sealed[:4], "user-1"},
+		{"empty", s, nil, "user-1"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.sealer.Open(tt.sealed, tt.id); err == nil {
+			t.Errorf("%s: Open() succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 Appendix B lists 8-digit codes; 6-digit codes are their
+	// last six digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%q at %d) = %d, %v, want step %d", tt.code, tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	const code = "050471" // step 37037037
+
+	tests := []struct {
+		offset time.Duration
+		want   bool
+	}{
+		{0, true},
+		{-30 * time.Second, true},
+		{30 * time.Second, true},
+		{-60 * time.Second, false},
+		{60 * time.Second, false},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, code, at.Add(tt.offset))
+		if ok != tt.want {
+			t.Errorf("ValidateTOTP() at %v = %v, want %v", tt.offset, ok, tt.want)
+		}
+		if ok && step != 37037037 {
+			t.Errorf("ValidateTOTP() at %v matched step %d, want 37037037", tt.offset, step)
+		}
+	}
+}
+
+func TestValidateTOTPRejects(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	lower := strings.ToLower(strings.TrimRight(rfc6238Secret, "="))
+
+	if _, ok := ValidateTOTP(lower, "050471", at); !ok {
+		t.Error("ValidateTOTP() rejected a lower-case secret")
+	}
+	for _, code := range []string{"050472", "50471", "0504710", "05047a", " 50471", ""} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at); ok {
+			t.Errorf("ValidateTOTP(%q) = true", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "050471", at); ok {
+		t.Error("ValidateTOTP() accepted an invalid secret")
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	a, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewTOTPSecret()
+	if a == b {
+		t.Error("NewTOTPSecret() returned the same secret twice")
+	}
+	key, err := totpEncoding.DecodeString(a)
+	if err != nil || len(key) != totpSecretSize {
+		t.Errorf("NewTOTPSecret() = %q, decodes to %d bytes, %v", a, len(key), err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	got := TOTPURI("Genvid", "user@example.com", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Genvid:user@example.com?algorithm=SHA1&digits=6&issuer=Genvid&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("TOTPURI() =\n%s\nwant\n%s", got, want)
+	}
+}